@@ -0,0 +1,170 @@
+// Package blocktypes reads blocks.json, which describes each block id and
+// data value: its name, its colour and how it is drawn.
+package blocktypes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// AnyData is the Data of a block type that covers every data value of its
+// id.
+const AnyData = -1
+
+type BlockType struct {
+	Id          int
+	Data        int
+	Name        string
+	Color       uint32 // RGBA
+	Item        bool
+	Transparent bool
+	Empty       bool
+}
+
+// Palette is the block types from a blocks.json in file order.
+type Palette struct {
+	Types    []*BlockType
+	byId     map[int]*BlockType
+	byIdData map[int]*BlockType
+}
+
+type jsonBlockType struct {
+	BlockId     *int
+	Data        interface{}
+	Name        string
+	Color       string
+	Item        *bool
+	Transparent *bool
+	Empty       bool
+}
+
+func Load(filename string) (*Palette, error) {
+	var jsonBytes, err = ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(jsonBytes)
+}
+
+// Parse reads the contents of a blocks.json. Entries with a list of data
+// values become one block type per value, named with the value after an
+// underscore.
+func Parse(jsonBytes []byte) (*Palette, error) {
+	var entries []jsonBlockType
+	var err = json.Unmarshal(jsonBytes, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	var p = &Palette{byId: make(map[int]*BlockType), byIdData: make(map[int]*BlockType)}
+	for _, e := range entries {
+		if e.BlockId == nil {
+			return nil, errors.New(fmt.Sprintf("Block type %q has no blockId", e.Name))
+		}
+
+		var t = BlockType{Id: *e.BlockId, Data: AnyData, Name: e.Name}
+		t.Color, err = parseColor(e.Color)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Block type %q: %v", e.Name, err))
+		}
+		if e.Item != nil && *e.Item {
+			t.Item, t.Transparent = true, true
+		}
+		if e.Transparent != nil {
+			t.Transparent = *e.Transparent
+		}
+		if e.Empty {
+			t.Empty, t.Transparent, t.Item = true, true, false
+		}
+
+		switch d := e.Data.(type) {
+		case nil:
+			p.add(t)
+		case float64:
+			t.Data = int(d)
+			p.add(t)
+		case []interface{}:
+			for _, value := range d {
+				var n, ok = value.(float64)
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("Block type %q has a data value that isn't a number", e.Name))
+				}
+				var dt = t
+				dt.Data = int(n)
+				dt.Name = fmt.Sprintf("%s_%d", t.Name, dt.Data)
+				p.add(dt)
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("Block type %q has a data value that isn't a number", e.Name))
+		}
+	}
+	return p, nil
+}
+
+func (p *Palette) add(t BlockType) {
+	var bt = &t
+	p.Types = append(p.Types, bt)
+	if t.Data == AnyData {
+		p.byId[t.Id] = bt
+	} else {
+		p.byIdData[t.Id+t.Data<<8] = bt
+	}
+}
+
+// parseColor reads #rrggbb or #rrggbbaa.
+func parseColor(s string) (uint32, error) {
+	switch len(s) {
+	case 0:
+		return 0, nil
+	case 7, 9:
+		var n, err = strconv.ParseUint(s[1:], 16, 32)
+		if err != nil || s[0] != '#' {
+			break
+		}
+		if len(s) == 7 {
+			return uint32(n)<<8 | 0xff, nil
+		}
+		return uint32(n), nil
+	}
+	return 0, errors.New(fmt.Sprintf("Bad colour %q", s))
+}
+
+// Type returns the block type for the block's id and data value, falling
+// back to one for the id alone. It is nil if blocks.json doesn't describe
+// the block.
+func (p *Palette) Type(block nbt.Block) *BlockType {
+	if t, ok := p.byIdData[int(block)]; ok {
+		return t
+	}
+	return p.byId[int(block&0xff)]
+}
+
+// Name returns the name of the block, or its id and data value if it has
+// none.
+func (p *Palette) Name(block nbt.Block) string {
+	if p != nil {
+		if t := p.Type(block); t != nil {
+			return t.Name
+		}
+	}
+	return fmt.Sprintf("%d:%d", block&0xff, block>>8)
+}
+
+// Find returns the block types with a name, ignoring case. A name like
+// Wool matches Wool_0 to Wool_15 as well.
+func (p *Palette) Find(name string) []*BlockType {
+	var found = make([]*BlockType, 0)
+	for _, t := range p.Types {
+		if strings.EqualFold(t.Name, name) {
+			found = append(found, t)
+		} else if i := strings.LastIndex(t.Name, "_"); i >= 0 && t.Data != AnyData && strings.EqualFold(t.Name[:i], name) {
+			found = append(found, t)
+		}
+	}
+	return found
+}
@@ -0,0 +1,83 @@
+package blocktypes
+
+import (
+	"github.com/quag/mcobj/nbt"
+	"testing"
+)
+
+func TestLoadBlocksJson(t *testing.T) {
+	p, err := Load("../blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		block nbt.Block
+		name  string
+	}{
+		{1, "Stone"},
+		{5 + 2<<8, "WoodenPlank2"},
+		{6 + 5<<8, "Sapling.Spruce_5"},
+		{255 + 3<<8, "255:3"},
+	} {
+		if name := p.Name(c.block); name != c.name {
+			t.Errorf("Block %#x is named %q not %q", c.block, name, c.name)
+		}
+	}
+
+	if air := p.Type(0); air == nil || !air.Empty || air.Color != 0xfefeff01 {
+		t.Errorf("Air is %+v", air)
+	}
+	if stone := p.Type(1); stone.Color != 0x7d7d7dff || stone.Transparent || stone.Item {
+		t.Errorf("Stone is %+v", stone)
+	}
+	if found := p.Find("sapling.spruce"); len(found) != 4 || found[0].Data != 1 {
+		t.Errorf("Found %v spruce saplings", len(found))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, bad := range []string{
+		`[{"name": "NoId"}]`,
+		`[{"blockId": 1, "color": "#12"}]`,
+		`[{"blockId": 1, "data": "x"}]`,
+		`{}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parsed %v", bad)
+		}
+	}
+}
+
+func TestParseMatcher(t *testing.T) {
+	p, err := Load("../blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := ParseMatcher("52, 35:1, DiamondOre, minecraft:red_wool, minecraft:lava", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		block nbt.Block
+		match bool
+	}{
+		{52, true},
+		{35 + 1<<8, true},
+		{56, true},
+		{35 + 14<<8, true},
+		{35 + 13<<8, false},
+		{11, true},
+		{11 + 3<<8, false},
+		{1, false},
+	} {
+		if match(c.block) != c.match {
+			t.Errorf("Block %#x matched %v", c.block, !c.match)
+		}
+	}
+
+	if _, err := ParseMatcher("NoSuchBlock", nil); err == nil {
+		t.Error("Expected an error for an unknown block")
+	}
+}
@@ -0,0 +1,70 @@
+package blocktypes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"strconv"
+	"strings"
+)
+
+// Matcher reports whether a block is one of those it was made for.
+type Matcher func(block nbt.Block) bool
+
+// ParseMatcher makes a Matcher from a comma separated list of blocks. Each
+// can be an id, an id:data value, a name from the palette or a namespaced
+// block state such as minecraft:red_wool. Ids, and names of blocks that
+// cover every data value, match every data value of the block. States match
+// the id and data value they are read from newer worlds as. The palette may
+// be nil, in which case names aren't recognised.
+func ParseMatcher(list string, palette *Palette) (Matcher, error) {
+	var (
+		anyData = make(map[int]bool)
+		exact   = make(map[nbt.Block]bool)
+	)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		var idStr, dataStr, hasData = strings.Cut(field, ":")
+		if id, err := strconv.Atoi(idStr); err == nil {
+			if !hasData {
+				anyData[id] = true
+				continue
+			}
+			var data, err = strconv.Atoi(dataStr)
+			if err != nil {
+				return nil, err
+			}
+			exact[nbt.Block(id+data<<8)] = true
+			continue
+		}
+
+		var types []*BlockType
+		if palette != nil {
+			types = palette.Find(field)
+		}
+		for _, t := range types {
+			if t.Data == AnyData {
+				anyData[t.Id] = true
+			} else {
+				exact[nbt.Block(t.Id+t.Data<<8)] = true
+			}
+		}
+		if len(types) != 0 {
+			continue
+		}
+
+		var block, ok = nbt.BlockFromName(field)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown block %q", field))
+		}
+		exact[block] = true
+	}
+
+	return func(block nbt.Block) bool {
+		return anyData[int(block&0xff)] || exact[block]
+	}, nil
+}
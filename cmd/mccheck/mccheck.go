@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/mcworld"
+	"os"
+)
+
+func main() {
+	var asJson = flag.Bool("json", false, "Write the report as JSON")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mccheck [-json] <world directory or backup .zip/.tar.gz>")
+		os.Exit(2)
+	}
+
+	world, err := mcworld.OpenWorld(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(world)
+
+	report, err := mcworld.CheckWorld(world)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "CheckWorld:", err)
+		os.Exit(2)
+	}
+
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		for _, p := range report.Problems {
+			fmt.Println(p)
+		}
+		fmt.Printf("%v regions, %v chunks, %v damaged chunks, %v problems\n", report.Regions, report.Chunks, report.Damaged, len(report.Problems))
+	}
+
+	// Chunks in formats that can't be decoded aren't damaged
+	for _, p := range report.Problems {
+		if p.Kind != mcworld.ProblemUnsupported {
+			mcworld.CloseWorld(world)
+			os.Exit(1)
+		}
+	}
+}
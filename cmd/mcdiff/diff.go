@@ -0,0 +1,203 @@
+package main
+
+import (
+	"github.com/quag/mcobj/mcworld"
+	"github.com/quag/mcobj/nbt"
+)
+
+type change byte
+
+const (
+	unchanged change = iota
+	added
+	removed
+	changed
+)
+
+var changeNames = []string{"unchanged", "added", "removed", "changed"}
+
+func (c change) String() string {
+	return changeNames[c]
+}
+
+func changeOf(oldBlock, newBlock nbt.Block) change {
+	switch {
+	case oldBlock == newBlock:
+		return unchanged
+	case oldBlock == 0:
+		return added
+	case newBlock == 0:
+		return removed
+	}
+	return changed
+}
+
+// chunkDiff is how one chunk differs between the worlds. Either chunk is
+// nil when the other world doesn't have it, which is the same as it being
+// all air.
+type chunkDiff struct {
+	x, z       int
+	minY       int // y of the bottom of changes
+	height     int
+	oldChunk   *nbt.Chunk
+	newChunk   *nbt.Chunk
+	changes    []change // XZY like nbt.Chunk.Blocks
+	counts     [4]int
+	oldMissing bool
+	newMissing bool
+}
+
+func diffChunk(x, z int, oldChunk, newChunk *nbt.Chunk) *chunkDiff {
+	var d = &chunkDiff{x: x, z: z, oldChunk: oldChunk, newChunk: newChunk, oldMissing: oldChunk == nil, newMissing: newChunk == nil}
+	switch {
+	case newChunk == nil:
+		d.minY, d.height = oldChunk.MinY, oldChunk.Height()
+	case oldChunk == nil:
+		d.minY, d.height = newChunk.MinY, newChunk.Height()
+	default:
+		d.minY = min(oldChunk.MinY, newChunk.MinY)
+		d.height = max(oldChunk.MinY+oldChunk.Height(), newChunk.MinY+newChunk.Height()) - d.minY
+	}
+
+	d.changes = make([]change, 16*16*d.height)
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			for y := 0; y < d.height; y++ {
+				var c = changeOf(blockAt(oldChunk, x, d.minY+y, z), blockAt(newChunk, x, d.minY+y, z))
+				d.changes[y+d.height*(z+16*x)] = c
+				d.counts[c]++
+			}
+		}
+	}
+	return d
+}
+
+// blockAt treats blocks above or below a chunk, and missing chunks, as air,
+// so chunks of different heights can be compared. y is from the bottom of
+// the world rather than of the chunk.
+func blockAt(chunk *nbt.Chunk, x, y, z int) nbt.Block {
+	if chunk == nil || y < chunk.MinY || y >= chunk.MinY+chunk.Height() {
+		return 0
+	}
+	return chunk.Block(x, y-chunk.MinY, z)
+}
+
+func (d *chunkDiff) changed() bool {
+	return d.counts[added]+d.counts[removed]+d.counts[changed] != 0
+}
+
+func (d *chunkDiff) change(x, y, z int) change {
+	return d.changes[y+d.height*(z+16*x)]
+}
+
+func (d *chunkDiff) blocks(x, y, z int) (oldBlock, newBlock nbt.Block) {
+	return blockAt(d.oldChunk, x, d.minY+y, z), blockAt(d.newChunk, x, d.minY+y, z)
+}
+
+// coordsMask masks the chunks outside the area as well as those that
+// aren't in coords, or with outside, those that are.
+type coordsMask struct {
+	mask    mcworld.ChunkMask
+	coords  map[mcworld.ChunkCoord]bool
+	outside bool
+}
+
+func (m *coordsMask) IsMasked(x, z int) bool {
+	return m.mask.IsMasked(x, z) || m.coords[mcworld.ChunkCoord{X: x, Z: z}] == m.outside
+}
+
+// diffWorlds calls fn with each chunk inside the mask that differs between
+// the worlds. Chunks in the new world are compared first, then those only
+// in the old world. The old world's chunks that are in the new world are
+// decoded by a walk of their own in the same order, so both worlds are read
+// in parallel.
+func diffWorlds(oldWorld, newWorld mcworld.World, mask mcworld.ChunkMask, fn func(d *chunkDiff) error) error {
+	var oldPool, err = oldWorld.ChunkPool(mask)
+	if err != nil {
+		return err
+	}
+	newPool, err := newWorld.ChunkPool(mask)
+	if err != nil {
+		return err
+	}
+	var order = &mcworld.RowMajorChunkOrder{}
+	var inNew = make(map[mcworld.ChunkCoord]bool)
+	var it = newPool.Iterator(order)
+	for x, z, ok := it.Next(); ok; x, z, ok = it.Next() {
+		inNew[mcworld.ChunkCoord{X: x, Z: z}] = true
+	}
+
+	var (
+		oldChunks = make(chan *nbt.Chunk)
+		oldErr    = make(chan error, 1)
+		cancel    = make(chan struct{})
+	)
+	go func() {
+		oldErr <- mcworld.Walk(oldWorld, &coordsMask{mask, inNew, false}, &mcworld.WalkOptions{Order: order}, func(oldChunk *nbt.Chunk) error {
+			select {
+			case oldChunks <- oldChunk:
+				return nil
+			case <-cancel:
+				return mcworld.StopWalk
+			}
+		})
+		close(oldChunks)
+	}()
+
+	var chunkErrs = make(mcworld.ChunkErrors, 0)
+	var addErrs = func(err error) error {
+		if errs, ok := err.(mcworld.ChunkErrors); ok {
+			chunkErrs = append(chunkErrs, errs...)
+			return nil
+		}
+		return err
+	}
+
+	var next = <-oldChunks
+	var newErr = mcworld.Walk(newWorld, mask, &mcworld.WalkOptions{Order: order}, func(newChunk *nbt.Chunk) error {
+		var x, z = newChunk.XPos, newChunk.ZPos
+
+		// Old chunks before this one are those whose new chunk couldn't be
+		// read
+		for next != nil && (next.ZPos < z || (next.ZPos == z && next.XPos < x)) {
+			next = <-oldChunks
+		}
+		var oldChunk *nbt.Chunk
+		if next != nil && next.XPos == x && next.ZPos == z {
+			oldChunk, next = next, <-oldChunks
+		} else if oldPool.Pop(x, z) {
+			// The old chunk couldn't be read. Comparing against nothing
+			// would make the whole chunk look new.
+			return nil
+		}
+
+		if d := diffChunk(x, z, oldChunk, newChunk); d.changed() {
+			return fn(d)
+		}
+		return nil
+	})
+	close(cancel)
+	for range oldChunks {
+	}
+	if err := addErrs(newErr); err != nil {
+		return err
+	}
+	if err := addErrs(<-oldErr); err != nil {
+		return err
+	}
+
+	err = mcworld.Walk(oldWorld, &coordsMask{mask, inNew, true}, &mcworld.WalkOptions{Order: order}, func(oldChunk *nbt.Chunk) error {
+		if d := diffChunk(oldChunk.XPos, oldChunk.ZPos, oldChunk, nil); d.changed() {
+			return fn(d)
+		}
+		return nil
+	})
+	if err := addErrs(err); err != nil {
+		return err
+	}
+
+	if len(chunkErrs) != 0 {
+		return chunkErrs
+	}
+	return nil
+}
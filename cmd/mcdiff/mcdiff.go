@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/mcworld"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var (
+		cx         = flag.Int("cx", 0, "Center x coordinate in chunks. Defaults to the spawn")
+		cz         = flag.Int("cz", 0, "Center z coordinate in chunks. Defaults to the spawn")
+		square     = flag.Int("s", math.MaxInt32, "Chunk square size")
+		rectx      = flag.Int("rx", math.MaxInt32, "Width(x) of rectangle size")
+		rectz      = flag.Int("rz", math.MaxInt32, "Height(z) of rectangle size")
+		outFile    = flag.String("o", "", "Also write the changes to a .csv list, an .obj or .prt model or a .png heatmap")
+		blocksPath = flag.String("blocks", "", "blocks.json to name the blocks in a .csv with. Defaults to the one beside mcdiff")
+	)
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: mcdiff [-s 20 | -rx 10 -rz 30] [-o changes.csv|.obj|.prt|.png] <old world> <new world>")
+		os.Exit(2)
+	}
+
+	var ext = strings.ToLower(filepath.Ext(*outFile))
+	if *outFile != "" && ext != ".csv" && ext != ".obj" && ext != ".prt" && ext != ".png" {
+		fmt.Fprintln(os.Stderr, "-o must be a .csv, .obj, .prt or .png file")
+		os.Exit(2)
+	}
+
+	oldWorld, err := mcworld.OpenWorld(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(oldWorld)
+
+	newWorld, err := mcworld.OpenWorld(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(newWorld)
+
+	var manualCenter = false
+	flag.Visit(func(f *flag.Flag) {
+		manualCenter = manualCenter || f.Name == "cx" || f.Name == "cz"
+	})
+	if levelReader, ok := newWorld.(mcworld.LevelReader); ok && !manualCenter {
+		if level, err := levelReader.ReadLevel(); err == nil {
+			*cx, *cz = level.SpawnX/16, level.SpawnZ/16
+		}
+	}
+	var mask, _ = mcworld.CenteredChunkMask(*cx, *cz, *square, *rectx, *rectz)
+
+	var out diffWriter
+	switch ext {
+	case ".csv":
+		var path = *blocksPath
+		if path == "" {
+			exeDir, _ := filepath.Split(strings.Replace(os.Args[0], "\\", "/", -1))
+			path = filepath.Join(exeDir, "blocks.json")
+		}
+		palette, err := blocktypes.Load(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "blocks.json:", err)
+			palette = nil
+		}
+		out, err = newCsvDiffWriter(*outFile, palette)
+	case ".obj":
+		out, err = newObjDiffWriter(*outFile)
+	case ".prt":
+		out, err = newPrtDiffWriter(*outFile)
+	case ".png":
+		var box *mcworld.BoundingBox
+		box, err = unionBoundingBox(mask, oldWorld, newWorld)
+		if err == nil && box.IsEmpty() {
+			err = errors.New("Neither world has chunks to map")
+		}
+		if err == nil {
+			out = newHeatmapWriter(*outFile, box)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var (
+		totals                     [4]int
+		chunksAdded, chunksRemoved int
+		chunksChanged              int
+	)
+	err = diffWorlds(oldWorld, newWorld, mask, func(d *chunkDiff) error {
+		var state = "changed"
+		switch {
+		case d.oldMissing:
+			state = "new"
+			chunksAdded++
+		case d.newMissing:
+			state = "gone"
+			chunksRemoved++
+		default:
+			chunksChanged++
+		}
+		fmt.Printf("Chunk %v,%v %v: %v added, %v removed, %v changed\n", d.x, d.z, state, d.counts[added], d.counts[removed], d.counts[changed])
+		for c, n := range d.counts {
+			totals[c] += n
+		}
+
+		if out != nil {
+			return out.writeChunk(d)
+		}
+		return nil
+	})
+	if chunkErrs, ok := err.(mcworld.ChunkErrors); ok {
+		for _, e := range chunkErrs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Diff:", err)
+		os.Exit(1)
+	}
+
+	if out != nil {
+		if err := out.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("%v chunks changed, %v new, %v gone. %v blocks added, %v removed, %v changed\n", chunksChanged, chunksAdded, chunksRemoved, totals[added], totals[removed], totals[changed])
+}
+
+// unionBoundingBox is the box holding the chunks inside the mask in either
+// world.
+func unionBoundingBox(mask mcworld.ChunkMask, worlds ...mcworld.World) (*mcworld.BoundingBox, error) {
+	var box = mcworld.EmptyBoundingBox()
+	for _, world := range worlds {
+		var pool, err = world.ChunkPool(mask)
+		if err != nil {
+			return nil, err
+		}
+		if b := pool.BoundingBox(); !b.IsEmpty() {
+			box.Union(b.X0, b.Z0)
+			box.Union(b.X1, b.Z1)
+		}
+	}
+	return box, nil
+}
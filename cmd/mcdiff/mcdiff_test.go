@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/quag/mcobj/mcworld"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testWorlds() (oldWorld, newWorld *mcworld.MemoryWorld) {
+	oldWorld, newWorld = mcworld.NewMemoryWorld(), mcworld.NewMemoryWorld()
+	for _, w := range []*mcworld.MemoryWorld{oldWorld, newWorld} {
+		w.Fill(0, 0, 0, 15, 1, 15, 1) // Stone
+	}
+	oldWorld.SetBlock(4, 2, 4, 20) // Glass that is removed
+	oldWorld.SetBlock(5, 1, 5, 1)  // Stone that becomes gold
+	newWorld.SetBlock(5, 1, 5, 41)
+	newWorld.Fill(6, 2, 6, 6, 4, 6, 4) // Cobblestone pillar that is added
+	oldWorld.SetBlock(-10, 0, 0, 1)    // A chunk that is gone
+	newWorld.SetBlock(20, 0, 0, 1)     // A chunk that is new
+	return
+}
+
+func TestDiffWorlds(t *testing.T) {
+	oldWorld, newWorld := testWorlds()
+
+	diffs := make(map[mcworld.ChunkCoord]*chunkDiff)
+	err := diffWorlds(oldWorld, newWorld, &mcworld.AllChunksMask{}, func(d *chunkDiff) error {
+		diffs[mcworld.ChunkCoord{X: d.x, Z: d.z}] = d
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("%v chunks differ", len(diffs))
+	}
+
+	d := diffs[mcworld.ChunkCoord{X: 0, Z: 0}]
+	if d.counts[added] != 3 || d.counts[removed] != 1 || d.counts[changed] != 1 || d.oldMissing || d.newMissing {
+		t.Errorf("Chunk 0,0 counts %v", d.counts)
+	}
+	if d.change(4, 2, 4) != removed || d.change(5, 1, 5) != changed || d.change(6, 3, 6) != added {
+		t.Error("Block changes are wrong")
+	}
+	if d := diffs[mcworld.ChunkCoord{X: -1, Z: 0}]; !d.newMissing || d.counts[removed] != 1 {
+		t.Errorf("Gone chunk %+v", d.counts)
+	}
+	if d := diffs[mcworld.ChunkCoord{X: 1, Z: 0}]; !d.oldMissing || d.counts[added] != 1 {
+		t.Errorf("New chunk %+v", d.counts)
+	}
+}
+
+func TestDiffWriters(t *testing.T) {
+	oldWorld, newWorld := testWorlds()
+	dir := t.TempDir()
+
+	csvOut, err := newCsvDiffWriter(filepath.Join(dir, "diff.csv"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objOut, err := newObjDiffWriter(filepath.Join(dir, "diff.obj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prtOut, err := newPrtDiffWriter(filepath.Join(dir, "diff.prt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := unionBoundingBox(&mcworld.AllChunksMask{}, oldWorld, newWorld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatmapOut := newHeatmapWriter(filepath.Join(dir, "diff.png"), box)
+
+	outs := []diffWriter{csvOut, objOut, prtOut, heatmapOut}
+	err = diffWorlds(oldWorld, newWorld, &mcworld.RectangleChunkMask{X0: 0, Z0: 0, X1: 1, Z1: 1}, func(d *chunkDiff) error {
+		for _, out := range outs {
+			if err := out.writeChunk(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, out := range outs {
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	csvBytes, _ := ioutil.ReadFile(filepath.Join(dir, "diff.csv"))
+	if lines := strings.Split(strings.TrimSpace(string(csvBytes)), "\n"); len(lines) != 6 || !strings.Contains(string(csvBytes), "5,1,5,changed,1:0,41:0") {
+		t.Errorf("CSV is %q", csvBytes)
+	}
+
+	// The pillar's three blocks share two faces, leaving 14, and the glass
+	// and gold blocks have 6 each
+	objBytes, _ := ioutil.ReadFile(filepath.Join(dir, "diff.obj"))
+	if faces := bytes.Count(objBytes, []byte("\nf ")); faces != 26 {
+		t.Errorf("OBJ has %v faces", faces)
+	}
+	if !bytes.Contains(objBytes, []byte("usemtl removed")) {
+		t.Error("OBJ has no removed material")
+	}
+
+	prtBytes, _ := ioutil.ReadFile(filepath.Join(dir, "diff.prt"))
+	if count := prtBytes[0x30]; count != 5 {
+		t.Errorf("PRT has %v particles", count)
+	}
+
+	// The gone chunk at -1,0 is the left of the image
+	if heatmapOut.img.NRGBAAt(16+6, 6).A == 0 || heatmapOut.img.NRGBAAt(16+7, 7).A != 0 {
+		t.Error("Heatmap columns are wrong")
+	}
+}
+
+func TestDiffWorldsPairsChunks(t *testing.T) {
+	oldWorld, newWorld := mcworld.NewMemoryWorld(), mcworld.NewMemoryWorld()
+	expected := make(map[mcworld.ChunkCoord]string)
+	for x := 0; x < 10; x++ {
+		for z := 0; z < 3; z++ {
+			inOld, inNew := x%2 == 0, x%3 != 0
+			if inOld {
+				oldWorld.SetBlock(16*x, 1, 16*z, 1)
+			}
+			if inNew {
+				newWorld.SetBlock(16*x, 1, 16*z, 1)
+			}
+			coord := mcworld.ChunkCoord{X: x, Z: z}
+			switch {
+			case inOld && inNew && x == 4:
+				newWorld.SetBlock(16*x, 2, 16*z, 4)
+				expected[coord] = "changed"
+			case inOld && !inNew:
+				expected[coord] = "gone"
+			case inNew && !inOld:
+				expected[coord] = "new"
+			}
+		}
+	}
+
+	diffs := make(map[mcworld.ChunkCoord]string)
+	err := diffWorlds(oldWorld, newWorld, &mcworld.AllChunksMask{}, func(d *chunkDiff) error {
+		state := "changed"
+		if d.oldMissing {
+			state = "new"
+		} else if d.newMissing {
+			state = "gone"
+		}
+		diffs[mcworld.ChunkCoord{X: d.x, Z: d.z}] = state
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != len(expected) {
+		t.Errorf("%v chunks differ, not %v", len(diffs), len(expected))
+	}
+	for coord, state := range expected {
+		if diffs[coord] != state {
+			t.Errorf("Chunk %v,%v is %q not %q", coord.X, coord.Z, diffs[coord], state)
+		}
+	}
+
+	stop := errors.New("stop")
+	err = diffWorlds(oldWorld, newWorld, &mcworld.AllChunksMask{}, func(d *chunkDiff) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("Error %v not %v", err, stop)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/mcworld"
+	"github.com/quag/mcobj/prt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// diffWriter writes out the changed chunks as they are found.
+type diffWriter interface {
+	writeChunk(d *chunkDiff) error
+	Close() error
+}
+
+// csvDiffWriter lists every changed block.
+type csvDiffWriter struct {
+	file    *os.File
+	w       *csv.Writer
+	palette *blocktypes.Palette
+}
+
+func newCsvDiffWriter(filename string, palette *blocktypes.Palette) (*csvDiffWriter, error) {
+	var file, err = os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	var o = &csvDiffWriter{file, csv.NewWriter(file), palette}
+	o.w.Write([]string{"x", "y", "z", "change", "old", "new"})
+	return o, nil
+}
+
+func (o *csvDiffWriter) writeChunk(d *chunkDiff) error {
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			for y := 0; y < d.height; y++ {
+				var c = d.change(x, y, z)
+				if c == unchanged {
+					continue
+				}
+				var oldBlock, newBlock = d.blocks(x, y, z)
+				o.w.Write([]string{
+					strconv.Itoa(d.x*16 + x), strconv.Itoa(d.minY + y), strconv.Itoa(d.z*16 + z),
+					c.String(), o.palette.Name(oldBlock), o.palette.Name(newBlock),
+				})
+			}
+		}
+	}
+	return o.w.Error()
+}
+
+func (o *csvDiffWriter) Close() error {
+	o.w.Flush()
+	if err := o.w.Error(); err != nil {
+		o.file.Close()
+		return err
+	}
+	return o.file.Close()
+}
+
+var changeColors = map[change]uint32{
+	added:   0x33cc33ff,
+	removed: 0xe03030ff,
+	changed: 0xf0c020ff,
+}
+
+// objDiffWriter draws the changed blocks as cubes, using materials named
+// after the change. Faces between blocks with the same change are left out.
+// Coordinates are scaled like mcobj's so the two can be overlaid.
+type objDiffWriter struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+var cubeFaces = []struct {
+	dx, dy, dz int
+	corners    [4][3]int
+}{
+	{-1, 0, 0, [4][3]int{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}}},
+	{1, 0, 0, [4][3]int{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}}},
+	{0, -1, 0, [4][3]int{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}}},
+	{0, 1, 0, [4][3]int{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}}},
+	{0, 0, -1, [4][3]int{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}}},
+	{0, 0, 1, [4][3]int{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}},
+}
+
+func newObjDiffWriter(filename string) (*objDiffWriter, error) {
+	var mtlFilename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mtl"
+	var mtl, err = os.Create(mtlFilename)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range []change{added, removed, changed} {
+		var rgba = changeColors[c]
+		fmt.Fprintf(mtl, "newmtl %s\nKd %.4f %.4f %.4f\nillum 1\n\n", c, float64(rgba>>24)/255, float64(rgba>>16&0xff)/255, float64(rgba>>8&0xff)/255)
+	}
+	if err := mtl.Close(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	var o = &objDiffWriter{file, bufio.NewWriter(file)}
+	fmt.Fprintln(o.w, "mtllib", filepath.Base(mtlFilename))
+	return o, nil
+}
+
+func (o *objDiffWriter) writeChunk(d *chunkDiff) error {
+	fmt.Fprintf(o.w, "g chunk_%d_%d\n", d.x, d.z)
+	for _, c := range []change{added, removed, changed} {
+		if d.counts[c] == 0 {
+			continue
+		}
+		fmt.Fprintln(o.w, "usemtl", c)
+		for x := 0; x < 16; x++ {
+			for z := 0; z < 16; z++ {
+				for y := 0; y < d.height; y++ {
+					if d.change(x, y, z) != c {
+						continue
+					}
+					for _, face := range cubeFaces {
+						var nx, ny, nz = x + face.dx, y + face.dy, z + face.dz
+						if nx >= 0 && nx < 16 && nz >= 0 && nz < 16 && ny >= 0 && ny < d.height && d.change(nx, ny, nz) == c {
+							continue
+						}
+						for _, corner := range face.corners {
+							var (
+								xa = d.x*16 + x + corner[0]
+								ya = d.minY + y + corner[1] - 64
+								za = d.z*16 + z + corner[2]
+							)
+							fmt.Fprintf(o.w, "v %.2f %.2f %.2f\n", float64(xa)/20, float64(ya)/20, float64(za)/20)
+						}
+						fmt.Fprintln(o.w, "f -4 -3 -2 -1")
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (o *objDiffWriter) Close() error {
+	if err := o.w.Flush(); err != nil {
+		o.file.Close()
+		return err
+	}
+	return o.file.Close()
+}
+
+// prtDiffWriter writes a particle for each changed block with the block it
+// became, or was for removed blocks, and the change as 1 added, 2 removed or
+// 3 changed.
+type prtDiffWriter struct {
+	file          *os.File
+	w             *bufio.Writer
+	zw            io.WriteCloser
+	particleCount int64
+}
+
+func newPrtDiffWriter(filename string) (*prtDiffWriter, error) {
+	var file, err = os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	var o = &prtDiffWriter{file: file, w: bufio.NewWriter(file)}
+	prt.WriteHeader(o.w, -1, []prt.ChannelDefinition{
+		{Name: "Position", DataType: prt.Float32, Arity: 3, Offset: 0},
+		{Name: "BlockID", DataType: prt.Int32, Arity: 1, Offset: 12},
+		{Name: "Change", DataType: prt.Int32, Arity: 1, Offset: 16},
+	})
+	o.zw, err = zlib.NewWriterLevel(o.w, zlib.NoCompression)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *prtDiffWriter) writeChunk(d *chunkDiff) error {
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			for y := 0; y < d.height; y++ {
+				var c = d.change(x, y, z)
+				if c == unchanged {
+					continue
+				}
+				var oldBlock, newBlock = d.blocks(x, y, z)
+				var block = newBlock
+				if c == removed {
+					block = oldBlock
+				}
+				o.particleCount++
+				binary.Write(o.zw, binary.LittleEndian, [3]float32{float32(d.x*16 + x), float32(-(d.z*16 + z)), float32(d.minY + y - 64)})
+				binary.Write(o.zw, binary.LittleEndian, [2]int32{int32(block), int32(c)})
+			}
+		}
+	}
+	return nil
+}
+
+func (o *prtDiffWriter) Close() error {
+	o.zw.Close()
+	o.w.Flush()
+	prt.UpdateParticleCount(o.file, o.particleCount)
+	return o.file.Close()
+}
+
+// heatmapWriter draws a map2d style image of the area with each column
+// coloured by how many of its blocks changed, from dark red for one to
+// white for all of them. Columns without changes are left transparent.
+type heatmapWriter struct {
+	filename string
+	box      *mcworld.BoundingBox
+	img      *image.NRGBA
+}
+
+func newHeatmapWriter(filename string, box *mcworld.BoundingBox) *heatmapWriter {
+	return &heatmapWriter{filename, box, image.NewNRGBA(image.Rect(0, 0, 16*box.Width(), 16*box.Length()))}
+}
+
+func (o *heatmapWriter) writeChunk(d *chunkDiff) error {
+	var xoffset, zoffset = 16 * (d.x - o.box.X0), 16 * (d.z - o.box.Z0)
+	for x := 0; x < 16; x++ {
+		for z := 0; z < 16; z++ {
+			var count = 0
+			for y := 0; y < d.height; y++ {
+				if d.change(x, y, z) != unchanged {
+					count++
+				}
+			}
+			if count != 0 {
+				o.img.Set(xoffset+x, zoffset+z, heat(math.Log(float64(1+count))/math.Log(float64(1+d.height))))
+			}
+		}
+	}
+	return nil
+}
+
+// heat goes from dark red through yellow to white as t goes from 0 to 1.
+func heat(t float64) color.NRGBA {
+	var channel = func(v float64) uint8 {
+		return uint8(255 * math.Max(0, math.Min(1, v)))
+	}
+	return color.NRGBA{channel(0.4 + 3*t), channel(3*t - 1), channel(3*t - 2), 0xff}
+}
+
+func (o *heatmapWriter) Close() error {
+	var file, err = os.Create(o.filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, o.img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
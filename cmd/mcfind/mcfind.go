@@ -0,0 +1,279 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/mcworld"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type match struct {
+	X        int      `json:"x"`
+	Y        int      `json:"y"`
+	Z        int      `json:"z"`
+	Name     string   `json:"name"`
+	Id       int      `json:"id"`
+	Data     int      `json:"data"`
+	Distance *float64 `json:"distance,omitempty"`
+
+	found int // How many matches came before it
+}
+
+type point struct {
+	x, y, z int
+}
+
+func main() {
+	var (
+		cx         = flag.Int("cx", 0, "Center x coordinate in chunks. Defaults to the spawn")
+		cz         = flag.Int("cz", 0, "Center z coordinate in chunks. Defaults to the spawn")
+		square     = flag.Int("s", math.MaxInt32, "Chunk square size")
+		rectx      = flag.Int("rx", math.MaxInt32, "Width(x) of rectangle size")
+		rectz      = flag.Int("rz", math.MaxInt32, "Height(z) of rectangle size")
+		blocksPath = flag.String("blocks", "", "blocks.json to name the blocks with. Defaults to the one beside mcfind")
+		limit      = flag.Int("limit", 0, "Most blocks to list. 0 lists them all")
+		near       = flag.String("near", "", "Sort by distance from x,y,z, or from the spawn if given spawn")
+		format     = flag.String("format", "csv", "Output format: csv or json")
+	)
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: mcfind [-s 20 | -rx 10 -rz 30] [-near spawn | -near x,y,z] [-limit 10] [-format csv|json] <blocks> <world directory or backup .zip/.tar.gz>")
+		fmt.Fprintln(os.Stderr, "Blocks are a comma separated list of ids, id:data values, names from blocks.json or block states such as minecraft:spawner")
+		os.Exit(2)
+	}
+	if *format != "csv" && *format != "json" {
+		fmt.Fprintln(os.Stderr, "Unknown format", *format)
+		os.Exit(2)
+	}
+
+	var path = *blocksPath
+	if path == "" {
+		exeDir, _ := filepath.Split(strings.Replace(os.Args[0], "\\", "/", -1))
+		path = filepath.Join(exeDir, "blocks.json")
+	}
+	palette, err := blocktypes.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "blocks.json:", err)
+		palette = nil
+	}
+
+	matcher, err := blocktypes.ParseMatcher(flag.Arg(0), palette)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	world, err := mcworld.OpenWorld(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(world)
+
+	var spawn *nbt.Level
+	if levelReader, ok := world.(mcworld.LevelReader); ok {
+		spawn, _ = levelReader.ReadLevel()
+	}
+
+	var origin *point
+	switch *near {
+	case "":
+	case "spawn":
+		if spawn == nil {
+			fmt.Fprintln(os.Stderr, "The world has no spawn to search near")
+			os.Exit(2)
+		}
+		origin = &point{spawn.SpawnX, spawn.SpawnY, spawn.SpawnZ}
+	default:
+		origin, err = parsePoint(*near)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-near:", err)
+			os.Exit(2)
+		}
+	}
+
+	var manualCenter = false
+	flag.Visit(func(f *flag.Flag) {
+		manualCenter = manualCenter || f.Name == "cx" || f.Name == "cz"
+	})
+	if spawn != nil && !manualCenter {
+		*cx, *cz = spawn.SpawnX/16, spawn.SpawnZ/16
+	}
+	var mask, _ = mcworld.CenteredChunkMask(*cx, *cz, *square, *rectx, *rectz)
+
+	matches, err := find(world, mask, matcher, palette, origin, *limit)
+	if chunkErrs, ok := err.(mcworld.ChunkErrors); ok {
+		fmt.Fprintf(os.Stderr, "%v chunks couldn't be read\n", len(chunkErrs))
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Walk:", err)
+		os.Exit(1)
+	}
+
+	if *format == "json" {
+		err = writeJson(os.Stdout, matches)
+	} else {
+		err = writeCsv(os.Stdout, matches, origin != nil)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func parsePoint(s string) (*point, error) {
+	var xyz = strings.Split(s, ",")
+	if len(xyz) != 3 {
+		return nil, errors.New(fmt.Sprintf("%q isn't x,y,z", s))
+	}
+	var n [3]int
+	for i := range xyz {
+		var err error
+		if n[i], err = strconv.Atoi(strings.TrimSpace(xyz[i])); err != nil {
+			return nil, err
+		}
+	}
+	return &point{n[0], n[1], n[2]}, nil
+}
+
+// find walks the masked chunks for the blocks matching. With an origin the
+// matches are sorted nearest first, and only the nearest limit are kept,
+// otherwise they are in the order the chunks are walked and the walk stops
+// once the limit is reached.
+func find(world mcworld.World, mask mcworld.ChunkMask, matcher blocktypes.Matcher, palette *blocktypes.Palette, origin *point, limit int) ([]*match, error) {
+	var (
+		matches = make([]*match, 0)
+		nearest = make(farthestFirst, 0)
+		found   = 0
+		opts    = &mcworld.WalkOptions{}
+	)
+	if origin != nil {
+		opts.Order = &mcworld.NearestChunkOrder{X: origin.x >> 4, Z: origin.z >> 4}
+	}
+	var bounded = origin != nil && limit > 0
+
+	var err = mcworld.Walk(world, mask, opts, func(chunk *nbt.Chunk) error {
+		if bounded && len(nearest) == limit && chunksDistance(chunk.XPos, chunk.ZPos, origin) > *nearest[0].Distance {
+			return mcworld.StopWalk
+		}
+
+		var height = chunk.Height()
+		for i, block := range chunk.Blocks {
+			if !matcher(block) {
+				continue
+			}
+			var x, y, z = chunk.XPos*16 + i/(height*16), chunk.MinY + i%height, chunk.ZPos*16 + i/height%16
+			var distance float64
+			if origin != nil {
+				var dx, dy, dz = float64(x - origin.x), float64(y - origin.y), float64(z - origin.z)
+				distance = math.Round(100*math.Sqrt(dx*dx+dy*dy+dz*dz)) / 100
+				if bounded && len(nearest) == limit && distance >= *nearest[0].Distance {
+					continue
+				}
+			}
+
+			var m = &match{
+				X:     x,
+				Y:     y,
+				Z:     z,
+				Name:  palette.Name(block),
+				Id:    int(block & 0xff),
+				Data:  int(block >> 8),
+				found: found,
+			}
+			found++
+			if origin != nil {
+				m.Distance = &distance
+			}
+
+			switch {
+			case !bounded:
+				matches = append(matches, m)
+				if origin == nil && limit > 0 && len(matches) == limit {
+					return mcworld.StopWalk
+				}
+			case len(nearest) < limit:
+				heap.Push(&nearest, m)
+			default:
+				nearest[0] = m
+				heap.Fix(&nearest, 0)
+			}
+		}
+		return nil
+	})
+
+	if origin != nil {
+		matches = append(matches, nearest...)
+		sort.Slice(matches, func(i, j int) bool {
+			return farthestFirst(matches).Less(j, i)
+		})
+	}
+	return matches, err
+}
+
+// chunksDistance is no further than the nearest block of the chunk x,z, or
+// of any chunk NearestChunkOrder visits after it, is from the origin.
+func chunksDistance(x, z int, origin *point) float64 {
+	var dx, dz = float64(x - origin.x>>4), float64(z - origin.z>>4)
+	return 16 * (math.Sqrt(dx*dx+dz*dz) - math.Sqrt2)
+}
+
+// farthestFirst is a heap of matches with the farthest from the origin on
+// top. Of matches the same distance away, the one found last is on top.
+type farthestFirst []*match
+
+func (h farthestFirst) Len() int      { return len(h) }
+func (h farthestFirst) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h farthestFirst) Less(i, j int) bool {
+	if *h[i].Distance != *h[j].Distance {
+		return *h[i].Distance > *h[j].Distance
+	}
+	return h[i].found > h[j].found
+}
+
+func (h *farthestFirst) Push(x interface{}) {
+	*h = append(*h, x.(*match))
+}
+
+func (h *farthestFirst) Pop() interface{} {
+	var old = *h
+	var m = old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
+
+func writeCsv(w io.Writer, matches []*match, distance bool) error {
+	var cw = csv.NewWriter(w)
+	var header = []string{"x", "y", "z", "name", "id", "data"}
+	if distance {
+		header = append(header, "distance")
+	}
+	cw.Write(header)
+	for _, m := range matches {
+		var row = []string{strconv.Itoa(m.X), strconv.Itoa(m.Y), strconv.Itoa(m.Z), m.Name, strconv.Itoa(m.Id), strconv.Itoa(m.Data)}
+		if distance {
+			row = append(row, strconv.FormatFloat(*m.Distance, 'f', -1, 64))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJson(w io.Writer, matches []*match) error {
+	var encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(matches)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/mcworld"
+	"strings"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	var w = mcworld.NewMemoryWorld()
+	w.Fill(-16, 0, 0, 31, 3, 15, 1) // Stone
+	w.SetBlock(20, 2, 5, 52)        // Spawners
+	w.SetBlock(-10, 1, 3, 52)
+	w.SetBlock(2, 3, 2, 52)
+	w.SetBlock(4, 1, 4, 56) // Diamond ore
+
+	matcher, err := blocktypes.ParseMatcher("52", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := find(w, &mcworld.AllChunksMask{}, matcher, nil, &point{0, 3, 0}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].X != 2 || matches[0].Y != 3 || matches[0].Z != 2 || matches[1].X != -10 || matches[1].Z != 3 {
+		t.Fatalf("Nearest spawners: %+v", matches)
+	}
+
+	var out bytes.Buffer
+	if err := writeCsv(&out, matches, true); err != nil {
+		t.Fatal(err)
+	}
+	var expected = "x,y,z,name,id,data,distance\n2,3,2,52:0,52,0,2.83\n-10,1,3,52:0,52,0,10.63\n"
+	if out.String() != expected {
+		t.Errorf("CSV is %q", out.String())
+	}
+
+	matches, err = find(w, &mcworld.AllChunksMask{}, matcher, nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 3 {
+		t.Errorf("Found %v spawners", len(matches))
+	}
+
+	matches, err = find(w, &mcworld.RectangleChunkMask{X0: 0, Z0: 0, X1: 1, Z1: 1}, matcher, nil, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].X != 2 {
+		t.Errorf("Limited search found %+v", matches)
+	}
+
+	out.Reset()
+	if err := writeJson(&out, matches); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "distance") {
+		t.Errorf("JSON without an origin has distances: %v", out.String())
+	}
+}
+
+func TestFindNearestLimit(t *testing.T) {
+	var w = mcworld.NewMemoryWorld()
+	w.Fill(-64, 0, -64, 63, 1, 63, 1)
+
+	matcher, err := blocktypes.ParseMatcher("1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var origin = &point{5, 1, -3}
+
+	all, err := find(w, &mcworld.AllChunksMask{}, matcher, nil, origin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nearest, err := find(w, &mcworld.AllChunksMask{}, matcher, nil, origin, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 128*2*128 || len(nearest) != 40 {
+		t.Fatalf("Found %v and %v nearest", len(all), len(nearest))
+	}
+	for i, m := range nearest {
+		if m.X != all[i].X || m.Y != all[i].Y || m.Z != all[i].Z || *m.Distance != *all[i].Distance {
+			t.Errorf("Match %v is %v,%v,%v not %v,%v,%v", i, m.X, m.Y, m.Z, all[i].X, all[i].Y, all[i].Z)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/mcworld"
+	"github.com/quag/mcobj/nbt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var gameTypes = []string{"survival", "creative", "adventure", "spectator"}
+
+type info struct {
+	Name        string               `json:"name,omitempty"`
+	Seed        int                  `json:"seed"`
+	Spawn       [3]int               `json:"spawn"`
+	GameType    string               `json:"gameType,omitempty"`
+	Version     string               `json:"version,omitempty"`
+	DataVersion int                  `json:"dataVersion,omitempty"`
+	Format      string               `json:"format"`
+	Dimensions  []*dimension         `json:"dimensions,omitempty"`
+	Chunks      int                  `json:"chunks"`
+	Regions     int                  `json:"regions,omitempty"`
+	ChunkBox    *mcworld.BoundingBox `json:"chunkBox,omitempty"`
+	BlockBox    *mcworld.BoundingBox `json:"blockBox,omitempty"`
+	Size        int64                `json:"size"`
+}
+
+type dimension struct {
+	Name    string `json:"name"`
+	Regions int    `json:"regions"`
+	Size    int64  `json:"size"`
+}
+
+func main() {
+	var asJson = flag.Bool("json", false, "Write the information as JSON")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mcinfo [-json] <world directory or backup .zip/.tar.gz>")
+		os.Exit(2)
+	}
+	var worldPath = flag.Arg(0)
+
+	world, err := mcworld.OpenWorld(worldPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(world)
+
+	i, err := worldInfo(world)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	i.Size, err = diskSize(worldPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *asJson {
+		var encoder = json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(i)
+	} else {
+		printInfo(i)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func worldInfo(world mcworld.World) (*info, error) {
+	var i = &info{}
+
+	if levelReader, ok := world.(mcworld.LevelReader); ok {
+		var level, err = levelReader.ReadLevel()
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("level.dat: ", err))
+		}
+		i.Name = level.Name
+		i.Seed = level.Seed
+		i.Spawn = [3]int{level.SpawnX, level.SpawnY, level.SpawnZ}
+		i.GameType = strconv.Itoa(level.GameType)
+		if level.GameType >= 0 && level.GameType < len(gameTypes) {
+			i.GameType = gameTypes[level.GameType]
+		}
+		i.Version = level.Version
+		i.DataVersion = level.DataVersion
+	}
+
+	switch w := world.(type) {
+	case *mcworld.BetaWorld:
+		var dimensions, err = w.Dimensions()
+		if err != nil {
+			return nil, err
+		}
+		i.Format = "McRegion"
+		for _, d := range dimensions {
+			if d.Dir == "" {
+				i.Format = d.Format
+				i.Regions = d.Regions
+			}
+			i.Dimensions = append(i.Dimensions, &dimension{d.Name, d.Regions, d.Size})
+		}
+		if i.Format == "Anvil" && i.DataVersion >= nbt.DataVersionFlattening {
+			i.Format = "Anvil with block palettes"
+		}
+	case *mcworld.AlphaWorld:
+		i.Format = "Alpha"
+	case *mcworld.BedrockWorld:
+		i.Format = "Bedrock"
+	case *mcworld.LevelFileWorld:
+		i.Format = "Indev or Classic level"
+		i.Spawn = [3]int{w.SpawnX, w.SpawnY, w.SpawnZ}
+	case *mcworld.SchematicWorld:
+		i.Format = "Schematic"
+	default:
+		i.Format = fmt.Sprintf("%T", world)
+	}
+
+	var pool, err = world.ChunkPool(&mcworld.AllChunksMask{})
+	if err != nil {
+		return nil, err
+	}
+	i.Chunks = pool.Remaining()
+	if i.Chunks != 0 {
+		i.ChunkBox = pool.BoundingBox()
+		i.BlockBox = i.ChunkBox.BlockBox()
+	}
+
+	return i, nil
+}
+
+// diskSize is the size of a backup file, or of all the files in a world
+// directory.
+func diskSize(path string) (int64, error) {
+	var size int64
+	var err = filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func printInfo(i *info) {
+	fmt.Printf("Name:         %v\n", i.Name)
+	fmt.Printf("Seed:         %v\n", i.Seed)
+	fmt.Printf("Spawn:        %v,%v,%v (chunk %v,%v)\n", i.Spawn[0], i.Spawn[1], i.Spawn[2], i.Spawn[0]>>4, i.Spawn[2]>>4)
+	fmt.Printf("Game type:    %v\n", i.GameType)
+	if i.Version != "" || i.DataVersion != 0 {
+		fmt.Printf("Version:      %v (data version %v)\n", i.Version, i.DataVersion)
+	}
+	fmt.Printf("Format:       %v\n", i.Format)
+	for _, d := range i.Dimensions {
+		fmt.Printf("Dimension:    %v, %v regions, %v\n", d.Name, d.Regions, megabytes(d.Size))
+	}
+	fmt.Printf("Chunks:       %v", i.Chunks)
+	if i.Regions != 0 {
+		fmt.Printf(" in %v regions", i.Regions)
+	}
+	fmt.Println()
+	if i.ChunkBox != nil {
+		fmt.Printf("Chunk bounds: %v,%v to %v,%v (%v by %v)\n", i.ChunkBox.X0, i.ChunkBox.Z0, i.ChunkBox.X1, i.ChunkBox.Z1, i.ChunkBox.Width(), i.ChunkBox.Length())
+		fmt.Printf("Block bounds: %v,%v to %v,%v\n", i.BlockBox.X0, i.BlockBox.Z0, i.BlockBox.X1, i.BlockBox.Z1)
+		var cx, cz = (i.ChunkBox.X0 + i.ChunkBox.X1) / 2, (i.ChunkBox.Z0 + i.ChunkBox.Z1) / 2
+		fmt.Printf("Center:       -cx %v -cz %v\n", cx, cz)
+	}
+	fmt.Printf("Size:         %v\n", megabytes(i.Size))
+}
+
+func megabytes(size int64) string {
+	return fmt.Sprintf("%.1fMB", float64(size)/1024/1024)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var gameTypes = []string{"survival", "creative", "adventure", "spectator"}
+
+func main() {
+	var (
+		spawn        = flag.String("spawn", "", "Set the spawn to x,y,z")
+		name         = flag.String("name", "", "Rename the level")
+		gameType     = flag.String("gametype", "", "Set the game type: survival, creative, adventure, spectator or 0-3")
+		dayTime      = flag.Int("time", -1, "Set the time of day in ticks. 0 is sunrise, 6000 noon and 18000 midnight")
+		clearWeather = flag.Bool("clearweather", false, "Stop rain and thunder")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mcleveldat [-spawn x,y,z] [-name name] [-gametype creative] [-time 6000] [-clearweather] <world directory or level.dat>")
+		os.Exit(2)
+	}
+
+	var path = flag.Arg(0)
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, "level.dat")
+	}
+
+	root, err := readTree(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "level.dat:", err)
+		os.Exit(1)
+	}
+	var data = root.Get("Data")
+	if data == nil || data.Type != nbt.TagStruct {
+		fmt.Fprintln(os.Stderr, "level.dat:", nbt.DataStructNotFound)
+		os.Exit(1)
+	}
+
+	var edited = false
+	flag.Visit(func(f *flag.Flag) { edited = true })
+	if !edited {
+		printLevel(path)
+		return
+	}
+
+	if *spawn != "" {
+		var xyz = strings.Split(*spawn, ",")
+		if len(xyz) != 3 {
+			fmt.Fprintln(os.Stderr, "-spawn needs x,y,z")
+			os.Exit(2)
+		}
+		for i, field := range []string{"SpawnX", "SpawnY", "SpawnZ"} {
+			var n, err = strconv.Atoi(strings.TrimSpace(xyz[i]))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "-spawn:", err)
+				os.Exit(2)
+			}
+			data.Set(nbt.TagInt32, field, n)
+		}
+	}
+
+	if *name != "" {
+		data.Set(nbt.TagString, "LevelName", *name)
+	}
+
+	if *gameType != "" {
+		var mode, err = parseGameType(*gameType)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-gametype:", err)
+			os.Exit(2)
+		}
+		data.Set(nbt.TagInt32, "GameType", mode)
+		// In single player the player's own game type wins
+		if player := data.Get("Player"); player != nil && player.Get("playerGameType") != nil {
+			player.Set(nbt.TagInt32, "playerGameType", mode)
+		}
+	}
+
+	if *dayTime >= 0 {
+		if data.Get("DayTime") != nil {
+			data.Set(nbt.TagInt64, "DayTime", *dayTime)
+		} else {
+			// Before 1.3 the time of day came from the world's age
+			var age int
+			if t := data.Get("Time"); t != nil {
+				age, _ = t.Value.(int)
+			}
+			data.Set(nbt.TagInt64, "Time", age-age%24000+*dayTime)
+		}
+	}
+
+	if *clearWeather {
+		data.Set(nbt.TagInt8, "raining", 0)
+		data.Set(nbt.TagInt8, "thundering", 0)
+		data.Set(nbt.TagInt32, "rainTime", 0)
+		data.Set(nbt.TagInt32, "thunderTime", 0)
+	}
+
+	backup, err := save(path, root, data)
+	if backup != "" {
+		fmt.Println("Backed up to", backup)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Writing level.dat:", err)
+		os.Exit(1)
+	}
+
+	printLevel(path)
+}
+
+func parseGameType(s string) (int, error) {
+	for i, name := range gameTypes {
+		if strings.EqualFold(s, name) || s == strconv.Itoa(i) {
+			return i, nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("Unknown game type %q", s))
+}
+
+func readTree(path string) (*nbt.Tag, error) {
+	var file, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return nbt.ReadLevelTree(file)
+}
+
+// save writes the edited tree and checks it reads back, restoring the
+// backup when it doesn't.
+func save(path string, root, data *nbt.Tag) (string, error) {
+	var backup, err = writeTree(path, root)
+	if err != nil {
+		return backup, err
+	}
+
+	if err := validate(path, data); err != nil {
+		if restoreErr := copyFile(backup, path); restoreErr != nil {
+			return backup, errors.New(fmt.Sprintf("Didn't read back correctly (%v), and restoring the backup failed: %v", err, restoreErr))
+		}
+		return backup, errors.New(fmt.Sprintf("Didn't read back correctly, so the backup was restored: %v", err))
+	}
+	return backup, nil
+}
+
+// writeTree backs up the file, then writes the new level.dat beside it and
+// renames it into place.
+func writeTree(path string, root *nbt.Tag) (string, error) {
+	var backup, err = backupFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return backup, err
+	}
+	if err := nbt.WriteLevelTree(file, root); err != nil {
+		file.Close()
+		return backup, err
+	}
+	if err := file.Close(); err != nil {
+		return backup, err
+	}
+	return backup, os.Rename(path+".tmp", path)
+}
+
+// backupFile copies the file to a name holding the time. Backups are never
+// overwritten, so another edit within the same second gets a numbered name.
+func backupFile(path string) (string, error) {
+	var stamp = path + "." + time.Now().Format("20060102-150405")
+	for i := 0; ; i++ {
+		var backup = stamp + ".bak"
+		if i != 0 {
+			backup = fmt.Sprintf("%v.%v.bak", stamp, i)
+		}
+
+		var dst, err = os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := copyInto(dst, path); err != nil {
+			return "", err
+		}
+		return backup, nil
+	}
+}
+
+// validate reads the written file back, both as a level and as a whole
+// tree, and checks the edited values survived.
+func validate(path string, data *nbt.Tag) error {
+	var file, err = os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := nbt.ReadLevelDat(file); err != nil {
+		return err
+	}
+
+	var root, readErr = readTree(path)
+	if readErr != nil {
+		return readErr
+	}
+	var written = root.Get("Data")
+	for _, expected := range data.Value.([]*nbt.Tag) {
+		var tag = written.Get(expected.Name)
+		if tag == nil || tag.Type != expected.Type {
+			return errors.New(fmt.Sprintf("%v is missing", expected.Name))
+		}
+		if expected.Type != nbt.TagStruct && expected.Type != nbt.TagList && fmt.Sprint(tag.Value) != fmt.Sprint(expected.Value) {
+			return errors.New(fmt.Sprintf("%v is %v not %v", expected.Name, tag.Value, expected.Value))
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	var dst, err = os.Create(to)
+	if err != nil {
+		return err
+	}
+	return copyInto(dst, from)
+}
+
+// copyInto copies the file from into dst and closes dst.
+func copyInto(dst *os.File, from string) error {
+	var src, err = os.Open(from)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func printLevel(path string) {
+	var file, err = os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer file.Close()
+
+	level, err := nbt.ReadLevelDat(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "level.dat:", err)
+		return
+	}
+
+	var gameType = strconv.Itoa(level.GameType)
+	if level.GameType >= 0 && level.GameType < len(gameTypes) {
+		gameType = gameTypes[level.GameType]
+	}
+	fmt.Printf("Name:      %v\n", level.Name)
+	fmt.Printf("Spawn:     %v,%v,%v\n", level.SpawnX, level.SpawnY, level.SpawnZ)
+	fmt.Printf("Game type: %v\n", gameType)
+	fmt.Printf("Time:      %v (day time %v)\n", level.Time, level.DayTime)
+	fmt.Printf("Weather:   raining %v, thundering %v\n", level.Raining, level.Thundering)
+}
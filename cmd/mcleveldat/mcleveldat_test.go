@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"github.com/quag/mcobj/nbt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testLevel(t *testing.T) (path string, root *nbt.Tag) {
+	var data = &nbt.Tag{Type: nbt.TagStruct, Name: "Data", Value: []*nbt.Tag{}}
+	data.Set(nbt.TagString, "LevelName", "Old")
+	data.Set(nbt.TagInt32, "SpawnX", 1)
+	data.Set(nbt.TagInt32, "SpawnY", 64)
+	data.Set(nbt.TagInt32, "SpawnZ", 2)
+	root = &nbt.Tag{Type: nbt.TagStruct, Value: []*nbt.Tag{data}}
+
+	path = filepath.Join(t.TempDir(), "level.dat")
+	var file, err = os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nbt.WriteLevelTree(file, root); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	return path, root
+}
+
+func TestSave(t *testing.T) {
+	var path, root = testLevel(t)
+	var original, _ = ioutil.ReadFile(path)
+
+	var data = root.Get("Data")
+	data.Set(nbt.TagString, "LevelName", "New")
+	var first, err = save(path, root, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Set(nbt.TagInt32, "SpawnX", 5)
+	second, err := save(path, root, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both edits happen within a second, and neither backup is overwritten
+	if first == second {
+		t.Fatalf("Both backups are %v", first)
+	}
+	if backup, _ := ioutil.ReadFile(first); !bytes.Equal(backup, original) {
+		t.Error("First backup isn't the original level.dat")
+	}
+	var edited, _ = ioutil.ReadFile(path)
+	if backup, _ := ioutil.ReadFile(second); bytes.Equal(backup, original) || bytes.Equal(backup, edited) {
+		t.Error("Second backup isn't the level.dat after the first edit")
+	}
+
+	level, err := readTree(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := level.Get("Data").Get("LevelName").Value; name != "New" {
+		t.Errorf("LevelName is %v", name)
+	}
+}
+
+func TestSaveRestoresBackup(t *testing.T) {
+	var path, root = testLevel(t)
+	var original, _ = ioutil.ReadFile(path)
+
+	// The edits checked for aren't those written
+	var expected = &nbt.Tag{Type: nbt.TagStruct, Name: "Data", Value: []*nbt.Tag{}}
+	expected.Set(nbt.TagString, "LevelName", "Expected")
+	root.Get("Data").Set(nbt.TagString, "LevelName", "Written")
+
+	var backup, err = save(path, root, expected)
+	if err == nil || !strings.Contains(err.Error(), "LevelName") {
+		t.Fatalf("Mismatched edit saved with error %v", err)
+	}
+	if backup == "" {
+		t.Fatal("No backup")
+	}
+	if restored, _ := ioutil.ReadFile(path); !bytes.Equal(restored, original) {
+		t.Error("Backup not restored")
+	}
+}
@@ -7,6 +7,7 @@ import (
 type EnclosingSides [4]ChunkSide
 type EnclosedChunk struct {
 	xPos, zPos int
+	minY       int
 	blocks     Blocks
 	enclosing  EnclosingSides
 }
@@ -23,13 +24,13 @@ func (e *EnclosedChunk) Get(x, y, z int) (blockId nbt.Block) {
 	case y >= e.blocks.height:
 		blockId = 0
 	case x == -1:
-		blockId = e.enclosing.side(0).BlockId(z, y)
+		blockId = e.enclosing.side(0).BlockId(z, e.minY+y)
 	case x == 16:
-		blockId = e.enclosing.side(1).BlockId(z, y)
+		blockId = e.enclosing.side(1).BlockId(z, e.minY+y)
 	case z == -1:
-		blockId = e.enclosing.side(2).BlockId(x, y)
+		blockId = e.enclosing.side(2).BlockId(x, e.minY+y)
 	case z == 16:
-		blockId = e.enclosing.side(3).BlockId(x, y)
+		blockId = e.enclosing.side(3).BlockId(x, e.minY+y)
 	default:
 		blockId = e.blocks.Get(x, y, z)
 	}
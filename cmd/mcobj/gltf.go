@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GltfOptions choose how the scene is laid out in a glTF file.
+type GltfOptions struct {
+	// ChunkNodes gives each chunk a node and mesh of its own, placed at the
+	// chunk's corner. Otherwise the whole scene is one mesh.
+	ChunkNodes bool
+}
+
+// GltfGenerator writes glTF 2.0, either a .gltf file with its buffer in a
+// .bin beside it or a single .glb, chosen by the output's extension. Each
+// material is a primitive of triangles indexing shared vertexes. Positions
+// are in blocks, which glTF reads as metres, with y offset by -64 as in obj
+// files. No normals are written, so faces are shaded flat.
+type GltfGenerator struct {
+	Options GltfOptions
+
+	enclosedsChan chan *EnclosedChunkJob
+	meshesChan    chan *chunkMesh
+	completeChan  chan bool
+
+	total  int
+	binary bool
+	err    error
+
+	outFilename, binFilename string
+	binFile                  *os.File
+	bin                      *bufio.Writer
+	binLength                int
+
+	doc       gltfDocument
+	materials map[nbt.Block]int
+
+	// Without chunk nodes the vertexes of every chunk share one accessor,
+	// and each material's triangles are gathered until Close
+	vertexCount int
+	min, max    [3]float32
+	triangles   materialTriangles
+}
+
+// materialTriangles are the triangles of each material, by materialKey,
+// and the order the materials were first seen in.
+type materialTriangles struct {
+	keys    []nbt.Block
+	indexes map[nbt.Block][]uint32
+}
+
+type chunkMesh struct {
+	xPos, zPos int
+	positions  []Vertex
+	mtls       []*MtlFaces
+	last       bool
+}
+
+// glTF constants
+const (
+	gltfFloat        = 5126
+	gltfUnsignedInt  = 5125
+	gltfArrayBuffer  = 34962
+	gltfElementArray = 34963
+
+	glbMagic     = 0x46546C67 // glTF
+	glbJsonChunk = 0x4E4F534A // JSON
+	glbBinChunk  = 0x004E4942 // BIN
+)
+
+type gltfDocument struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes,omitempty"`
+	Meshes      []gltfMesh       `json:"meshes,omitempty"`
+	Materials   []gltfMaterial   `json:"materials,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors,omitempty"`
+	BufferViews []gltfBufferView `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer     `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string  `json:"name,omitempty"`
+	Mesh        int     `json:"mesh"`
+	Translation *[3]int `json:"translation,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Material   *int           `json:"material,omitempty"`
+}
+
+type gltfMaterial struct {
+	Name                 string  `json:"name"`
+	PbrMetallicRoughness gltfPbr `json:"pbrMetallicRoughness"`
+	AlphaMode            string  `json:"alphaMode,omitempty"`
+}
+
+type gltfPbr struct {
+	BaseColorFactor [4]float64 `json:"baseColorFactor"`
+	MetallicFactor  float64    `json:"metallicFactor"`
+	RoughnessFactor float64    `json:"roughnessFactor"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfBuffer struct {
+	Uri        string `json:"uri,omitempty"`
+	ByteLength int    `json:"byteLength"`
+}
+
+func (o *GltfGenerator) Start(outFilename string, total int, maxProcs int, boundary *BoundaryLocator) error {
+	o.enclosedsChan = make(chan *EnclosedChunkJob, maxProcs*2)
+	o.meshesChan = make(chan *chunkMesh, maxProcs*2)
+	o.completeChan = make(chan bool)
+	o.total = total
+
+	o.doc = gltfDocument{
+		Asset:  gltfAsset{Version: "2.0", Generator: "mcobj " + version},
+		Scenes: []gltfScene{{Nodes: []int{}}},
+	}
+	o.materials = make(map[nbt.Block]int)
+	o.triangles = materialTriangles{indexes: make(map[nbt.Block][]uint32)}
+	o.min = [3]float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+	o.max = [3]float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+
+	for i := 0; i < maxProcs; i++ {
+		go func() {
+			var faces Faces
+			faces.boundary = boundary
+			faces.options = new(ObjOptions)
+			for {
+				var job = <-o.enclosedsChan
+				var positions, mtls = faces.ProcessChunkMesh(job.enclosed)
+				o.meshesChan <- &chunkMesh{job.enclosed.xPos, job.enclosed.zPos, positions, mtls, job.last}
+			}
+		}()
+	}
+
+	go func() {
+		var chunkCount = 0
+		for {
+			var mesh = <-o.meshesChan
+			chunkCount++
+
+			var chunkFaces = 0
+			for _, mtl := range mesh.mtls {
+				chunkFaces += len(mtl.faces)
+			}
+			if o.err == nil {
+				o.err = o.addChunk(mesh)
+			}
+			fmt.Printf("%4v/%-4v (%3v,%3v) Faces: %4d Size: %4.1fMB\n", chunkCount, o.total, mesh.xPos, mesh.zPos, chunkFaces, float64(o.binLength)/1024/1024)
+
+			if mesh.last {
+				o.completeChan <- true
+			}
+		}
+	}()
+
+	o.outFilename = outFilename
+	o.binary = strings.EqualFold(filepath.Ext(outFilename), ".glb")
+	if o.binary {
+		o.binFilename = outFilename + ".bin.tmp"
+	} else {
+		o.binFilename = outFilename[:len(outFilename)-len(filepath.Ext(outFilename))] + ".bin"
+	}
+
+	var err error
+	o.binFile, err = os.Create(o.binFilename)
+	if err != nil {
+		return err
+	}
+	o.bin = bufio.NewWriterSize(o.binFile, 1024*1024)
+	return nil
+}
+
+func (o *GltfGenerator) GetEnclosedJobsChan() chan *EnclosedChunkJob {
+	return o.enclosedsChan
+}
+
+func (o *GltfGenerator) GetCompleteChan() chan bool {
+	return o.completeChan
+}
+
+// addChunk writes a chunk's vertexes to the buffer. With chunk nodes its
+// triangles are written too, and it gets a mesh and node.
+func (o *GltfGenerator) addChunk(mesh *chunkMesh) error {
+	if len(mesh.mtls) == 0 {
+		return nil
+	}
+
+	var origin Vertex
+	if o.Options.ChunkNodes {
+		origin = Vertex{mesh.xPos * 16, 64, mesh.zPos * 16}
+	} else {
+		origin = Vertex{0, 64, 0}
+	}
+
+	var positions = make([]float32, 0, 3*len(mesh.positions))
+	var lo, hi = o.min, o.max
+	if o.Options.ChunkNodes {
+		lo = [3]float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+		hi = [3]float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	}
+	for _, v := range mesh.positions {
+		var p = [3]float32{float32(v.x - origin.x), float32(v.y - origin.y), float32(v.z - origin.z)}
+		for i := range p {
+			lo[i], hi[i] = min(lo[i], p[i]), max(hi[i], p[i])
+		}
+		positions = append(positions, p[:]...)
+	}
+	if err := o.write(positions); err != nil {
+		return err
+	}
+
+	if !o.Options.ChunkNodes {
+		o.triangles.add(mesh.mtls, uint32(o.vertexCount))
+		o.vertexCount += len(mesh.positions)
+		o.min, o.max = lo, hi
+		return nil
+	}
+
+	var positionsAccessor = o.addAccessor(o.binLength-4*len(positions), 4*len(positions), gltfArrayBuffer, gltfAccessor{
+		ComponentType: gltfFloat, Count: len(mesh.positions), Type: "VEC3", Min: lo[:], Max: hi[:],
+	})
+
+	var m = gltfMesh{Name: fmt.Sprintf("Chunk %d,%d", mesh.xPos, mesh.zPos)}
+	var triangles = materialTriangles{indexes: make(map[nbt.Block][]uint32)}
+	triangles.add(mesh.mtls, 0)
+	for _, key := range triangles.keys {
+		var primitive, err = o.addPrimitive(key, triangles.indexes[key], positionsAccessor)
+		if err != nil {
+			return err
+		}
+		m.Primitives = append(m.Primitives, primitive)
+	}
+
+	o.doc.Meshes = append(o.doc.Meshes, m)
+	o.doc.Nodes = append(o.doc.Nodes, gltfNode{Name: m.Name, Mesh: len(o.doc.Meshes) - 1, Translation: &[3]int{origin.x, origin.y - 64, origin.z}})
+	o.doc.Scenes[0].Nodes = append(o.doc.Scenes[0].Nodes, len(o.doc.Nodes)-1)
+	return nil
+}
+
+// add splits each face of a chunk into two triangles. Face vertexes count
+// from 1 within their chunk, and first is the index of the chunk's first
+// vertex. Without materials every face goes in one primitive.
+func (t *materialTriangles) add(mtls []*MtlFaces, first uint32) {
+	for _, mtl := range mtls {
+		var key nbt.Block
+		if !noColor {
+			key = materialKey(mtl.blockId)
+		}
+		var indexes, seen = t.indexes[key]
+		if !seen {
+			t.keys = append(t.keys, key)
+		}
+		for _, f := range mtl.faces {
+			var v [4]uint32
+			for i, n := range f.vertexes {
+				v[i] = first + uint32(n-1)
+			}
+			indexes = append(indexes, v[0], v[1], v[2], v[0], v[2], v[3])
+		}
+		t.indexes[key] = indexes
+	}
+}
+
+// addPrimitive writes a material's triangles to the buffer.
+func (o *GltfGenerator) addPrimitive(key nbt.Block, indexes []uint32, positionsAccessor int) (gltfPrimitive, error) {
+	if err := o.write(indexes); err != nil {
+		return gltfPrimitive{}, err
+	}
+	var indexesAccessor = o.addAccessor(o.binLength-4*len(indexes), 4*len(indexes), gltfElementArray, gltfAccessor{
+		ComponentType: gltfUnsignedInt, Count: len(indexes), Type: "SCALAR",
+	})
+
+	var primitive = gltfPrimitive{Attributes: map[string]int{"POSITION": positionsAccessor}, Indices: indexesAccessor}
+	if !noColor {
+		var material = o.material(key)
+		primitive.Material = &material
+	}
+	return primitive, nil
+}
+
+func (o *GltfGenerator) write(data interface{}) error {
+	var err = binary.Write(o.bin, binary.LittleEndian, data)
+	o.binLength += binary.Size(data)
+	return err
+}
+
+// addAccessor adds an accessor for data already written to the buffer,
+// with a buffer view of its own.
+func (o *GltfGenerator) addAccessor(offset, length, target int, accessor gltfAccessor) int {
+	o.doc.BufferViews = append(o.doc.BufferViews, gltfBufferView{Buffer: 0, ByteOffset: offset, ByteLength: length, Target: target})
+	accessor.BufferView = len(o.doc.BufferViews) - 1
+	o.doc.Accessors = append(o.doc.Accessors, accessor)
+	return len(o.doc.Accessors) - 1
+}
+
+// material finds or adds the material for a materialKey. blocks.json
+// colours are sRGB, while glTF's base colour is linear.
+func (o *GltfGenerator) material(key nbt.Block) int {
+	if i, ok := o.materials[key]; ok {
+		return i
+	}
+
+	var color = findMtl(key).color
+	var m = gltfMaterial{
+		Name: MaterialNamer.NameBlockId(key),
+		PbrMetallicRoughness: gltfPbr{
+			BaseColorFactor: [4]float64{
+				linear(uint8(color >> 24)),
+				linear(uint8(color >> 16)),
+				linear(uint8(color >> 8)),
+				math.Round(float64(color&0xff)/255*1e4) / 1e4,
+			},
+			RoughnessFactor: 1,
+		},
+	}
+	if color&0xff != 0xff {
+		m.AlphaMode = "BLEND"
+	}
+
+	o.doc.Materials = append(o.doc.Materials, m)
+	o.materials[key] = len(o.doc.Materials) - 1
+	return len(o.doc.Materials) - 1
+}
+
+// linear converts an sRGB colour component to linear, rounded to keep the
+// JSON short.
+func linear(c uint8) float64 {
+	var s = float64(c) / 255
+	var l float64
+	if s <= 0.04045 {
+		l = s / 12.92
+	} else {
+		l = math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return math.Round(l*1e4) / 1e4
+}
+
+func (o *GltfGenerator) Close() error {
+	if o.err != nil {
+		o.binFile.Close()
+		return o.err
+	}
+
+	if !o.Options.ChunkNodes && o.vertexCount != 0 {
+		var positionsAccessor = o.addAccessor(0, 12*o.vertexCount, gltfArrayBuffer, gltfAccessor{
+			ComponentType: gltfFloat, Count: o.vertexCount, Type: "VEC3", Min: o.min[:], Max: o.max[:],
+		})
+		var m = gltfMesh{Name: "World"}
+		for _, key := range o.triangles.keys {
+			var primitive, err = o.addPrimitive(key, o.triangles.indexes[key], positionsAccessor)
+			if err != nil {
+				o.binFile.Close()
+				return err
+			}
+			m.Primitives = append(m.Primitives, primitive)
+		}
+		o.doc.Meshes = append(o.doc.Meshes, m)
+		o.doc.Nodes = append(o.doc.Nodes, gltfNode{Name: m.Name, Mesh: 0})
+		o.doc.Scenes[0].Nodes = append(o.doc.Scenes[0].Nodes, 0)
+	}
+
+	if err := o.bin.Flush(); err != nil {
+		o.binFile.Close()
+		return err
+	}
+	if err := o.binFile.Close(); err != nil {
+		return err
+	}
+
+	if o.binLength != 0 {
+		var buffer = gltfBuffer{ByteLength: o.binLength}
+		if !o.binary {
+			buffer.Uri = filepath.Base(o.binFilename)
+		}
+		o.doc.Buffers = []gltfBuffer{buffer}
+	}
+
+	var outFile, err = os.Create(o.outFilename)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	if o.binary {
+		err = o.writeGlb(outFile)
+	} else {
+		var jsonBytes []byte
+		jsonBytes, err = json.MarshalIndent(&o.doc, "", "  ")
+		if err == nil {
+			_, err = outFile.Write(append(jsonBytes, '\n'))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return outFile.Close()
+}
+
+// writeGlb writes the header, the JSON chunk and the buffer as the binary
+// chunk, moving the buffer in from the temporary file it was written to.
+// Chunks are padded to four bytes, the JSON with spaces.
+func (o *GltfGenerator) writeGlb(w io.Writer) error {
+	var jsonBytes, err = json.Marshal(&o.doc)
+	if err != nil {
+		return err
+	}
+	for len(jsonBytes)%4 != 0 {
+		jsonBytes = append(jsonBytes, ' ')
+	}
+
+	var length = 12 + 8 + len(jsonBytes)
+	if o.binLength != 0 {
+		length += 8 + o.binLength
+	}
+	for _, v := range []uint32{glbMagic, 2, uint32(length), uint32(len(jsonBytes)), glbJsonChunk} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(jsonBytes); err != nil {
+		return err
+	}
+
+	if o.binLength != 0 {
+		for _, v := range []uint32{uint32(o.binLength), glbBinChunk} {
+			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		if err := copyFile(w, o.binFilename); err != nil {
+			return err
+		}
+	}
+	return os.Remove(o.binFilename)
+}
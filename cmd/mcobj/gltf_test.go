@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readGltf reads a .gltf and its .bin, or a .glb.
+func readGltf(t *testing.T, filename string) (doc gltfDocument, bin []byte) {
+	var data, err = ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Ext(filename) != ".glb" {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if len(doc.Buffers) != 1 || doc.Buffers[0].Uri == "" {
+			t.Fatalf("Buffers %+v", doc.Buffers)
+		}
+		bin, err = ioutil.ReadFile(filepath.Join(filepath.Dir(filename), doc.Buffers[0].Uri))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc, bin
+	}
+
+	var le = binary.LittleEndian
+	if le.Uint32(data[0:]) != glbMagic || le.Uint32(data[4:]) != 2 || int(le.Uint32(data[8:])) != len(data) {
+		t.Fatalf("Bad glb header % x", data[:12])
+	}
+	var jsonLength = int(le.Uint32(data[12:]))
+	if le.Uint32(data[16:]) != glbJsonChunk || jsonLength%4 != 0 {
+		t.Fatalf("Bad JSON chunk header % x", data[12:20])
+	}
+	if err := json.Unmarshal(data[20:20+jsonLength], &doc); err != nil {
+		t.Fatal(err)
+	}
+	var binHeader = data[20+jsonLength:]
+	if le.Uint32(binHeader[4:]) != glbBinChunk || int(le.Uint32(binHeader)) != len(binHeader)-8 {
+		t.Fatalf("Bad BIN chunk header % x", binHeader[:8])
+	}
+	if len(doc.Buffers) != 1 || doc.Buffers[0].Uri != "" {
+		t.Fatalf("Buffers %+v", doc.Buffers)
+	}
+	return doc, binHeader[8:]
+}
+
+// checkGltf checks the accessors fit in the buffer and the indexes in
+// their positions, and returns how many triangles there are.
+func checkGltf(t *testing.T, doc gltfDocument, bin []byte) (triangles int) {
+	if doc.Buffers[0].ByteLength != len(bin) {
+		t.Fatalf("Buffer is %v bytes not %v", len(bin), doc.Buffers[0].ByteLength)
+	}
+	var le = binary.LittleEndian
+	var view = func(accessor int) []byte {
+		var v = doc.BufferViews[doc.Accessors[accessor].BufferView]
+		if v.ByteOffset%4 != 0 || v.ByteOffset+v.ByteLength > len(bin) {
+			t.Fatalf("Buffer view %+v", v)
+		}
+		return bin[v.ByteOffset : v.ByteOffset+v.ByteLength]
+	}
+
+	for _, mesh := range doc.Meshes {
+		for _, p := range mesh.Primitives {
+			var positions = doc.Accessors[p.Attributes["POSITION"]]
+			if len(view(p.Attributes["POSITION"])) != 12*positions.Count {
+				t.Errorf("%v positions don't fill their view", positions.Count)
+			}
+			for i := 0; i < positions.Count*3; i++ {
+				var f = math.Float32frombits(le.Uint32(view(p.Attributes["POSITION"])[4*i:]))
+				if f < positions.Min[i%3] || f > positions.Max[i%3] {
+					t.Fatalf("Position %v outside %v to %v", f, positions.Min, positions.Max)
+				}
+			}
+
+			var indexes = view(p.Indices)
+			if doc.Accessors[p.Indices].Count*4 != len(indexes) || len(indexes)%12 != 0 {
+				t.Errorf("%v indexes in %v bytes", doc.Accessors[p.Indices].Count, len(indexes))
+			}
+			for i := 0; i < len(indexes); i += 4 {
+				if int(le.Uint32(indexes[i:])) >= positions.Count {
+					t.Fatalf("Index %v of %v positions", le.Uint32(indexes[i:]), positions.Count)
+				}
+			}
+			triangles += len(indexes) / 12
+		}
+	}
+	return triangles
+}
+
+func TestGltf(t *testing.T) {
+	setupTest(t)
+	var outFilename = filepath.Join(t.TempDir(), "world.gltf")
+
+	runGenerator(t, new(GltfGenerator), testWorld(), outFilename)
+
+	var doc, bin = readGltf(t, outFilename)
+	if triangles := checkGltf(t, doc, bin); triangles != 2*faceCount {
+		t.Errorf("%v triangles for %v faces", triangles, faceCount)
+	}
+
+	if len(doc.Nodes) != 1 || len(doc.Meshes) != 1 {
+		t.Fatalf("%v nodes and %v meshes", len(doc.Nodes), len(doc.Meshes))
+	}
+	var primitives = doc.Meshes[0].Primitives
+	if len(primitives) != len(doc.Materials) {
+		t.Errorf("%v primitives for %v materials", len(primitives), len(doc.Materials))
+	}
+	for i, p := range primitives {
+		if p.Material == nil || *p.Material != i {
+			t.Errorf("Primitive %v has material %v", i, p.Material)
+		}
+	}
+
+	var positions = doc.Accessors[primitives[0].Attributes["POSITION"]]
+	if positions.Min[0] != -16 || positions.Max[0] != 16 || positions.Min[1] != -64 || positions.Max[1] != -58 {
+		t.Errorf("Positions from %v to %v", positions.Min, positions.Max)
+	}
+
+	var materials = make(map[string]gltfMaterial)
+	for _, m := range doc.Materials {
+		materials[m.Name] = m
+	}
+	if stone := materials["Stone"].PbrMetallicRoughness; stone.BaseColorFactor != [4]float64{0.2051, 0.2051, 0.2051, 1} || stone.MetallicFactor != 0 || stone.RoughnessFactor != 1 {
+		t.Errorf("Stone is %+v", stone)
+	}
+	if materials["Glass"].AlphaMode != "BLEND" || materials["Stone"].AlphaMode != "" {
+		t.Errorf("Glass alpha mode %q, stone %q", materials["Glass"].AlphaMode, materials["Stone"].AlphaMode)
+	}
+	if _, ok := materials["Wool.Red"]; !ok {
+		t.Errorf("No red wool material in %v", materials)
+	}
+}
+
+func TestGlbChunkNodes(t *testing.T) {
+	setupTest(t)
+	var dir = t.TempDir()
+	var outFilename = filepath.Join(dir, "world.glb")
+
+	runGenerator(t, &GltfGenerator{Options: GltfOptions{ChunkNodes: true}}, testWorld(), outFilename)
+
+	var doc, bin = readGltf(t, outFilename)
+	if triangles := checkGltf(t, doc, bin); triangles != 2*faceCount {
+		t.Errorf("%v triangles for %v faces", triangles, faceCount)
+	}
+
+	if len(doc.Nodes) != 2 || len(doc.Scenes[0].Nodes) != 2 {
+		t.Fatalf("%v nodes", len(doc.Nodes))
+	}
+	for _, node := range doc.Nodes {
+		if node.Translation == nil || node.Translation[1] != 0 || (node.Translation[0] != 0 && node.Translation[0] != -16) {
+			t.Errorf("Node %v at %v", node.Name, node.Translation)
+		}
+		var positions = doc.Accessors[doc.Meshes[node.Mesh].Primitives[0].Attributes["POSITION"]]
+		if positions.Min[0] < 0 || positions.Max[0] > 16 {
+			t.Errorf("Node %v positions from %v to %v", node.Name, positions.Min, positions.Max)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%v files left beside the glb", len(files))
+	}
+	if _, err := os.Stat(outFilename + ".bin.tmp"); err == nil {
+		t.Error("Temporary buffer not removed")
+	}
+}
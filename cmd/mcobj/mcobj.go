@@ -2,9 +2,9 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/quag/mcobj/blocktypes"
 	"github.com/quag/mcobj/commandline"
 	"github.com/quag/mcobj/mcworld"
 	"github.com/quag/mcobj/nbt"
@@ -14,7 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
+	"sort"
 	"strings"
 )
 
@@ -42,6 +42,15 @@ func main() {
 	var prt bool
 	var solidSides bool
 	var mtlNumber bool
+	var mmap bool
+	var index, heightMaps bool
+	var objOptions ObjOptions
+	var gltfOptions GltfOptions
+	var plyOptions PlyOptions
+	var texturePack string
+	var populated bool
+	var inhabited int
+	var contains string
 
 	var defaultObjOutFilename = "a.obj"
 	var defaultPrtOutFilename = "a.prt"
@@ -51,7 +60,7 @@ func main() {
 	var outFilename string
 	commandLine.IntVar(&maxProcs, "cpu", maxProcs, "Number of cores to use")
 	commandLine.StringVar(&outFilename, "o", defaultObjOutFilename, "Name for output file")
-	commandLine.IntVar(&yMin, "y", 0, "Omit all blocks below this height. 63 is sea level")
+	commandLine.IntVar(&yMin, "y", 0, "Omit all blocks below this height. 63 is sea level. Use -64 for the deep caves of 1.18 worlds")
 	commandLine.BoolVar(&solidSides, "sides", false, "Solid sides, rather than showing underground")
 	commandLine.BoolVar(&blockFaces, "bf", false, "Don't combine adjacent faces of the same block within a column")
 	commandLine.BoolVar(&hideBottom, "hb", false, "Hide bottom of world")
@@ -67,6 +76,18 @@ func main() {
 	commandLine.BoolVar(&prt, "prt", false, "Write out PRT file instead of Obj file")
 	commandLine.BoolVar(&obj3dsmax, "3dsmax", false, "Create .obj file compatible with 3dsMax")
 	commandLine.BoolVar(&mtlNumber, "mtlnum", false, "Number materials instead of using names")
+	commandLine.BoolVar(&objOptions.Triangles, "tri", false, "Write triangles instead of quads")
+	commandLine.BoolVar(&objOptions.Normals, "normals", false, "Write a normal for each face")
+	commandLine.BoolVar(&objOptions.TexCoords, "uv", false, "Write texture coordinates for each face, one unit per block")
+	commandLine.BoolVar(&plyOptions.Ascii, "ascii", false, "Write .ply files as text rather than binary")
+	commandLine.BoolVar(&gltfOptions.ChunkNodes, "chunknodes", false, "Give each chunk its own node in .gltf and .glb files")
+	commandLine.StringVar(&texturePack, "textures", "", "Texture the blocks from a resource pack or client jar. Only for .obj output with materials")
+	commandLine.BoolVar(&mmap, "mmap", false, "Memory map region files")
+	commandLine.BoolVar(&index, "index", false, "Keep an index of the world's chunks to start faster next time")
+	commandLine.BoolVar(&heightMaps, "heightmaps", false, "Keep the height of every column in the index too, for map2d. Implies -index")
+	commandLine.BoolVar(&populated, "populated", false, "Skip chunks that haven't finished generating")
+	commandLine.IntVar(&inhabited, "inhabited", 0, "Skip chunks players have spent fewer than this many ticks near. 1200 is a minute")
+	commandLine.StringVar(&contains, "contains", "", "Only use chunks holding one of these comma separated blocks, as id, id:data or name")
 	var showHelp = commandLine.Bool("h", false, "Show Help")
 	commandLine.Parse(os.Args[1:])
 
@@ -159,14 +180,47 @@ func main() {
 		defaultSide = emptySide
 	}
 
-	{
-		var jsonError = loadBlockTypesJson(filepath.Join(exeDir, "blocks.json"))
-		if jsonError != nil {
-			fmt.Fprintln(os.Stderr, "blocks.json error:", jsonError)
+	var palette, jsonError = loadBlockTypesJson(filepath.Join(exeDir, "blocks.json"))
+	if jsonError != nil {
+		fmt.Fprintln(os.Stderr, "blocks.json error:", jsonError)
+		return
+	}
+
+	if texturePack != "" && (prt || noColor || isGltf(outFilename) || isPly(outFilename)) {
+		fmt.Fprintln(os.Stderr, "-textures only applies to .obj output with materials, not with -prt, -g or .gltf, .glb or .ply output")
+		return
+	}
+	if texturePack != "" {
+		var atlas, err = buildTextureAtlas(texturePack, colors)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Textures error:", err)
+			return
+		}
+		// Atlas tiles can't repeat across faces covering several blocks
+		blockFaces = true
+		objOptions.TexCoords = true
+		objOptions.Atlas = atlas
+	}
+
+	var filters []mcworld.ChunkFilter
+	if populated {
+		filters = append(filters, mcworld.PopulatedFilter)
+	}
+	if inhabited > 0 {
+		filters = append(filters, mcworld.InhabitedFilter(inhabited))
+	}
+	if contains != "" {
+		var matcher, err = blocktypes.ParseMatcher(contains, palette)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-contains:", err)
 			return
 		}
+		filters = append(filters, mcworld.ContainsFilter(matcher))
 	}
 
+	// -tri applies to ply files as well
+	plyOptions.Triangles = objOptions.Triangles
+
 	settings := &ProcessingSettings{
 		Prt:          prt,
 		OutFilename:  outFilename,
@@ -177,6 +231,15 @@ func main() {
 		Square:       square,
 		Rectx:        rectx,
 		Rectz:        rectz,
+		Mmap:         mmap,
+		Index:        index || heightMaps,
+		HeightMaps:   heightMaps,
+		ObjOptions:   objOptions,
+		GltfOptions:  gltfOptions,
+		PlyOptions:   plyOptions,
+	}
+	if len(filters) != 0 {
+		settings.Filter = mcworld.AllFilters(filters...)
 	}
 
 	validPath := false
@@ -217,6 +280,13 @@ type ProcessingSettings struct {
 	Cx, Cz       int
 	Square       int
 	Rectx, Rectz int
+	Mmap         bool
+	Index        bool
+	HeightMaps   bool
+	Filter       mcworld.ChunkFilter
+	ObjOptions   ObjOptions
+	GltfOptions  GltfOptions
+	PlyOptions   PlyOptions
 }
 
 func processWorldDir(dirpath string, settings *ProcessingSettings) {
@@ -224,74 +294,73 @@ func processWorldDir(dirpath string, settings *ProcessingSettings) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "World error:", err)
 		return
-	} else if !fi.IsDir() {
-		fmt.Fprintln(os.Stderr, dirpath, "is not a directory")
+	} else if !fi.IsDir() && !mcworld.IsArchive(dirpath) && !mcworld.IsSchematic(dirpath) && !mcworld.IsLevelFile(dirpath) {
+		fmt.Fprintln(os.Stderr, dirpath, "is not a directory, a .zip/.tar.gz archive, a level file or a schematic")
+		return
+	}
+
+	var world, openErr = mcworld.OpenWorld(dirpath)
+	if openErr != nil {
+		fmt.Fprintln(os.Stderr, "World error:", openErr)
+		return
+	}
+	defer mcworld.CloseWorld(world)
+
+	if betaWorld, ok := world.(*mcworld.BetaWorld); ok && settings.Mmap {
+		var err = betaWorld.ConfigureRegionCache(mcworld.DefaultRegionCacheSize, true)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "World error:", err)
+			return
+		}
+	}
+
+	var index *mcworld.WorldIndex
+	if indexer, ok := world.(mcworld.Indexer); ok && settings.Index {
+		index, err = openIndex(dirpath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Index error:", err)
+		} else {
+			index.HeightMaps = settings.HeightMaps
+			indexer.SetIndex(index)
+		}
 	}
 
 	// Pick cx, cz
 	var cx, cz int
 	if settings.ManualCenter {
 		cx, cz = settings.Cx, settings.Cz
-	} else {
-		var file, fileErr = os.Open(filepath.Join(dirpath, "level.dat"))
-		defer file.Close()
-		if fileErr != nil {
-			fmt.Fprintln(os.Stderr, "os.Open", fileErr)
-			return
-		}
-		level, err := nbt.ReadLevelDat(file)
+	} else if levelReader, ok := world.(mcworld.LevelReader); ok {
+		level, err := levelReader.ReadLevel()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "nbt.ReadLevelDat", err)
+			fmt.Fprintln(os.Stderr, "level.dat:", err)
 			return
 		}
-		file.Close()
 		cx, cz = level.SpawnX/16, level.SpawnZ/16
 	}
 
-	// Create ChunkMask
-	var (
-		chunkMask  mcworld.ChunkMask
-		chunkLimit int
-	)
-	if settings.Square != math.MaxInt32 {
-		chunkLimit = settings.Square * settings.Square
-		var h = settings.Square / 2
-		chunkMask = &mcworld.RectangleChunkMask{cx - h, cz - h, cx - h + settings.Square, cz - h + settings.Square}
-	} else if settings.Rectx != math.MaxInt32 || settings.Rectz != math.MaxInt32 {
-		switch {
-		case settings.Rectx != math.MaxInt32 && settings.Rectz != math.MaxInt32:
-			chunkLimit = settings.Rectx * settings.Rectz
-			var (
-				hx = settings.Rectx / 2
-				hz = settings.Rectz / 2
-			)
-			chunkMask = &mcworld.RectangleChunkMask{cx - hx, cz - hz, cx - hx + settings.Rectx, cz - hz + settings.Rectz}
-		case settings.Rectx != math.MaxInt32:
-			chunkLimit = math.MaxInt32
-			var hx = settings.Rectx / 2
-			chunkMask = &mcworld.RectangleChunkMask{cx - hx, math.MinInt32, cx - hx + settings.Rectx, math.MaxInt32}
-		case settings.Rectz != math.MaxInt32:
-			chunkLimit = math.MaxInt32
-			var hz = settings.Rectz / 2
-			chunkMask = &mcworld.RectangleChunkMask{math.MinInt32, cz - hz, math.MaxInt32, cz - hz + settings.Rectz}
-		}
-	} else {
-		chunkLimit = math.MaxInt32
-		chunkMask = &mcworld.AllChunksMask{}
-	}
+	var chunkMask, chunkLimit = mcworld.CenteredChunkMask(cx, cz, settings.Square, settings.Rectx, settings.Rectz)
 
-	var world = mcworld.OpenWorld(dirpath)
 	var pool, poolErr = world.ChunkPool(chunkMask)
 	if poolErr != nil {
 		fmt.Fprintln(os.Stderr, "Chunk pool error:", poolErr)
 		return
 	}
+	if index != nil {
+		if err := index.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "Index error:", err)
+		}
+	}
 
 	var generator OutputGenerator
-	if settings.Prt {
+	switch {
+	case settings.Prt:
 		generator = new(PrtGenerator)
-	} else {
-		generator = new(ObjGenerator)
+	case isGltf(settings.OutFilename):
+		generator = &GltfGenerator{Options: settings.GltfOptions}
+	case isPly(settings.OutFilename):
+		generator = &PlyGenerator{Options: settings.PlyOptions}
+	default:
+		generator = &ObjGenerator{Options: settings.ObjOptions}
 	}
 	var boundary = new(BoundaryLocator)
 	boundary.Init()
@@ -301,7 +370,7 @@ func processWorldDir(dirpath string, settings *ProcessingSettings) {
 		return
 	}
 
-	if walkEnclosedChunks(pool, world, chunkMask, chunkLimit, cx, cz, generator.GetEnclosedJobsChan()) {
+	if walkEnclosedChunks(world, pool, settings.Filter, chunkLimit, cx, cz, generator.GetEnclosedJobsChan()) {
 		<-generator.GetCompleteChan()
 	}
 
@@ -312,6 +381,16 @@ func processWorldDir(dirpath string, settings *ProcessingSettings) {
 	}
 }
 
+// isGltf reports whether an output filename asks for glTF rather than obj.
+func isGltf(filename string) bool {
+	var ext = strings.ToLower(filepath.Ext(filename))
+	return ext == ".gltf" || ext == ".glb"
+}
+
+func isPly(filename string) bool {
+	return strings.ToLower(filepath.Ext(filename)) == ".ply"
+}
+
 type OutputGenerator interface {
 	Start(outFilename string, total int, maxProcs int, boundary *BoundaryLocator) error
 	GetEnclosedJobsChan() chan *EnclosedChunkJob
@@ -324,42 +403,114 @@ type EnclosedChunkJob struct {
 	enclosed *EnclosedChunk
 }
 
-func walkEnclosedChunks(pool mcworld.ChunkPool, opener mcworld.ChunkOpener, chunkMask mcworld.ChunkMask, chunkLimit int, cx, cz int, enclosedsChan chan *EnclosedChunkJob) bool {
+// waitingChunk is a chunk Walk has delivered that is waiting for its
+// neighbours' sides.
+type waitingChunk struct {
+	chunk   *nbt.Chunk
+	arrival int
+}
+
+// walkEnclosedChunks sends each chunk with the sides of its neighbours. The
+// sides are taken from the chunks Walk decodes, so each chunk waits until
+// the neighbours being walked have arrived. Chunks ready at the same time
+// are sent in the order they arrived. Chunks the filter doesn't keep are
+// left out as if masked.
+func walkEnclosedChunks(world mcworld.World, pool mcworld.ChunkPool, filter mcworld.ChunkFilter, chunkLimit int, cx, cz int, enclosedsChan chan *EnclosedChunkJob) bool {
+	// The chunks Walk will deliver, so that chunks don't wait for
+	// neighbours that aren't coming
+	var coords = make([]mcworld.ChunkCoord, 0, pool.Remaining())
+	var walked = make(map[mcworld.ChunkCoord]bool)
+	var it = pool.Iterator(&mcworld.NearestChunkOrder{X: cx, Z: cz})
+	for x, z, ok := it.Next(); ok && len(coords) < chunkLimit; x, z, ok = it.Next() {
+		var c = mcworld.ChunkCoord{X: x, Z: z}
+		coords = append(coords, c)
+		walked[c] = true
+	}
+
 	var (
 		sideCache = new(SideCache)
-		started   = false
+		waiting   = make(map[mcworld.ChunkCoord]*waitingChunk)
+		arrivals  = 0
+		pending   *EnclosedChunkJob
 	)
 
-	for i := 0; moreChunks(pool.Remaining(), chunkLimit); i++ {
-		for x := 0; x < i && moreChunks(pool.Remaining(), chunkLimit); x++ {
-			for z := 0; z < i && moreChunks(pool.Remaining(), chunkLimit); z++ {
-				var (
-					ax = cx + unzigzag(x)
-					az = cz + unzigzag(z)
-				)
-
-				if pool.Pop(ax, az) {
-					loadSide(sideCache, opener, chunkMask, ax-1, az)
-					loadSide(sideCache, opener, chunkMask, ax+1, az)
-					loadSide(sideCache, opener, chunkMask, ax, az-1)
-					loadSide(sideCache, opener, chunkMask, ax, az+1)
-
-					var chunk, loadErr = loadChunk2(opener, ax, az)
-					if loadErr != nil {
-						fmt.Println(loadErr)
-					} else {
-						var enclosed = sideCache.EncloseChunk(chunk)
-						sideCache.AddChunk(chunk)
-						chunkCount++
-						enclosedsChan <- &EnclosedChunkJob{!moreChunks(pool.Remaining(), chunkLimit), enclosed}
-						started = true
-					}
-				}
+	var ready = func(c mcworld.ChunkCoord) bool {
+		for _, n := range neighbours(c) {
+			if walked[n] && !sideCache.HasSide(n.X, n.Z) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// send takes the waiting chunks that are ready, or all of them, and
+	// sends them in the order they arrived
+	var send = func(coords []mcworld.ChunkCoord, all bool) error {
+		var chunks = make([]*waitingChunk, 0, len(coords))
+		for _, c := range coords {
+			if w := waiting[c]; w != nil && (all || ready(c)) {
+				chunks = append(chunks, w)
+				delete(waiting, c)
 			}
 		}
+		sort.Slice(chunks, func(i, j int) bool { return chunks[i].arrival < chunks[j].arrival })
+
+		for _, w := range chunks {
+			if !moreChunks(chunkLimit) {
+				return mcworld.StopWalk
+			}
+			var enclosed = sideCache.EncloseChunk(w.chunk)
+			chunkCount++
+			// Held back a chunk so the last job is marked even when the
+			// chunks after it fail to load
+			if pending != nil {
+				enclosedsChan <- pending
+			}
+			pending = &EnclosedChunkJob{false, enclosed}
+		}
+		return nil
+	}
+
+	var walkErr = mcworld.Walk(world, nil, &mcworld.WalkOptions{Coords: coords}, func(chunk *nbt.Chunk) error {
+		var c = mcworld.ChunkCoord{X: chunk.XPos, Z: chunk.ZPos}
+		if filter != nil && !filter(chunk) {
+			// Left out like a masked chunk, so its neighbours stop waiting
+			walked[c] = false
+			return send(neighbours(c), false)
+		}
+		sideCache.AddChunk(chunk)
+		waiting[c] = &waitingChunk{chunk, arrivals}
+		arrivals++
+		return send(append(neighbours(c), c), false)
+	})
+
+	if chunkErrs, ok := walkErr.(mcworld.ChunkErrors); ok {
+		for _, err := range chunkErrs {
+			fmt.Println(err)
+		}
+		fmt.Printf("%v chunks couldn't be loaded. Run mccheck on the world for details\n", len(chunkErrs))
+	} else if walkErr != nil {
+		fmt.Println(walkErr)
+	}
+
+	// Chunks whose neighbours couldn't be loaded, or weren't reached, go
+	// without those sides
+	var rest = make([]mcworld.ChunkCoord, 0, len(waiting))
+	for c := range waiting {
+		rest = append(rest, c)
+	}
+	send(rest, true)
+
+	if pending == nil {
+		return false
 	}
+	pending.last = true
+	enclosedsChan <- pending
+	return true
+}
 
-	return started
+func neighbours(c mcworld.ChunkCoord) []mcworld.ChunkCoord {
+	return []mcworld.ChunkCoord{{X: c.X - 1, Z: c.Z}, {X: c.X + 1, Z: c.Z}, {X: c.X, Z: c.Z - 1}, {X: c.X, Z: c.Z + 1}}
 }
 
 type Blocks struct {
@@ -378,16 +529,8 @@ func (b *Blocks) Column(x, z int) BlockColumn {
 	return BlockColumn(b.data[i : i+b.height])
 }
 
-func zigzag(n int) int {
-	return (n << 1) ^ (n >> 31)
-}
-
-func unzigzag(n int) int {
-	return (n >> 1) ^ (-(n & 1))
-}
-
-func moreChunks(unprocessedCount, chunkLimit int) bool {
-	return unprocessedCount > 0 && faceCount < faceLimit && chunkCount < chunkLimit
+func moreChunks(chunkLimit int) bool {
+	return faceCount < faceLimit && chunkCount < chunkLimit
 }
 
 func loadChunk(filename string) (*nbt.Chunk, error) {
@@ -403,130 +546,43 @@ func loadChunk(filename string) (*nbt.Chunk, error) {
 	return chunk, err
 }
 
-func loadChunk2(opener mcworld.ChunkOpener, x, z int) (*nbt.Chunk, error) {
-	var r, openErr = opener.OpenChunk(x, z)
-	if openErr != nil {
-		return nil, openErr
+// loadBlockTypesJson fills in the materials and block types from a
+// blocks.json.
+func loadBlockTypesJson(filename string) (*blocktypes.Palette, error) {
+	var palette, err = blocktypes.Load(filename)
+	if err != nil {
+		return nil, err
 	}
-	defer r.Close()
 
-	var chunk, nbtErr = nbt.ReadChunkNbt(r)
-	if nbtErr != nil {
-		return nil, nbtErr
-	}
-	return chunk, nil
-}
+	for _, t := range palette.Types {
+		var blockId = byte(t.Id)
+		var (
+			mass         SingularOrAggregate = Mass
+			transparency Transparency        = Opaque
+		)
+		if t.Item {
+			mass = Item
+		}
+		if t.Transparent {
+			transparency = Transparent
+		}
 
-func loadSide(sideCache *SideCache, opener mcworld.ChunkOpener, chunkMask mcworld.ChunkMask, x, z int) {
-	if !sideCache.HasSide(x, z) && !chunkMask.IsMasked(x, z) {
-		var chunk, loadErr = loadChunk2(opener, x, z)
-		if loadErr != nil {
-			fmt.Println(loadErr)
+		blockTypeMap[blockId] = &BlockType{blockId, mass, transparency, t.Empty}
+		if t.Data == blocktypes.AnyData {
+			colors[blockId] = MTL{blockId, 255, t.Color, t.Name}
 		} else {
-			sideCache.AddChunk(chunk)
+			extraData[blockId] = true
+			colors = append(colors, MTL{blockId, byte(t.Data), t.Color, t.Name})
 		}
 	}
-}
 
-func loadBlockTypesJson(filename string) error {
-	var jsonBytes, jsonIoError = ioutil.ReadFile(filename)
-
-	if jsonIoError != nil {
-		return jsonIoError
-	}
-
-	var f interface{}
-	var unmarshalError = json.Unmarshal(jsonBytes, &f)
-	if unmarshalError != nil {
-		return unmarshalError
-	}
-
-	var lines, linesOk = f.([]interface{})
-	if linesOk {
-		for _, line := range lines {
-			var fields, fieldsOk = line.(map[string]interface{})
-			if fieldsOk {
-				var (
-					blockId      byte
-					data         byte = 255
-					dataArray    []byte
-					name         string
-					mass         SingularOrAggregate = Mass
-					transparency Transparency        = Opaque
-					empty        bool                = false
-					color        uint32
-				)
-				for k, v := range fields {
-					switch k {
-					case "name":
-						name = v.(string)
-					case "color":
-						switch len(v.(string)) {
-						case 7:
-							var n, numErr = strconv.ParseUint(v.(string)[1:], 16, 64)
-							if numErr == nil {
-								color = uint32(n*0x100 + 0xff)
-							}
-						case 9:
-							var n, numErr = strconv.ParseUint(v.(string)[1:], 16, 64)
-							if numErr == nil {
-								color = uint32(n)
-							}
-						}
-					case "blockId":
-						blockId = byte(v.(float64))
-					case "data":
-						switch d := v.(type) {
-						case float64:
-							data = byte(d)
-						case []interface{}:
-							dataArray = make([]byte, len(d))
-							for i, value := range d {
-								dataArray[i] = byte(value.(float64))
-							}
-						}
-					case "item":
-						if v.(bool) {
-							mass = Item
-							transparency = Transparent
-						} else {
-							mass = Mass
-							transparency = Opaque
-						}
-					case "transparent":
-						if v.(bool) {
-							transparency = Transparent
-						} else {
-							transparency = Opaque
-						}
-					case "empty":
-						if v.(bool) {
-							empty = true
-							transparency = Transparent
-							mass = Mass
-						} else {
-							empty = false
-						}
-					}
-				}
+	return palette, nil
+}
 
-				blockTypeMap[blockId] = &BlockType{blockId, mass, transparency, empty}
-				if dataArray == nil {
-					if data != 255 {
-						extraData[blockId] = true
-						colors = append(colors, MTL{blockId, data, color, name})
-					} else {
-						colors[blockId] = MTL{blockId, data, color, name}
-					}
-				} else {
-					extraData[blockId] = true
-					for _, data = range dataArray {
-						colors = append(colors, MTL{blockId, data, color, fmt.Sprintf("%s_%d", name, data)})
-					}
-				}
-			}
-		}
+func openIndex(worldPath string) (*mcworld.WorldIndex, error) {
+	var path, err = mcworld.DefaultIndexPath(worldPath)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return mcworld.OpenIndex(path)
 }
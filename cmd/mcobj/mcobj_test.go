@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"github.com/quag/mcobj/mcworld"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+var loadBlockTypesOnce sync.Once
+
+// setupTest loads blocks.json and resets the globals normally set from the
+// command line.
+func setupTest(t *testing.T) {
+	loadBlockTypesOnce.Do(func() {
+		var _, err = loadBlockTypesJson(filepath.Join("..", "..", "blocks.json"))
+		if err != nil {
+			t.Fatal("blocks.json:", err)
+		}
+	})
+
+	MaterialNamer = new(NameBlockIdNamer)
+	yMin = 0
+	blockFaces = false
+	hideBottom = false
+	noColor = false
+	obj3dsmax = false
+	defaultSide = solidSide
+	faceCount = 0
+	faceLimit = math.MaxInt32
+	chunkCount = 0
+}
+
+// testWorld is a small scene: a stone floor over two chunks with a
+// glass block, a torch, a pool of water and some wool.
+func testWorld() *mcworld.MemoryWorld {
+	var w = mcworld.NewMemoryWorld()
+	w.Fill(-16, 0, 0, 15, 0, 15, 7)   // Bedrock
+	w.Fill(-16, 1, 0, 15, 2, 15, 1)   // Stone
+	w.Fill(-3, 2, 3, -1, 2, 5, 9)     // Water
+	w.SetBlock(2, 3, 2, 20)           // Glass
+	w.SetBlock(4, 3, 4, 50)           // Torch
+	w.SetBlock(6, 3, 6, 35+14<<8)     // Red wool
+	w.Fill(8, 3, 8, 8, 5, 8, 35+1<<8) // Orange wool column
+	return w
+}
+
+func runGenerator(t *testing.T, generator OutputGenerator, world mcworld.World, outFilename string) {
+	var mask = &mcworld.AllChunksMask{}
+	var pool, poolErr = world.ChunkPool(mask)
+	if poolErr != nil {
+		t.Fatal(poolErr)
+	}
+
+	var boundary = new(BoundaryLocator)
+	boundary.Init()
+	if err := generator.Start(outFilename, pool.Remaining(), 1, boundary); err != nil {
+		t.Fatal(err)
+	}
+
+	if walkEnclosedChunks(world, pool, nil, math.MaxInt32, 0, 0, generator.GetEnclosedJobsChan()) {
+		<-generator.GetCompleteChan()
+	}
+
+	if err := generator.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkGolden(t *testing.T, filename, goldenName string) {
+	var actual, err = ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var goldenPath = filepath.Join("testdata", goldenName)
+	if *updateGolden {
+		if err := ioutil.WriteFile(goldenPath, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("%s doesn't match %s (run go test -update to accept changes)", filepath.Base(filename), goldenPath)
+	}
+}
+
+// countingWorld counts how many times each chunk is opened.
+type countingWorld struct {
+	*mcworld.MemoryWorld
+	lock  sync.Mutex
+	opens map[mcworld.ChunkCoord]int
+}
+
+func (w *countingWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
+	w.lock.Lock()
+	w.opens[mcworld.ChunkCoord{X: x, Z: z}]++
+	w.lock.Unlock()
+	return w.MemoryWorld.OpenChunk(x, z)
+}
+
+func TestWalkEnclosedChunksUsesWalkedSides(t *testing.T) {
+	setupTest(t)
+	var world = &countingWorld{MemoryWorld: mcworld.NewMemoryWorld(), opens: make(map[mcworld.ChunkCoord]int)}
+	for x := -1; x <= 1; x++ {
+		for z := -1; z <= 1; z++ {
+			world.SetBlock(16*x+x+1, 1, 16*z+z+1, 1)
+		}
+	}
+	world.SetBlock(-1, 5, 7, 3)
+
+	var pool, err = world.ChunkPool(&mcworld.AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs = make(chan *EnclosedChunkJob, 9)
+	if !walkEnclosedChunks(world, pool, nil, math.MaxInt32, 0, 0, jobs) {
+		t.Fatal("No chunks walked")
+	}
+	close(jobs)
+
+	var count = 0
+	for job := range jobs {
+		count++
+		if job.last != (count == 9) {
+			t.Errorf("Job %v last is %v", count, job.last)
+		}
+		if e := job.enclosed; e.xPos == 0 && e.zPos == 0 {
+			if b := e.Get(-1, 5, 7); b != 3 {
+				t.Errorf("West side block %d not 3", b)
+			}
+			if b := e.Get(16, 5, 7); b != 0 {
+				t.Errorf("East side block %d not air", b)
+			}
+		}
+	}
+	if count != 9 {
+		t.Errorf("%v chunks sent, not 9", count)
+	}
+	for c, n := range world.opens {
+		if n != 1 {
+			t.Errorf("Chunk %v,%v opened %v times", c.X, c.Z, n)
+		}
+	}
+}
+
+func TestWalkEnclosedChunksFilter(t *testing.T) {
+	setupTest(t)
+	var world = mcworld.NewMemoryWorld()
+	for x := -1; x <= 1; x++ {
+		for z := -1; z <= 1; z++ {
+			world.EmptyChunk(x, z).InhabitedTime = 1000 * (x + 1)
+		}
+	}
+	world.SetBlock(-1, 5, 7, 3)
+
+	var pool, err = world.ChunkPool(&mcworld.AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs = make(chan *EnclosedChunkJob, 9)
+	if !walkEnclosedChunks(world, pool, mcworld.InhabitedFilter(1000), math.MaxInt32, 0, 0, jobs) {
+		t.Fatal("No chunks walked")
+	}
+	close(jobs)
+
+	var count = 0
+	for job := range jobs {
+		count++
+		if job.last != (count == 6) {
+			t.Errorf("Job %v last is %v", count, job.last)
+		}
+		if e := job.enclosed; e.xPos == -1 {
+			t.Errorf("Chunk %v,%v not filtered", e.xPos, e.zPos)
+		} else if e.xPos == 0 && e.zPos == 0 {
+			if b := e.Get(-1, 5, 7); b != 1 {
+				t.Errorf("West side block %d not the default side", b)
+			}
+		}
+	}
+	if count != 6 {
+		t.Errorf("%v chunks sent, not 6", count)
+	}
+}
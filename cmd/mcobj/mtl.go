@@ -13,7 +13,9 @@ func printMtl(w io.Writer, blockId nbt.Block) {
 	}
 }
 
-func writeMtlFile(filename string) error {
+// writeMtlFile writes a material for each block. Blocks with textures in
+// the atlas are given them in place of their colour.
+func writeMtlFile(filename string, atlas *TextureAtlas, atlasFilename string) error {
 	if noColor {
 		return nil
 	}
@@ -25,10 +27,14 @@ func writeMtlFile(filename string) error {
 	defer outFile.Close()
 
 	for _, color := range colors {
-		color.Print(outFile)
+		if atlas != nil && atlas.textured(color.colorId()) {
+			color.PrintTextured(outFile, atlasFilename, atlas.translucent[color.colorId()])
+		} else {
+			color.Print(outFile)
+		}
 	}
 
-	return nil
+	return outFile.Close()
 }
 
 type MTL struct {
@@ -49,6 +55,16 @@ func (mtl *MTL) Print(w io.Writer) {
 	fmt.Fprintf(w, "# %s\nnewmtl %s\nKd %.4f %.4f %.4f\nd %.4f\nillum 1\n\n", mtl.name, MaterialNamer.NameBlockId(nbt.Block(mtl.blockId)+nbt.Block(mtl.metadata)*256), float64(r)/255, float64(g)/255, float64(b)/255, float64(a)/255)
 }
 
+// PrintTextured writes the material using the atlas for its colour, and for
+// its transparency if the block's textures aren't opaque.
+func (mtl *MTL) PrintTextured(w io.Writer, atlasFilename string, translucent bool) {
+	fmt.Fprintf(w, "# %s\nnewmtl %s\nKd 1.0000 1.0000 1.0000\nd 1.0000\nmap_Kd %s\n", mtl.name, MaterialNamer.NameBlockId(nbt.Block(mtl.blockId)+nbt.Block(mtl.metadata)*256), atlasFilename)
+	if translucent {
+		fmt.Fprintf(w, "map_d %s\n", atlasFilename)
+	}
+	fmt.Fprintf(w, "illum 1\n\n")
+}
+
 func (mtl *MTL) colorId() nbt.Block {
 	var id = nbt.Block(mtl.blockId)
 	if mtl.metadata != 255 {
@@ -57,6 +73,17 @@ func (mtl *MTL) colorId() nbt.Block {
 	return id
 }
 
+// findMtl returns the material for a block's materialKey, or the one for
+// its id when blocks.json doesn't list its data value.
+func findMtl(key nbt.Block) MTL {
+	for _, mtl := range colors {
+		if mtl.colorId() == key {
+			return mtl
+		}
+	}
+	return colors[key&0xff]
+}
+
 func init() {
 	colors = make([]MTL, 256)
 	for i, _ := range colors {
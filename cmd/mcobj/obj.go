@@ -7,9 +7,24 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
+// ObjOptions add to the faces written for tools that need more than the
+// compact quads written by default.
+type ObjOptions struct {
+	Triangles bool // Split each face into two triangles
+	Normals   bool // Refer each face to a normal
+	TexCoords bool // Give each face texture coordinates, one unit per block
+
+	// Atlas moves the texture coordinates into the tiles of a texture
+	// atlas. Faces must be one block across, as with -bf.
+	Atlas *TextureAtlas
+}
+
 type ObjGenerator struct {
+	Options ObjOptions
+
 	enclosedsChan  chan *EnclosedChunkJob
 	writeFacesChan chan *WriteFacesJob
 	completeChan   chan bool
@@ -37,6 +52,7 @@ func (o *ObjGenerator) Start(outFilename string, total int, maxProcs int, bounda
 		go func() {
 			var faces Faces
 			faces.boundary = boundary
+			faces.options = &o.Options
 			for {
 				var job = <-o.enclosedsChan
 
@@ -67,7 +83,7 @@ func (o *ObjGenerator) Start(outFilename string, total int, maxProcs int, bounda
 				for _, mtl := range job.mtls {
 					printMtl(o.fout, mtl.blockId)
 					for _, face := range mtl.faces {
-						printFaceLine(o.fout, face, vertexBase)
+						printFace(o.fout, mtl.blockId, face, vertexBase, &o.Options)
 					}
 				}
 				o.fout.Flush()
@@ -87,7 +103,14 @@ func (o *ObjGenerator) Start(outFilename string, total int, maxProcs int, bounda
 	}()
 
 	var mtlFilename = fmt.Sprintf("%s.mtl", outFilename[:len(outFilename)-len(filepath.Ext(outFilename))])
-	var mtlErr = writeMtlFile(mtlFilename)
+	var atlasFilename string
+	if o.Options.Atlas != nil {
+		atlasFilename = fmt.Sprintf("%s.png", outFilename[:len(outFilename)-len(filepath.Ext(outFilename))])
+		if err := writePng(atlasFilename, o.Options.Atlas.Image); err != nil {
+			return err
+		}
+	}
+	var mtlErr = writeMtlFile(mtlFilename, o.Options.Atlas, filepath.Base(atlasFilename))
 	if mtlErr != nil {
 		return mtlErr
 	}
@@ -142,6 +165,11 @@ func (o *ObjGenerator) Start(outFilename string, total int, maxProcs int, bounda
 		mw = o.out
 	}
 	fmt.Fprintln(mw, "mtllib", filepath.Base(mtlFilename))
+	if o.Options.Normals {
+		for _, axes := range cubeFaceAxes {
+			fmt.Fprintln(mw, "vn", axes.n.x, axes.n.y, axes.n.z)
+		}
+	}
 
 	o.outFile, outFile = outFile, nil
 	o.voutFile, voutFile = voutFile, nil
@@ -211,6 +239,7 @@ func copyFile(w io.Writer, filename string) error {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	_, err = io.Copy(w, file)
 	return err
@@ -225,25 +254,30 @@ type WriteFacesJob struct {
 
 type Faces struct {
 	xPos, zPos int
+	minY       int
 	count      int
 
 	vertexes Vertexes
 	faces    []IndexFace
 	boundary *BoundaryLocator
+	options  *ObjOptions
 }
 
 func (fs *Faces) ProcessChunk(enclosed *EnclosedChunk, w io.Writer, vw io.Writer) (faceCount, vertexCount int, mtls []*MtlFaces) {
-	fs.clean(enclosed.xPos, enclosed.zPos, enclosed.height())
+	fs.clean(enclosed.xPos, enclosed.zPos, enclosed.minY, enclosed.height())
 	fs.processBlocks(enclosed)
 	vertexCount, mtls = fs.Write(w, vw)
 	return len(fs.faces), vertexCount, mtls
 }
 
-func (fs *Faces) clean(xPos, zPos int, height int) {
+func (fs *Faces) clean(xPos, zPos, minY int, height int) {
 	fs.xPos = xPos
 	fs.zPos = zPos
+	fs.minY = minY
 
-	if fs.vertexes.data == nil {
+	// Chunks of one world can have different heights, such as old chunks
+	// beside those generated since 1.18
+	if fs.vertexes.data == nil || fs.vertexes.height != height {
 		fs.vertexes.data = make([]int16, (height+1)*(16+1)*(16+1))
 		fs.vertexes.height = height
 	} else {
@@ -260,9 +294,61 @@ func (fs *Faces) clean(xPos, zPos int, height int) {
 type IndexFace struct {
 	blockId nbt.Block
 	indexes [4]int
+	normal  int
+	uvs     [4][2]int
+}
+
+type VertexNumFace struct {
+	vertexes [4]int
+	normal   int // index into cubeFaceAxes
+	uvs      [4][2]int
 }
 
-type VertexNumFace [4]int
+// cubeFaceAxes are the directions faces point in, n, and the directions
+// across them that texture coordinates u and v follow, chosen so textures
+// aren't mirrored and the sides of blocks are upright. They are in the
+// order of resourcepack.Faces. When normals are written they are at the top
+// of the file in this order.
+var cubeFaceAxes = [6]struct{ n, u, v Vertex }{
+	{Vertex{-1, 0, 0}, Vertex{0, 0, 1}, Vertex{0, 1, 0}},
+	{Vertex{1, 0, 0}, Vertex{0, 0, -1}, Vertex{0, 1, 0}},
+	{Vertex{0, -1, 0}, Vertex{1, 0, 0}, Vertex{0, 0, 1}},
+	{Vertex{0, 1, 0}, Vertex{1, 0, 0}, Vertex{0, 0, -1}},
+	{Vertex{0, 0, -1}, Vertex{-1, 0, 0}, Vertex{0, 1, 0}},
+	{Vertex{0, 0, 1}, Vertex{1, 0, 0}, Vertex{0, 1, 0}},
+}
+
+func (v Vertex) dot(o Vertex) int {
+	return v.x*o.x + v.y*o.y + v.z*o.z
+}
+
+// faceAxes works out which way a face points from the winding of its
+// corners, which processBlocks gives anticlockwise seen from outside, and
+// the texture coordinates of its corners.
+func faceAxes(corners [4]Vertex) (normal int, uvs [4][2]int) {
+	var (
+		a, b = corners[1], corners[2]
+		e1   = Vertex{a.x - corners[0].x, a.y - corners[0].y, a.z - corners[0].z}
+		e2   = Vertex{b.x - corners[0].x, b.y - corners[0].y, b.z - corners[0].z}
+		n    = Vertex{e1.y*e2.z - e1.z*e2.y, e1.z*e2.x - e1.x*e2.z, e1.x*e2.y - e1.y*e2.x}
+	)
+	for i, axes := range cubeFaceAxes {
+		if axes.n.dot(n) > 0 {
+			normal = i
+			break
+		}
+	}
+
+	var axes = cubeFaceAxes[normal]
+	var minU, minV = corners[0].dot(axes.u), corners[0].dot(axes.v)
+	for _, c := range corners[1:] {
+		minU, minV = min(minU, c.dot(axes.u)), min(minV, c.dot(axes.v))
+	}
+	for i, c := range corners {
+		uvs[i] = [2]int{c.dot(axes.u) - minU, c.dot(axes.v) - minV}
+	}
+	return normal, uvs
+}
 
 type MtlFaces struct {
 	blockId nbt.Block
@@ -270,14 +356,43 @@ type MtlFaces struct {
 }
 
 func (fs *Faces) AddFace(blockId nbt.Block, v1, v2, v3, v4 Vertex) {
-	var face = IndexFace{blockId, [4]int{fs.vertexes.Use(v1), fs.vertexes.Use(v2), fs.vertexes.Use(v3), fs.vertexes.Use(v4)}}
+	var normal, uvs = faceAxes([4]Vertex{v1, v2, v3, v4})
+	var face = IndexFace{blockId, [4]int{fs.vertexes.Use(v1), fs.vertexes.Use(v2), fs.vertexes.Use(v3), fs.vertexes.Use(v4)}, normal, uvs}
 	fs.faces = append(fs.faces, face)
 }
 
 func (fs *Faces) Write(w io.Writer, vw io.Writer) (vertexCount int, mtls []*MtlFaces) {
 	fs.vertexes.Number()
-	var vc = int16(fs.vertexes.Print(io.MultiWriter(w, vw), fs.xPos, fs.zPos))
+	var vc = int16(fs.vertexes.Print(io.MultiWriter(w, vw), fs.xPos, fs.zPos, fs.minY))
+
+	var mfs = fs.groupFaces()
+	for _, mf := range mfs {
+		printMtl(w, mf.blockId)
+		for _, vf := range mf.faces {
+			printFace(w, mf.blockId, vf, -int(vc+1), fs.options)
+			faceCount++
+		}
+	}
+
+	return int(vc), mfs
+}
+
+// ProcessChunkMesh finds the faces of a chunk like ProcessChunk, but gives
+// the positions of the vertexes rather than writing them. Face vertexes
+// count from 1 into positions.
+func (fs *Faces) ProcessChunkMesh(enclosed *EnclosedChunk) (positions []Vertex, mtls []*MtlFaces) {
+	fs.clean(enclosed.xPos, enclosed.zPos, enclosed.minY, enclosed.height())
+	fs.processBlocks(enclosed)
+	fs.vertexes.Number()
+	positions = fs.vertexes.Positions(fs.xPos, fs.zPos, fs.minY)
+	mtls = fs.groupFaces()
+	faceCount += len(fs.faces)
+	return positions, mtls
+}
 
+// groupFaces gathers the faces by material, in the order the materials are
+// first used. The vertexes must be numbered first.
+func (fs *Faces) groupFaces() []*MtlFaces {
 	var blockIds = make([]nbt.Block, 0, 16)
 	for _, face := range fs.faces {
 		var found = false
@@ -296,24 +411,53 @@ func (fs *Faces) Write(w io.Writer, vw io.Writer) (vertexCount int, mtls []*MtlF
 	var mfs = make([]*MtlFaces, 0, len(blockIds))
 
 	for _, blockId := range blockIds {
-		printMtl(w, blockId)
 		var mf = &MtlFaces{blockId, make([]*VertexNumFace, 0, len(fs.faces))}
 		mfs = append(mfs, mf)
 		for _, face := range fs.faces {
 			if face.blockId == blockId {
-				var vf = face.VertexNumFace(fs.vertexes)
-				printFaceLine(w, vf, -int(vc+1))
-				mf.faces = append(mf.faces, vf)
-				faceCount++
+				mf.faces = append(mf.faces, face.VertexNumFace(fs.vertexes))
 			}
 		}
 	}
 
-	return int(vc), mfs
+	return mfs
 }
 
-func printFaceLine(w io.Writer, f *VertexNumFace, offset int) {
-	fmt.Fprintln(w, "f", f[0]+offset, f[1]+offset, f[2]+offset, f[3]+offset)
+// printFace writes a face's f line, or two for triangles. Its texture
+// coordinates are written just before it and referred to relatively, and
+// its normal refers to the vn lines at the top of the file, so neither
+// depends on where in the file the face ends up.
+func printFace(w io.Writer, blockId nbt.Block, f *VertexNumFace, offset int, options *ObjOptions) {
+	if options.TexCoords {
+		for _, uv := range f.uvs {
+			if options.Atlas != nil {
+				var u, v = options.Atlas.texCoords(blockId, f.normal, uv)
+				fmt.Fprintf(w, "vt %.5f %.5f\n", u, v)
+			} else {
+				fmt.Fprintln(w, "vt", uv[0], uv[1])
+			}
+		}
+	}
+
+	var corner = func(i int) string {
+		var s = strconv.Itoa(f.vertexes[i] + offset)
+		switch {
+		case options.TexCoords && options.Normals:
+			s += "/" + strconv.Itoa(i-4) + "/" + strconv.Itoa(f.normal+1)
+		case options.TexCoords:
+			s += "/" + strconv.Itoa(i-4)
+		case options.Normals:
+			s += "//" + strconv.Itoa(f.normal+1)
+		}
+		return s
+	}
+
+	if options.Triangles {
+		fmt.Fprintln(w, "f", corner(0), corner(1), corner(2))
+		fmt.Fprintln(w, "f", corner(0), corner(2), corner(3))
+	} else {
+		fmt.Fprintln(w, "f", corner(0), corner(1), corner(2), corner(3))
+	}
 }
 
 type Vertex struct {
@@ -347,10 +491,13 @@ func (vs *Vertexes) Get(i int) int16 {
 
 func (face *IndexFace) VertexNumFace(vs Vertexes) *VertexNumFace {
 	return &VertexNumFace{
-		int(vs.Get(face.indexes[0])),
-		int(vs.Get(face.indexes[1])),
-		int(vs.Get(face.indexes[2])),
-		int(vs.Get(face.indexes[3]))}
+		[4]int{
+			int(vs.Get(face.indexes[0])),
+			int(vs.Get(face.indexes[1])),
+			int(vs.Get(face.indexes[2])),
+			int(vs.Get(face.indexes[3]))},
+		face.normal,
+		face.uvs}
 }
 
 func (vs *Vertexes) Clear() {
@@ -371,7 +518,7 @@ func (vs *Vertexes) Number() {
 	}
 }
 
-func (vs *Vertexes) Print(w io.Writer, xPos, zPos int) (count int) {
+func (vs *Vertexes) Print(w io.Writer, xPos, zPos, minY int) (count int) {
 	var buf = make([]byte, 64)
 	copy(buf[0:2], "v ")
 
@@ -387,7 +534,7 @@ func (vs *Vertexes) Print(w io.Writer, xPos, zPos int) (count int) {
 
 				var (
 					xa = x + xPos*16
-					ya = y - 64
+					ya = y + minY - 64
 					za = z + zPos*16
 				)
 
@@ -406,6 +553,23 @@ func (vs *Vertexes) Print(w io.Writer, xPos, zPos int) (count int) {
 	return
 }
 
+// Positions lists the used vertexes in the order Number numbered them, in
+// blocks from the world's origin.
+func (vs *Vertexes) Positions(xPos, zPos, minY int) []Vertex {
+	var positions []Vertex
+	for i := 0; i < len(vs.data); i += (vs.height + 1) {
+		var x, z = (i / (vs.height + 1)) / 17, (i / (vs.height + 1)) % 17
+
+		var column = vs.data[i : i+(vs.height+1)]
+		for y, offset := range column {
+			if offset != -1 {
+				positions = append(positions, Vertex{x + xPos*16, y + minY, z + zPos*16})
+			}
+		}
+	}
+	return positions
+}
+
 func appendCoord(buf []byte, x int) []byte {
 	var b [64]byte
 	var j = len(b)
@@ -507,7 +671,7 @@ func (fs *Faces) processBlocks(enclosedChunk *EnclosedChunk) {
 
 		var column = BlockColumn(enclosedChunk.blocks.data[i : i+height])
 		for y, blockId := range column {
-			if y < yMin {
+			if y+enclosedChunk.minY < yMin {
 				continue
 			}
 
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/quag/mcobj/nbt"
+	"path/filepath"
+	"testing"
+)
+
+func TestObjGolden(t *testing.T) {
+	setupTest(t)
+	var dir = t.TempDir()
+	var outFilename = filepath.Join(dir, "world.obj")
+
+	runGenerator(t, new(ObjGenerator), testWorld(), outFilename)
+
+	checkGolden(t, outFilename, "world.obj.golden")
+	checkGolden(t, filepath.Join(dir, "world.mtl"), "world.mtl.golden")
+}
+
+func TestObjBlockFacesGolden(t *testing.T) {
+	setupTest(t)
+	blockFaces = true
+	yMin = 2
+	var outFilename = filepath.Join(t.TempDir(), "world.obj")
+
+	runGenerator(t, new(ObjGenerator), testWorld(), outFilename)
+
+	checkGolden(t, outFilename, "blockfaces.obj.golden")
+}
+
+func TestObjOptionsGolden(t *testing.T) {
+	setupTest(t)
+	var outFilename = filepath.Join(t.TempDir(), "world.obj")
+
+	var generator = &ObjGenerator{Options: ObjOptions{Triangles: true, Normals: true, TexCoords: true}}
+	runGenerator(t, generator, testWorld(), outFilename)
+
+	checkGolden(t, outFilename, "options.obj.golden")
+}
+
+func TestFaceAxes(t *testing.T) {
+	// The faces of a block at the origin as processBlocks winds them
+	var faces = [][4]Vertex{
+		{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}},
+		{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}},
+		{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}},
+		{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}},
+		{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}},
+		{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}},
+	}
+	for i, corners := range faces {
+		var normal, uvs = faceAxes(corners)
+		if normal != i {
+			t.Errorf("Face %d has normal %v", i, cubeFaceAxes[normal].n)
+		}
+		for j, uv := range uvs {
+			if uv[0] < 0 || uv[0] > 1 || uv[1] < 0 || uv[1] > 1 {
+				t.Errorf("Face %d corner %d has texture coordinates %v", i, j, uv)
+			}
+		}
+		// Going round the corners anticlockwise turns the same way in
+		// texture space, so textures aren't mirrored
+		var e1 = [2]int{uvs[1][0] - uvs[0][0], uvs[1][1] - uvs[0][1]}
+		var e2 = [2]int{uvs[2][0] - uvs[0][0], uvs[2][1] - uvs[0][1]}
+		if e1[0]*e2[1]-e1[1]*e2[0] <= 0 {
+			t.Errorf("Face %d has mirrored texture coordinates %v", i, uvs)
+		}
+	}
+
+	// Sides of a column of three blocks are three units high
+	var _, uvs = faceAxes([4]Vertex{{0, 0, 0}, {0, 0, 1}, {0, 3, 1}, {0, 3, 0}})
+	if uvs[2] != [2]int{1, 3} && uvs[3] != [2]int{1, 3} {
+		t.Errorf("Column side texture coordinates %v", uvs)
+	}
+}
+
+func TestAppendCoord(t *testing.T) {
+	var cases = map[int]string{0: "0.00", 20: "1.00", 3: "0.15", -3: "-0.15", -45: "-2.25"}
+	for x, expected := range cases {
+		if s := string(appendCoord(make([]byte, 0, 64), x)); s != expected {
+			t.Errorf("appendCoord(%d) = %q not %q", x, s, expected)
+		}
+	}
+}
+
+func TestFacesMixedHeights(t *testing.T) {
+	setupTest(t)
+	yMin = -64
+	var boundary = new(BoundaryLocator)
+	boundary.Init()
+	var faces = Faces{boundary: boundary, options: new(ObjOptions)}
+	var cache SideCache
+
+	var old = nbt.NewChunk(0, 0, 256)
+	old.SetBlock(3, 70, 3, 1)
+	var tall = nbt.NewChunk(1, 0, 384)
+	tall.MinY = -64
+	tall.SetBlock(3, 64+300, 3, 1)
+	tall.SetBlock(3, 0, 3, 1)
+
+	for _, chunk := range []*nbt.Chunk{old, tall, old} {
+		var positions, _ = faces.ProcessChunkMesh(cache.EncloseChunk(chunk))
+		var top, bottom = positions[0].y, positions[0].y
+		for _, p := range positions {
+			top, bottom = max(top, p.y), min(bottom, p.y)
+		}
+		var expectedTop, expectedBottom = 71, 70
+		if chunk == tall {
+			expectedTop, expectedBottom = 301, -64
+		}
+		if top != expectedTop || bottom != expectedBottom {
+			t.Errorf("Chunk %v,%v vertexes from y %v to %v", chunk.XPos, chunk.ZPos, bottom, top)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/quag/mcobj/ply"
+	"math"
+	"os"
+	"strconv"
+)
+
+// PlyOptions choose how .ply files are written.
+type PlyOptions struct {
+	Ascii     bool // Write text rather than little-endian binary
+	Triangles bool // Split each face into two triangles
+}
+
+// PlyGenerator writes a Stanford .ply file. Each vertex has the colour of
+// the material of its faces, so there is no .mtl file, and vertexes shared
+// by faces of different materials are repeated. Positions match those of
+// obj files. Faces are written to a second file and appended once all the
+// vertexes are written, and then the counts in the header are filled in.
+type PlyGenerator struct {
+	Options PlyOptions
+
+	enclosedsChan chan *EnclosedChunkJob
+	meshesChan    chan *chunkMesh
+	completeChan  chan bool
+
+	total int
+
+	header                 ply.Header
+	outFile, foutFile      *os.File
+	out, fout              *bufio.Writer
+	outFilename, fFilename string
+	buf                    []byte
+
+	vertexCount, faceCount int64
+}
+
+func (o *PlyGenerator) Start(outFilename string, total int, maxProcs int, boundary *BoundaryLocator) error {
+	o.enclosedsChan = make(chan *EnclosedChunkJob, maxProcs*2)
+	o.meshesChan = make(chan *chunkMesh, maxProcs*2)
+	o.completeChan = make(chan bool)
+	o.total = total
+	o.buf = make([]byte, 0, 64)
+
+	for i := 0; i < maxProcs; i++ {
+		go func() {
+			var faces Faces
+			faces.boundary = boundary
+			faces.options = new(ObjOptions)
+			for {
+				var job = <-o.enclosedsChan
+				var positions, mtls = faces.ProcessChunkMesh(job.enclosed)
+				o.meshesChan <- &chunkMesh{job.enclosed.xPos, job.enclosed.zPos, positions, mtls, job.last}
+			}
+		}()
+	}
+
+	go func() {
+		var chunkCount = 0
+		for {
+			var mesh = <-o.meshesChan
+			chunkCount++
+
+			var chunkFaces = 0
+			for _, mtl := range mesh.mtls {
+				chunkFaces += len(mtl.faces)
+				o.addFaces(mtl, mesh.positions)
+			}
+			fmt.Printf("%4v/%-4v (%3v,%3v) Faces: %4d Vertexes: %d\n", chunkCount, o.total, mesh.xPos, mesh.zPos, chunkFaces, o.vertexCount)
+
+			if mesh.last {
+				o.completeChan <- true
+			}
+		}
+	}()
+
+	var format = ply.BinaryLittleEndian
+	if o.Options.Ascii {
+		format = ply.Ascii
+	}
+	var vertexProperties = []string{"float x", "float y", "float z"}
+	if !noColor {
+		vertexProperties = append(vertexProperties, "uchar red", "uchar green", "uchar blue", "uchar alpha")
+	}
+	o.header = ply.Header{
+		Format:   format,
+		Comments: []string{"Written by mcobj"},
+		Elements: []ply.Element{
+			{Name: "vertex", Properties: vertexProperties},
+			{Name: "face", Properties: []string{"list uchar uint vertex_indices"}},
+		},
+	}
+
+	o.outFilename = outFilename
+	o.fFilename = outFilename + ".f"
+
+	var outFile, foutFile *os.File
+	var outErr error
+	outFile, outErr = os.Create(o.outFilename)
+	if outErr != nil {
+		return outErr
+	}
+	defer func() {
+		if outFile != nil {
+			outFile.Close()
+		}
+	}()
+
+	foutFile, outErr = os.Create(o.fFilename)
+	if outErr != nil {
+		return outErr
+	}
+
+	o.out = bufio.NewWriterSize(outFile, 1024*1024)
+	o.fout = bufio.NewWriterSize(foutFile, 1024*1024)
+	if err := o.header.Write(o.out); err != nil {
+		foutFile.Close()
+		return err
+	}
+
+	o.outFile, outFile = outFile, nil
+	o.foutFile = foutFile
+	return nil
+}
+
+func (o *PlyGenerator) GetEnclosedJobsChan() chan *EnclosedChunkJob {
+	return o.enclosedsChan
+}
+
+func (o *PlyGenerator) GetCompleteChan() chan bool {
+	return o.completeChan
+}
+
+// addFaces writes the vertexes of a material's faces in its colour, and
+// the faces using them. Write errors are kept by the buffered writers until
+// Close.
+func (o *PlyGenerator) addFaces(mtl *MtlFaces, positions []Vertex) {
+	var color uint32
+	if !noColor {
+		color = findMtl(materialKey(mtl.blockId)).color
+	}
+
+	// Face vertexes count from 1 within the chunk
+	var indexes = make(map[int]uint32)
+	for _, f := range mtl.faces {
+		var v [4]uint32
+		for i, n := range f.vertexes {
+			var index, ok = indexes[n]
+			if !ok {
+				index = uint32(o.vertexCount)
+				indexes[n] = index
+				o.writeVertex(positions[n-1], color)
+				o.vertexCount++
+			}
+			v[i] = index
+		}
+
+		if o.Options.Triangles {
+			o.writeFace(v[0], v[1], v[2])
+			o.writeFace(v[0], v[2], v[3])
+		} else {
+			o.writeFace(v[:]...)
+		}
+	}
+}
+
+func (o *PlyGenerator) writeVertex(v Vertex, color uint32) {
+	var buf = o.buf[:0]
+	if o.Options.Ascii {
+		buf = appendCoord(buf, v.x)
+		buf = append(buf, ' ')
+		buf = appendCoord(buf, v.y-64)
+		buf = append(buf, ' ')
+		buf = appendCoord(buf, v.z)
+		if !noColor {
+			for shift := 24; shift >= 0; shift -= 8 {
+				buf = append(buf, ' ')
+				buf = strconv.AppendUint(buf, uint64(color>>uint(shift)&0xff), 10)
+			}
+		}
+		buf = append(buf, '\n')
+	} else {
+		for _, c := range []int{v.x, v.y - 64, v.z} {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(c)/20))
+		}
+		if !noColor {
+			buf = binary.BigEndian.AppendUint32(buf, color)
+		}
+	}
+	o.out.Write(buf)
+	o.buf = buf
+}
+
+func (o *PlyGenerator) writeFace(indexes ...uint32) {
+	var buf = o.buf[:0]
+	if o.Options.Ascii {
+		buf = strconv.AppendInt(buf, int64(len(indexes)), 10)
+		for _, index := range indexes {
+			buf = append(buf, ' ')
+			buf = strconv.AppendUint(buf, uint64(index), 10)
+		}
+		buf = append(buf, '\n')
+	} else {
+		buf = append(buf, byte(len(indexes)))
+		for _, index := range indexes {
+			buf = binary.LittleEndian.AppendUint32(buf, index)
+		}
+	}
+	o.fout.Write(buf)
+	o.buf = buf
+	o.faceCount++
+}
+
+func (o *PlyGenerator) Close() error {
+	var err = o.fout.Flush()
+	if closeErr := o.foutFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = copyFile(o.out, o.fFilename)
+	}
+	if err == nil {
+		err = o.out.Flush()
+	}
+	if err == nil {
+		o.header.Elements[0].Count = o.vertexCount
+		o.header.Elements[1].Count = o.faceCount
+		err = o.header.UpdateCounts(o.outFile)
+	}
+	if closeErr := o.outFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(o.fFilename)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlyAsciiGolden(t *testing.T) {
+	setupTest(t)
+	var outFilename = filepath.Join(t.TempDir(), "world.ply")
+
+	runGenerator(t, &PlyGenerator{Options: PlyOptions{Ascii: true}}, testWorld(), outFilename)
+
+	checkGolden(t, outFilename, "world.ply.golden")
+	if _, err := os.Stat(outFilename + ".f"); err == nil {
+		t.Error("Faces file not removed")
+	}
+}
+
+func TestPlyBinaryTriangles(t *testing.T) {
+	setupTest(t)
+	var outFilename = filepath.Join(t.TempDir(), "world.ply")
+
+	runGenerator(t, &PlyGenerator{Options: PlyOptions{Triangles: true}}, testWorld(), outFilename)
+
+	var data, err = ioutil.ReadFile(outFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var end = bytes.Index(data, []byte("end_header\n"))
+	if end == -1 {
+		t.Fatal("No end_header")
+	}
+	var header, body = string(data[:end]), data[end+len("end_header\n"):]
+
+	var vertexes, faces int
+	for _, line := range bytes.Split([]byte(header), []byte("\n")) {
+		fmt.Sscanf(string(line), "element vertex %d", &vertexes)
+		fmt.Sscanf(string(line), "element face %d", &faces)
+	}
+	if !bytes.HasPrefix(data, []byte("ply\nformat binary_little_endian 1.0\n")) {
+		t.Errorf("Header\n%s", header)
+	}
+	if faces != 2*faceCount {
+		t.Errorf("%v triangles for %v faces", faces, faceCount)
+	}
+	if len(body) != vertexes*16+faces*13 {
+		t.Fatalf("%v bytes for %v vertexes and %v faces", len(body), vertexes, faces)
+	}
+
+	for i := vertexes * 16; i < len(body); i += 13 {
+		if body[i] != 3 {
+			t.Fatalf("Face with %v vertexes", body[i])
+		}
+		for j := 0; j < 3; j++ {
+			if index := binary.LittleEndian.Uint32(body[i+1+4*j:]); int(index) >= vertexes {
+				t.Fatalf("Index %v of %v vertexes", index, vertexes)
+			}
+		}
+	}
+}
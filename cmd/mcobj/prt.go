@@ -5,6 +5,7 @@ import (
 	"compress/zlib"
 	"encoding/binary"
 	"fmt"
+	"github.com/quag/mcobj/prt"
 	"io"
 	"os"
 )
@@ -41,7 +42,10 @@ func (o *PrtGenerator) Start(outFilename string, total int, maxProcs int, bounda
 	}
 
 	o.w = bufio.NewWriter(o.outFile)
-	WriteHeader(o.w, -1, []ChannelDefinition{{"Position", 4, 3, 0}, {"BlockID", 1, 1, 12}})
+	prt.WriteHeader(o.w, -1, []prt.ChannelDefinition{
+		{Name: "Position", DataType: prt.Float32, Arity: 3, Offset: 0},
+		{Name: "BlockID", DataType: prt.Int32, Arity: 1, Offset: 12},
+	})
 
 	var zErr error
 	o.zw, zErr = zlib.NewWriterLevel(o.w, zlib.NoCompression)
@@ -65,7 +69,7 @@ func (o *PrtGenerator) chunkProcessor() {
 
 			var column = BlockColumn(e.blocks.data[i : i+height])
 			for y, blockId := range column {
-				if y < yMin {
+				if y+e.minY < yMin {
 					continue
 				}
 
@@ -84,7 +88,7 @@ func (o *PrtGenerator) chunkProcessor() {
 					o.particleCount++
 					var (
 						xa = x + e.xPos*16
-						ya = y - 64
+						ya = y + e.minY - 64
 						za = -(z + e.zPos*16)
 					)
 					binary.Write(o.zw, binary.LittleEndian, float32(xa))
@@ -108,7 +112,7 @@ func (o *PrtGenerator) chunkProcessor() {
 func (o *PrtGenerator) Close() error {
 	o.zw.Close()
 	o.w.Flush()
-	UpdateParticleCount(o.outFile, o.particleCount)
+	prt.UpdateParticleCount(o.outFile, o.particleCount)
 	o.outFile.Close()
 	return nil
 }
@@ -120,65 +124,3 @@ func (o *PrtGenerator) GetEnclosedJobsChan() chan *EnclosedChunkJob {
 func (o *PrtGenerator) GetCompleteChan() chan bool {
 	return o.completeChan
 }
-
-type ChannelDefinition struct {
-	Name                    string // max of 31 characters and must meet the regex [a-zA-Z_][0-9a-zA-Z_]*
-	DataType, Arity, Offset int32
-}
-
-// http://software.primefocusworld.com/software/support/krakatoa/prt_file_format.php
-// http://www.thinkboxsoftware.com/krak-prt-file-format/
-func WriteHeader(w io.Writer, particleCount int64, channels []ChannelDefinition) {
-	// Header (56 bytes)
-	var magic = []byte{192, 'P', 'R', 'T', '\r', '\n', 26, '\n'}
-	w.Write(magic)
-
-	var headerLength = uint32(56)
-	binary.Write(w, binary.LittleEndian, headerLength)
-
-	var signature = make([]byte, 32)
-	copy(signature, []byte("Extensible Particle Format"))
-	w.Write(signature)
-
-	var version = uint32(1)
-	binary.Write(w, binary.LittleEndian, version)
-
-	binary.Write(w, binary.LittleEndian, particleCount)
-
-	// Reserved bytes (4 bytes)
-	var reserved = int32(4)
-	binary.Write(w, binary.LittleEndian, reserved)
-
-	// Channel definition header (8 bytes)
-	binary.Write(w, binary.LittleEndian, int32(len(channels)))
-
-	var channelDefinitionSize = int32(44)
-	binary.Write(w, binary.LittleEndian, channelDefinitionSize)
-
-	for _, channel := range channels {
-		var nameBytes = make([]byte, 32)
-		copy(nameBytes, []byte(channel.Name))
-		w.Write(nameBytes)
-
-		binary.Write(w, binary.LittleEndian, channel.DataType)
-		binary.Write(w, binary.LittleEndian, channel.Arity)
-		binary.Write(w, binary.LittleEndian, channel.Offset)
-	}
-}
-
-func UpdateParticleCount(file *os.File, particleCount int64) error {
-	var storedOffset, err = file.Seek(0, 1)
-	if err != nil {
-		return err
-	}
-	_, err = file.Seek(0x30, 0)
-	if err != nil {
-		return err
-	}
-	err = binary.Write(file, binary.LittleEndian, particleCount)
-	if err != nil {
-		return err
-	}
-	_, err = file.Seek(storedOffset, 0)
-	return err
-}
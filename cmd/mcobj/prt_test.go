@@ -0,0 +1,15 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPrtGolden(t *testing.T) {
+	setupTest(t)
+	var outFilename = filepath.Join(t.TempDir(), "world.prt")
+
+	runGenerator(t, new(PrtGenerator), testWorld(), outFilename)
+
+	checkGolden(t, outFilename, "world.prt.golden")
+}
@@ -21,7 +21,7 @@ func (s *SideCache) AddChunk(chunk *nbt.Chunk) {
 		s.chunks = make(map[uint64]*ChunkSidesData)
 	}
 
-	s.chunks[s.key(chunk.XPos, chunk.ZPos)] = calculateSides(wrapBlockData(chunk.Blocks))
+	s.chunks[s.key(chunk.XPos, chunk.ZPos)] = calculateSides(wrapBlockData(chunk.Blocks), chunk.MinY)
 }
 
 func wrapBlockData(data []nbt.Block) Blocks {
@@ -40,6 +40,7 @@ func (s *SideCache) EncloseChunk(chunk *nbt.Chunk) *EnclosedChunk {
 	return &EnclosedChunk{
 		chunk.XPos,
 		chunk.ZPos,
+		chunk.MinY,
 		wrapBlockData(chunk.Blocks),
 		EnclosingSides{
 			s.getSide(chunk.XPos-1, chunk.ZPos, 1),
@@ -50,8 +51,8 @@ func (s *SideCache) EncloseChunk(chunk *nbt.Chunk) *EnclosedChunk {
 	}
 }
 
-func calculateSides(blocks Blocks) *ChunkSidesData {
-	var sides = &ChunkSidesData{NewChunkSide(blocks.height), NewChunkSide(blocks.height), NewChunkSide(blocks.height), NewChunkSide(blocks.height)}
+func calculateSides(blocks Blocks, minY int) *ChunkSidesData {
+	var sides = &ChunkSidesData{NewChunkSide(minY, blocks.height), NewChunkSide(minY, blocks.height), NewChunkSide(minY, blocks.height), NewChunkSide(minY, blocks.height)}
 	for i := 0; i < 16; i++ {
 		copy(sides[0].Column(i), blocks.Column(0, i))
 		copy(sides[1].Column(i), blocks.Column(15, i))
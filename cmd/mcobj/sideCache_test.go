@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/quag/mcobj/nbt"
+	"testing"
+)
+
+func TestSideCacheEnclosesNeighbours(t *testing.T) {
+	setupTest(t)
+	var (
+		cache  SideCache
+		center = nbt.NewChunk(0, 0, 16)
+		west   = nbt.NewChunk(-1, 0, 16)
+		south  = nbt.NewChunk(0, 1, 16)
+	)
+	west.SetBlock(15, 3, 7, 1)
+	south.SetBlock(9, 4, 0, 2)
+
+	cache.AddChunk(west)
+	cache.AddChunk(south)
+	if !cache.HasSide(-1, 0) || cache.HasSide(1, 0) {
+		t.Error("HasSide doesn't match the added chunks")
+	}
+
+	var enclosed = cache.EncloseChunk(center)
+	if b := enclosed.Get(-1, 3, 7); b != 1 {
+		t.Errorf("West side block %d not 1", b)
+	}
+	if b := enclosed.Get(9, 4, 16); b != 2 {
+		t.Errorf("South side block %d not 2", b)
+	}
+	if b := enclosed.Get(16, 0, 0); b != solidSide.blockId {
+		t.Errorf("Missing east side block %d not %d", b, solidSide.blockId)
+	}
+	if b := enclosed.Get(0, 16, 0); b != 0 {
+		t.Errorf("Block above the chunk %d not air", b)
+	}
+}
+
+func TestSideCacheReleasesUsedSides(t *testing.T) {
+	setupTest(t)
+	var cache SideCache
+	cache.AddChunk(nbt.NewChunk(0, 0, 16))
+
+	cache.EncloseChunk(nbt.NewChunk(-1, 0, 16))
+	cache.EncloseChunk(nbt.NewChunk(1, 0, 16))
+	cache.EncloseChunk(nbt.NewChunk(0, -1, 16))
+	if !cache.HasSide(0, 0) {
+		t.Error("Chunk released before all its sides were used")
+	}
+
+	cache.EncloseChunk(nbt.NewChunk(0, 1, 16))
+	if cache.HasSide(0, 0) {
+		t.Error("Chunk kept after all its sides were used")
+	}
+}
+
+func TestSideCacheMixedHeights(t *testing.T) {
+	setupTest(t)
+	var (
+		cache SideCache
+		old   = nbt.NewChunk(-1, 0, 256)
+		tall  = nbt.NewChunk(0, 0, 384)
+		east  = nbt.NewChunk(1, 0, 384)
+	)
+	tall.MinY, east.MinY = -64, -64
+	old.SetBlock(15, 70, 7, 1)
+	east.SetBlock(0, 10, 7, 2)
+
+	cache.AddChunk(old)
+	cache.AddChunk(east)
+	var enclosed = cache.EncloseChunk(tall)
+	// Sides are matched by world y, and are air beyond the shorter chunk
+	if b := enclosed.Get(-1, 64+70, 7); b != 1 {
+		t.Errorf("West side block at y 70 %d not 1", b)
+	}
+	if b := enclosed.Get(-1, 10, 7); b != 0 {
+		t.Errorf("West side block below the old chunk %d not air", b)
+	}
+	if b := enclosed.Get(-1, 383, 7); b != 0 {
+		t.Errorf("West side block above the old chunk %d not air", b)
+	}
+
+	cache.AddChunk(tall)
+	enclosed = cache.EncloseChunk(old)
+	if b := enclosed.Get(16, 70, 7); b != 0 {
+		t.Errorf("East side block at y 70 %d not air", b)
+	}
+	if b := enclosed.Get(16, 0, 7); b != 0 {
+		t.Errorf("East side block at y 0 %d not air", b)
+	}
+}
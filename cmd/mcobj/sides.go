@@ -10,6 +10,8 @@ var (
 	defaultSide = solidSide
 )
 
+// ChunkSide is the column of blocks along one edge of a chunk. y is a
+// world y, as neighbouring chunks can start at different heights.
 type ChunkSide interface {
 	BlockId(x, y int) nbt.Block
 }
@@ -22,11 +24,12 @@ func (s *FixedChunkSide) BlockId(x, y int) nbt.Block {
 	return s.blockId
 }
 
-func NewChunkSide(height int) *ChunkSideData {
-	return &ChunkSideData{make([]nbt.Block, height*16)}
+func NewChunkSide(minY, height int) *ChunkSideData {
+	return &ChunkSideData{minY, make([]nbt.Block, height*16)}
 }
 
 type ChunkSideData struct {
+	minY int
 	data []nbt.Block
 }
 
@@ -36,7 +39,12 @@ func (s *ChunkSideData) index(x, y int) int {
 	return y + (x * s.height())
 }
 
+// BlockId is air above and below the chunk's blocks.
 func (s *ChunkSideData) BlockId(x, y int) nbt.Block {
+	y -= s.minY
+	if y < 0 || y >= s.height() {
+		return 0
+	}
 	return s.data[s.index(x, y)]
 }
 
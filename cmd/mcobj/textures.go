@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"github.com/quag/mcobj/resourcepack"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+)
+
+// TextureAtlas packs the block textures of a resource pack into one image.
+// Each material has a tile for each direction its faces point in.
+type TextureAtlas struct {
+	Image *image.NRGBA
+
+	tileSize    int
+	cols, rows  int
+	tiles       map[nbt.Block][6]int // by materialKey, in cubeFaceAxes order
+	translucent map[nbt.Block]bool
+}
+
+// buildTextureAtlas reads the textures for the materials from a resource
+// pack or client jar. Materials whose block has no model in the pack keep
+// their flat colour. Tile 0 is white so their faces can still be given
+// texture coordinates.
+func buildTextureAtlas(filename string, materials []MTL) (*TextureAtlas, error) {
+	var pack, err = resourcepack.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer pack.Close()
+
+	var (
+		atlas     = &TextureAtlas{tiles: make(map[nbt.Block][6]int), translucent: make(map[nbt.Block]bool)}
+		images    = []image.Image{nil}
+		tileIndex = make(map[string]int)
+	)
+	for _, mtl := range materials {
+		var key = mtl.colorId()
+		var textures, found = pack.BlockTextures(key)
+		if !found {
+			continue
+		}
+
+		var tiles [6]int
+		for i, texture := range textures {
+			if texture.Path == "" {
+				continue
+			}
+			var tile, seen = tileIndex[texture.Key()]
+			if !seen {
+				var img, err = pack.ReadTexture(texture)
+				if err != nil {
+					continue
+				}
+				if atlas.tileSize == 0 {
+					atlas.tileSize = img.Bounds().Dx()
+				}
+				tile = len(images)
+				images = append(images, img)
+				tileIndex[texture.Key()] = tile
+			}
+			tiles[i] = tile
+			if !resourcepack.Opaque(images[tile]) {
+				atlas.translucent[key] = true
+			}
+		}
+		atlas.tiles[key] = fillMissingTiles(tiles)
+	}
+
+	if len(images) == 1 {
+		return nil, errors.New(fmt.Sprintf("%v has no textures for any of the blocks in blocks.json", filename))
+	}
+	atlas.pack(images)
+	return atlas, nil
+}
+
+// fillMissingTiles gives the directions that have no texture one of the
+// others, so a block with only a side texture still has a top.
+func fillMissingTiles(tiles [6]int) [6]int {
+	var some = 0
+	for _, tile := range tiles {
+		if tile != 0 {
+			some = tile
+			break
+		}
+	}
+	for i := range tiles {
+		if tiles[i] == 0 {
+			tiles[i] = some
+		}
+	}
+	return tiles
+}
+
+// pack lays the tiles out in a grid as near square as possible. Textures
+// are cut to their first frame and scaled to the size of the first.
+func (a *TextureAtlas) pack(images []image.Image) {
+	a.cols = int(math.Ceil(math.Sqrt(float64(len(images)))))
+	a.rows = (len(images) + a.cols - 1) / a.cols
+	a.Image = image.NewNRGBA(image.Rect(0, 0, a.cols*a.tileSize, a.rows*a.tileSize))
+
+	for i, img := range images {
+		var x0, y0 = (i % a.cols) * a.tileSize, (i / a.cols) * a.tileSize
+		for y := 0; y < a.tileSize; y++ {
+			for x := 0; x < a.tileSize; x++ {
+				var c color.Color = color.White
+				if img != nil {
+					var frame = resourcepack.FirstFrame(img)
+					c = img.At(frame.Min.X+x*frame.Dx()/a.tileSize, frame.Min.Y+y*frame.Dy()/a.tileSize)
+				}
+				a.Image.Set(x0+x, y0+y, c)
+			}
+		}
+	}
+}
+
+func (a *TextureAtlas) textured(block nbt.Block) bool {
+	var _, ok = a.tiles[materialKey(block)]
+	return ok
+}
+
+// texCoords maps texture coordinates across a face, from 0 to 1, into the
+// block's tile for the direction the face points in. Coordinates are kept
+// half a texel inside the tile so neighbouring tiles don't bleed in.
+func (a *TextureAtlas) texCoords(block nbt.Block, normal int, uv [2]int) (u, v float64) {
+	var tile = a.tiles[materialKey(block)][normal]
+	var (
+		col, row = tile % a.cols, a.rows - 1 - tile/a.cols
+		inset    = 0.5 / float64(a.tileSize)
+	)
+	u = (float64(col) + inset + float64(uv[0])*(1-2*inset)) / float64(a.cols)
+	v = (float64(row) + inset + float64(uv[1])*(1-2*inset)) / float64(a.rows)
+	return u, v
+}
+
+// materialKey is the block a block's material is recorded under: the id
+// alone unless blocks.json gives the id's data values their own materials.
+func materialKey(block nbt.Block) nbt.Block {
+	if extraData[byte(block&0xff)] {
+		return block
+	}
+	return block & 0xff
+}
+
+func writePng(filename string, img image.Image) error {
+	var file, err = os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
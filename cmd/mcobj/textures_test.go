@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"github.com/quag/mcobj/resourcepack"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestPack writes a resource pack with stone, grass and glass, using
+// block states, parent models and tints the way Minecraft's own do.
+func writeTestPack(t *testing.T, filename string) {
+	var file, err = os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var zw = zip.NewWriter(file)
+
+	var files = map[string]string{
+		"assets/minecraft/blockstates/stone.json":       `{"variants": {"": {"model": "minecraft:block/stone"}}}`,
+		"assets/minecraft/blockstates/grass_block.json": `{"variants": {"snowy=true": {"model": "minecraft:block/grass_block_snow"}, "snowy=false": [{"model": "minecraft:block/grass_block"}, {"model": "minecraft:block/grass_block", "y": 90}]}}`,
+		"assets/minecraft/models/block/cube.json":       `{"elements": [{"from": [0, 0, 0], "to": [16, 16, 16], "faces": {"down": {"texture": "#down"}, "up": {"texture": "#up"}, "north": {"texture": "#north"}, "south": {"texture": "#south"}, "west": {"texture": "#west"}, "east": {"texture": "#east"}}}]}`,
+		"assets/minecraft/models/block/cube_all.json":   `{"parent": "block/cube", "textures": {"particle": "#all", "down": "#all", "up": "#all", "north": "#all", "south": "#all", "west": "#all", "east": "#all"}}`,
+		"assets/minecraft/models/block/stone.json":      `{"parent": "minecraft:block/cube_all", "textures": {"all": "minecraft:block/stone"}}`,
+		"assets/minecraft/models/block/glass.json":      `{"parent": "minecraft:block/cube_all", "textures": {"all": "minecraft:block/glass"}}`,
+		"assets/minecraft/models/block/grass_block.json": `{"parent": "block/block", "textures": {"bottom": "block/dirt", "top": "block/grass_block_top", "side": "block/grass_block_side"},
+			"elements": [{"from": [0, 0, 0], "to": [16, 16, 16], "faces": {"down": {"texture": "#bottom"}, "up": {"texture": "#top", "tintindex": 0}, "north": {"texture": "#side"}, "south": {"texture": "#side"}, "west": {"texture": "#side"}, "east": {"texture": "#side"}}}]}`,
+	}
+	for name, content := range files {
+		var w, err = zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+
+	var textures = map[string]color.NRGBA{
+		"stone":            {0x80, 0x80, 0x80, 0xff},
+		"dirt":             {0x86, 0x60, 0x43, 0xff},
+		"grass_block_top":  {0xff, 0xff, 0xff, 0xff},
+		"grass_block_side": {0x70, 0x60, 0x40, 0xff},
+		"glass":            {0xc0, 0xe0, 0xff, 0x40},
+	}
+	for name, c := range textures {
+		// Grass sides are twice the size of the rest, and stone is animated
+		var w, h = 16, 16
+		switch name {
+		case "grass_block_side":
+			w, h = 32, 32
+		case "stone":
+			h = 32
+		}
+		var img = image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		var pw, err = zw.Create("assets/minecraft/textures/block/" + name + ".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(pw, img)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTextureAtlas(t *testing.T) {
+	setupTest(t)
+	var packFilename = filepath.Join(t.TempDir(), "pack.zip")
+	writeTestPack(t, packFilename)
+
+	var atlas, err = buildTextureAtlas(packFilename, colors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tileColor = func(tile int) color.NRGBA {
+		var x, y = (tile%atlas.cols)*atlas.tileSize + 3, (tile/atlas.cols)*atlas.tileSize + 3
+		return atlas.Image.NRGBAAt(x, y)
+	}
+
+	var stone = atlas.tiles[1]
+	for _, tile := range stone {
+		if tile != stone[0] || tileColor(tile) != (color.NRGBA{0x80, 0x80, 0x80, 0xff}) {
+			t.Errorf("Stone tiles %v", stone)
+		}
+	}
+
+	var grass = atlas.tiles[2]
+	if c := tileColor(grass[3]); c != resourcepack.GrassTint {
+		t.Errorf("Grass top %v not tinted %v", c, resourcepack.GrassTint)
+	}
+	if c := tileColor(grass[2]); c != (color.NRGBA{0x86, 0x60, 0x43, 0xff}) {
+		t.Errorf("Grass bottom %v not dirt", c)
+	}
+	if grass[0] != grass[4] || grass[0] == grass[3] || tileColor(grass[0]) != (color.NRGBA{0x70, 0x60, 0x40, 0xff}) {
+		t.Errorf("Grass tiles %v", grass)
+	}
+
+	if !atlas.textured(20) || !atlas.translucent[20] || atlas.translucent[1] {
+		t.Errorf("Glass textured %v translucent %v, stone translucent %v", atlas.textured(20), atlas.translucent[20], atlas.translucent[1])
+	}
+	if atlas.textured(4) {
+		t.Errorf("Cobblestone textured without a model")
+	}
+
+	var dir = t.TempDir()
+	var outFilename = filepath.Join(dir, "world.obj")
+	blockFaces = true
+	runGenerator(t, &ObjGenerator{Options: ObjOptions{TexCoords: true, Atlas: atlas}}, testWorld(), outFilename)
+
+	if _, err := os.Stat(filepath.Join(dir, "world.png")); err != nil {
+		t.Error("Atlas not written:", err)
+	}
+	mtl, err := ioutil.ReadFile(filepath.Join(dir, "world.mtl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(mtl), "newmtl Stone\nKd 1.0000 1.0000 1.0000\nd 1.0000\nmap_Kd world.png\nillum") {
+		t.Error("Stone material not textured")
+	}
+	if !strings.Contains(string(mtl), "map_d world.png") {
+		t.Error("Glass material has no map_d")
+	}
+	obj, err := ioutil.ReadFile(outFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(obj), "\nvt 0.") || !strings.Contains(string(obj), "/-4 ") {
+		t.Error("Faces have no texture coordinates")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/resourcepack"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var (
+		blocksPath = flag.String("blocks", "", "blocks.json to merge the colours into. Defaults to the one beside mcpalette")
+		outPath    = flag.String("o", "", "File to write the new blocks.json to. Defaults to standard output")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mcpalette [-blocks blocks.json] [-o blocks.json] <resource pack .zip or client .jar>")
+		os.Exit(2)
+	}
+
+	var path = *blocksPath
+	if path == "" {
+		exeDir, _ := filepath.Split(strings.Replace(os.Args[0], "\\", "/", -1))
+		path = filepath.Join(exeDir, "blocks.json")
+	}
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "blocks.json:", err)
+		os.Exit(2)
+	}
+
+	pack, err := resourcepack.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer pack.Close()
+
+	merged, missing, err := mergeColors(jsonBytes, pack.BlockColor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "blocks.json:", err)
+		os.Exit(1)
+	}
+	if len(missing) != 0 {
+		fmt.Fprintln(os.Stderr, "Kept the colours of blocks without textures:", strings.Join(missing, ", "))
+	}
+
+	if *outPath == "" {
+		_, err = os.Stdout.Write(merged)
+	} else {
+		err = ioutil.WriteFile(*outPath, merged, 0666)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
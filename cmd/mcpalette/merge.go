@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/nbt"
+	"image/color"
+	"regexp"
+	"strconv"
+)
+
+var colorField = regexp.MustCompile(`"color"\s*:\s*"([^"]*)"`)
+
+type entry struct {
+	BlockId int
+	Data    interface{}
+	Name    string
+}
+
+// block is the block whose textures colour the entry. Entries with a list
+// of data values share a look, so the first stands for them all.
+func (e *entry) block() nbt.Block {
+	var data = 0
+	switch d := e.Data.(type) {
+	case float64:
+		data = int(d)
+	case []interface{}:
+		if len(d) != 0 {
+			if n, ok := d[0].(float64); ok {
+				data = int(n)
+			}
+		}
+	}
+	return nbt.Block(e.BlockId + data<<8)
+}
+
+// mergeColors gives each entry of a blocks.json the colour colorOf finds for
+// its block, returning the new file and the names of the entries it had no
+// colour for. Only the colours change, so the rest of the file keeps its
+// layout. Entries keep the alpha they had, as it says how see-through the
+// block is drawn rather than what it looks like.
+func mergeColors(jsonBytes []byte, colorOf func(nbt.Block) (color.NRGBA, bool)) ([]byte, []string, error) {
+	if _, err := blocktypes.Parse(jsonBytes); err != nil {
+		return nil, nil, err
+	}
+
+	var dec = json.NewDecoder(bytes.NewReader(jsonBytes))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		merged  bytes.Buffer
+		missing []string
+		last    int64
+	)
+	for dec.More() {
+		var start = dec.InputOffset()
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, err
+		}
+		var end = dec.InputOffset()
+
+		var e entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, nil, err
+		}
+
+		merged.Write(jsonBytes[last:start])
+		last = end
+
+		var c, ok = colorOf(e.block())
+		if !ok {
+			missing = append(missing, e.Name)
+			merged.Write(jsonBytes[start:end])
+			continue
+		}
+		var object, err = setColor(jsonBytes[start:end], c)
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Block type %q: %v", e.Name, err))
+		}
+		merged.Write(object)
+	}
+	merged.Write(jsonBytes[last:])
+	return merged.Bytes(), missing, nil
+}
+
+// setColor replaces the colour in the text of a blocks.json entry, or adds
+// one before the closing brace of entries without.
+func setColor(object []byte, c color.NRGBA) ([]byte, error) {
+	var m = colorField.FindSubmatchIndex(object)
+	if m == nil {
+		var end = bytes.LastIndexByte(object, '}')
+		var field = fmt.Sprintf(`, "color": %q`, formatColor(c))
+		return append(append(append([]byte{}, object[:end]...), field...), object[end:]...), nil
+	}
+
+	var old = string(object[m[2]:m[3]])
+	c.A = 0xff
+	if len(old) == 9 {
+		var a, err = strconv.ParseUint(old[7:], 16, 8)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Bad colour %q", old))
+		}
+		c.A = uint8(a)
+	}
+	return append(append(append([]byte{}, object[:m[2]]...), formatColor(c)...), object[m[3]:]...), nil
+}
+
+// formatColor writes #rrggbb, or #rrggbbaa for see-through colours.
+func formatColor(c color.NRGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
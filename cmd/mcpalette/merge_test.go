@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/quag/mcobj/nbt"
+	"image/color"
+	"testing"
+)
+
+func TestMergeColors(t *testing.T) {
+	var blocksJson = `[
+{"blockId": 0,                      "name": "Air",          "color": "#fefeff01", "empty": true },
+{"blockId": 1,                      "name": "Stone",        "color": "#7d7d7d"                  },
+{"blockId": 20,                     "name": "Glass",        "color": "#ffffff40"                },
+{"blockId": 35, "data": 14,         "name": "Wool14"                                            },
+{"blockId": 6,  "data": [1,5,9,13], "name": "Sapling.Spruce", "color": "#779656", "item": true }
+]
+`
+	var colors = map[nbt.Block]color.NRGBA{
+		1:          {0x80, 0x81, 0x82, 0xff},
+		20:         {0xc0, 0xe0, 0xff, 0x80},
+		35 + 14<<8: {0xa0, 0x27, 0x22, 0xff},
+		6 + 1<<8:   {0x2e, 0x48, 0x2e, 0xc0},
+	}
+
+	var merged, missing, err = mergeColors([]byte(blocksJson), func(block nbt.Block) (color.NRGBA, bool) {
+		var c, ok = colors[block]
+		return c, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = `[
+{"blockId": 0,                      "name": "Air",          "color": "#fefeff01", "empty": true },
+{"blockId": 1,                      "name": "Stone",        "color": "#808182"                  },
+{"blockId": 20,                     "name": "Glass",        "color": "#c0e0ff40"                },
+{"blockId": 35, "data": 14,         "name": "Wool14"                                            , "color": "#a02722"},
+{"blockId": 6,  "data": [1,5,9,13], "name": "Sapling.Spruce", "color": "#2e482e", "item": true }
+]
+`
+	if string(merged) != expected {
+		t.Errorf("Merged\n%s\nnot\n%s", merged, expected)
+	}
+	if len(missing) != 1 || missing[0] != "Air" {
+		t.Errorf("Missing %v", missing)
+	}
+
+	if _, _, err := mergeColors([]byte(`[{"name": "NoId"}]`), nil); err == nil {
+		t.Error("Merged a block type without a blockId")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/mcworld"
+	"github.com/quag/mcobj/nbt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var (
+		outDir    = flag.String("o", "", "Directory for the pruned world. Defaults to the world's name with -pruned added")
+		cx        = flag.Int("cx", 0, "Center x coordinate in chunks. Defaults to the spawn")
+		cz        = flag.Int("cz", 0, "Center z coordinate in chunks. Defaults to the spawn")
+		square    = flag.Int("s", math.MaxInt32, "Chunk square size")
+		rectx     = flag.Int("rx", math.MaxInt32, "Width(x) of rectangle size")
+		rectz     = flag.Int("rz", math.MaxInt32, "Height(z) of rectangle size")
+		inhabited = flag.Int("inhabited", 0, "Remove chunks players have spent fewer than this many ticks near. 1200 is a minute")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mcprune [-s 20 | -rx 10 -rz 30] [-inhabited 1200] [-o dir] <world directory or backup .zip/.tar.gz>")
+		os.Exit(2)
+	}
+	var worldPath = flag.Arg(0)
+
+	world, err := mcworld.OpenWorld(worldPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(world)
+
+	betaWorld, ok := world.(*mcworld.BetaWorld)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Only worlds with region files can be pruned")
+		os.Exit(2)
+	}
+
+	var manualCenter = false
+	flag.Visit(func(f *flag.Flag) {
+		manualCenter = manualCenter || f.Name == "cx" || f.Name == "cz"
+	})
+	if !manualCenter {
+		level, err := betaWorld.ReadLevel()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "level.dat:", err)
+			os.Exit(2)
+		}
+		*cx, *cz = level.SpawnX/16, level.SpawnZ/16
+	}
+	var mask, _ = mcworld.CenteredChunkMask(*cx, *cz, *square, *rectx, *rectz)
+
+	var dir = *outDir
+	if dir == "" {
+		dir = filepath.Clean(worldPath)
+		for _, ext := range []string{".gz", ".tar", ".zip"} {
+			dir = strings.TrimSuffix(dir, ext)
+		}
+		dir += "-pruned"
+	}
+	if _, err := os.Stat(dir); err == nil {
+		fmt.Fprintln(os.Stderr, dir, "already exists")
+		os.Exit(2)
+	}
+
+	// Only the overworld is pruned as the other dimensions don't line up
+	// with its chunks
+	var isOverworld = func(name string) bool {
+		return strings.Count(name, "/") == 1
+	}
+	var isOverworldRegion = func(name string) bool {
+		return isOverworld(name) && (mcworld.IsRegionFile(name) || mcworld.IsChunkDataFile(name))
+	}
+
+	err = betaWorld.CopyFiles(dir, isOverworldRegion)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "CopyFiles:", err)
+		os.Exit(1)
+	}
+
+	var kept, removed int
+	var keptChunks = make(map[mcworld.ChunkCoord]bool)
+	err = betaWorld.EachRegion(func(name string, rx, rz int, data []byte) error {
+		if !isOverworld(name) {
+			return nil
+		}
+
+		var pruned, k, r = mcworld.PruneRegion(data, rx, rz, func(x, z int, chunk *nbt.Chunk) bool {
+			// Chunks that can't be read are kept unless the mask rules them out
+			var keep = !mask.IsMasked(x, z) && (chunk == nil || chunk.InhabitedTime >= *inhabited)
+			if keep {
+				keptChunks[mcworld.ChunkCoord{X: x, Z: z}] = true
+			}
+			return keep
+		})
+		kept += k
+		removed += r
+		if k == 0 {
+			return nil
+		}
+
+		return pruned.WriteFile(filepath.Join(dir, filepath.FromSlash(name)))
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Prune:", err)
+		os.Exit(1)
+	}
+
+	// The entities and points of interest of the chunks that were removed
+	// go with them
+	err = betaWorld.EachChunkDataRegion(func(name string, rx, rz int, data []byte) error {
+		if !isOverworld(name) {
+			return nil
+		}
+
+		var pruned, k, _ = mcworld.PruneRegion(data, rx, rz, func(x, z int, chunk *nbt.Chunk) bool {
+			return keptChunks[mcworld.ChunkCoord{X: x, Z: z}]
+		})
+		if k == 0 {
+			return nil
+		}
+
+		return pruned.WriteFile(filepath.Join(dir, filepath.FromSlash(name)))
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Prune:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%v chunks kept, %v removed. Written to %v\n", kept, removed, dir)
+}
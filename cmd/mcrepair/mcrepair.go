@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/mcworld"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var (
+		outDir  = flag.String("o", "", "Directory to write the repaired world to. Defaults to the world's name with -repaired added")
+		inPlace = flag.Bool("inplace", false, "Rewrite the region files in the world itself rather than a copy")
+		salvage = flag.Bool("salvage", false, "Scan unused sectors for chunks whose location entries are lost")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mcrepair [-salvage] [-o dir | -inplace] <world directory or backup .zip/.tar.gz>")
+		os.Exit(2)
+	}
+	var worldPath = flag.Arg(0)
+
+	world, err := mcworld.OpenWorld(worldPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(world)
+
+	betaWorld, ok := world.(*mcworld.BetaWorld)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Only worlds with region files can be repaired")
+		os.Exit(2)
+	}
+
+	var dir = *outDir
+	if *inPlace {
+		if fi, err := os.Stat(worldPath); err != nil || !fi.IsDir() {
+			fmt.Fprintln(os.Stderr, "-inplace needs a world directory")
+			os.Exit(2)
+		}
+		dir = worldPath
+	} else {
+		if dir == "" {
+			dir = filepath.Clean(worldPath)
+			for _, ext := range []string{".gz", ".tar", ".zip"} {
+				dir = strings.TrimSuffix(dir, ext)
+			}
+			dir += "-repaired"
+		}
+		if _, err := os.Stat(dir); err == nil {
+			fmt.Fprintln(os.Stderr, dir, "already exists")
+			os.Exit(2)
+		}
+		err = betaWorld.CopyFiles(dir, mcworld.IsRegionFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "CopyFiles:", err)
+			os.Exit(1)
+		}
+	}
+
+	var total mcworld.RegionRepair
+	err = betaWorld.EachRegion(func(name string, rx, rz int, data []byte) error {
+		var repaired, repair = mcworld.RepairRegion(data, rx, rz, *salvage)
+		if repair.Dropped != 0 || repair.Salvaged != 0 {
+			fmt.Printf("%v: %v chunks dropped, %v salvaged\n", name, repair.Dropped, repair.Salvaged)
+		}
+		total.Kept += repair.Kept
+		total.Dropped += repair.Dropped
+		total.Salvaged += repair.Salvaged
+		total.OldSize += repair.OldSize
+		total.NewSize += repair.NewSize
+
+		return repaired.WriteFile(filepath.Join(dir, filepath.FromSlash(name)))
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Repair:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%v chunks kept, %v dropped, %v salvaged. Regions went from %.1fMB to %.1fMB\n", total.Kept, total.Dropped, total.Salvaged, float64(total.OldSize)/1024/1024, float64(total.NewSize)/1024/1024)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/mcworld"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+	var (
+		cx         = flag.Int("cx", 0, "Center x coordinate in chunks. Defaults to the spawn")
+		cz         = flag.Int("cz", 0, "Center z coordinate in chunks. Defaults to the spawn")
+		square     = flag.Int("s", math.MaxInt32, "Chunk square size")
+		rectx      = flag.Int("rx", math.MaxInt32, "Width(x) of rectangle size")
+		rectz      = flag.Int("rz", math.MaxInt32, "Height(z) of rectangle size")
+		blocksPath = flag.String("blocks", "", "blocks.json to name the blocks with. Defaults to the one beside mcstats")
+		report     = flag.String("report", "blocks", "Report to write: blocks, heights, chunks or biomes")
+		format     = flag.String("format", "table", "Output format: table, csv or json")
+		ids        = flag.String("ids", "", "Comma separated blocks, as id, id:data or name, for the heights and chunks reports")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mcstats [-s 20 | -rx 10 -rz 30] [-report blocks|heights|chunks|biomes] [-format table|csv|json] [-ids 14,15,56] <world directory or backup .zip/.tar.gz>")
+		os.Exit(2)
+	}
+
+	var write func(w io.Writer, t *table) error
+	switch *format {
+	case "table":
+		write = writeTable
+	case "csv":
+		write = writeCsv
+	case "json":
+		write = writeJson
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown format", *format)
+		os.Exit(2)
+	}
+
+	var path = *blocksPath
+	if path == "" {
+		exeDir, _ := filepath.Split(strings.Replace(os.Args[0], "\\", "/", -1))
+		path = filepath.Join(exeDir, "blocks.json")
+	}
+	palette, err := blocktypes.Load(path)
+	if err != nil {
+		// Blocks are still counted, just by number
+		fmt.Fprintln(os.Stderr, "blocks.json:", err)
+		palette = nil
+	}
+
+	var filter blocktypes.Matcher
+	if *ids != "" {
+		filter, err = blocktypes.ParseMatcher(*ids, palette)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-ids:", err)
+			os.Exit(2)
+		}
+	}
+
+	world, err := mcworld.OpenWorld(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "OpenWorld:", err)
+		os.Exit(2)
+	}
+	defer mcworld.CloseWorld(world)
+
+	var manualCenter = false
+	flag.Visit(func(f *flag.Flag) {
+		manualCenter = manualCenter || f.Name == "cx" || f.Name == "cz"
+	})
+	if levelReader, ok := world.(mcworld.LevelReader); ok && !manualCenter {
+		if level, err := levelReader.ReadLevel(); err == nil {
+			*cx, *cz = level.SpawnX/16, level.SpawnZ/16
+		}
+	}
+	var mask, _ = mcworld.CenteredChunkMask(*cx, *cz, *square, *rectx, *rectz)
+
+	var s = newStats(filter)
+	err = mcworld.Walk(world, mask, &mcworld.WalkOptions{Unordered: true}, func(chunk *nbt.Chunk) error {
+		s.add(chunk)
+		return nil
+	})
+	if chunkErrs, ok := err.(mcworld.ChunkErrors); ok {
+		fmt.Fprintf(os.Stderr, "%v chunks couldn't be read\n", len(chunkErrs))
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Walk:", err)
+		os.Exit(1)
+	}
+
+	var t *table
+	switch *report {
+	case "blocks":
+		t = blocksReport(s, palette)
+	case "heights":
+		t = heightsReport(s, palette)
+	case "chunks":
+		t = chunksReport(s)
+	case "biomes":
+		t = biomesReport(s)
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown report", *report)
+		os.Exit(2)
+	}
+
+	if err := write(os.Stdout, t); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// table is a report ready to be written out in any of the formats.
+type table struct {
+	header []string
+	rows   [][]interface{}
+}
+
+func (t *table) add(row ...interface{}) {
+	t.rows = append(t.rows, row)
+}
+
+func blocksReport(s *stats, palette *blocktypes.Palette) *table {
+	var t = &table{header: []string{"name", "id", "data", "count", "percent"}}
+	var total = s.total()
+	for _, block := range s.sortedBlocks() {
+		if s.filter != nil && !s.filter(block) {
+			continue
+		}
+		var n = s.blocks[block]
+		t.add(palette.Name(block), int(block&0xff), int(block>>8), n, percent(float64(n), float64(total)))
+	}
+	return t
+}
+
+// heightsReport lists how many of each block there are at each y, leaving
+// out the heights a block isn't found at.
+func heightsReport(s *stats, palette *blocktypes.Palette) *table {
+	var t = &table{header: []string{"y", "name", "id", "data", "count"}}
+	var blocks = s.sortedBlocks()
+	var maxHeight = 0
+	for _, column := range s.heights {
+		maxHeight = max(maxHeight, len(column))
+	}
+	for y := 0; y < maxHeight; y++ {
+		for _, block := range blocks {
+			if s.filter == nil && block == 0 || s.filter != nil && !s.filter(block) {
+				continue
+			}
+			if column := s.heights[block]; y < len(column) && column[y] != 0 {
+				t.add(y+s.minY, palette.Name(block), int(block&0xff), int(block>>8), column[y])
+			}
+		}
+	}
+	return t
+}
+
+func chunksReport(s *stats) *table {
+	var t = &table{header: []string{"x", "z", "count", "density"}}
+	sort.Slice(s.density, func(i, j int) bool {
+		var a, b = s.density[i], s.density[j]
+		if a.z != b.z {
+			return a.z < b.z
+		}
+		return a.x < b.x
+	})
+	for _, d := range s.density {
+		t.add(d.x, d.z, d.count, percent(float64(d.count), float64(d.volume)))
+	}
+	return t
+}
+
+func biomesReport(s *stats) *table {
+	var t = &table{header: []string{"name", "id", "columns", "percent"}}
+	var biomes = make([]int, 0, len(s.biomes))
+	var total float64
+	for biome, n := range s.biomes {
+		biomes = append(biomes, biome)
+		total += n
+	}
+	sort.Slice(biomes, func(i, j int) bool {
+		var a, b = s.biomes[biomes[i]], s.biomes[biomes[j]]
+		if a != b {
+			return a > b
+		}
+		return biomes[i] < biomes[j]
+	})
+	for _, biome := range biomes {
+		t.add(nbt.BiomeName(biome), biome, int64(math.Round(s.biomes[biome])), percent(s.biomes[biome], total))
+	}
+	return t
+}
+
+func percent(n, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(10000*n/total) / 100
+}
+
+func writeTable(w io.Writer, t *table) error {
+	var tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		var fields = make([]string, len(row))
+		for i, value := range row {
+			fields[i] = fmt.Sprint(value)
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCsv(w io.Writer, t *table) error {
+	var cw = csv.NewWriter(w)
+	cw.Write(t.header)
+	for _, row := range t.rows {
+		var fields = make([]string, len(row))
+		for i, value := range row {
+			fields[i] = fmt.Sprint(value)
+		}
+		cw.Write(fields)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJson(w io.Writer, t *table) error {
+	var objects = make([]map[string]interface{}, len(t.rows))
+	for i, row := range t.rows {
+		objects[i] = make(map[string]interface{})
+		for j, value := range row {
+			objects[i][t.header[j]] = value
+		}
+	}
+	var encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(objects)
+}
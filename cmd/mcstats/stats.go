@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/nbt"
+	"sort"
+)
+
+// stats holds the counts gathered from the walked chunks. Only the blocks
+// matching the filter, or every block but air when there is no filter, are
+// counted towards each chunk's density.
+type stats struct {
+	chunks  int
+	blocks  map[nbt.Block]int64
+	heights map[nbt.Block][]int64 // indexed by y - minY
+	minY    int
+	density []chunkDensity
+	biomes  map[int]float64
+	filter  blocktypes.Matcher
+}
+
+type chunkDensity struct {
+	x, z   int
+	count  int
+	volume int
+}
+
+func newStats(filter blocktypes.Matcher) *stats {
+	return &stats{
+		blocks:  make(map[nbt.Block]int64),
+		heights: make(map[nbt.Block][]int64),
+		density: make([]chunkDensity, 0),
+		biomes:  make(map[int]float64),
+		filter:  filter,
+	}
+}
+
+func (s *stats) add(chunk *nbt.Chunk) {
+	s.chunks++
+
+	if chunk.MinY < s.minY {
+		// Worlds upgraded to 1.18 have chunks reaching below 0 among older
+		// ones that don't
+		for block, column := range s.heights {
+			s.heights[block] = append(make([]int64, s.minY-chunk.MinY), column...)
+		}
+		s.minY = chunk.MinY
+	}
+
+	var height = chunk.Height()
+	var top = chunk.MinY - s.minY + height
+	var counted = 0
+	for i, block := range chunk.Blocks {
+		s.blocks[block]++
+
+		var y = chunk.MinY - s.minY + i%height
+		var column, ok = s.heights[block]
+		if !ok {
+			column = make([]int64, top)
+			s.heights[block] = column
+		} else if len(column) < top {
+			column = append(column, make([]int64, top-len(column))...)
+			s.heights[block] = column
+		}
+		column[y]++
+
+		if s.filter == nil && block != 0 || s.filter != nil && s.filter(block) {
+			counted++
+		}
+	}
+	s.density = append(s.density, chunkDensity{chunk.XPos, chunk.ZPos, counted, len(chunk.Blocks)})
+
+	// Biomes are counted in columns, so chunks with a biome per 4x4x4 cell
+	// weigh the same as those with one per column
+	for _, biome := range chunk.Biomes {
+		if biome < 0 {
+			continue
+		}
+		s.biomes[biome] += 256 / float64(len(chunk.Biomes))
+	}
+}
+
+// sortedBlocks returns the counted blocks, most common first.
+func (s *stats) sortedBlocks() []nbt.Block {
+	var blocks = make([]nbt.Block, 0, len(s.blocks))
+	for block := range s.blocks {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		var a, b = s.blocks[blocks[i]], s.blocks[blocks[j]]
+		if a != b {
+			return a > b
+		}
+		return blocks[i] < blocks[j]
+	})
+	return blocks
+}
+
+func (s *stats) total() int64 {
+	var total int64
+	for _, n := range s.blocks {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/quag/mcobj/blocktypes"
+	"github.com/quag/mcobj/mcworld"
+	"github.com/quag/mcobj/nbt"
+	"path/filepath"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var palette, err = blocktypes.Load(filepath.Join("..", "..", "blocks.json"))
+	if err != nil {
+		t.Fatal("blocks.json:", err)
+	}
+
+	var w = mcworld.NewMemoryWorld()
+	w.Fill(0, 0, 0, 31, 1, 15, 1) // Stone
+	w.SetBlock(3, 1, 3, 56)       // Diamond ore
+	w.SetBlock(20, 0, 4, 56)
+	w.SetBlock(20, 1, 5, 15) // Iron ore
+	w.Chunk(0, 0).Biomes = make([]int, 256)
+	w.Chunk(1, 0).Biomes = make([]int, 1024)
+	for i := range w.Chunk(1, 0).Biomes {
+		w.Chunk(1, 0).Biomes[i] = 2
+	}
+
+	filter, err := blocktypes.ParseMatcher("DiamondOre,15:0", palette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s = newStats(filter)
+	err = mcworld.Walk(w, &mcworld.AllChunksMask{}, &mcworld.WalkOptions{Unordered: true}, func(chunk *nbt.Chunk) error {
+		s.add(chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.chunks != 2 || s.blocks[56] != 2 || s.blocks[15] != 1 || s.blocks[1] != 2*16*16*2-3 {
+		t.Errorf("Counts: %v chunks, %v", s.chunks, s.blocks)
+	}
+	if s.heights[56][0] != 1 || s.heights[56][1] != 1 {
+		t.Errorf("Diamond ore heights: %v", s.heights[56])
+	}
+
+	var chunks = chunksReport(s)
+	if len(chunks.rows) != 2 || chunks.rows[0][2] != 1 || chunks.rows[1][2] != 2 {
+		t.Errorf("Chunk densities: %v", chunks.rows)
+	}
+
+	var biomes = biomesReport(s)
+	if len(biomes.rows) != 2 || biomes.rows[0][2] != int64(256) || biomes.rows[0][3] != 50.0 {
+		t.Errorf("Biomes: %v", biomes.rows)
+	}
+
+	var out bytes.Buffer
+	if err := writeJson(&out, blocksReport(s, palette)); err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["name"] != "DiamondOre" || rows[0]["count"] != 2.0 || rows[1]["name"] != "IronOre" {
+		t.Errorf("Blocks report: %v", rows)
+	}
+}
+
+func TestStatsBelowZero(t *testing.T) {
+	var s = newStats(nil)
+
+	var old = nbt.NewChunk(0, 0, 128)
+	old.SetBlock(0, 5, 0, 56)
+	s.add(old)
+
+	var deep = nbt.NewChunk(1, 0, 384)
+	deep.MinY = -64
+	deep.SetBlock(0, 0, 0, 56)
+	deep.SetBlock(0, 69, 0, 56)
+	s.add(deep)
+
+	var heights = heightsReport(s, nil)
+	if len(heights.rows) != 2 || heights.rows[0][0] != -64 || heights.rows[1][0] != 5 || heights.rows[1][4] != int64(2) {
+		t.Errorf("Heights: %v", heights.rows)
+	}
+}
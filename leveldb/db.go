@@ -0,0 +1,322 @@
+// Package leveldb reads LevelDB databases, such as the db folder of a
+// Bedrock Edition world. Databases are opened read only and are never
+// compacted or written to.
+package leveldb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound        = errors.New("Key not found")
+	ErrCorruptManifest = errors.New("Corrupt LevelDB manifest")
+)
+
+type DB struct {
+	dir    string
+	levels [][]*tableInfo
+	mem    map[string]memEntry
+	lock   sync.Mutex // Guards opening tables
+}
+
+type memEntry struct {
+	sequence uint64
+	deleted  bool
+	value    []byte
+}
+
+type tableInfo struct {
+	number            uint64
+	smallest, largest []byte
+	table             *table
+}
+
+// Open reads the manifest and write-ahead log of the database in dir.
+// Tables are opened when first needed.
+func Open(dir string) (*DB, error) {
+	var current, err = ioutil.ReadFile(filepath.Join(dir, "CURRENT"))
+	if err != nil {
+		return nil, err
+	}
+
+	var db = &DB{dir: dir, mem: make(map[string]memEntry)}
+	var logNumber, manifestErr = db.readManifest(strings.TrimSpace(string(current)))
+	if manifestErr != nil {
+		return nil, manifestErr
+	}
+
+	// Logs at or after the manifest's log number hold writes that haven't
+	// been compacted into tables yet
+	var logs, globErr = filepath.Glob(filepath.Join(dir, "*.log"))
+	if globErr != nil {
+		return nil, globErr
+	}
+	sort.Slice(logs, func(i, j int) bool { return fileNumber(logs[i]) < fileNumber(logs[j]) })
+	for _, name := range logs {
+		if fileNumber(name) >= logNumber {
+			if err := db.readLog(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return db, nil
+}
+
+func fileNumber(name string) uint64 {
+	var base = filepath.Base(name)
+	var n, _ = strconv.ParseUint(strings.TrimSuffix(base, filepath.Ext(base)), 10, 64)
+	return n
+}
+
+// Manifest entries are version edits: the files added to and removed from
+// each level since the last edit.
+const (
+	editComparator     = 1
+	editLogNumber      = 2
+	editNextFile       = 3
+	editLastSequence   = 4
+	editCompactPointer = 5
+	editDeletedFile    = 6
+	editNewFile        = 7
+	editPrevLogNumber  = 9
+)
+
+func (db *DB) readManifest(name string) (uint64, error) {
+	var data, err = ioutil.ReadFile(filepath.Join(db.dir, name))
+	if err != nil {
+		return 0, err
+	}
+
+	var entries, logErr = readLogEntries(data)
+	if logErr != nil {
+		return 0, logErr
+	}
+
+	var logNumber uint64
+	var files = make(map[uint64]*tableInfo)
+	var fileLevels = make(map[uint64]int)
+
+	for _, entry := range entries {
+		var r = &byteReader{data: entry}
+		for !r.done() {
+			switch r.uvarint() {
+			case editComparator:
+				r.lengthPrefixed()
+			case editLogNumber:
+				logNumber = r.uvarint()
+			case editNextFile, editLastSequence, editPrevLogNumber:
+				r.uvarint()
+			case editCompactPointer:
+				r.uvarint()
+				r.lengthPrefixed()
+			case editDeletedFile:
+				r.uvarint()
+				delete(files, r.uvarint())
+			case editNewFile:
+				var level = int(r.uvarint())
+				var info = &tableInfo{number: r.uvarint()}
+				r.uvarint() // File size
+				info.smallest = r.lengthPrefixed()
+				info.largest = r.lengthPrefixed()
+				files[info.number] = info
+				fileLevels[info.number] = level
+			default:
+				return 0, ErrCorruptManifest
+			}
+		}
+		if r.err != nil {
+			return 0, ErrCorruptManifest
+		}
+	}
+
+	for number, info := range files {
+		var level = fileLevels[number]
+		for len(db.levels) <= level {
+			db.levels = append(db.levels, nil)
+		}
+		db.levels[level] = append(db.levels[level], info)
+	}
+
+	// Newer level 0 files win over older ones. Other levels don't overlap
+	// so are sorted by key
+	for level, infos := range db.levels {
+		if level == 0 {
+			sort.Slice(infos, func(i, j int) bool { return infos[i].number > infos[j].number })
+		} else {
+			sort.Slice(infos, func(i, j int) bool { return bytes.Compare(infos[i].smallest, infos[j].smallest) < 0 })
+		}
+	}
+
+	return logNumber, nil
+}
+
+// readLog applies the write batches in a write-ahead log to the memory
+// table.
+func (db *DB) readLog(name string) error {
+	var data, err = ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	var entries, logErr = readLogEntries(data)
+	if logErr != nil {
+		return errors.New(fmt.Sprintf("%v: %v", name, logErr))
+	}
+
+	for _, batch := range entries {
+		var r = &byteReader{data: batch}
+		var sequence = r.fixed64()
+		var count = int(r.fixed32())
+		for i := 0; i < count && r.err == nil; i++ {
+			var kind = r.byte()
+			var key = string(r.lengthPrefixed())
+			var entry = memEntry{sequence: sequence + uint64(i), deleted: kind == kindDeletion}
+			if kind == kindValue {
+				entry.value = r.lengthPrefixed()
+			}
+			if old, ok := db.mem[key]; !ok || old.sequence <= entry.sequence {
+				db.mem[key] = entry
+			}
+		}
+		if r.err != nil {
+			return errors.New(fmt.Sprintf("%v: %v", name, ErrCorruptLog))
+		}
+	}
+
+	return nil
+}
+
+func (info *tableInfo) covers(key []byte) bool {
+	return bytes.Compare(key, internalUserKey(info.smallest)) >= 0 && bytes.Compare(key, internalUserKey(info.largest)) <= 0
+}
+
+func (db *DB) open(info *tableInfo) (*table, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if info.table != nil {
+		return info.table, nil
+	}
+
+	var name = filepath.Join(db.dir, fmt.Sprintf("%06d.ldb", info.number))
+	var t, err = openTable(name)
+	if err != nil {
+		// Older databases name their tables .sst
+		var sstTable, sstErr = openTable(filepath.Join(db.dir, fmt.Sprintf("%06d.sst", info.number)))
+		if sstErr != nil {
+			return nil, err
+		}
+		t = sstTable
+	}
+
+	info.table = t
+	return t, nil
+}
+
+// Get returns the value of the key, or ErrNotFound. It is safe to call from
+// many goroutines at once.
+func (db *DB) Get(key []byte) ([]byte, error) {
+	if entry, ok := db.mem[string(key)]; ok {
+		if entry.deleted {
+			return nil, ErrNotFound
+		}
+		return entry.value, nil
+	}
+
+	for _, infos := range db.levels {
+		for _, info := range infos {
+			if !info.covers(key) {
+				continue
+			}
+
+			var t, err = db.open(info)
+			if err != nil {
+				return nil, err
+			}
+			value, deleted, found, err := t.get(key)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				if deleted {
+					return nil, ErrNotFound
+				}
+				return value, nil
+			}
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// Keys returns every key in the database in sorted order. Every table is
+// read, so this is slow on large databases.
+func (db *DB) Keys() ([][]byte, error) {
+	type version struct {
+		sequence uint64
+		deleted  bool
+	}
+	var newest = make(map[string]version)
+
+	var add = func(key string, v version) {
+		if old, ok := newest[key]; !ok || old.sequence < v.sequence {
+			newest[key] = v
+		}
+	}
+
+	for key, entry := range db.mem {
+		add(key, version{entry.sequence, entry.deleted})
+	}
+
+	for _, infos := range db.levels {
+		for _, info := range infos {
+			var t, err = db.open(info)
+			if err != nil {
+				return nil, err
+			}
+			err = t.each(func(key, value []byte) error {
+				add(string(internalUserKey(key)), version{internalSequence(key), internalKind(key) == kindDeletion})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var keys = make([][]byte, 0, len(newest))
+	for key, v := range newest {
+		if !v.deleted {
+			keys = append(keys, []byte(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys, nil
+}
+
+func (db *DB) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var firstErr error
+	for _, infos := range db.levels {
+		for _, info := range infos {
+			if info.table != nil {
+				if err := info.table.Close(); err != nil && firstErr == nil {
+					firstErr = err
+				}
+				info.table = nil
+			}
+		}
+	}
+	return firstErr
+}
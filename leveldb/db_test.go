@@ -0,0 +1,246 @@
+package leveldb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	// Level 1 holds the oldest data, level 0 overrides it and the log
+	// overrides both
+	writeTable(t, filepath.Join(dir, "000004.ldb"), compressionSnappy, []testEntry{
+		{"apple", 1, kindValue, "old apple"},
+		{"banana", 2, kindValue, "banana"},
+		{"cherry", 3, kindValue, "cherry"},
+	})
+	writeTable(t, filepath.Join(dir, "000005.ldb"), compressionZlib, []testEntry{
+		{"apple", 4, kindValue, "new apple"},
+		{"cherry", 5, kindDeletion, ""},
+	})
+	writeTable(t, filepath.Join(dir, "000006.sst"), compressionNone, []testEntry{
+		{"zebra", 6, kindValue, "zebra"},
+	})
+
+	var manifest []byte
+	manifest = appendEdit(manifest, 1, 4, "apple", 1, "cherry", 3)
+	manifest = appendEdit(manifest, 0, 5, "apple", 4, "cherry", 5)
+	manifest = appendEdit(manifest, 2, 6, "zebra", 6, "zebra", 6)
+	manifest = binary.AppendUvarint(manifest, editLogNumber)
+	manifest = binary.AppendUvarint(manifest, 7)
+	writeLog(t, filepath.Join(dir, "MANIFEST-000002"), [][]byte{manifest})
+	ioutil.WriteFile(filepath.Join(dir, "CURRENT"), []byte("MANIFEST-000002\n"), 0644)
+
+	big := bytes.Repeat([]byte("0123456789"), 10000)
+	writeLog(t, filepath.Join(dir, "000007.log"), [][]byte{
+		testBatch(10, []testEntry{{"banana", 0, kindDeletion, ""}, {"date", 0, kindValue, "date"}}),
+		testBatch(12, []testEntry{{"big", 0, kindValue, string(big)}}),
+	})
+	// Logs older than the manifest's log number are already in tables
+	writeLog(t, filepath.Join(dir, "000003.log"), [][]byte{
+		testBatch(1, []testEntry{{"stale", 0, kindValue, "stale"}}),
+	})
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for key, want := range map[string]string{"apple": "new apple", "date": "date", "zebra": "zebra", "big": string(big)} {
+		value, err := db.Get([]byte(key))
+		if err != nil {
+			t.Errorf("Get(%q): %v", key, err)
+		} else if string(value) != want {
+			t.Errorf("Get(%q) is %.20q not %.20q", key, value, want)
+		}
+	}
+	for _, key := range []string{"banana", "cherry", "stale", "aardvark"} {
+		if _, err := db.Get([]byte(key)); err != ErrNotFound {
+			t.Errorf("Get(%q) error is %v not %v", key, err, ErrNotFound)
+		}
+	}
+
+	keys, err := db.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, key := range keys {
+		names = append(names, string(key))
+	}
+	if want := "[apple big date zebra]"; fmt.Sprint(names) != want {
+		t.Errorf("Keys are %v not %v", names, want)
+	}
+}
+
+func TestSnappyCopies(t *testing.T) {
+	// "abcd" as a literal, then a 1 byte offset copy of 8 bytes from 4 back
+	// and a 2 byte offset copy of 2 bytes from 1 back
+	src := []byte{14, 3 << 2, 'a', 'b', 'c', 'd', 1 | (8-4)<<2, 4, 2 | (2-1)<<2, 1, 0}
+	got, err := snappyDecode(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abcdabcdabcddd" {
+		t.Errorf("Decoded %q", got)
+	}
+
+	if _, err := snappyDecode([]byte{5, 1 | 0<<2, 9}); err != ErrCorruptSnappy {
+		t.Errorf("Copy before the start wasn't an error: %v", err)
+	}
+}
+
+type testEntry struct {
+	key      string
+	sequence uint64
+	kind     int
+	value    string
+}
+
+func internalKey(key string, sequence uint64, kind int) []byte {
+	return binary.LittleEndian.AppendUint64([]byte(key), sequence<<8|uint64(kind))
+}
+
+func appendEdit(edit []byte, level, number int, smallest string, smallestSeq uint64, largest string, largestSeq uint64) []byte {
+	edit = binary.AppendUvarint(edit, editNewFile)
+	edit = binary.AppendUvarint(edit, uint64(level))
+	edit = binary.AppendUvarint(edit, uint64(number))
+	edit = binary.AppendUvarint(edit, 0)
+	for _, key := range [][]byte{internalKey(smallest, smallestSeq, kindValue), internalKey(largest, largestSeq, kindValue)} {
+		edit = binary.AppendUvarint(edit, uint64(len(key)))
+		edit = append(edit, key...)
+	}
+	return edit
+}
+
+func testBatch(sequence uint64, entries []testEntry) []byte {
+	batch := binary.LittleEndian.AppendUint64(nil, sequence)
+	batch = binary.LittleEndian.AppendUint32(batch, uint32(len(entries)))
+	for _, e := range entries {
+		batch = append(batch, byte(e.kind))
+		batch = binary.AppendUvarint(batch, uint64(len(e.key)))
+		batch = append(batch, e.key...)
+		if e.kind == kindValue {
+			batch = binary.AppendUvarint(batch, uint64(len(e.value)))
+			batch = append(batch, e.value...)
+		}
+	}
+	return batch
+}
+
+func maskCrc(crc uint32) uint32 {
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+func writeLog(t *testing.T, name string, entries [][]byte) {
+	var log []byte
+	for _, entry := range entries {
+		for first := true; first || len(entry) > 0; first = false {
+			left := logBlockSize - len(log)%logBlockSize
+			if left < logHeaderSize {
+				log = append(log, make([]byte, left)...)
+				left = logBlockSize
+			}
+			n := min(len(entry), left-logHeaderSize)
+			kind := byte(logMiddle)
+			switch {
+			case first && n == len(entry):
+				kind = logFull
+			case first:
+				kind = logFirst
+			case n == len(entry):
+				kind = logLast
+			}
+			crc := crc32.Update(crc32.Checksum([]byte{kind}, crcTable), crcTable, entry[:n])
+			log = binary.LittleEndian.AppendUint32(log, maskCrc(crc))
+			log = binary.LittleEndian.AppendUint16(log, uint16(n))
+			log = append(log, kind)
+			log = append(log, entry[:n]...)
+			entry = entry[n:]
+		}
+	}
+	if err := ioutil.WriteFile(name, log, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTable writes the entries into a single data block. Keys share
+// prefixes with the key before them to exercise the prefix compression.
+func writeTable(t *testing.T, name string, compression byte, entries []testEntry) {
+	var data, last []byte
+	for _, e := range entries {
+		key := internalKey(e.key, e.sequence, e.kind)
+		shared := 0
+		for shared < len(key) && shared < len(last) && key[shared] == last[shared] {
+			shared++
+		}
+		data = binary.AppendUvarint(data, uint64(shared))
+		data = binary.AppendUvarint(data, uint64(len(key)-shared))
+		data = binary.AppendUvarint(data, uint64(len(e.value)))
+		data = append(data, key[shared:]...)
+		data = append(data, e.value...)
+		last = key
+	}
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, 1)
+
+	var file []byte
+	appendBlock := func(block []byte, compression byte) blockHandle {
+		switch compression {
+		case compressionSnappy:
+			// A single literal
+			encoded := binary.AppendUvarint(nil, uint64(len(block)))
+			encoded = append(encoded, 60<<2, byte(len(block)-1))
+			block = append(encoded, block...)
+		case compressionZlib:
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			zw.Write(block)
+			zw.Close()
+			block = buf.Bytes()
+		}
+		h := blockHandle{uint64(len(file)), uint64(len(block))}
+		crc := crc32.Update(crc32.Checksum(block, crcTable), crcTable, []byte{compression})
+		file = append(file, block...)
+		file = append(file, compression)
+		file = binary.LittleEndian.AppendUint32(file, maskCrc(crc))
+		return h
+	}
+
+	dataHandle := appendBlock(data, compression)
+
+	var index []byte
+	handle := binary.AppendUvarint(nil, dataHandle.offset)
+	handle = binary.AppendUvarint(handle, dataHandle.size)
+	index = binary.AppendUvarint(index, 0)
+	index = binary.AppendUvarint(index, uint64(len(last)))
+	index = binary.AppendUvarint(index, uint64(len(handle)))
+	index = append(index, last...)
+	index = append(index, handle...)
+	index = binary.LittleEndian.AppendUint32(index, 0)
+	index = binary.LittleEndian.AppendUint32(index, 1)
+
+	metaHandle := appendBlock(binary.LittleEndian.AppendUint32(nil, 0), compressionNone)
+	indexHandle := appendBlock(index, compressionNone)
+
+	var footer []byte
+	for _, h := range []blockHandle{metaHandle, indexHandle} {
+		footer = binary.AppendUvarint(footer, h.offset)
+		footer = binary.AppendUvarint(footer, h.size)
+	}
+	footer = append(footer, make([]byte, tableFooterSize-8-len(footer))...)
+	footer = binary.LittleEndian.AppendUint64(footer, tableMagic)
+	file = append(file, footer...)
+
+	if err := ioutil.WriteFile(name, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
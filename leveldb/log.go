@@ -0,0 +1,160 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Log files (the .log write-ahead logs and the MANIFEST) are a sequence of
+// 32KB blocks. Each block holds records with a 7 byte header: a masked
+// crc32c, a little endian uint16 length and a type saying whether the record
+// is a whole entry or a fragment of one.
+
+const (
+	logBlockSize  = 32 * 1024
+	logHeaderSize = 7
+
+	logFull   = 1
+	logFirst  = 2
+	logMiddle = 3
+	logLast   = 4
+)
+
+var (
+	ErrCorruptLog = errors.New("Corrupt LevelDB log record")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func unmaskCrc(masked uint32) uint32 {
+	var rot = masked - 0xa282ead8
+	return rot>>17 | rot<<15
+}
+
+// readLogEntries splits a log file into its entries. A torn record at the
+// end of the log, as left by a crash while writing, ends the log rather than
+// being an error.
+func readLogEntries(data []byte) ([][]byte, error) {
+	var entries = make([][]byte, 0)
+	var entry []byte
+	var inEntry = false
+
+	for block := 0; block < len(data); block += logBlockSize {
+		var end = min(block+logBlockSize, len(data))
+		for pos := block; pos+logHeaderSize <= end; {
+			var (
+				crc    = binary.LittleEndian.Uint32(data[pos:])
+				length = int(binary.LittleEndian.Uint16(data[pos+4:]))
+				kind   = data[pos+6]
+			)
+
+			if kind == 0 && length == 0 {
+				// Zero filled padding after a preallocated or torn write
+				break
+			}
+			if pos+logHeaderSize+length > end {
+				return entries, nil
+			}
+
+			var payload = data[pos+logHeaderSize : pos+logHeaderSize+length]
+			if crc32.Update(crc32.Checksum([]byte{kind}, crcTable), crcTable, payload) != unmaskCrc(crc) {
+				if block+logBlockSize >= len(data) {
+					return entries, nil
+				}
+				return nil, ErrCorruptLog
+			}
+			pos += logHeaderSize + length
+
+			switch kind {
+			case logFull:
+				entries = append(entries, payload)
+				inEntry = false
+			case logFirst:
+				entry = append([]byte(nil), payload...)
+				inEntry = true
+			case logMiddle, logLast:
+				if !inEntry {
+					return nil, ErrCorruptLog
+				}
+				entry = append(entry, payload...)
+				if kind == logLast {
+					entries = append(entries, entry)
+					inEntry = false
+				}
+			default:
+				return nil, ErrCorruptLog
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// byteReader reads the varints and length prefixed strings that LevelDB
+// records are made of.
+type byteReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *byteReader) done() bool {
+	return r.err != nil || r.pos >= len(r.data)
+}
+
+func (r *byteReader) fail() {
+	if r.err == nil {
+		r.err = io.ErrUnexpectedEOF
+	}
+	r.pos = len(r.data)
+}
+
+func (r *byteReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.fail()
+		return 0
+	}
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+func (r *byteReader) uvarint() uint64 {
+	var x, n = binary.Uvarint(r.data[min(r.pos, len(r.data)):])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.pos += n
+	return x
+}
+
+func (r *byteReader) bytes(n int) []byte {
+	if n < 0 || r.pos+n > len(r.data) {
+		r.fail()
+		return nil
+	}
+	r.pos += n
+	return r.data[r.pos-n : r.pos]
+}
+
+func (r *byteReader) lengthPrefixed() []byte {
+	return r.bytes(int(r.uvarint()))
+}
+
+func (r *byteReader) fixed32() uint32 {
+	var b = r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *byteReader) fixed64() uint64 {
+	var b = r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
@@ -0,0 +1,86 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrCorruptSnappy = errors.New("Corrupt snappy block")
+)
+
+// snappyDecode decompresses a block in the snappy format: a varint of the
+// decoded length followed by literal and back reference elements.
+func snappyDecode(src []byte) ([]byte, error) {
+	var length, n = binary.Uvarint(src)
+	if n <= 0 || length > 1<<32 {
+		return nil, ErrCorruptSnappy
+	}
+	src = src[n:]
+
+	var dst = make([]byte, 0, length)
+	for len(src) > 0 {
+		var tag = src[0]
+		var literalLength, offset, copyLength int
+
+		switch tag & 3 {
+		case 0:
+			literalLength = int(tag>>2) + 1
+			src = src[1:]
+			if literalLength > 60 {
+				// Lengths over 60 are stored in the following 1 to 4 bytes
+				var extra = literalLength - 60
+				if len(src) < extra {
+					return nil, ErrCorruptSnappy
+				}
+				literalLength = 0
+				for i := extra - 1; i >= 0; i-- {
+					literalLength = literalLength<<8 | int(src[i])
+				}
+				literalLength++
+				src = src[extra:]
+			}
+			if literalLength <= 0 || len(src) < literalLength {
+				return nil, ErrCorruptSnappy
+			}
+			dst = append(dst, src[:literalLength]...)
+			src = src[literalLength:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, ErrCorruptSnappy
+			}
+			copyLength = 4 + int(tag>>2)&7
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, ErrCorruptSnappy
+			}
+			copyLength = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, ErrCorruptSnappy
+			}
+			copyLength = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) {
+			return nil, ErrCorruptSnappy
+		}
+		// Copies may overlap their own output, so go a byte at a time
+		var start = len(dst) - offset
+		for i := 0; i < copyLength; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if uint64(len(dst)) != length {
+		return nil, ErrCorruptSnappy
+	}
+	return dst, nil
+}
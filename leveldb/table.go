@@ -0,0 +1,274 @@
+package leveldb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+)
+
+// Sorted string tables (.ldb and .sst files) hold data blocks of sorted
+// internal keys, an index block pointing at the data blocks and a footer
+// pointing at the index.
+
+const (
+	tableFooterSize  = 48
+	tableMagic       = 0xdb4775248b80fb57
+	blockTrailerSize = 5
+
+	compressionNone    = 0
+	compressionSnappy  = 1
+	compressionZlib    = 2 // Used by Bedrock Edition
+	compressionDeflate = 4 // Raw deflate, also Bedrock Edition
+)
+
+var (
+	ErrCorruptTable = errors.New("Corrupt LevelDB table")
+)
+
+type blockHandle struct {
+	offset, size uint64
+}
+
+func readBlockHandle(r *byteReader) blockHandle {
+	return blockHandle{r.uvarint(), r.uvarint()}
+}
+
+type table struct {
+	file  *os.File
+	name  string
+	index *block
+}
+
+func openTable(name string) (*table, error) {
+	var file, err = os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var t = &table{file: file, name: name}
+	var fi, statErr = file.Stat()
+	if statErr != nil {
+		file.Close()
+		return nil, statErr
+	}
+	if fi.Size() < tableFooterSize {
+		file.Close()
+		return nil, t.corrupt("too short for a footer")
+	}
+
+	var footer [tableFooterSize]byte
+	if _, err := file.ReadAt(footer[:], fi.Size()-tableFooterSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if binary.LittleEndian.Uint64(footer[tableFooterSize-8:]) != tableMagic {
+		file.Close()
+		return nil, t.corrupt("bad magic number")
+	}
+
+	var r = &byteReader{data: footer[:]}
+	readBlockHandle(r) // Meta index, which only holds filters
+	var indexHandle = readBlockHandle(r)
+	if r.err != nil {
+		file.Close()
+		return nil, t.corrupt("bad footer")
+	}
+
+	t.index, err = t.readBlock(indexHandle)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *table) corrupt(reason string) error {
+	return errors.New(fmt.Sprintf("%v: %v: %v", ErrCorruptTable, t.name, reason))
+}
+
+func (t *table) Close() error {
+	return t.file.Close()
+}
+
+func (t *table) readBlock(h blockHandle) (*block, error) {
+	var raw = make([]byte, h.size+blockTrailerSize)
+	if _, err := t.file.ReadAt(raw, int64(h.offset)); err != nil {
+		return nil, err
+	}
+
+	var data, compression = raw[:h.size], raw[h.size]
+	var crc = binary.LittleEndian.Uint32(raw[h.size+1:])
+	if crc32.Update(crc32.Checksum(data, crcTable), crcTable, raw[h.size:h.size+1]) != unmaskCrc(crc) {
+		return nil, t.corrupt(fmt.Sprintf("checksum mismatch in block at %v", h.offset))
+	}
+
+	var err error
+	switch compression {
+	case compressionNone:
+	case compressionSnappy:
+		data, err = snappyDecode(data)
+	case compressionZlib:
+		var zr, zErr = zlib.NewReader(bytes.NewReader(data))
+		if zErr != nil {
+			return nil, zErr
+		}
+		data, err = ioutil.ReadAll(zr)
+	case compressionDeflate:
+		data, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	default:
+		return nil, t.corrupt(fmt.Sprintf("unknown compression type %v", compression))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newBlock(data)
+}
+
+// get finds the newest entry for the user key in the table. Entries of a
+// key are sorted newest first, so the first one found is the one wanted.
+func (t *table) get(key []byte) (value []byte, deleted, found bool, err error) {
+	var it = t.index.iterator()
+	for it.next() {
+		if bytes.Compare(internalUserKey(it.key), key) < 0 {
+			continue
+		}
+
+		var handle = readBlockHandle(&byteReader{data: it.value})
+		var b, readErr = t.readBlock(handle)
+		if readErr != nil {
+			return nil, false, false, readErr
+		}
+
+		var bit = b.iterator()
+		for bit.next() {
+			var c = bytes.Compare(internalUserKey(bit.key), key)
+			if c == 0 {
+				return bit.value, internalKind(bit.key) == kindDeletion, true, nil
+			} else if c > 0 {
+				break
+			}
+		}
+		if bit.err != nil {
+			return nil, false, false, bit.err
+		}
+
+		// The key may carry on into the next block when a block ends
+		// part way through the versions of a key, so keep going while the
+		// index still covers it
+		if bytes.Compare(internalUserKey(it.key), key) > 0 {
+			break
+		}
+	}
+	return nil, false, false, it.err
+}
+
+// each calls fn for every entry in the table in order.
+func (t *table) each(fn func(internalKey, value []byte) error) error {
+	var it = t.index.iterator()
+	for it.next() {
+		var handle = readBlockHandle(&byteReader{data: it.value})
+		var b, err = t.readBlock(handle)
+		if err != nil {
+			return err
+		}
+		var bit = b.iterator()
+		for bit.next() {
+			if err := fn(bit.key, bit.value); err != nil {
+				return err
+			}
+		}
+		if bit.err != nil {
+			return bit.err
+		}
+	}
+	return it.err
+}
+
+// block is a run of prefix compressed entries followed by the offsets of
+// the restart points where the prefix compression starts again.
+type block struct {
+	data []byte
+}
+
+func newBlock(data []byte) (*block, error) {
+	if len(data) < 4 {
+		return nil, ErrCorruptTable
+	}
+	var restarts = int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	var end = len(data) - 4 - 4*restarts
+	if restarts < 0 || end < 0 {
+		return nil, ErrCorruptTable
+	}
+	return &block{data[:end]}, nil
+}
+
+func (b *block) iterator() *blockIterator {
+	return &blockIterator{r: byteReader{data: b.data}}
+}
+
+type blockIterator struct {
+	r          byteReader
+	key, value []byte
+	err        error
+}
+
+func (it *blockIterator) next() bool {
+	if it.r.done() {
+		it.err = it.r.err
+		return false
+	}
+
+	var (
+		shared   = int(it.r.uvarint())
+		unshared = int(it.r.uvarint())
+		length   = int(it.r.uvarint())
+		suffix   = it.r.bytes(unshared)
+		value    = it.r.bytes(length)
+	)
+	if it.r.err != nil || shared > len(it.key) {
+		it.err = ErrCorruptTable
+		return false
+	}
+
+	var key = make([]byte, shared+unshared)
+	copy(key, it.key[:shared])
+	copy(key[shared:], suffix)
+	it.key, it.value = key, value
+	return true
+}
+
+// Internal keys are the user key followed by 8 bytes holding the sequence
+// number and whether the entry is a value or a deletion.
+
+const (
+	kindDeletion = 0
+	kindValue    = 1
+)
+
+func internalUserKey(key []byte) []byte {
+	if len(key) < 8 {
+		return key
+	}
+	return key[:len(key)-8]
+}
+
+func internalKind(key []byte) int {
+	if len(key) < 8 {
+		return kindDeletion
+	}
+	return int(key[len(key)-8])
+}
+
+func internalSequence(key []byte) uint64 {
+	if len(key) < 8 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(key[len(key)-8:]) >> 8
+}
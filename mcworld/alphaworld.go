@@ -2,19 +2,35 @@ package mcworld
 
 import (
 	"compress/gzip"
+	"github.com/quag/mcobj/nbt"
 	"io"
 	"os"
-	"path/filepath"
+	"path"
 	"strconv"
 	"strings"
 )
 
 type AlphaWorld struct {
-	worldDir string
+	store worldStore
+	index *WorldIndex
+}
+
+// SetIndex makes ChunkPool take the chunks in folders that haven't changed
+// from the index. Only worlds in directories are indexed.
+func (w *AlphaWorld) SetIndex(index *WorldIndex) {
+	w.index = index
+}
+
+func (w *AlphaWorld) ReadLevel() (*nbt.Level, error) {
+	return readLevel(w.store)
+}
+
+func (w *AlphaWorld) Close() error {
+	return w.store.Close()
 }
 
 func (w *AlphaWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
-	var file, fileErr = os.Open(chunkPath(w.worldDir, x, z))
+	var file, fileErr = w.store.Open(chunkPath(x, z))
 	if fileErr != nil {
 		return nil, fileErr
 	}
@@ -27,57 +43,106 @@ func (w *AlphaWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
 }
 
 type AlphaChunkPool struct {
-	chunkMap map[string]bool
-	box      *BoundingBox
-	worldDir string
+	chunkSet
 }
 
-func (p *AlphaChunkPool) Pop(x, z int) bool {
-	var chunkFilename = chunkPath(p.worldDir, x, z)
-	var _, exists = p.chunkMap[chunkFilename]
-	delete(p.chunkMap, chunkFilename)
-	return exists
+func (p *AlphaChunkPool) Iterator(order ChunkOrder) *ChunkIterator {
+	return NewChunkIterator(p, p.coords(), order)
 }
 
-func (p *AlphaChunkPool) BoundingBox() *BoundingBox {
-	return p.box
-}
+func (w *AlphaWorld) ChunkPool(mask ChunkMask) (ChunkPool, error) {
+	var pool = &AlphaChunkPool{newChunkSet()}
 
-func (p *AlphaChunkPool) Remaining() int {
-	return len(p.chunkMap)
-}
+	if _, ok := w.store.(*dirStore); ok && w.index != nil {
+		return pool, w.poolIndexedChunks(mask, pool)
+	}
 
-func (w *AlphaWorld) ChunkPool(mask ChunkMask) (ChunkPool, error) {
-	chunks := make(map[string]bool)
-	box := EmptyBoundingBox()
+	err := w.store.Walk(func(name string, info os.FileInfo) error {
+		if x, z, ok := parseChunkName(path.Base(name)); ok && !mask.IsMasked(x, z) {
+			pool.add(x, z)
+		}
+		return nil
+	})
+	return pool, err
+}
 
-	err := filepath.Walk(w.worldDir, func(path string, info os.FileInfo, err error) error {
+// poolIndexedChunks lists the chunk folders, two levels deep, and only
+// reads those that changed since they were indexed.
+func (w *AlphaWorld) poolIndexedChunks(mask ChunkMask, pool *AlphaChunkPool) error {
+	var outer, err = w.store.ReadDirNames(".")
+	if err != nil {
+		return err
+	}
+	for _, xFolder := range outer {
+		if !isChunkFolder(xFolder) {
+			continue
+		}
+		var inner, err = w.store.ReadDirNames(xFolder)
 		if err != nil {
 			return err
 		}
+		for _, zFolder := range inner {
+			var dir = xFolder + "/" + zFolder
+			if !isChunkFolder(zFolder) {
+				continue
+			}
+			var info, statErr = w.store.Stat(dir)
+			if statErr != nil {
+				return statErr
+			}
+			if !info.IsDir() {
+				continue
+			}
+
+			var d = w.index.dir(dir, info)
+			if d == nil {
+				var names, err = w.store.ReadDirNames(dir)
+				if err != nil {
+					return err
+				}
+				d = &dirIndex{ModTime: info.ModTime().UnixNano(), Chunks: make([]ChunkCoord, 0)}
+				for _, name := range names {
+					if x, z, ok := parseChunkName(name); ok {
+						d.Chunks = append(d.Chunks, ChunkCoord{x, z})
+					}
+				}
+				w.index.setDir(dir, d)
+			}
 
-		if !info.IsDir() {
-			var match, err = filepath.Match("c.*.*.dat", filepath.Base(path))
-			if match && err == nil {
-				var (
-					s       = strings.SplitN(filepath.Base(path), ".", 4)
-					x, xErr = strconv.ParseInt(s[1], 36, 64)
-					z, zErr = strconv.ParseInt(s[2], 36, 64)
-				)
-				if xErr == nil && zErr == nil && !mask.IsMasked(int(x), int(z)) {
-					chunks[path] = true
-					box.Union(int(x), int(z))
+			for _, c := range d.Chunks {
+				if !mask.IsMasked(c.X, c.Z) {
+					pool.add(c.X, c.Z)
 				}
 			}
 		}
+	}
+	return nil
+}
 
-		return nil
-	})
-	return &AlphaChunkPool{chunks, box, w.worldDir}, err
+// parseChunkName returns the coordinates of an alpha chunk file's name,
+// such as c.-1.a.dat.
+func parseChunkName(name string) (x, z int, ok bool) {
+	var match, err = path.Match("c.*.*.dat", name)
+	if !match || err != nil {
+		return 0, 0, false
+	}
+	var (
+		s         = strings.SplitN(name, ".", 4)
+		x64, xErr = strconv.ParseInt(s[1], 36, 64)
+		z64, zErr = strconv.ParseInt(s[2], 36, 64)
+	)
+	return int(x64), int(z64), xErr == nil && zErr == nil
+}
+
+// isChunkFolder reports whether name is one of the 64 base 36 folder names
+// chunks are spread over.
+func isChunkFolder(name string) bool {
+	var i, err = strconv.ParseInt(name, 36, 64)
+	return err == nil && i >= 0 && i < 64 && name == base36(int(i))
 }
 
-func chunkPath(world string, x, z int) string {
-	return filepath.Join(world, encodeFolder(x), encodeFolder(z), "c."+base36(x)+"."+base36(z)+".dat")
+func chunkPath(x, z int) string {
+	return path.Join(encodeFolder(x), encodeFolder(z), "c."+base36(x)+"."+base36(z)+".dat")
 }
 
 func base36(i int) string {
@@ -0,0 +1,360 @@
+package mcworld
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	UnknownArchiveError = errors.New("Unknown archive type. Expected .zip, .tar, .tar.gz or .tgz")
+)
+
+// IsArchive reports whether the path names a backup archive that OpenWorld
+// can read a world from.
+func IsArchive(path string) bool {
+	return archiveKind(path) != ""
+}
+
+func archiveKind(path string) string {
+	var lower = strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tgz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	}
+	return ""
+}
+
+func openArchiveStore(path string) (worldStore, error) {
+	switch archiveKind(path) {
+	case "zip":
+		return openZipStore(path)
+	case "tgz":
+		return openTarStore(path, true)
+	case "tar":
+		return openTarStore(path, false)
+	}
+	return nil, UnknownArchiveError
+}
+
+type archiveMember struct {
+	name string
+	info os.FileInfo
+	open func() (worldFile, error)
+}
+
+// archiveStore serves the members of an archive. The world directory within
+// the archive is found by looking for the shallowest level.dat, so backups
+// that contain "world/level.dat" or "backups/2012-04-01/world/level.dat" work
+// the same as archives of the world directory's contents.
+type archiveStore struct {
+	members map[string]*archiveMember
+	dirs    map[string][]string
+	root    string
+	close   func() error
+}
+
+func newArchiveStore(members []*archiveMember, close func() error) *archiveStore {
+	var root = archiveRoot(members)
+	var s = &archiveStore{make(map[string]*archiveMember), make(map[string][]string), root, close}
+
+	for _, m := range members {
+		if !strings.HasPrefix(m.name, root) {
+			continue
+		}
+		var name = m.name[len(root):]
+		s.members[name] = m
+
+		for dir, base := path.Split(name); ; dir, base = path.Split(dir) {
+			dir = strings.TrimSuffix(dir, "/")
+			var children, seen = s.dirs[dir]
+			if !containsString(children, base) {
+				s.dirs[dir] = append(children, base)
+			}
+			if seen || dir == "" {
+				break
+			}
+		}
+	}
+
+	return s
+}
+
+// archiveRoot returns the prefix of member names that is the world
+// directory, including its trailing slash.
+func archiveRoot(members []*archiveMember) string {
+	var root, depth = "", -1
+	for _, m := range members {
+		if path.Base(m.name) == "level.dat" {
+			var d = strings.Count(m.name, "/")
+			if depth == -1 || d < depth {
+				root, depth = path.Dir(m.name), d
+			}
+		}
+	}
+
+	if depth == -1 {
+		for _, m := range members {
+			var d = strings.Count(m.name, "/")
+			if path.Base(path.Dir(m.name)) == "region" && (depth == -1 || d < depth) {
+				root, depth = path.Dir(path.Dir(m.name)), d
+			}
+		}
+	}
+
+	if depth == -1 || root == "." {
+		return ""
+	}
+	return root + "/"
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *archiveStore) Open(name string) (worldFile, error) {
+	var m, ok = s.members[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return m.open()
+}
+
+func (s *archiveStore) Stat(name string) (os.FileInfo, error) {
+	if m, ok := s.members[name]; ok {
+		return m.info, nil
+	}
+	if _, ok := s.dirs[name]; ok {
+		return &archiveDirInfo{path.Base(name)}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (s *archiveStore) ReadDirNames(dir string) ([]string, error) {
+	var names, ok = s.dirs[dir]
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: dir, Err: os.ErrNotExist}
+	}
+	return append([]string(nil), names...), nil
+}
+
+func (s *archiveStore) Walk(fn func(name string, info os.FileInfo) error) error {
+	var names = make([]string, 0, len(s.members))
+	for name := range s.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var err = fn(name, s.members[name].info)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *archiveStore) Close() error {
+	return s.close()
+}
+
+type archiveDirInfo struct {
+	name string
+}
+
+func (d *archiveDirInfo) Name() string       { return d.name }
+func (d *archiveDirInfo) Size() int64        { return 0 }
+func (d *archiveDirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (d *archiveDirInfo) ModTime() time.Time { return time.Time{} }
+func (d *archiveDirInfo) IsDir() bool        { return true }
+func (d *archiveDirInfo) Sys() interface{}   { return nil }
+
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+type sectionFile struct {
+	*io.SectionReader
+}
+
+func (f *sectionFile) Close() error {
+	return nil
+}
+
+// Zip members are compressed individually, so each is inflated into memory
+// when it is opened.
+func openZipStore(filename string) (worldStore, error) {
+	var r, err = zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var members = make([]*archiveMember, 0, len(r.File))
+	for _, f := range r.File {
+		var info = f.FileInfo()
+		if info.IsDir() {
+			continue
+		}
+		var f = f
+		members = append(members, &archiveMember{cleanArchiveName(f.Name), info, func() (worldFile, error) {
+			return openZipMember(f)
+		}})
+	}
+
+	return newArchiveStore(members, r.Close), nil
+}
+
+func openZipMember(f *zip.File) (worldFile, error) {
+	var r, err = f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var data, readErr = ioutil.ReadAll(r)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return &memoryFile{bytes.NewReader(data)}, nil
+}
+
+// Tar archives can't be read out of order, so the members making up the
+// world are spooled into a temporary file that is deleted when the store is
+// closed. The rest are read from the archive again by Stream.
+func openTarStore(filename string, gzipped bool) (worldStore, error) {
+	var spool, err = ioutil.TempFile("", "mcobj-spool")
+	if err != nil {
+		return nil, err
+	}
+	var closeSpool = func() error {
+		var closeErr = spool.Close()
+		var removeErr = os.Remove(spool.Name())
+		if closeErr != nil {
+			return closeErr
+		}
+		return removeErr
+	}
+
+	var members = make([]*archiveMember, 0)
+	var offset int64
+	err = readTar(filename, gzipped, func(name string, header *tar.Header, r io.Reader) error {
+		if !isWorldFile(name) {
+			return nil
+		}
+
+		var n, copyErr = io.Copy(spool, r)
+		if copyErr != nil {
+			return copyErr
+		}
+
+		var section = io.NewSectionReader(spool, offset, n)
+		members = append(members, &archiveMember{name, header.FileInfo(), func() (worldFile, error) {
+			return &sectionFile{io.NewSectionReader(section, 0, section.Size())}, nil
+		}})
+		offset += n
+		return nil
+	})
+	if err != nil {
+		closeSpool()
+		return nil, err
+	}
+
+	return &tarStore{newArchiveStore(members, closeSpool), filename, gzipped}, nil
+}
+
+// readTar calls fn with each regular member of a tar archive in turn.
+func readTar(filename string, gzipped bool, fn func(name string, header *tar.Header, r io.Reader) error) error {
+	var file, err = os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if gzipped {
+		var gz, gzErr = gzip.NewReader(file)
+		if gzErr != nil {
+			return gzErr
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var tr = tar.NewReader(r)
+	for {
+		var header, nextErr = tr.Next()
+		if nextErr == io.EOF {
+			return nil
+		}
+		if nextErr != nil {
+			return nextErr
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(cleanArchiveName(header.Name), header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// tarStore is an archiveStore holding only the members that are read to
+// walk the world.
+type tarStore struct {
+	*archiveStore
+	filename string
+	gzipped  bool
+}
+
+// Stream reads every file of the world from the archive, including those
+// that weren't spooled.
+func (s *tarStore) Stream(fn func(name string, info os.FileInfo, r io.Reader) error) error {
+	return readTar(s.filename, s.gzipped, func(name string, header *tar.Header, r io.Reader) error {
+		if !strings.HasPrefix(name, s.root) {
+			return nil
+		}
+		return fn(name[len(s.root):], header.FileInfo(), r)
+	})
+}
+
+func cleanArchiveName(name string) string {
+	return strings.TrimPrefix(path.Clean(strings.Replace(name, "\\", "/", -1)), "./")
+}
+
+// isWorldFile picks out the files needed to read chunks: level.dat, region
+// files and the chunks stored beside them, and Alpha chunk files.
+func isWorldFile(name string) bool {
+	var base = path.Base(name)
+	if base == "level.dat" {
+		return true
+	}
+	if match, _ := filepath.Match("c.*.*.dat", base); match {
+		return true
+	}
+	var ext = path.Ext(base)
+	return path.Base(path.Dir(name)) == "region" && (ext == ".mca" || ext == ".mcr" || ext == ".mcc")
+}
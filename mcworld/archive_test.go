@@ -0,0 +1,222 @@
+package mcworld
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestOpenZipWorld(t *testing.T) {
+	files := testWorldFiles(t)
+	archive := filepath.Join(t.TempDir(), "backup.zip")
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range sortedNames(files) {
+		w, _ := zw.Create("backups/world/" + name)
+		w.Write(files[name])
+	}
+	zw.Create("backups/world/players/")
+	zw.Close()
+	ioutil.WriteFile(archive, buf.Bytes(), 0644)
+
+	checkTestWorld(t, archive)
+}
+
+func TestOpenTarGzWorld(t *testing.T) {
+	files := testWorldFiles(t)
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range sortedNames(files) {
+		tw.WriteHeader(&tar.Header{Name: "./world/" + name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write(files[name])
+	}
+	tw.Close()
+	gw.Close()
+	ioutil.WriteFile(archive, buf.Bytes(), 0644)
+
+	checkTestWorld(t, archive)
+}
+
+func TestCopyFilesFromTar(t *testing.T) {
+	files := testWorldFiles(t)
+	files["playerdata/player.dat"] = []byte("player")
+	files["datapacks/pack/pack.mcmeta"] = []byte("{}")
+	archive := filepath.Join(t.TempDir(), "backup.tar")
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range sortedNames(files) {
+		tw.WriteHeader(&tar.Header{Name: "world/" + name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write(files[name])
+	}
+	tw.Close()
+	ioutil.WriteFile(archive, buf.Bytes(), 0644)
+
+	world, err := OpenWorld(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+	if _, err := world.(*BetaWorld).store.Stat("playerdata/player.dat"); err == nil {
+		t.Error("Player data spooled to read the world")
+	}
+
+	dir := t.TempDir()
+	if err := world.(*BetaWorld).CopyFiles(dir, func(string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if copied, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err != nil || !bytes.Equal(copied, data) {
+			t.Errorf("%v not copied: %v", name, err)
+		}
+	}
+}
+
+func TestOpenDirWorld(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range testWorldFiles(t) {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+	}
+
+	checkTestWorld(t, dir)
+}
+
+func TestUnknownArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.rar")
+	ioutil.WriteFile(path, []byte("x"), 0644)
+	if _, err := OpenWorld(path); err != UnknownArchiveError {
+		t.Errorf("Error was %q not %q", err, UnknownArchiveError)
+	}
+}
+
+// testWorldFiles makes a level.dat with spawn 100,64,-40 and a region file
+// holding chunks (0,0) and (3,-1) of the test world.
+func testWorldFiles(t *testing.T) map[string][]byte {
+	mw := NewMemoryWorld()
+	mw.SetBlock(1, 2, 3, 1)
+	mw.SetBlock(3*16, 5, -16, 4)
+
+	return map[string][]byte{
+		"level.dat":          testLevelDat(100, 64, -40),
+		"region/r.0.0.mca":   testRegion(t, mw, 0, 0),
+		"region/r.0.-1.mca":  testRegion(t, mw, 0, -1),
+		"region/notes.txt":   []byte("not a region"),
+		"DIM-1/region/r.0.0": []byte("other dimension"),
+	}
+}
+
+func checkTestWorld(t *testing.T, path string) {
+	world, err := OpenWorld(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	level, err := world.(LevelReader).ReadLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level.SpawnX != 100 || level.SpawnZ != -40 {
+		t.Errorf("Spawn (%d,%d) not (100,-40)", level.SpawnX, level.SpawnZ)
+	}
+
+	pool, err := world.ChunkPool(&AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Remaining() != 2 {
+		t.Errorf("%d chunks not 2", pool.Remaining())
+	}
+
+	r, err := world.OpenChunk(3, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	chunk, err := nbt.ReadChunkNbt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.XPos != 3 || chunk.ZPos != -1 || chunk.Block(0, 5, 0) != 4 {
+		t.Errorf("Chunk (%d,%d) doesn't hold the expected block", chunk.XPos, chunk.ZPos)
+	}
+}
+
+func testLevelDat(x, y, z int) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	w := nbt.NewWriter(gw)
+	w.WriteTag(nbt.TagStruct, "")
+	w.WriteTag(nbt.TagStruct, "Data")
+	w.WriteTag(nbt.TagInt32, "SpawnX")
+	w.WriteInt32(x)
+	w.WriteTag(nbt.TagInt32, "SpawnY")
+	w.WriteInt32(y)
+	w.WriteTag(nbt.TagInt32, "SpawnZ")
+	w.WriteInt32(z)
+	w.WriteTag(nbt.TagStructEnd, "")
+	w.WriteTag(nbt.TagStructEnd, "")
+	gw.Close()
+	return buf.Bytes()
+}
+
+// testRegion packs the chunks of a region of the memory world into the
+// McRegion/Anvil file layout.
+func testRegion(t *testing.T, mw *MemoryWorld, rx, rz int) []byte {
+	var header [8192]byte
+	var body bytes.Buffer
+
+	for cz := 0; cz < 32; cz++ {
+		for cx := 0; cx < 32; cx++ {
+			data, err := mw.ChunkNbt(rx*32+cx, rz*32+cz)
+			if err == ChunkNotFoundError {
+				continue
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var compressed bytes.Buffer
+			zw := zlib.NewWriter(&compressed)
+			zw.Write(data)
+			zw.Close()
+
+			var chunk bytes.Buffer
+			binary.Write(&chunk, binary.BigEndian, uint32(compressed.Len()+1))
+			chunk.WriteByte(2)
+			io.Copy(&chunk, &compressed)
+			for chunk.Len()%4096 != 0 {
+				chunk.WriteByte(0)
+			}
+
+			sector := 2 + body.Len()/4096
+			binary.BigEndian.PutUint32(header[4*(cx+cz*32):], uint32(sector<<8|chunk.Len()/4096))
+			io.Copy(&body, &chunk)
+		}
+	}
+
+	return append(header[:], body.Bytes()...)
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,115 @@
+package mcworld
+
+import (
+	"github.com/quag/mcobj/nbt"
+)
+
+// bedrockName describes a Bedrock block name that differs from Java
+// Edition's. The data value is the position of the named state's value in
+// values, or data when the block has no such state.
+type bedrockName struct {
+	id     int
+	data   int
+	state  string
+	values []string
+}
+
+var (
+	bedrockWoodTypes  = []string{"oak", "spruce", "birch", "jungle"}
+	bedrockColors     = []string{"white", "orange", "magenta", "light_blue", "yellow", "lime", "pink", "gray", "silver", "cyan", "purple", "blue", "brown", "green", "red", "black"}
+	bedrockSlabTypes  = []string{"smooth_stone", "sandstone", "wood", "cobblestone", "brick", "stone_brick"}
+	bedrockBrickTypes = []string{"default", "mossy", "cracked", "chiseled"}
+)
+
+var bedrockNames = map[string]bedrockName{
+	"minecraft:grass":                 {2, 0, "", nil},
+	"minecraft:planks":                {5, 0, "wood_type", bedrockWoodTypes},
+	"minecraft:sapling":               {6, 0, "sapling_type", bedrockWoodTypes},
+	"minecraft:log":                   {17, 0, "old_log_type", bedrockWoodTypes},
+	"minecraft:log2":                  {17, 0, "", nil},
+	"minecraft:leaves":                {18, 0, "old_leaf_type", bedrockWoodTypes},
+	"minecraft:leaves2":               {18, 0, "", nil},
+	"minecraft:sandstone":             {24, 0, "sand_stone_type", []string{"default", "heiroglyphs", "smooth"}},
+	"minecraft:golden_rail":           {27, 0, "", nil},
+	"minecraft:web":                   {30, 0, "", nil},
+	"minecraft:tallgrass":             {31, 0, "tall_grass_type", []string{"default", "tall", "fern"}},
+	"minecraft:double_plant":          {31, 1, "", nil},
+	"minecraft:deadbush":              {32, 0, "", nil},
+	"minecraft:wool":                  {35, 0, "color", bedrockColors},
+	"minecraft:yellow_flower":         {37, 0, "", nil},
+	"minecraft:red_flower":            {38, 0, "", nil},
+	"minecraft:double_stone_slab":     {43, 0, "stone_slab_type", bedrockSlabTypes},
+	"minecraft:double_wooden_slab":    {43, 2, "", nil},
+	"minecraft:stone_slab":            {44, 0, "stone_slab_type", bedrockSlabTypes},
+	"minecraft:wooden_slab":           {44, 2, "", nil},
+	"minecraft:brick_block":           {45, 0, "", nil},
+	"minecraft:mob_spawner":           {52, 0, "", nil},
+	"minecraft:lit_furnace":           {62, 0, "", nil},
+	"minecraft:standing_sign":         {63, 0, "", nil},
+	"minecraft:wooden_door":           {64, 0, "", nil},
+	"minecraft:stone_stairs":          {67, 0, "", nil},
+	"minecraft:wooden_pressure_plate": {72, 0, "", nil},
+	"minecraft:lit_redstone_ore":      {74, 0, "", nil},
+	"minecraft:unlit_redstone_torch":  {75, 0, "", nil},
+	"minecraft:snow_layer":            {78, 0, "", nil},
+	"minecraft:snow":                  {80, 0, "", nil},
+	"minecraft:reeds":                 {83, 0, "", nil},
+	"minecraft:fence":                 {85, 0, "", nil},
+	"minecraft:portal":                {90, 0, "", nil},
+	"minecraft:lit_pumpkin":           {91, 0, "", nil},
+	"minecraft:unpowered_repeater":    {93, 0, "", nil},
+	"minecraft:powered_repeater":      {94, 0, "", nil},
+	"minecraft:trapdoor":              {96, 0, "", nil},
+	"minecraft:monster_egg":           {97, 0, "", nil},
+	"minecraft:stonebrick":            {98, 0, "stone_brick_type", bedrockBrickTypes},
+	"minecraft:melon_block":           {103, 0, "", nil},
+	"minecraft:fence_gate":            {107, 0, "", nil},
+	"minecraft:waterlily":             {111, 0, "", nil},
+	"minecraft:nether_brick":          {112, 0, "", nil},
+	"minecraft:lit_redstone_lamp":     {124, 0, "", nil},
+	"minecraft:brown_mushroom_block":  {99, 0, "", nil},
+	"minecraft:red_mushroom_block":    {100, 0, "", nil},
+	"minecraft:end_portal_frame":      {120, 0, "", nil},
+	"minecraft:enchanting_table":      {116, 0, "", nil},
+	"minecraft:stone_pressure_plate":  {70, 0, "", nil},
+	"minecraft:frame":                 {0, 0, "", nil},
+	"minecraft:unknown":               {0, 0, "", nil},
+	"minecraft:invisible_bedrock":     {0, 0, "", nil},
+	"minecraft:bubble_column":         {9, 0, "", nil},
+	"minecraft:light_block":           {0, 0, "", nil},
+	"minecraft:hard_glass":            {20, 0, "", nil},
+	"minecraft:stained_hardened_clay": {82, 0, "", nil},
+	"minecraft:hardened_clay":         {82, 0, "", nil},
+	"minecraft:unlit_redstone_lamp":   {123, 0, "", nil},
+	"minecraft:stripped_oak_log":      {17, 0, "", nil},
+}
+
+// bedrockBlock converts a block state from a subchunk palette. Blocks that
+// have no numeric id are drawn as stone so the shape of the terrain is kept.
+func bedrockBlock(state map[string]interface{}) nbt.Block {
+	var name, _ = state["name"].(string)
+	var states, _ = state["states"].(map[string]interface{})
+
+	if b, ok := bedrockNames[name]; ok {
+		var data = b.data
+		if value, ok := states[b.state].(string); ok {
+			for i, v := range b.values {
+				if v == value {
+					data = i
+				}
+			}
+		}
+		return nbt.Block(b.id) + nbt.Block(data)<<8
+	}
+
+	var block, ok = nbt.BlockFromName(name)
+	if !ok {
+		return 1
+	}
+
+	// Worlds from before 1.13 store the data value alongside the name
+	if val, ok := state["val"].(int); ok && val >= 0 && val < 16 {
+		return block&0xff + nbt.Block(val)<<8
+	}
+	return block
+}
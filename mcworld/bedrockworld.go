@@ -0,0 +1,333 @@
+package mcworld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/leveldb"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	BedrockArchiveError = errors.New("Bedrock worlds must be extracted from their archive before they can be opened")
+)
+
+const BedrockHeight = 256
+
+// From 1.18 subchunks run from -4 to 19, so chunks are 384 blocks high from
+// y -64.
+const (
+	bedrockMinSubChunk = -4
+	bedrockMaxSubChunk = 19
+)
+
+// Record types stored after the chunk coordinates (and dimension) in the
+// keys of a Bedrock world's database.
+const (
+	bedrockVersion       = 44
+	bedrockSubChunk      = 47
+	bedrockLegacyTerrain = 48
+	bedrockVersionOld    = 118
+)
+
+// BedrockWorld reads the LevelDB database in the db folder of a Bedrock
+// Edition world. Subchunks are converted to the numeric ids used by the
+// rest of mcobj. Chunks with subchunks below y 0 or above y 255 are 384
+// high with MinY -64, and the rest are BedrockHeight high.
+type BedrockWorld struct {
+	dir       string
+	db        *leveldb.DB
+	Dimension int // 0 is the overworld, 1 the nether and 2 the end
+}
+
+// IsBedrockWorld reports whether the directory holds a Bedrock world.
+func IsBedrockWorld(dir string) bool {
+	var _, err = os.Stat(filepath.Join(dir, "db", "CURRENT"))
+	return err == nil
+}
+
+func OpenBedrockWorld(dir string) (*BedrockWorld, error) {
+	var db, err = leveldb.Open(filepath.Join(dir, "db"))
+	if err != nil {
+		return nil, err
+	}
+	return &BedrockWorld{dir: dir, db: db}, nil
+}
+
+func (w *BedrockWorld) ReadLevel() (*nbt.Level, error) {
+	var file, err = os.Open(filepath.Join(w.dir, "level.dat"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return nbt.ReadBedrockLevelDat(file)
+}
+
+func (w *BedrockWorld) Close() error {
+	return w.db.Close()
+}
+
+func (w *BedrockWorld) key(x, z int, tag byte, extra ...byte) []byte {
+	var key = make([]byte, 0, 14)
+	key = binary.LittleEndian.AppendUint32(key, uint32(int32(x)))
+	key = binary.LittleEndian.AppendUint32(key, uint32(int32(z)))
+	if w.Dimension != 0 {
+		key = binary.LittleEndian.AppendUint32(key, uint32(int32(w.Dimension)))
+	}
+	key = append(key, tag)
+	return append(key, extra...)
+}
+
+// Chunk reads and converts a chunk.
+func (w *BedrockWorld) Chunk(x, z int) (*nbt.Chunk, error) {
+	if _, err := w.db.Get(w.key(x, z, bedrockVersion)); err == leveldb.ErrNotFound {
+		if _, err := w.db.Get(w.key(x, z, bedrockVersionOld)); err == leveldb.ErrNotFound {
+			return nil, ChunkNotFoundError
+		} else if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Worlds from before 1.0 keep the whole chunk in one record
+	if terrain, err := w.db.Get(w.key(x, z, bedrockLegacyTerrain)); err == nil {
+		var chunk = nbt.NewChunk(x, z, BedrockHeight)
+		return chunk, decodeLegacyTerrain(chunk, terrain)
+	} else if err != leveldb.ErrNotFound {
+		return nil, err
+	}
+
+	var subChunks = make(map[int][]byte)
+	var minCy, maxCy = 0, BedrockHeight/16 - 1
+	for cy := bedrockMinSubChunk; cy <= bedrockMaxSubChunk; cy++ {
+		var data, err = w.db.Get(w.key(x, z, bedrockSubChunk, byte(int8(cy))))
+		if err == leveldb.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		subChunks[cy] = data
+		if cy < 0 || cy > maxCy {
+			minCy, maxCy = bedrockMinSubChunk, bedrockMaxSubChunk
+		}
+	}
+
+	var chunk = nbt.NewChunk(x, z, 16*(maxCy-minCy+1))
+	chunk.MinY = 16 * minCy
+	for cy := minCy; cy <= maxCy; cy++ {
+		var data, ok = subChunks[cy]
+		if !ok {
+			continue
+		}
+		if err := decodeSubChunk(chunk, cy-minCy, data); err != nil {
+			return nil, errors.New(fmt.Sprintf("Chunk %v,%v subchunk %v: %v", x, z, cy, err))
+		}
+	}
+
+	return chunk, nil
+}
+
+func (w *BedrockWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
+	var chunk, err = w.Chunk(x, z)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := nbt.WriteChunkNbt(&buf, chunk); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+func (w *BedrockWorld) ChunkPool(mask ChunkMask) (ChunkPool, error) {
+	var keys, err = w.db.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var pool = &BedrockChunkPool{newChunkSet()}
+	for _, key := range keys {
+		var dimension int
+		switch len(key) {
+		case 9:
+		case 13:
+			dimension = int(int32(binary.LittleEndian.Uint32(key[8:])))
+		default:
+			continue
+		}
+
+		var tag = key[len(key)-1]
+		if dimension != w.Dimension || (tag != bedrockVersion && tag != bedrockVersionOld) {
+			continue
+		}
+
+		var (
+			x = int(int32(binary.LittleEndian.Uint32(key)))
+			z = int(int32(binary.LittleEndian.Uint32(key[4:])))
+		)
+		if !mask.IsMasked(x, z) {
+			pool.add(x, z)
+		}
+	}
+
+	return pool, nil
+}
+
+type BedrockChunkPool struct {
+	chunkSet
+}
+
+func (p *BedrockChunkPool) Iterator(order ChunkOrder) *ChunkIterator {
+	return NewChunkIterator(p, p.coords(), order)
+}
+
+// decodeLegacyTerrain reads the 128 high chunks of worlds from before 1.0:
+// block ids then data nibbles, both in XZY order.
+func decodeLegacyTerrain(chunk *nbt.Chunk, terrain []byte) error {
+	const blockCount = 16 * 16 * 128
+	if len(terrain) < blockCount+blockCount/2 {
+		return errors.New(fmt.Sprintf("Legacy terrain is %v bytes, expected at least %v", len(terrain), blockCount+blockCount/2))
+	}
+
+	for i := 0; i < blockCount; i++ {
+		var x, z, y = i >> 11, (i >> 7) & 15, i & 127
+		var data = terrain[blockCount+i/2]
+		if i&1 == 1 {
+			data >>= 4
+		}
+		chunk.SetBlock(x, y, z, nbt.Block(terrain[i])+nbt.Block(data&0xf)<<8)
+	}
+	return nil
+}
+
+// decodeSubChunk reads a 16x16x16 subchunk. Versions 1, 8 and 9 hold block
+// storages of palette indexes packed into 32 bit words, with a palette of
+// little endian NBT block states. The other versions hold numeric ids and
+// data nibbles.
+func decodeSubChunk(chunk *nbt.Chunk, cy int, data []byte) error {
+	if len(data) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	var r = nbt.NewLittleEndianReader(bytes.NewReader(data[1:]))
+	var storages = 1
+
+	switch version := data[0]; version {
+	case 1:
+	case 8, 9:
+		var count, err = r.ReadInt8()
+		if err != nil {
+			return err
+		}
+		storages = count & 0xff
+		if version == 9 {
+			// The subchunk's own y index, which matches the key's
+			if _, err := r.ReadInt8(); err != nil {
+				return err
+			}
+		}
+	default:
+		return decodeLegacySubChunk(chunk, cy, data[1:])
+	}
+
+	var blocks [4096]nbt.Block
+	for s := 0; s < storages; s++ {
+		var layer, err = readBlockStorage(r)
+		if err != nil {
+			return err
+		}
+
+		// The second storage holds water in waterlogged blocks, which
+		// only shows where the first storage is air
+		for i, block := range layer {
+			if blocks[i] == 0 {
+				blocks[i] = block
+			}
+		}
+	}
+
+	for i, block := range blocks {
+		var x, z, y = i >> 8, (i >> 4) & 15, i & 15
+		chunk.SetBlock(x, y+16*cy, z, block)
+	}
+	return nil
+}
+
+func decodeLegacySubChunk(chunk *nbt.Chunk, cy int, data []byte) error {
+	if len(data) < 4096+2048 {
+		return errors.New(fmt.Sprintf("Legacy subchunk is %v bytes, expected at least %v", len(data), 4096+2048))
+	}
+
+	for i := 0; i < 4096; i++ {
+		var x, z, y = i >> 8, (i >> 4) & 15, i & 15
+		var meta = data[4096+i/2]
+		if i&1 == 1 {
+			meta >>= 4
+		}
+		chunk.SetBlock(x, y+16*cy, z, nbt.Block(data[i])+nbt.Block(meta&0xf)<<8)
+	}
+	return nil
+}
+
+func readBlockStorage(r *nbt.Reader) ([]nbt.Block, error) {
+	var header, err = r.ReadInt8()
+	if err != nil {
+		return nil, err
+	}
+
+	var bits = (header & 0xff) >> 1
+	var indexes = make([]int, 4096)
+	var paletteSize = 1
+
+	if bits != 0 {
+		if bits > 16 {
+			return nil, errors.New(fmt.Sprintf("%v bits per block isn't supported", bits))
+		}
+
+		var perWord = 32 / bits
+		var words = (4096 + perWord - 1) / perWord
+		for w := 0; w < words; w++ {
+			var word, err = r.ReadInt32()
+			if err != nil {
+				return nil, err
+			}
+			for j := 0; j < perWord && w*perWord+j < 4096; j++ {
+				indexes[w*perWord+j] = int(uint32(word)>>uint(j*bits)) & (1<<uint(bits) - 1)
+			}
+		}
+
+		paletteSize, err = r.ReadInt32()
+		if err != nil {
+			return nil, err
+		}
+		if paletteSize < 0 || paletteSize > 4096 {
+			return nil, errors.New(fmt.Sprintf("Bad palette size %v", paletteSize))
+		}
+	}
+
+	var palette = make([]nbt.Block, paletteSize)
+	for i := range palette {
+		var state, err = r.ReadRoot()
+		if err != nil {
+			return nil, err
+		}
+		palette[i] = bedrockBlock(state)
+	}
+
+	var blocks = make([]nbt.Block, 4096)
+	for i, index := range indexes {
+		if index >= len(palette) {
+			return nil, errors.New(fmt.Sprintf("Palette index %v out of range of %v", index, len(palette)))
+		}
+		blocks[i] = palette[index]
+	}
+	return blocks, nil
+}
@@ -0,0 +1,276 @@
+package mcworld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/quag/mcobj/nbt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestBedrockWorld(t *testing.T) {
+	dir := openTestBedrockWorld(t)
+
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	level, err := world.(LevelReader).ReadLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level.SpawnX != 12 || level.SpawnY != 70 || level.SpawnZ != -30 {
+		t.Errorf("Spawn is %v,%v,%v not 12,70,-30", level.SpawnX, level.SpawnY, level.SpawnZ)
+	}
+
+	pool, err := world.ChunkPool(&AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Remaining() != 3 || !pool.Pop(0, 0) || !pool.Pop(-1, 2) || !pool.Pop(4, 4) {
+		t.Errorf("Pool doesn't hold just chunks 0,0, -1,2 and 4,4")
+	}
+
+	r, err := world.OpenChunk(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	chunk, err := nbt.ReadChunkNbt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		block   nbt.Block
+		x, y, z int
+	}{
+		{1, 0, 0, 0},
+		{5 + 1<<8, 1, 2, 3},
+		{9, 5, 5, 5},
+		{0, 6, 5, 5},
+		{35 + 8<<8, 15, 15, 15},
+		{1, 3, 16 + 5, 4},
+		{98 + 2<<8, 15, 31, 15},
+		{0, 0, 32, 0},
+	} {
+		if b := chunk.Block(c.x, c.y, c.z); b != c.block {
+			t.Errorf("Block at %v,%v,%v is %#x not %#x", c.x, c.y, c.z, b, c.block)
+		}
+	}
+
+	if _, err := world.OpenChunk(5, 5); err != ChunkNotFoundError {
+		t.Errorf("Missing chunk error is %v not %v", err, ChunkNotFoundError)
+	}
+}
+
+func TestBedrockCavesAndCliffsChunk(t *testing.T) {
+	world, err := OpenWorld(openTestBedrockWorld(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	r, err := world.OpenChunk(4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	chunk, err := nbt.ReadChunkNbt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chunk.MinY != -64 || chunk.Height() != 384 {
+		t.Fatalf("Chunk is %v high from y %v", chunk.Height(), chunk.MinY)
+	}
+	if b := chunk.Block(0, 0, 0); b != 1 {
+		t.Errorf("Block at y -64 is %#x not stone", b)
+	}
+	if b := chunk.Block(3, 309+64, 4); b != 1 {
+		t.Errorf("Block at y 309 is %#x not stone", b)
+	}
+}
+
+func TestBedrockNetherWorld(t *testing.T) {
+	world, err := OpenBedrockWorld(openTestBedrockWorld(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer world.Close()
+	world.Dimension = 1
+
+	pool, err := world.ChunkPool(&AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Remaining() != 1 || !pool.Pop(7, 7) {
+		t.Errorf("Pool doesn't hold just the nether chunk")
+	}
+
+	chunk, err := world.Chunk(7, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := chunk.Block(0, 0, 0); b != 87 {
+		t.Errorf("Nether block is %#x not netherrack", b)
+	}
+}
+
+// openTestBedrockWorld makes a world with chunk 0,0 holding a palette
+// subchunk at y 0 (version 9 with a water layer) and a numeric one at y 1
+// (version 0), chunk -1,2 with no subchunks, chunk 4,4 with subchunks at
+// y -4 and 19, and a nether chunk 7,7.
+func openTestBedrockWorld(t *testing.T) string {
+	dir := t.TempDir()
+
+	var level bytes.Buffer
+	level.Write(make([]byte, 8))
+	w := nbt.NewLittleEndianWriter(&level)
+	w.WriteTag(nbt.TagStruct, "")
+	for _, spawn := range []struct {
+		name  string
+		value int
+	}{{"SpawnX", 12}, {"SpawnY", 70}, {"SpawnZ", -30}} {
+		w.WriteTag(nbt.TagInt32, spawn.name)
+		w.WriteInt32(spawn.value)
+	}
+	w.WriteTag(nbt.TagStructEnd, "")
+	ioutil.WriteFile(filepath.Join(dir, "level.dat"), level.Bytes(), 0644)
+
+	var blocks [4096]int
+	blocks[xzy(0, 0, 0)] = 1
+	blocks[xzy(1, 2, 3)] = 2
+	blocks[xzy(15, 15, 15)] = 3
+	var water [4096]int
+	water[xzy(5, 5, 5)] = 1
+	water[xzy(0, 0, 0)] = 1
+
+	var subChunk bytes.Buffer
+	subChunk.Write([]byte{9, 2, 0})
+	writeBlockStorage(&subChunk, 2, blocks[:], []string{"minecraft:air", "minecraft:stone", "minecraft:planks", "minecraft:wool"}, []string{"", "", "spruce", "silver"})
+	writeBlockStorage(&subChunk, 1, water[:], []string{"minecraft:air", "minecraft:water"}, []string{"", ""})
+
+	legacy := make([]byte, 1+4096+2048)
+	legacy[1+xzy(3, 5, 4)] = 1
+	legacy[1+xzy(15, 15, 15)] = 98
+	legacy[1+4096+xzy(15, 15, 15)/2] = 2 << 4
+
+	var nether bytes.Buffer
+	nether.Write([]byte{8, 1})
+	nether.WriteByte(0 << 1)
+	writePalette(&nether, []string{"minecraft:netherrack"}, []string{""})
+
+	var deep bytes.Buffer
+	deep.Write([]byte{9, 1, 0xfc})
+	deep.WriteByte(0 << 1)
+	writePalette(&deep, []string{"minecraft:stone"}, []string{""})
+
+	writeTestLevelDB(t, filepath.Join(dir, "db"), map[string][]byte{
+		bedrockKey(0, 0, 0, bedrockVersion):        {40},
+		bedrockKey(0, 0, 0, bedrockSubChunk, 0):    subChunk.Bytes(),
+		bedrockKey(0, 0, 0, bedrockSubChunk, 1):    legacy,
+		bedrockKey(-1, 2, 0, bedrockVersionOld):    {3},
+		bedrockKey(4, 4, 0, bedrockVersion):        {40},
+		bedrockKey(4, 4, 0, bedrockSubChunk, 0xfc): deep.Bytes(),
+		bedrockKey(4, 4, 0, bedrockSubChunk, 19):   legacy,
+		bedrockKey(7, 7, 1, bedrockVersion):        {40},
+		bedrockKey(7, 7, 1, bedrockSubChunk, 0):    nether.Bytes(),
+		bedrockKey(3, 3, 0, bedrockSubChunk, 0):    subChunk.Bytes(),
+		"~local_player":                            {},
+	})
+
+	return dir
+}
+
+func xzy(x, y, z int) int {
+	return x<<8 | z<<4 | y
+}
+
+func bedrockKey(x, z, dimension int, tag byte, extra ...byte) string {
+	w := &BedrockWorld{Dimension: dimension}
+	return string(w.key(x, z, tag, extra...))
+}
+
+func writeBlockStorage(buf *bytes.Buffer, bits int, indexes []int, names, states []string) {
+	buf.WriteByte(byte(bits << 1))
+	perWord := 32 / bits
+	for i := 0; i < len(indexes); i += perWord {
+		var word uint32
+		for j := 0; j < perWord && i+j < len(indexes); j++ {
+			word |= uint32(indexes[i+j]) << uint(j*bits)
+		}
+		binary.Write(buf, binary.LittleEndian, word)
+	}
+	binary.Write(buf, binary.LittleEndian, int32(len(names)))
+	writePalette(buf, names, states)
+}
+
+// writePalette writes block states with at most one state, which is named
+// after the block's wood_type or color.
+func writePalette(buf *bytes.Buffer, names, states []string) {
+	w := nbt.NewLittleEndianWriter(buf)
+	for i, name := range names {
+		w.WriteTag(nbt.TagStruct, "")
+		w.WriteTag(nbt.TagString, "name")
+		w.WriteString(name)
+		w.WriteTag(nbt.TagStruct, "states")
+		if states[i] != "" {
+			key := "wood_type"
+			if name == "minecraft:wool" {
+				key = "color"
+			}
+			w.WriteTag(nbt.TagString, key)
+			w.WriteString(states[i])
+		}
+		w.WriteTag(nbt.TagStructEnd, "")
+		w.WriteTag(nbt.TagStructEnd, "")
+	}
+}
+
+// writeTestLevelDB writes the records into the write-ahead log of an
+// otherwise empty database.
+func writeTestLevelDB(t *testing.T, dir string, records map[string][]byte) {
+	os.MkdirAll(dir, 0755)
+
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	batch := binary.LittleEndian.AppendUint64(nil, 1)
+	batch = binary.LittleEndian.AppendUint32(batch, uint32(len(keys)))
+	for _, key := range keys {
+		batch = append(batch, 1)
+		batch = binary.AppendUvarint(batch, uint64(len(key)))
+		batch = append(batch, key...)
+		batch = binary.AppendUvarint(batch, uint64(len(records[key])))
+		batch = append(batch, records[key]...)
+	}
+
+	// Log number 3
+	manifest := []byte{2, 3}
+
+	ioutil.WriteFile(filepath.Join(dir, "CURRENT"), []byte("MANIFEST-000001\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "MANIFEST-000001"), logRecord(manifest), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "000003.log"), logRecord(batch), 0644)
+}
+
+func logRecord(data []byte) []byte {
+	if len(data) > 32*1024-7 {
+		panic("Test log record doesn't fit in a block")
+	}
+	table := crc32.MakeTable(crc32.Castagnoli)
+	crc := crc32.Update(crc32.Checksum([]byte{1}, table), table, data)
+	record := binary.LittleEndian.AppendUint32(nil, (crc>>15|crc<<17)+0xa282ead8)
+	record = binary.LittleEndian.AppendUint16(record, uint16(len(data)))
+	record = append(record, 1)
+	return append(record, data...)
+}
@@ -1,15 +1,15 @@
 package mcworld
 
 import (
+	"compress/gzip"
 	"compress/zlib"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"github.com/quag/mcobj/nbt"
 	"io"
-	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
+	"io/ioutil"
+	"path"
 )
 
 var (
@@ -17,88 +17,119 @@ var (
 )
 
 type BetaWorld struct {
-	worldDir string
+	store   worldStore
+	regions *regionCache
+	index   *WorldIndex
 }
 
-type McrFile struct {
-	*os.File
+func newBetaWorld(store worldStore) *BetaWorld {
+	return &BetaWorld{store: store, regions: newRegionCache(store, DefaultRegionCacheSize, false)}
 }
 
-func (w *BetaWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
-	mcaName := fmt.Sprintf("r.%v.%v.mca", x>>5, z>>5)
-	mcaPath := filepath.Join(w.worldDir, "region", mcaName)
+// SetIndex makes ChunkPool take the chunks from the index for regions that
+// haven't changed, and record the regions that have.
+func (w *BetaWorld) SetIndex(index *WorldIndex) {
+	w.index = index
+}
 
-	mcrName := fmt.Sprintf("r.%v.%v.mcr", x>>5, z>>5)
-	mcrPath := filepath.Join(w.worldDir, "region", mcrName)
+// ConfigureRegionCache sets how many region files are kept open at once and
+// whether they are memory mapped rather than read with pread. Files already
+// open are closed.
+func (w *BetaWorld) ConfigureRegionCache(size int, mmap bool) error {
+	var err = w.regions.Close()
+	w.regions = newRegionCache(w.store, size, mmap)
+	return err
+}
 
-	var path string
-	if _, err := os.Stat(mcaPath); err == nil {
-		path = mcaPath
-	} else {
-		path = mcrPath
-	}
+func (w *BetaWorld) ReadLevel() (*nbt.Level, error) {
+	return readLevel(w.store)
+}
 
-	file, openErr := os.Open(path)
-	if openErr != nil {
-		return nil, openErr
+func (w *BetaWorld) Close() error {
+	var regionsErr = w.regions.Close()
+	var storeErr = w.store.Close()
+	if regionsErr != nil {
+		return regionsErr
 	}
-	defer func() {
-		if file != nil {
-			file.Close()
-		}
-	}()
+	return storeErr
+}
 
-	var mcr = &McrFile{file}
-	var loc, readLocErr = mcr.ReadLocation(x, z)
-	if readLocErr != nil {
-		return nil, readLocErr
+// OpenChunk is safe to call from many goroutines at once.
+func (w *BetaWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
+	var region, acquireErr = w.regions.acquire(x, z)
+	if acquireErr != nil {
+		return nil, acquireErr
+	}
+	if region == nil {
+		return nil, ChunkNotFoundError
 	}
 
-	if loc == 0 {
-		return nil, errors.New(fmt.Sprintf("Chunk missing: %v,%v in %v. %v", x, z, mcaName, (x&31)+(z&31)*32))
+	var r, err = openRegionChunk(w.store, region, x, z)
+	if err != nil {
+		w.regions.release(region)
+		return nil, err
 	}
 
-	var (
-		length          uint32
-		compressionType byte
-	)
+	return &ReadCloserPair{r, &regionReleaser{w.regions, region}}, nil
+}
 
-	var _, seekErr = mcr.Seek(int64(loc.Offset()), 0)
-	if seekErr != nil {
-		return nil, seekErr
-	}
+const (
+	CompressionGzip         = 1
+	CompressionZlib         = 2
+	CompressionUncompressed = 3
+)
 
-	var lengthReadErr = binary.Read(mcr, binary.BigEndian, &length)
-	if lengthReadErr != nil {
-		return nil, lengthReadErr
+// openRegionChunk opens a chunk in a region file. Chunks too big for the
+// region file have the 0x80 bit set on their compression type and are
+// stored in a c.x.z.mcc file beside it.
+func openRegionChunk(store worldStore, region *regionFile, x, z int) (io.ReadCloser, error) {
+	var loc = region.location(x, z)
+	if loc == 0 {
+		return nil, ChunkNotFoundError
 	}
 
-	var compressionTypeErr = binary.Read(mcr, binary.BigEndian, &compressionType)
-	if compressionTypeErr != nil {
-		return nil, compressionTypeErr
+	var header [5]byte
+	var _, readErr = region.r.ReadAt(header[:], int64(loc.Offset()))
+	if readErr != nil {
+		return nil, readErr
 	}
 
-	var r, zlibNewErr = zlib.NewReader(mcr)
-	if zlibNewErr != nil {
-		return nil, zlibNewErr
+	var (
+		length                    = int64(binary.BigEndian.Uint32(header[:4]))
+		compressionType           = header[4]
+		data            io.Reader = io.NewSectionReader(region.r, int64(loc.Offset())+5, length-1)
+	)
+
+	if compressionType&0x80 != 0 {
+		var file, openErr = store.Open(fmt.Sprintf("%v/c.%v.%v.mcc", path.Dir(region.name), x, z))
+		if openErr != nil {
+			return nil, openErr
+		}
+		var r, err = decompressRegionChunk(compressionType&0x7f, file)
+		if err != nil {
+			file.Close()
+			return nil, errors.New(fmt.Sprintf("Chunk %v,%v in %v: %v", x, z, region.name, err))
+		}
+		return &ReadCloserPair{r, file}, nil
 	}
 
-	var pair = &ReadCloserPair{r, file}
-	file = nil
-	return pair, nil
+	var r, err = decompressRegionChunk(compressionType, data)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Chunk %v,%v in %v: %v", x, z, region.name, err))
+	}
+	return r, nil
 }
 
-func (r McrFile) ReadLocation(x, z int) (ChunkLocation, error) {
-	var _, seekErr = r.Seek(int64(4*((x&31)+(z&31)*32)), 0)
-	if seekErr != nil {
-		return ChunkLocation(0), seekErr
+func decompressRegionChunk(compressionType byte, data io.Reader) (io.ReadCloser, error) {
+	switch compressionType {
+	case CompressionGzip:
+		return gzip.NewReader(data)
+	case CompressionZlib:
+		return zlib.NewReader(data)
+	case CompressionUncompressed:
+		return ioutil.NopCloser(data), nil
 	}
-	var location uint32
-	var readErr = binary.Read(r, binary.BigEndian, &location)
-	if readErr != nil {
-		return ChunkLocation(0), readErr
-	}
-	return ChunkLocation(location), nil
+	return nil, errors.New(fmt.Sprintf("unknown compression type %v", compressionType))
 }
 
 type ChunkLocation uint32
@@ -112,99 +143,140 @@ func (cl ChunkLocation) Sectors() int {
 }
 
 func (w *BetaWorld) ChunkPool(mask ChunkMask) (ChunkPool, error) {
-	var regionDirname = filepath.Join(w.worldDir, "region")
-	var dir, dirOpenErr = os.Open(regionDirname)
-	if dirOpenErr != nil {
-		return nil, dirOpenErr
+	var filenames, readErr = w.store.ReadDirNames("region")
+	if readErr != nil {
+		return nil, readErr
 	}
-	defer dir.Close()
 
-	var pool = &BetaChunkPool{make(map[uint64]bool), EmptyBoundingBox()}
+	var pool = &BetaChunkPool{newChunkSet()}
 
-	for {
-		var filenames, readErr = dir.Readdirnames(1)
-		if readErr == io.EOF || len(filenames) == 0 {
-			break
-		}
-		if readErr != nil {
-			return nil, readErr
+	var names = make(map[string]bool)
+	for _, filename := range filenames {
+		names[filename] = true
+	}
+
+	for _, filename := range filenames {
+		if rx, rz, ok := parseRegionName(filename); ok {
+			var mcrErr error
+			if w.index == nil {
+				mcrErr = w.poolMcrChunks(mask, pool, rx, rz)
+			} else if path.Ext(filename) == ".mca" || !names[fmt.Sprintf("r.%v.%v.mca", rx, rz)] {
+				// Only the file the region cache reads is indexed
+				mcrErr = w.poolIndexedChunks(mask, pool, "region/"+filename, rx, rz)
+			}
+			if mcrErr != nil {
+				return nil, mcrErr
+			}
 		}
+	}
 
-		var fields = strings.FieldsFunc(filenames[0], func(c rune) bool { return c == '.' })
+	return pool, nil
+}
 
-		if len(fields) == 4 {
-			var (
-				rx, rxErr = strconv.Atoi(fields[1])
-				rz, ryErr = strconv.Atoi(fields[2])
-			)
+func (w *BetaWorld) poolIndexedChunks(mask ChunkMask, pool *BetaChunkPool, name string, rx, rz int) error {
+	var info, statErr = w.store.Stat(name)
+	if statErr != nil {
+		return statErr
+	}
 
-			if rxErr == nil && ryErr == nil {
-				var regionFilename = filepath.Join(regionDirname, filenames[0])
-				var mcrErr = w.poolMcrChunks(regionFilename, mask, pool, rx, rz)
-				if mcrErr != nil {
-					return nil, mcrErr
-				}
-			}
+	var r = w.index.region(name, info)
+	if r == nil {
+		var err error
+		if r, err = w.indexRegion(rx, rz, w.index.staleRegion(name)); err != nil {
+			return err
 		}
+		r.Size, r.ModTime = info.Size(), info.ModTime().UnixNano()
+		w.index.setRegion(name, r)
 	}
 
-	return pool, nil
+	for _, i := range r.Chunks {
+		var x, z = rx*32 + i%32, rz*32 + i/32
+		if !mask.IsMasked(x, z) {
+			pool.add(x, z)
+		}
+	}
+	return nil
 }
 
-func (w *BetaWorld) poolMcrChunks(regionFilename string, mask ChunkMask, pool *BetaChunkPool, rx, rz int) error {
-	var region, regionOpenErr = os.Open(regionFilename)
-	if regionOpenErr != nil {
-		return regionOpenErr
+// indexRegion reads a region's header, and its chunks when height maps are
+// being recorded. Height maps are taken from old, the region's previous
+// entry, for chunks whose timestamps haven't changed.
+func (w *BetaWorld) indexRegion(rx, rz int, old *regionIndex) (*regionIndex, error) {
+	var region, acquireErr = w.regions.acquire(rx*32, rz*32)
+	if acquireErr != nil {
+		return nil, acquireErr
+	}
+	if region == nil {
+		return &regionIndex{}, nil
+	}
+	defer w.regions.release(region)
+
+	var timestamps [4096]byte
+	if region.r != nil {
+		if _, err := region.r.ReadAt(timestamps[:], 4096); err != nil && err != io.EOF {
+			return nil, err
+		}
 	}
-	defer region.Close()
 
-	for cz := 0; cz < 32; cz++ {
-		for cx := 0; cx < 32; cx++ {
-			var location uint32
-			var readErr = binary.Read(region, binary.BigEndian, &location)
-			if readErr == io.EOF {
+	var r = &regionIndex{Chunks: make([]int, 0), Timestamps: make([]int32, 0)}
+	for i, location := range region.locations {
+		if location == 0 {
+			continue
+		}
+		r.Chunks = append(r.Chunks, i)
+		r.Timestamps = append(r.Timestamps, int32(binary.BigEndian.Uint32(timestamps[4*i:])))
+	}
+
+	if w.index.HeightMaps {
+		r.HeightMaps = make([][]int16, len(r.Chunks))
+		for j, i := range r.Chunks {
+			if heights := old.unchangedHeightMap(i, r.Timestamps[j]); heights != nil {
+				r.HeightMaps[j] = heights
 				continue
 			}
-			if readErr != nil {
-				return readErr
+			// Chunks that can't be read are left without a height map
+			var chunk, err = readChunk(w, rx*32+i%32, rz*32+i/32)
+			if err != nil {
+				r.HeightMaps[j] = []int16{}
+				continue
 			}
-			if location != 0 {
-				var (
-					x = rx*32 + cx
-					z = rz*32 + cz
-				)
-
-				if !mask.IsMasked(x, z) {
-					pool.chunkMap[betaChunkPoolKey(x, z)] = true
-					pool.box.Union(x, z)
-				}
+			var heights = chunkHeightMap(chunk)
+			r.HeightMaps[j] = make([]int16, len(heights))
+			for k, h := range heights {
+				r.HeightMaps[j][k] = int16(h)
 			}
 		}
 	}
-
-	return nil
+	return r, nil
 }
 
-type BetaChunkPool struct {
-	chunkMap map[uint64]bool
-	box      *BoundingBox
-}
+func (w *BetaWorld) poolMcrChunks(mask ChunkMask, pool *BetaChunkPool, rx, rz int) error {
+	var region, acquireErr = w.regions.acquire(rx*32, rz*32)
+	if acquireErr != nil || region == nil {
+		return acquireErr
+	}
+	defer w.regions.release(region)
 
-func (p *BetaChunkPool) Pop(x, z int) bool {
-	var key = betaChunkPoolKey(x, z)
-	var _, exists = p.chunkMap[key]
-	delete(p.chunkMap, key)
-	return exists
-}
+	for i, location := range region.locations {
+		if location != 0 {
+			var (
+				x = rx*32 + i%32
+				z = rz*32 + i/32
+			)
+
+			if !mask.IsMasked(x, z) {
+				pool.add(x, z)
+			}
+		}
+	}
 
-func (p *BetaChunkPool) Remaining() int {
-	return len(p.chunkMap)
+	return nil
 }
 
-func (p *BetaChunkPool) BoundingBox() *BoundingBox {
-	return p.box
+type BetaChunkPool struct {
+	chunkSet
 }
 
-func betaChunkPoolKey(x, z int) uint64 {
-	return uint64(x)<<32 + uint64(z)
+func (p *BetaChunkPool) Iterator(order ChunkOrder) *ChunkIterator {
+	return NewChunkIterator(p, p.coords(), order)
 }
@@ -0,0 +1,192 @@
+package mcworld
+
+import (
+	"container/list"
+	"github.com/quag/mcobj/nbt"
+	"os"
+	"sync"
+)
+
+const DefaultBlockAccessSize = 256
+
+// BlockAccess reads and changes blocks by world block coordinates, however
+// many chunks apart they are. The most recently used chunks are kept
+// decoded. Chunks that have been changed are never dropped, and are handed
+// back by ModifiedChunks so they can be saved.
+//
+// Blocks in chunks that don't exist, and above or below a chunk, read as
+// air. BlockAccess is safe for use by many goroutines.
+type BlockAccess struct {
+	lock     sync.Mutex
+	world    ChunkOpener
+	capacity int
+	chunks   map[ChunkCoord]*list.Element
+	lru      *list.List
+}
+
+type accessChunk struct {
+	coord    ChunkCoord
+	chunk    *nbt.Chunk
+	modified bool
+}
+
+func NewBlockAccess(world ChunkOpener, capacity int) *BlockAccess {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &BlockAccess{world: world, capacity: capacity, chunks: make(map[ChunkCoord]*list.Element), lru: list.New()}
+}
+
+// Chunk returns the decoded chunk at chunk coordinates x, z, or nil if there
+// is no chunk there.
+func (a *BlockAccess) Chunk(x, z int) (*nbt.Chunk, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var c, err = a.chunk(x, z)
+	if err != nil {
+		return nil, err
+	}
+	return c.chunk, nil
+}
+
+func (a *BlockAccess) chunk(x, z int) (*accessChunk, error) {
+	var coord = ChunkCoord{x, z}
+	if e, ok := a.chunks[coord]; ok {
+		a.lru.MoveToFront(e)
+		return e.Value.(*accessChunk), nil
+	}
+
+	var chunk, err = a.load(x, z)
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &accessChunk{coord: coord, chunk: chunk}
+	a.chunks[coord] = a.lru.PushFront(c)
+
+	for e := a.lru.Back(); e != nil && a.lru.Len() > a.capacity; {
+		var prev = e.Prev()
+		if old := e.Value.(*accessChunk); !old.modified {
+			a.lru.Remove(e)
+			delete(a.chunks, old.coord)
+		}
+		e = prev
+	}
+
+	return c, nil
+}
+
+func (a *BlockAccess) load(x, z int) (*nbt.Chunk, error) {
+	var chunk, err = readChunk(a.world, x, z)
+	if err == ChunkNotFoundError || os.IsNotExist(err) {
+		return nil, nil
+	}
+	return chunk, err
+}
+
+func (a *BlockAccess) BlockAt(x, y, z int) (nbt.Block, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var c, err = a.chunk(x>>4, z>>4)
+	if err != nil || c.chunk == nil || y < c.chunk.MinY || y >= c.chunk.MinY+c.chunk.Height() {
+		return 0, err
+	}
+	return c.chunk.Block(x&15, y-c.chunk.MinY, z&15), nil
+}
+
+// SetBlockAt changes a block. It fails with ChunkNotFoundError if the chunk
+// doesn't exist. Blocks above or below the chunk are ignored.
+func (a *BlockAccess) SetBlockAt(x, y, z int, block nbt.Block) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var c, err = a.chunk(x>>4, z>>4)
+	if err != nil {
+		return err
+	}
+	if c.chunk == nil {
+		return ChunkNotFoundError
+	}
+	if y < c.chunk.MinY || y >= c.chunk.MinY+c.chunk.Height() {
+		return nil
+	}
+	c.chunk.SetBlock(x&15, y-c.chunk.MinY, z&15, block)
+	c.modified = true
+	return nil
+}
+
+// Column returns a copy of the blocks from the bottom to the top of the
+// world at x, z. It is empty if there is no chunk there.
+func (a *BlockAccess) Column(x, z int) ([]nbt.Block, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var c, err = a.chunk(x>>4, z>>4)
+	if err != nil || c.chunk == nil {
+		return nil, err
+	}
+	var height = c.chunk.Height()
+	var i = height * ((z & 15) + 16*(x&15))
+	return append([]nbt.Block(nil), c.chunk.Blocks[i:i+height]...), nil
+}
+
+// Height returns the height of the column at x, z: one above its highest
+// block that isn't air, or the bottom of the world if it is all air, or 0 if
+// there is no chunk there.
+func (a *BlockAccess) Height(x, z int) (int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var c, err = a.chunk(x>>4, z>>4)
+	if err != nil || c.chunk == nil {
+		return 0, err
+	}
+	return columnHeight(c.chunk, x&15, z&15), nil
+}
+
+// HeightMap returns the height of every column of the chunk at chunk
+// coordinates x, z, indexed by x + 16*z like Minecraft's own height maps. It
+// is nil if there is no chunk there.
+func (a *BlockAccess) HeightMap(x, z int) ([]int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var c, err = a.chunk(x, z)
+	if err != nil || c.chunk == nil {
+		return nil, err
+	}
+	return chunkHeightMap(c.chunk), nil
+}
+
+func chunkHeightMap(chunk *nbt.Chunk) []int {
+	var heights = make([]int, 256)
+	for i := range heights {
+		heights[i] = columnHeight(chunk, i%16, i/16)
+	}
+	return heights
+}
+
+func columnHeight(chunk *nbt.Chunk, x, z int) int {
+	for y := chunk.Height() - 1; y >= 0; y-- {
+		if chunk.Block(x, y, z) != 0 {
+			return chunk.MinY + y + 1
+		}
+	}
+	return chunk.MinY
+}
+
+// ModifiedChunks returns the chunks changed with SetBlockAt.
+func (a *BlockAccess) ModifiedChunks() []*nbt.Chunk {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var chunks = make([]*nbt.Chunk, 0)
+	for e := a.lru.Front(); e != nil; e = e.Next() {
+		if c := e.Value.(*accessChunk); c.modified {
+			chunks = append(chunks, c.chunk)
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,66 @@
+package mcworld
+
+import (
+	"testing"
+)
+
+func TestBlockAccess(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.SetBlock(-1, 10, -1, 1)
+	mw.SetBlock(0, 20, 0, 2)
+	mw.SetBlock(100, 30, 5, 3)
+
+	access := NewBlockAccess(mw, 2)
+	for _, c := range []struct {
+		x, y, z int
+		block   int
+	}{
+		{-1, 10, -1, 1},
+		{0, 20, 0, 2},
+		{100, 30, 5, 3},
+		{0, 19, 0, 0},
+		{0, -1, 0, 0},
+		{0, 256, 0, 0},
+		{1000, 0, 1000, 0},
+	} {
+		b, err := access.BlockAt(c.x, c.y, c.z)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(b) != c.block {
+			t.Errorf("Block at %v,%v,%v is %v not %v", c.x, c.y, c.z, b, c.block)
+		}
+	}
+
+	if err := access.SetBlockAt(0, 40, 0, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.SetBlockAt(1000, 0, 1000, 4); err != ChunkNotFoundError {
+		t.Errorf("Setting a block in a missing chunk gave %v", err)
+	}
+
+	// Read past the capacity so the changed chunk would have been dropped
+	for x := 0; x < 5; x++ {
+		access.BlockAt(x*16, 0, 64)
+	}
+	if b, _ := access.BlockAt(0, 40, 0); b != 4 {
+		t.Errorf("Changed block is %v not 4", b)
+	}
+	if modified := access.ModifiedChunks(); len(modified) != 1 || modified[0].XPos != 0 || modified[0].ZPos != 0 {
+		t.Errorf("Modified chunks are %v", modified)
+	}
+
+	if h, _ := access.Height(0, 0); h != 41 {
+		t.Errorf("Height at 0,0 is %v not 41", h)
+	}
+	heights, err := access.HeightMap(-1, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heights[15+16*15] != 11 || heights[0] != 0 {
+		t.Errorf("Heights are %v and %v, not 11 and 0", heights[15+16*15], heights[0])
+	}
+	if column, _ := access.Column(100, 5); len(column) != MemoryWorldHeight || column[30] != 3 {
+		t.Errorf("Column at 100,5 is wrong")
+	}
+}
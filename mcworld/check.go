@@ -0,0 +1,256 @@
+package mcworld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Kinds of Problem found by CheckWorld.
+const (
+	ProblemTruncated      = "truncated"
+	ProblemSectorRange    = "sector-range"
+	ProblemSectorOverlap  = "sector-overlap"
+	ProblemLengthMismatch = "length-mismatch"
+	ProblemCompression    = "compression"
+	ProblemDecompress     = "decompress"
+	ProblemNbt            = "nbt"
+	ProblemPosition       = "position"
+	ProblemOpen           = "open"
+
+	// ProblemUnsupported is an intact chunk in a format that can't be
+	// decoded. It isn't counted as damage.
+	ProblemUnsupported = "unsupported"
+)
+
+// Problem is a fault in a world's files. Chunk is nil when the problem is
+// with a region file as a whole.
+type Problem struct {
+	File    string      `json:"file,omitempty"`
+	Chunk   *ChunkCoord `json:"chunk,omitempty"`
+	Kind    string      `json:"kind"`
+	Message string      `json:"message"`
+}
+
+func (p Problem) String() string {
+	var where = p.File
+	if p.Chunk != nil {
+		if where != "" {
+			where += ": "
+		}
+		where += fmt.Sprintf("chunk %v,%v", p.Chunk.X, p.Chunk.Z)
+	}
+	return fmt.Sprintf("%v: %v: %v", where, p.Kind, p.Message)
+}
+
+type CheckReport struct {
+	Regions  int       `json:"regions"`
+	Chunks   int       `json:"chunks"`
+	Damaged  int       `json:"damaged"`
+	Problems []Problem `json:"problems"`
+}
+
+func (r *CheckReport) add(file string, chunk *ChunkCoord, kind, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{file, chunk, kind, fmt.Sprintf(format, args...)})
+}
+
+// CheckWorld reads every chunk of the world looking for damage. The region
+// files of Beta and Anvil worlds are checked sector by sector; other worlds
+// only have each chunk read and decoded.
+func CheckWorld(world World) (*CheckReport, error) {
+	var report = &CheckReport{Problems: make([]Problem, 0)}
+
+	if beta, ok := world.(*BetaWorld); ok {
+		var err = beta.check(report)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var pool, err = world.ChunkPool(&AllChunksMask{})
+		if err != nil {
+			return nil, err
+		}
+		var chunks = pool.Iterator(&RowMajorChunkOrder{})
+		for x, z, ok := chunks.Next(); ok; x, z, ok = chunks.Next() {
+			report.Chunks++
+			var coord = &ChunkCoord{x, z}
+			var r, openErr = world.OpenChunk(x, z)
+			if openErr != nil {
+				report.add("", coord, ProblemOpen, "%v", openErr)
+				continue
+			}
+			var data, readErr = ioutil.ReadAll(r)
+			r.Close()
+			if readErr != nil {
+				report.add("", coord, ProblemDecompress, "%v", readErr)
+				continue
+			}
+			checkChunkNbt(report, "", coord, data)
+		}
+	}
+
+	var damaged = make(map[ChunkCoord]bool)
+	for _, p := range report.Problems {
+		if p.Chunk != nil && p.Kind != ProblemUnsupported {
+			damaged[*p.Chunk] = true
+		}
+	}
+	report.Damaged = len(damaged)
+	return report, nil
+}
+
+func checkChunkNbt(report *CheckReport, file string, coord *ChunkCoord, data []byte) {
+	var chunk, err = nbt.ReadChunkNbt(bytes.NewReader(data))
+	if unsupported, ok := err.(*nbt.UnsupportedChunkError); ok {
+		report.add(file, coord, ProblemUnsupported, "%v", unsupported)
+		if x, z, ok := chunkPosition(data); ok && (x != coord.X || z != coord.Z) {
+			report.add(file, coord, ProblemPosition, "Chunk says it is at %v,%v", x, z)
+		}
+		return
+	}
+	if err != nil {
+		report.add(file, coord, ProblemNbt, "%v", err)
+		return
+	}
+	if chunk.XPos != coord.X || chunk.ZPos != coord.Z {
+		report.add(file, coord, ProblemPosition, "Chunk says it is at %v,%v", chunk.XPos, chunk.ZPos)
+	}
+}
+
+// parseRegionName returns the region coordinates from a name like
+// r.-1.2.mca.
+func parseRegionName(filename string) (rx, rz int, ok bool) {
+	var fields = strings.FieldsFunc(filename, func(c rune) bool { return c == '.' })
+	if len(fields) != 4 || fields[0] != "r" || (fields[3] != "mca" && fields[3] != "mcr") {
+		return 0, 0, false
+	}
+	var rxErr, rzErr error
+	rx, rxErr = strconv.Atoi(fields[1])
+	rz, rzErr = strconv.Atoi(fields[2])
+	return rx, rz, rxErr == nil && rzErr == nil
+}
+
+func (w *BetaWorld) check(report *CheckReport) error {
+	return w.EachRegion(func(name string, rx, rz int, data []byte) error {
+		report.Regions++
+		w.checkRegion(report, name, rx, rz, data)
+		return nil
+	})
+}
+
+// checkRegion checks a region file's location table against the sectors it
+// points to and then decodes each chunk.
+func (w *BetaWorld) checkRegion(report *CheckReport, name string, rx, rz int, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if len(data) < 8192 {
+		report.add(name, nil, ProblemTruncated, "Header is %v bytes, not 8192", len(data))
+	}
+
+	var (
+		sectors = (len(data) + 4095) / 4096
+		owners  = make([]int, sectors)
+	)
+	for i := range owners {
+		owners[i] = -1
+	}
+
+	for i := 0; i < 1024 && 4*i+4 <= len(data); i++ {
+		var loc = ChunkLocation(binary.BigEndian.Uint32(data[4*i:]))
+		if loc == 0 {
+			continue
+		}
+		report.Chunks++
+
+		var (
+			coord = &ChunkCoord{rx*32 + i%32, rz*32 + i/32}
+			first = loc.Offset() / 4096
+			count = loc.Sectors()
+		)
+
+		if count == 0 {
+			report.add(name, coord, ProblemSectorRange, "Chunk at sector %v has no sectors", first)
+			continue
+		}
+		if first < 2 {
+			report.add(name, coord, ProblemSectorRange, "Sectors %v to %v overlap the header", first, first+count-1)
+			continue
+		}
+		if first >= sectors {
+			report.add(name, coord, ProblemTruncated, "Sector %v is past the end of the file's %v sectors", first, sectors)
+			continue
+		}
+
+		var overlapped = false
+		for s := first; s < first+count && s < sectors; s++ {
+			if owners[s] >= 0 {
+				var other = owners[s]
+				report.add(name, coord, ProblemSectorOverlap, "Sector %v is also used by chunk %v,%v", s, rx*32+other%32, rz*32+other/32)
+				overlapped = true
+				break
+			}
+			owners[s] = i
+		}
+		if overlapped {
+			continue
+		}
+
+		if loc.Offset()+5 > len(data) {
+			report.add(name, coord, ProblemTruncated, "Chunk header is past the end of the file")
+			continue
+		}
+		var (
+			length      = int(binary.BigEndian.Uint32(data[loc.Offset():]))
+			compression = data[loc.Offset()+4]
+		)
+		if length < 1 || (length+4+4095)/4096 != count {
+			report.add(name, coord, ProblemLengthMismatch, "Length %v doesn't fit %v sectors", length, count)
+			if length < 1 || (length+4+4095)/4096 > count {
+				continue
+			}
+		}
+
+		var payload []byte
+		if compression&0x80 != 0 {
+			// Chunks too big for a region file are stored beside it
+			var external = fmt.Sprintf("%v/c.%v.%v.mcc", path.Dir(name), coord.X, coord.Z)
+			var file, err = w.store.Open(external)
+			if err != nil {
+				report.add(name, coord, ProblemTruncated, "%v", err)
+				continue
+			}
+			payload, err = ioutil.ReadAll(file)
+			file.Close()
+			if err != nil {
+				report.add(external, coord, ProblemTruncated, "%v", err)
+				continue
+			}
+			compression &^= 0x80
+		} else {
+			var end = loc.Offset() + 4 + length
+			if end > len(data) {
+				report.add(name, coord, ProblemTruncated, "Chunk ends %v bytes past the end of the file", end-len(data))
+				continue
+			}
+			payload = data[loc.Offset()+5 : end]
+		}
+
+		if compression != CompressionGzip && compression != CompressionZlib && compression != CompressionUncompressed {
+			report.add(name, coord, ProblemCompression, "Unknown compression type %v", compression)
+			continue
+		}
+		var chunkData, err = decompressChunk(compression, payload)
+		if err != nil {
+			report.add(name, coord, ProblemDecompress, "%v", err)
+			continue
+		}
+
+		checkChunkNbt(report, name, coord, chunkData)
+	}
+}
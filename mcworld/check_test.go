@@ -0,0 +1,134 @@
+package mcworld
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckWorld(t *testing.T) {
+	mw := NewMemoryWorld()
+	for x := 0; x < 6; x++ {
+		mw.SetBlock(x*16, 1, 0, 1)
+	}
+	region := testRegion(t, mw, 0, 0)
+
+	location := func(x int) uint32 { return binary.BigEndian.Uint32(region[4*x:]) }
+	sector := func(x int) int { return int(location(x)>>8) * 4096 }
+
+	// Chunk 1 shares chunk 0's sector, 2 has a bad compression byte, 3 has
+	// a length too long for its sector, 4 is in the slot for 5,0 and 5
+	// runs off the end of the truncated file.
+	binary.BigEndian.PutUint32(region[4*1:], location(0))
+	region[sector(2)+4] = 9
+	binary.BigEndian.PutUint32(region[sector(3):], 5000)
+	binary.BigEndian.PutUint32(region[4*31:], location(4))
+	binary.BigEndian.PutUint32(region[4*4:], 0)
+	region = region[:sector(5)+100]
+
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "region"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "region", "r.0.0.mca"), region, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "region", "r.1.0.mca"), make([]byte, 1000), 0644)
+
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	report, err := CheckWorld(world)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		file string
+		x    int
+		kind string
+	}{
+		{"region/r.0.0.mca", 1, ProblemSectorOverlap},
+		{"region/r.0.0.mca", 2, ProblemCompression},
+		{"region/r.0.0.mca", 3, ProblemLengthMismatch},
+		{"region/r.0.0.mca", 5, ProblemTruncated},
+		{"region/r.0.0.mca", 31, ProblemPosition},
+		{"region/r.1.0.mca", -1, ProblemTruncated},
+	}
+	if len(report.Problems) != len(expected) {
+		t.Fatalf("Problems %v, expected %v", report.Problems, expected)
+	}
+	for i, e := range expected {
+		p := report.Problems[i]
+		if p.File != e.file || p.Kind != e.kind || (p.Chunk == nil) != (e.x < 0) || (p.Chunk != nil && *p.Chunk != ChunkCoord{e.x, 0}) {
+			t.Errorf("Problem %v is %v, expected %v chunk %v %v", i, p, e.file, e.x, e.kind)
+		}
+	}
+
+	if report.Regions != 2 || report.Chunks != 6 || report.Damaged != 5 {
+		t.Errorf("%v regions, %v chunks and %v damaged, not 2, 6 and 5", report.Regions, report.Chunks, report.Damaged)
+	}
+}
+
+func TestCheckWorldDimensions(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.SetBlock(0, 1, 0, 1)
+	mw.SetBlock(16, 1, 0, 1)
+	region := testRegion(t, mw, 0, 0)
+
+	// The nether's second chunk claims no sectors
+	nether := append([]byte(nil), region...)
+	nether[4*1+3] = 0
+
+	dir := t.TempDir()
+	for _, d := range []string{"region", "DIM-1/region"} {
+		os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "region", "r.0.0.mca"), region, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "DIM-1", "region", "r.0.0.mca"), nether, 0644)
+
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	report, err := CheckWorld(world)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Regions != 2 || report.Chunks != 4 || len(report.Problems) != 1 {
+		t.Fatalf("%v regions, %v chunks and problems %v", report.Regions, report.Chunks, report.Problems)
+	}
+	if p := report.Problems[0]; p.File != "DIM-1/region/r.0.0.mca" || p.Kind != ProblemSectorRange || p.Message != "Chunk at sector 3 has no sectors" {
+		t.Errorf("Problem %v", p)
+	}
+}
+
+func TestCheckWorldUnsupportedChunk(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.SetBlock(0, 1, 0, 1)
+	region := testRegion(t, mw, 0, 0)
+
+	region = appendRegionChunk(region, 1, unsupportedChunkNbt(1, 0))
+
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "region"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "region", "r.0.0.mca"), region, 0644)
+
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	report, err := CheckWorld(world)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Kind != ProblemUnsupported || report.Damaged != 0 {
+		t.Errorf("%v damaged chunks and problems %v", report.Damaged, report.Problems)
+	}
+}
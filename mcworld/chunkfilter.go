@@ -0,0 +1,47 @@
+package mcworld
+
+import (
+	"github.com/quag/mcobj/nbt"
+)
+
+// ChunkFilter decides from a chunk's contents whether to use it. Filters
+// are applied to the chunks Walk delivers, so each chunk is decoded once.
+type ChunkFilter func(chunk *nbt.Chunk) bool
+
+// PopulatedFilter keeps chunks that have finished generating, leaving out
+// those at the edge of the explored area that are missing trees and ores.
+func PopulatedFilter(chunk *nbt.Chunk) bool {
+	return chunk.Populated
+}
+
+// InhabitedFilter keeps chunks players have spent at least ticks near.
+// There are 20 ticks a second.
+func InhabitedFilter(ticks int) ChunkFilter {
+	return func(chunk *nbt.Chunk) bool {
+		return chunk.InhabitedTime >= ticks
+	}
+}
+
+// ContainsFilter keeps chunks with at least one block that matches.
+func ContainsFilter(match func(nbt.Block) bool) ChunkFilter {
+	return func(chunk *nbt.Chunk) bool {
+		for _, block := range chunk.Blocks {
+			if match(block) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllFilters keeps the chunks every filter keeps. Nil filters are ignored.
+func AllFilters(filters ...ChunkFilter) ChunkFilter {
+	return func(chunk *nbt.Chunk) bool {
+		for _, filter := range filters {
+			if filter != nil && !filter(chunk) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,48 @@
+package mcworld
+
+import (
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"sort"
+	"testing"
+)
+
+func TestChunkFilters(t *testing.T) {
+	var w = NewMemoryWorld()
+	for x := 0; x < 4; x++ {
+		w.EmptyChunk(x, 0).InhabitedTime = x * 1000
+	}
+	w.Chunk(2, 0).Populated = false
+	w.SetBlock(16*3+5, 10, 2, 56)
+	w.SetBlock(16*1+5, 10, 2, 56)
+
+	var tests = []struct {
+		mask     ChunkMask
+		filter   ChunkFilter
+		expected string
+	}{
+		{&AllChunksMask{}, PopulatedFilter, "[0 1 3]"},
+		{&AllChunksMask{}, InhabitedFilter(2000), "[2 3]"},
+		{&AllChunksMask{}, ContainsFilter(func(block nbt.Block) bool { return block == 56 }), "[1 3]"},
+		{&AllChunksMask{}, AllFilters(PopulatedFilter, nil, InhabitedFilter(1000)), "[1 3]"},
+		{&RectangleChunkMask{X0: 2, Z0: 0, X1: 4, Z1: 1}, PopulatedFilter, "[3]"},
+	}
+
+	for i, test := range tests {
+		var walked = make([]int, 0)
+		var err = Walk(w, test.mask, nil, func(chunk *nbt.Chunk) error {
+			if !test.filter(chunk) {
+				return nil
+			}
+			walked = append(walked, chunk.XPos)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Ints(walked)
+		if fmt.Sprint(walked) != test.expected {
+			t.Errorf("Test %d walked %v not %v", i, walked, test.expected)
+		}
+	}
+}
@@ -1,5 +1,9 @@
 package mcworld
 
+import (
+	"math"
+)
+
 type ChunkMask interface {
 	IsMasked(x, z int) bool
 }
@@ -17,3 +21,31 @@ type AllChunksMask struct{}
 func (m *AllChunksMask) IsMasked(x, z int) bool {
 	return false
 }
+
+// CenteredChunkMask returns a mask for a square, or failing that a
+// rectangle, of chunks centered on chunk cx, cz along with how many chunks
+// it holds. Sizes of math.MaxInt32 aren't set. A rectangle with only one
+// side set extends without limit in the other direction, and with no sizes
+// set every chunk is used.
+func CenteredChunkMask(cx, cz, square, rectx, rectz int) (ChunkMask, int) {
+	if square != math.MaxInt32 {
+		var h = square / 2
+		return &RectangleChunkMask{X0: cx - h, Z0: cz - h, X1: cx - h + square, Z1: cz - h + square}, square * square
+	}
+
+	switch {
+	case rectx != math.MaxInt32 && rectz != math.MaxInt32:
+		var (
+			hx = rectx / 2
+			hz = rectz / 2
+		)
+		return &RectangleChunkMask{X0: cx - hx, Z0: cz - hz, X1: cx - hx + rectx, Z1: cz - hz + rectz}, rectx * rectz
+	case rectx != math.MaxInt32:
+		var hx = rectx / 2
+		return &RectangleChunkMask{X0: cx - hx, Z0: math.MinInt32, X1: cx - hx + rectx, Z1: math.MaxInt32}, math.MaxInt32
+	case rectz != math.MaxInt32:
+		var hz = rectz / 2
+		return &RectangleChunkMask{X0: math.MinInt32, Z0: cz - hz, X1: math.MaxInt32, Z1: cz - hz + rectz}, math.MaxInt32
+	}
+	return &AllChunksMask{}, math.MaxInt32
+}
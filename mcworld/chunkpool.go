@@ -0,0 +1,136 @@
+package mcworld
+
+import (
+	"sort"
+)
+
+type ChunkCoord struct {
+	X, Z int
+}
+
+// ChunkOrder decides the order a ChunkIterator visits the chunks of a pool.
+type ChunkOrder interface {
+	Less(a, b ChunkCoord) bool
+}
+
+// NearestChunkOrder visits chunks closest to the chunk X,Z first.
+type NearestChunkOrder struct {
+	X, Z int
+}
+
+func (o *NearestChunkOrder) Less(a, b ChunkCoord) bool {
+	var da, db = o.distance(a), o.distance(b)
+	if da != db {
+		return da < db
+	}
+	return rowMajorLess(a, b)
+}
+
+func (o *NearestChunkOrder) distance(c ChunkCoord) int {
+	var dx, dz = c.X - o.X, c.Z - o.Z
+	return dx*dx + dz*dz
+}
+
+// RowMajorChunkOrder visits chunks a row (constant z) at a time.
+type RowMajorChunkOrder struct{}
+
+func (o *RowMajorChunkOrder) Less(a, b ChunkCoord) bool {
+	return rowMajorLess(a, b)
+}
+
+// RegionChunkOrder visits all the chunks of one region file before moving
+// on to the next region file.
+type RegionChunkOrder struct{}
+
+func (o *RegionChunkOrder) Less(a, b ChunkCoord) bool {
+	var ra, rb = ChunkCoord{a.X >> 5, a.Z >> 5}, ChunkCoord{b.X >> 5, b.Z >> 5}
+	if ra != rb {
+		return rowMajorLess(ra, rb)
+	}
+	return rowMajorLess(a, b)
+}
+
+func rowMajorLess(a, b ChunkCoord) bool {
+	if a.Z != b.Z {
+		return a.Z < b.Z
+	}
+	return a.X < b.X
+}
+
+// ChunkIterator pops the chunks of a pool in a fixed order. Chunks popped
+// from the pool by other means are skipped.
+type ChunkIterator struct {
+	pool   ChunkPool
+	coords []ChunkCoord
+}
+
+func NewChunkIterator(pool ChunkPool, coords []ChunkCoord, order ChunkOrder) *ChunkIterator {
+	sort.Sort(&chunkCoordSorter{coords, order})
+	return &ChunkIterator{pool, coords}
+}
+
+func (it *ChunkIterator) Next() (x, z int, ok bool) {
+	for len(it.coords) != 0 {
+		var c = it.coords[0]
+		it.coords = it.coords[1:]
+		if it.pool.Pop(c.X, c.Z) {
+			return c.X, c.Z, true
+		}
+	}
+	return 0, 0, false
+}
+
+type chunkCoordSorter struct {
+	coords []ChunkCoord
+	order  ChunkOrder
+}
+
+func (s *chunkCoordSorter) Len() int {
+	return len(s.coords)
+}
+
+func (s *chunkCoordSorter) Less(i, j int) bool {
+	return s.order.Less(s.coords[i], s.coords[j])
+}
+
+func (s *chunkCoordSorter) Swap(i, j int) {
+	s.coords[i], s.coords[j] = s.coords[j], s.coords[i]
+}
+
+// chunkSet is the bookkeeping shared by the ChunkPool implementations.
+type chunkSet struct {
+	chunkMap map[ChunkCoord]bool
+	box      *BoundingBox
+}
+
+func newChunkSet() chunkSet {
+	return chunkSet{make(map[ChunkCoord]bool), EmptyBoundingBox()}
+}
+
+func (s *chunkSet) add(x, z int) {
+	s.chunkMap[ChunkCoord{x, z}] = true
+	s.box.Union(x, z)
+}
+
+func (s *chunkSet) Pop(x, z int) bool {
+	var key = ChunkCoord{x, z}
+	var _, exists = s.chunkMap[key]
+	delete(s.chunkMap, key)
+	return exists
+}
+
+func (s *chunkSet) Remaining() int {
+	return len(s.chunkMap)
+}
+
+func (s *chunkSet) BoundingBox() *BoundingBox {
+	return s.box
+}
+
+func (s *chunkSet) coords() []ChunkCoord {
+	var coords = make([]ChunkCoord, 0, len(s.chunkMap))
+	for c := range s.chunkMap {
+		coords = append(coords, c)
+	}
+	return coords
+}
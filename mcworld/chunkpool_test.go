@@ -0,0 +1,111 @@
+package mcworld
+
+import (
+	"testing"
+)
+
+func TestUnionSetsBothBounds(t *testing.T) {
+	box := EmptyBoundingBox()
+	box.Union(3, -2)
+	checkBox(t, box, 3, -2, 3, -2)
+
+	box.Union(-1, 5)
+	checkBox(t, box, -1, -2, 3, 5)
+}
+
+func TestBoxContainsAndSize(t *testing.T) {
+	box := &BoundingBox{-1, -2, 3, 5}
+	if !box.Contains(-1, 5) || !box.Contains(3, -2) {
+		t.Error("Box doesn't contain its corners")
+	}
+	if box.Contains(4, 0) || box.Contains(0, -3) {
+		t.Error("Box contains chunks outside it")
+	}
+	if box.Width() != 5 || box.Length() != 8 {
+		t.Errorf("Size %dx%d not 5x8", box.Width(), box.Length())
+	}
+	if EmptyBoundingBox().Width() != 0 {
+		t.Error("Empty box has a width")
+	}
+}
+
+func TestBoxIntersect(t *testing.T) {
+	a := &BoundingBox{0, 0, 10, 10}
+	checkBox(t, a.Intersect(&BoundingBox{5, -5, 20, 5}), 5, 0, 10, 5)
+
+	if !a.Intersect(&BoundingBox{11, 0, 12, 10}).IsEmpty() {
+		t.Error("Disjoint boxes intersect")
+	}
+}
+
+func TestBoxExpand(t *testing.T) {
+	checkBox(t, (&BoundingBox{0, 0, 1, 1}).Expand(2), -2, -2, 3, 3)
+
+	if !(&BoundingBox{0, 0, 1, 1}).Expand(-1).IsEmpty() {
+		t.Error("Over shrunk box isn't empty")
+	}
+	if !EmptyBoundingBox().Expand(1).IsEmpty() {
+		t.Error("Expanded empty box isn't empty")
+	}
+}
+
+func TestBoxBlockConversion(t *testing.T) {
+	blocks := (&BoundingBox{-1, 0, 1, 2}).BlockBox()
+	checkBox(t, blocks, -16, 0, 31, 47)
+	checkBox(t, blocks.ChunkBox(), -1, 0, 1, 2)
+}
+
+func TestNearestOrder(t *testing.T) {
+	pool := testPool(ChunkCoord{10, 10}, ChunkCoord{0, 1}, ChunkCoord{-3, 0}, ChunkCoord{0, 0})
+	checkOrder(t, pool.Iterator(&NearestChunkOrder{0, 0}), ChunkCoord{0, 0}, ChunkCoord{0, 1}, ChunkCoord{-3, 0}, ChunkCoord{10, 10})
+	if pool.Remaining() != 0 {
+		t.Errorf("%d chunks remaining", pool.Remaining())
+	}
+}
+
+func TestRowMajorOrder(t *testing.T) {
+	pool := testPool(ChunkCoord{1, 1}, ChunkCoord{0, 1}, ChunkCoord{5, 0})
+	checkOrder(t, pool.Iterator(&RowMajorChunkOrder{}), ChunkCoord{5, 0}, ChunkCoord{0, 1}, ChunkCoord{1, 1})
+}
+
+func TestRegionOrder(t *testing.T) {
+	pool := testPool(ChunkCoord{32, 0}, ChunkCoord{0, 1}, ChunkCoord{-1, 0}, ChunkCoord{31, 31})
+	checkOrder(t, pool.Iterator(&RegionChunkOrder{}), ChunkCoord{-1, 0}, ChunkCoord{0, 1}, ChunkCoord{31, 31}, ChunkCoord{32, 0})
+}
+
+func TestIteratorSkipsPoppedChunks(t *testing.T) {
+	pool := testPool(ChunkCoord{0, 0}, ChunkCoord{1, 0}, ChunkCoord{2, 0})
+	it := pool.Iterator(&RowMajorChunkOrder{})
+	pool.Pop(1, 0)
+	checkOrder(t, it, ChunkCoord{0, 0}, ChunkCoord{2, 0})
+}
+
+func testPool(coords ...ChunkCoord) ChunkPool {
+	pool := &BetaChunkPool{newChunkSet()}
+	for _, c := range coords {
+		pool.add(c.X, c.Z)
+	}
+	return pool
+}
+
+func checkOrder(t *testing.T, it *ChunkIterator, expected ...ChunkCoord) {
+	for i, c := range expected {
+		x, z, ok := it.Next()
+		if !ok {
+			t.Errorf("Iterator ended after %d chunks, expected %d", i, len(expected))
+			return
+		}
+		if x != c.X || z != c.Z {
+			t.Errorf("Chunk %d was (%d,%d) not (%d,%d)", i, x, z, c.X, c.Z)
+		}
+	}
+	if x, z, ok := it.Next(); ok {
+		t.Errorf("Unexpected extra chunk (%d,%d)", x, z)
+	}
+}
+
+func checkBox(t *testing.T, box *BoundingBox, x0, z0, x1, z1 int) {
+	if box.X0 != x0 || box.Z0 != z0 || box.X1 != x1 || box.Z1 != z1 {
+		t.Errorf("Box %v not {%d %d %d %d}", *box, x0, z0, x1, z1)
+	}
+}
@@ -0,0 +1,96 @@
+package mcworld
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Dimension is a directory of region files in a world.
+type Dimension struct {
+	// Name is overworld, nether, end, or the namespaced name of a custom
+	// dimension
+	Name string
+
+	// Dir is the slash separated directory holding the region directory,
+	// "" for the overworld
+	Dir string
+
+	// Format is Anvil if any of the region files are .mca files, otherwise
+	// McRegion
+	Format string
+
+	// Regions is how many regions there are and Size the bytes of their
+	// region files
+	Regions int
+	Size    int64
+}
+
+// Dimensions lists the world's dimensions that have region files, the
+// overworld first. A region with both a .mca file and the .mcr file left
+// over from converting the world is counted once, as the .mca file.
+func (w *BetaWorld) Dimensions() ([]*Dimension, error) {
+	var files = make(map[string]map[ChunkCoord]regionFileInfo)
+	var err = w.store.Walk(func(name string, info os.FileInfo) error {
+		if !IsRegionFile(name) {
+			return nil
+		}
+		var dir = path.Dir(path.Dir(name))
+		if dir == "." {
+			dir = ""
+		}
+		var rx, rz, _ = parseRegionName(path.Base(name))
+
+		var regions, ok = files[dir]
+		if !ok {
+			regions = make(map[ChunkCoord]regionFileInfo)
+			files[dir] = regions
+		}
+		var coord = ChunkCoord{rx, rz}
+		if old, ok := regions[coord]; !ok || !old.anvil {
+			regions[coord] = regionFileInfo{strings.HasSuffix(name, ".mca"), info.Size()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var dimensions = make([]*Dimension, 0, len(files))
+	for dir, regions := range files {
+		var d = &Dimension{Name: dimensionName(dir), Dir: dir, Format: "McRegion", Regions: len(regions)}
+		for _, r := range regions {
+			d.Size += r.size
+			if r.anvil {
+				d.Format = "Anvil"
+			}
+		}
+		dimensions = append(dimensions, d)
+	}
+	sort.Slice(dimensions, func(i, j int) bool {
+		return dimensions[i].Dir < dimensions[j].Dir
+	})
+	return dimensions, nil
+}
+
+type regionFileInfo struct {
+	anvil bool
+	size  int64
+}
+
+func dimensionName(dir string) string {
+	switch dir {
+	case "":
+		return "overworld"
+	case "DIM-1":
+		return "nether"
+	case "DIM1":
+		return "end"
+	}
+	// 1.16 custom dimensions are in dimensions/<namespace>/<name>
+	if fields := strings.Split(dir, "/"); len(fields) == 3 && fields[0] == "dimensions" {
+		return fields[1] + ":" + fields[2]
+	}
+	return dir
+}
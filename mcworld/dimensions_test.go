@@ -0,0 +1,49 @@
+package mcworld
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDimensions(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.SetBlock(0, 1, 0, 1)
+	region := testRegion(t, mw, 0, 0)
+
+	dir := t.TempDir()
+	for _, name := range []string{"region/r.0.0.mcr", "region/r.0.0.mca", "region/r.1.0.mca", "DIM-1/region/r.0.0.mcr", "dimensions/mod/moon/region/r.0.0.mca", "data/r.0.0.mca"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		data := region
+		if name == "region/r.0.0.mcr" {
+			// The .mcr left over from conversion isn't counted
+			data = append(region, make([]byte, 4096)...)
+		}
+		ioutil.WriteFile(path, data, 0644)
+	}
+
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	dimensions, err := world.(*BetaWorld).Dimensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dimensions) != 3 {
+		t.Fatalf("Found %v dimensions", len(dimensions))
+	}
+	for i, expected := range []Dimension{
+		{"overworld", "", "Anvil", 2, 2 * int64(len(region))},
+		{"nether", "DIM-1", "McRegion", 1, int64(len(region))},
+		{"mod:moon", "dimensions/mod/moon", "Anvil", 1, int64(len(region))},
+	} {
+		if *dimensions[i] != expected {
+			t.Errorf("Dimension %v is %+v not %+v", i, dimensions[i], expected)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package mcworld
+
+import (
+	"crypto/sha1"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// indexVersion changes whenever the index file's layout, or what it records
+// about chunks, does, so old indexes are ignored rather than misread.
+const indexVersion = 2
+
+// WorldIndex remembers which chunks are in a world's files so that
+// ChunkPool doesn't have to read every region header, or list every alpha
+// chunk folder, each time the world is opened. Region files are checked
+// against their size and modification time and folders against their
+// modification time; any that differ are scanned again.
+type WorldIndex struct {
+	// HeightMaps records the height of every column when a region is
+	// scanned. Scanning is slower as every chunk saved since the last scan
+	// has to be read.
+	HeightMaps bool
+
+	path  string
+	lock  sync.Mutex
+	dirty bool
+	file  indexFile
+}
+
+type indexFile struct {
+	Version int
+	Regions map[string]*regionIndex
+	Dirs    map[string]*dirIndex
+}
+
+type regionIndex struct {
+	Size    int64
+	ModTime int64
+
+	// Chunks are the region's chunks as x&31 + 32*(z&31). Timestamps and
+	// HeightMaps are in the same order.
+	Chunks     []int
+	Timestamps []int32
+	HeightMaps [][]int16
+}
+
+type dirIndex struct {
+	ModTime int64
+	Chunks  []ChunkCoord
+}
+
+// Indexer is implemented by worlds that can use a WorldIndex.
+type Indexer interface {
+	SetIndex(index *WorldIndex)
+}
+
+// DefaultIndexPath is where the index of the world at worldPath is kept,
+// in the user's cache directory rather than the world itself.
+func DefaultIndexPath(worldPath string) (string, error) {
+	var abs, err = filepath.Abs(worldPath)
+	if err != nil {
+		return "", err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "mcobj", fmt.Sprintf("index-%x.gob", sha1.Sum([]byte(abs)))), nil
+}
+
+// OpenIndex reads the index at path. An index that is missing, unreadable
+// or from another version of mcobj starts out empty.
+func OpenIndex(path string) (*WorldIndex, error) {
+	var index = &WorldIndex{path: path, file: indexFile{indexVersion, make(map[string]*regionIndex), make(map[string]*dirIndex)}}
+
+	var file, err = os.Open(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var f indexFile
+	if err := gob.NewDecoder(file).Decode(&f); err == nil && f.Version == indexVersion {
+		if f.Regions != nil {
+			index.file.Regions = f.Regions
+		}
+		if f.Dirs != nil {
+			index.file.Dirs = f.Dirs
+		}
+	}
+	return index, nil
+}
+
+// Save writes the index back if ChunkPool changed it.
+func (idx *WorldIndex) Save() error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	if !idx.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return err
+	}
+	var file, err = os.Create(idx.path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(file).Encode(&idx.file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(idx.path+".tmp", idx.path); err != nil {
+		return err
+	}
+	idx.dirty = false
+	return nil
+}
+
+// HeightMap returns the heights of the chunk's columns, indexed by
+// x + 16*z, as they were when its region was last scanned. It is nil if
+// they weren't recorded.
+func (idx *WorldIndex) HeightMap(x, z int) []int {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	for _, ext := range []string{"mca", "mcr"} {
+		var r = idx.file.Regions[fmt.Sprintf("region/r.%v.%v.%v", x>>5, z>>5, ext)]
+		if r == nil {
+			continue
+		}
+		for i, chunk := range r.Chunks {
+			if chunk == (x&31)+32*(z&31) && i < len(r.HeightMaps) {
+				var heights = make([]int, len(r.HeightMaps[i]))
+				for j, h := range r.HeightMaps[i] {
+					heights[j] = int(h)
+				}
+				return heights
+			}
+		}
+	}
+	return nil
+}
+
+// region returns the entry for a region file if it is still up to date.
+func (idx *WorldIndex) region(name string, info os.FileInfo) *regionIndex {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	var r = idx.file.Regions[name]
+	if r == nil || r.Size != info.Size() || r.ModTime != info.ModTime().UnixNano() || (idx.HeightMaps && len(r.HeightMaps) != len(r.Chunks)) {
+		return nil
+	}
+	return r
+}
+
+// staleRegion returns the entry for a region file whether or not it is up
+// to date.
+func (idx *WorldIndex) staleRegion(name string) *regionIndex {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	return idx.file.Regions[name]
+}
+
+// unchangedHeightMap returns the recorded height map of chunk i, as
+// x&31 + 32*(z&31), if the chunk's timestamp is still the same. Chunks
+// without a timestamp are always read again.
+func (r *regionIndex) unchangedHeightMap(i int, timestamp int32) []int16 {
+	if r == nil || timestamp == 0 {
+		return nil
+	}
+	for j, chunk := range r.Chunks {
+		if chunk == i && j < len(r.Timestamps) && j < len(r.HeightMaps) && r.Timestamps[j] == timestamp {
+			return r.HeightMaps[j]
+		}
+	}
+	return nil
+}
+
+func (idx *WorldIndex) setRegion(name string, r *regionIndex) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.file.Regions[name] = r
+	idx.dirty = true
+}
+
+// dir returns the entry for a folder if it is still up to date. Folders
+// without a modification time, such as those in archives, are never
+// trusted.
+func (idx *WorldIndex) dir(name string, info os.FileInfo) *dirIndex {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	var d = idx.file.Dirs[name]
+	if d == nil || info.ModTime().IsZero() || d.ModTime != info.ModTime().UnixNano() {
+		return nil
+	}
+	return d
+}
+
+func (idx *WorldIndex) setDir(name string, d *dirIndex) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.file.Dirs[name] = d
+	idx.dirty = true
+}
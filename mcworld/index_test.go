@@ -0,0 +1,156 @@
+package mcworld
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openIndexedWorld(t *testing.T, dir, indexPath string, heightMaps bool) (World, *WorldIndex) {
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := OpenIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.HeightMaps = heightMaps
+	world.(Indexer).SetIndex(index)
+	return world, index
+}
+
+func poolSize(t *testing.T, world World) int {
+	pool, err := world.ChunkPool(&AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool.Remaining()
+}
+
+func TestBetaWorldIndex(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.Fill(0, 0, 0, 31, 4, 0, 1)
+	mw.SetBlock(3, 9, 0, 1)
+	dir := t.TempDir()
+	regionPath := filepath.Join(dir, "region", "r.0.0.mca")
+	os.Mkdir(filepath.Join(dir, "region"), 0755)
+	ioutil.WriteFile(regionPath, testRegion(t, mw, 0, 0), 0644)
+	// An old McRegion file beside the Anvil one is ignored
+	ioutil.WriteFile(filepath.Join(dir, "region", "r.0.0.mcr"), make([]byte, 8192), 0644)
+	indexPath := filepath.Join(t.TempDir(), "index.gob")
+
+	world, index := openIndexedWorld(t, dir, indexPath, true)
+	if n := poolSize(t, world); n != 2 {
+		t.Errorf("%v chunks not 2", n)
+	}
+	if err := index.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if heights := index.HeightMap(0, 0); len(heights) != 256 || heights[3] != 10 || heights[4] != 5 || heights[16] != 0 {
+		t.Errorf("Height map %v", heights)
+	}
+	CloseWorld(world)
+
+	// A region that changes without its size or time changing is trusted,
+	// which shows the index was used
+	info, _ := os.Stat(regionPath)
+	mw.SetBlock(2*16, 0, 0, 1)
+	mw.RemoveChunk(1, 0)
+	ioutil.WriteFile(regionPath, testRegion(t, mw, 0, 0), 0644)
+	os.Chtimes(regionPath, info.ModTime(), info.ModTime())
+
+	world, _ = openIndexedWorld(t, dir, indexPath, true)
+	if n := poolSize(t, world); n != 2 {
+		t.Errorf("%v chunks from the index not 2", n)
+	}
+	CloseWorld(world)
+
+	os.Chtimes(regionPath, info.ModTime(), info.ModTime().Add(time.Minute))
+	world, _ = openIndexedWorld(t, dir, indexPath, false)
+	defer CloseWorld(world)
+	pool, err := world.ChunkPool(&AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Remaining() != 2 || !pool.Pop(2, 0) || pool.Pop(1, 0) {
+		t.Error("The changed region wasn't scanned again")
+	}
+}
+
+func TestBetaWorldIndexHeightMapTimestamps(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.SetBlock(0, 3, 0, 1)
+	mw.SetBlock(16, 3, 0, 1)
+	dir := t.TempDir()
+	regionPath := filepath.Join(dir, "region", "r.0.0.mca")
+	os.Mkdir(filepath.Join(dir, "region"), 0755)
+	writeRegion := func(timestamps ...uint32) {
+		region := testRegion(t, mw, 0, 0)
+		for i, timestamp := range timestamps {
+			binary.BigEndian.PutUint32(region[4096+4*i:], timestamp)
+		}
+		ioutil.WriteFile(regionPath, region, 0644)
+	}
+	writeRegion(100, 100)
+	indexPath := filepath.Join(t.TempDir(), "index.gob")
+
+	world, index := openIndexedWorld(t, dir, indexPath, true)
+	poolSize(t, world)
+	index.Save()
+	CloseWorld(world)
+
+	// Both chunks change but only 1,0 says it was saved again, so 0,0's
+	// height map is taken from the index rather than read
+	mw.SetBlock(0, 7, 0, 1)
+	mw.SetBlock(16, 7, 0, 1)
+	writeRegion(100, 200)
+	info, _ := os.Stat(regionPath)
+	os.Chtimes(regionPath, info.ModTime(), info.ModTime().Add(time.Minute))
+
+	world, index = openIndexedWorld(t, dir, indexPath, true)
+	defer CloseWorld(world)
+	poolSize(t, world)
+	if heights := index.HeightMap(0, 0); len(heights) != 256 || heights[0] != 4 {
+		t.Errorf("Unchanged chunk's height map %v", heights)
+	}
+	if heights := index.HeightMap(1, 0); len(heights) != 256 || heights[0] != 8 {
+		t.Errorf("Saved chunk's height map %v", heights)
+	}
+}
+
+func TestAlphaWorldIndex(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "level.dat"), testLevelDat(0, 64, 0), 0644)
+	add := func(x, z int) {
+		path := filepath.Join(dir, filepath.FromSlash(chunkPath(x, z)))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte("chunk"), 0644)
+	}
+	add(0, 0)
+	add(-1, 5)
+	add(64, 0)
+	indexPath := filepath.Join(t.TempDir(), "index.gob")
+
+	world, index := openIndexedWorld(t, dir, indexPath, false)
+	if n := poolSize(t, world); n != 3 {
+		t.Errorf("%v chunks not 3", n)
+	}
+	index.Save()
+
+	// 0,0 and 64,0 share a folder. Adding to it without its time changing
+	// goes unnoticed, while a new folder is read.
+	folder := filepath.Join(dir, "0", "0")
+	info, _ := os.Stat(folder)
+	add(128, 64)
+	add(1, 1)
+	os.Chtimes(folder, info.ModTime(), info.ModTime())
+
+	world, _ = openIndexedWorld(t, dir, indexPath, false)
+	if n := poolSize(t, world); n != 4 {
+		t.Errorf("%v chunks not 4", n)
+	}
+}
@@ -0,0 +1,307 @@
+package mcworld
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Classic levels from 0.0.14a onwards are the level object written with
+// Java's ObjectOutputStream. javaDecoder understands enough of that
+// serialization format to pull out the object's fields.
+
+const (
+	tcNull           = 0x70
+	tcReference      = 0x71
+	tcClassDesc      = 0x72
+	tcObject         = 0x73
+	tcString         = 0x74
+	tcArray          = 0x75
+	tcClass          = 0x76
+	tcBlockData      = 0x77
+	tcEndBlockData   = 0x78
+	tcReset          = 0x79
+	tcBlockDataLong  = 0x7a
+	tcLongString     = 0x7c
+	tcProxyClassDesc = 0x7d
+	tcEnum           = 0x7e
+
+	scWriteMethod    = 0x01
+	scSerializable   = 0x02
+	scExternalizable = 0x04
+	scBlockData      = 0x08
+
+	javaBaseHandle = 0x7e0000
+)
+
+var (
+	javaStreamError = errors.New("Not a Java serialization stream")
+)
+
+type javaClass struct {
+	name   string
+	flags  byte
+	fields []javaField
+	super  *javaClass
+}
+
+type javaField struct {
+	typeCode byte
+	name     string
+}
+
+type javaObject struct {
+	class  *javaClass
+	fields map[string]interface{}
+}
+
+type javaDecoder struct {
+	r       io.Reader
+	handles []interface{}
+}
+
+func newJavaDecoder(r io.Reader) (*javaDecoder, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint16(header[:]) != 0xaced || binary.BigEndian.Uint16(header[2:]) != 5 {
+		return nil, javaStreamError
+	}
+	return &javaDecoder{r: r}, nil
+}
+
+func (d *javaDecoder) read(n int) []byte {
+	if n < 0 || n > 1<<28 {
+		panic(errors.New(fmt.Sprintf("Java serialization length %v out of range", n)))
+	}
+	var b = make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (d *javaDecoder) uint8() byte {
+	return d.read(1)[0]
+}
+
+func (d *javaDecoder) uint16() uint16 {
+	return binary.BigEndian.Uint16(d.read(2))
+}
+
+func (d *javaDecoder) uint32() uint32 {
+	return binary.BigEndian.Uint32(d.read(4))
+}
+
+func (d *javaDecoder) uint64() uint64 {
+	return binary.BigEndian.Uint64(d.read(8))
+}
+
+func (d *javaDecoder) utf() string {
+	return string(d.read(int(d.uint16())))
+}
+
+func (d *javaDecoder) newHandle(x interface{}) int {
+	d.handles = append(d.handles, x)
+	return len(d.handles) - 1
+}
+
+// ReadObject reads the next object in the stream.
+func (d *javaDecoder) ReadObject() (x interface{}, err error) {
+	err = d.catch(func() {
+		x = d.content(d.uint8())
+	})
+	return x, err
+}
+
+// catch runs fn, turning the panics the decoder uses for malformed or
+// truncated streams back into errors.
+func (d *javaDecoder) catch(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	fn()
+	return nil
+}
+
+func (d *javaDecoder) content(tc byte) interface{} {
+	switch tc {
+	case tcNull:
+		return nil
+	case tcReference:
+		var handle = int(d.uint32()) - javaBaseHandle
+		if handle < 0 || handle >= len(d.handles) {
+			panic(errors.New(fmt.Sprintf("Bad Java object reference %#x", handle+javaBaseHandle)))
+		}
+		return d.handles[handle]
+	case tcClassDesc, tcProxyClassDesc:
+		return d.classDesc(tc)
+	case tcClass:
+		var class = d.classDesc(d.uint8())
+		d.newHandle(class)
+		return class
+	case tcObject:
+		return d.object()
+	case tcString:
+		var s = d.utf()
+		d.newHandle(s)
+		return s
+	case tcLongString:
+		var s = string(d.read(int(d.uint64())))
+		d.newHandle(s)
+		return s
+	case tcArray:
+		return d.array()
+	case tcEnum:
+		d.classDesc(d.uint8())
+		var handle = d.newHandle(nil)
+		var name = d.content(d.uint8())
+		d.handles[handle] = name
+		return name
+	case tcReset:
+		d.handles = d.handles[:0]
+		return d.content(d.uint8())
+	}
+	panic(errors.New(fmt.Sprintf("Unsupported Java serialization type code %#x", tc)))
+}
+
+func (d *javaDecoder) classDesc(tc byte) *javaClass {
+	switch tc {
+	case tcNull:
+		return nil
+	case tcReference:
+		var class, ok = d.content(tc).(*javaClass)
+		if !ok {
+			panic(errors.New("Java class reference isn't a class"))
+		}
+		return class
+	case tcProxyClassDesc:
+		var class = &javaClass{}
+		d.newHandle(class)
+		for i := int(d.uint32()); i > 0; i-- {
+			d.utf()
+		}
+		d.annotation()
+		class.super = d.classDesc(d.uint8())
+		return class
+	case tcClassDesc:
+		var class = &javaClass{name: d.utf()}
+		d.uint64() // serialVersionUID
+		d.newHandle(class)
+		class.flags = d.uint8()
+		for i := int(d.uint16()); i > 0; i-- {
+			var f = javaField{typeCode: d.uint8(), name: d.utf()}
+			if f.typeCode == '[' || f.typeCode == 'L' {
+				d.content(d.uint8()) // Class name string
+			}
+			class.fields = append(class.fields, f)
+		}
+		d.annotation()
+		class.super = d.classDesc(d.uint8())
+		return class
+	}
+	panic(errors.New(fmt.Sprintf("Expected a Java class, found type code %#x", tc)))
+}
+
+// annotation skips the block data and objects written by a class's custom
+// writeObject method.
+func (d *javaDecoder) annotation() {
+	for {
+		switch tc := d.uint8(); tc {
+		case tcEndBlockData:
+			return
+		case tcBlockData:
+			d.read(int(d.uint8()))
+		case tcBlockDataLong:
+			d.read(int(d.uint32()))
+		default:
+			d.content(tc)
+		}
+	}
+}
+
+func (d *javaDecoder) object() *javaObject {
+	var class = d.classDesc(d.uint8())
+	var o = &javaObject{class, make(map[string]interface{})}
+	d.newHandle(o)
+
+	var hierarchy = make([]*javaClass, 0)
+	for c := class; c != nil; c = c.super {
+		hierarchy = append([]*javaClass{c}, hierarchy...)
+	}
+
+	for _, c := range hierarchy {
+		if c.flags&scExternalizable != 0 {
+			if c.flags&scBlockData == 0 {
+				panic(errors.New("Old style externalizable Java objects aren't supported"))
+			}
+			d.annotation()
+			continue
+		}
+		for _, f := range c.fields {
+			o.fields[f.name] = d.value(f.typeCode)
+		}
+		if c.flags&scWriteMethod != 0 {
+			d.annotation()
+		}
+	}
+
+	return o
+}
+
+func (d *javaDecoder) array() interface{} {
+	var class = d.classDesc(d.uint8())
+	var handle = d.newHandle(nil)
+	var length = int(int32(d.uint32()))
+	if class == nil || len(class.name) < 2 || length < 0 {
+		panic(errors.New("Bad Java array"))
+	}
+
+	var array interface{}
+	if class.name[1] == 'B' {
+		array = d.read(length)
+	} else {
+		var values = make([]interface{}, length)
+		for i := range values {
+			values[i] = d.value(class.name[1])
+		}
+		array = values
+	}
+
+	d.handles[handle] = array
+	return array
+}
+
+func (d *javaDecoder) value(typeCode byte) interface{} {
+	switch typeCode {
+	case 'B':
+		return int(int8(d.uint8()))
+	case 'Z':
+		return d.uint8() != 0
+	case 'C':
+		return int(d.uint16())
+	case 'S':
+		return int(int16(d.uint16()))
+	case 'I':
+		return int(int32(d.uint32()))
+	case 'J':
+		return int(int64(d.uint64()))
+	case 'F':
+		return math.Float32frombits(d.uint32())
+	case 'D':
+		return math.Float64frombits(d.uint64())
+	case 'L', '[':
+		return d.content(d.uint8())
+	}
+	panic(errors.New(fmt.Sprintf("Unknown Java field type %q", typeCode)))
+}
@@ -0,0 +1,218 @@
+package mcworld
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	UnknownLevelFileError = errors.New("Unknown level file. Expected an Indev .mclevel or a Classic .mine or .dat")
+)
+
+const classicMagic = 0x271bb788
+
+// IsLevelFile reports whether the path names a single file Indev or Classic
+// level that OpenWorld can read.
+func IsLevelFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mclevel", ".mine":
+		return true
+	case ".dat":
+		var fi, err = os.Stat(path)
+		return err == nil && !fi.IsDir()
+	}
+	return false
+}
+
+// LevelFileWorld presents a level from Indev or Classic, which are stored as
+// a single array of blocks, as a world of chunks. The level's minimum corner
+// is placed at block 0,0,0.
+type LevelFileWorld struct {
+	*MemoryWorld
+	Width, Height, Length  int
+	SpawnX, SpawnY, SpawnZ int
+}
+
+func OpenLevelFile(path string) (*LevelFileWorld, error) {
+	var file, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadLevelFile(file)
+}
+
+// ReadLevelFile reads a gzipped Indev or Classic level. Indev levels are
+// NBT. Classic levels are either a bare block array (before 0.0.13a), a
+// header and block array (0.0.13a) or a serialized Java object (0.0.14a
+// and later).
+func ReadLevelFile(reader io.Reader) (*LevelFileWorld, error) {
+	var gz, err = gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var r = bufio.NewReader(gz)
+	var header, _ = r.Peek(5)
+	if len(header) < 5 {
+		return nil, UnknownLevelFileError
+	}
+
+	var w = &LevelFileWorld{MemoryWorld: NewMemoryWorld()}
+	switch {
+	case header[0] == byte(nbt.TagStruct):
+		err = w.readIndev(r)
+	case binary.BigEndian.Uint32(header) == classicMagic:
+		r.Discard(4)
+		var version, _ = r.ReadByte()
+		switch version {
+		case 1:
+			err = w.readClassicV1(r)
+		case 2:
+			err = w.readClassicV2(r)
+		default:
+			err = errors.New(fmt.Sprintf("Unknown Classic level version %v", version))
+		}
+	default:
+		err = w.readClassicV0(r)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *LevelFileWorld) ReadLevel() (*nbt.Level, error) {
+	return &nbt.Level{SpawnX: w.SpawnX, SpawnY: w.SpawnY, SpawnZ: w.SpawnZ}, nil
+}
+
+// setBlocks copies blocks stored in YZX order into the world. classic
+// converts Classic's coloured cloth ids into wool.
+func (w *LevelFileWorld) setBlocks(width, height, length int, blocks, data []byte, classic bool) error {
+	if width <= 0 || height <= 0 || length <= 0 || len(blocks) < width*height*length {
+		return errors.New(fmt.Sprintf("Level of %vx%vx%v has %v blocks", width, height, length, len(blocks)))
+	}
+	w.Width, w.Height, w.Length = width, height, length
+
+	for i := 0; i < width*height*length; i++ {
+		var block = nbt.Block(blocks[i])
+		if classic {
+			block = classicBlock(blocks[i])
+		} else if i < len(data) {
+			// The low nibble holds the light level
+			block += nbt.Block(data[i]>>4) << 8
+		}
+		if block != 0 {
+			var x, z, y = i % width, (i / width) % length, i / (width * length)
+			w.SetBlock(x, y, z, block)
+		}
+	}
+	return nil
+}
+
+// Classic cloth came in 16 colours with ids 21 to 36, which later became
+// the data values of wool.
+var classicCloth = []int{14, 1, 4, 5, 13, 13, 9, 11, 10, 10, 10, 2, 6, 15, 7, 0}
+
+func classicBlock(id byte) nbt.Block {
+	if id >= 21 && id <= 36 {
+		return 35 + nbt.Block(classicCloth[id-21])<<8
+	}
+	return nbt.Block(id)
+}
+
+func (w *LevelFileWorld) readIndev(r io.Reader) error {
+	var root, err = nbt.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	var level, ok = root["Map"].(map[string]interface{})
+	if !ok {
+		return UnknownLevelFileError
+	}
+
+	var blocks, _ = level["Blocks"].([]byte)
+	var data, _ = level["Data"].([]byte)
+	if spawn, ok := level["Spawn"].([]int); ok && len(spawn) == 3 {
+		w.SpawnX, w.SpawnY, w.SpawnZ = spawn[0], spawn[1], spawn[2]
+	}
+
+	// Indev's Height is the vertical size, like a schematic's
+	return w.setBlocks(intField(level, "Width"), intField(level, "Height"), intField(level, "Length"), blocks, data, false)
+}
+
+// Before 0.0.13a levels were always 256x64x256 with no header.
+func (w *LevelFileWorld) readClassicV0(r io.Reader) error {
+	var blocks, err = ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(blocks) != 256*64*256 {
+		return UnknownLevelFileError
+	}
+	w.SpawnX, w.SpawnY, w.SpawnZ = 128, 64, 128
+	return w.setBlocks(256, 64, 256, blocks, nil, true)
+}
+
+// Classic's level height is the length along z and depth is the vertical
+// size.
+func (w *LevelFileWorld) readClassicV1(r io.Reader) error {
+	var d = &javaDecoder{r: r}
+	var width, length, height int
+	var blocks []byte
+
+	var err = d.catch(func() {
+		d.utf()    // Name
+		d.utf()    // Creator
+		d.uint64() // Creation time
+		width, length, height = int(int16(d.uint16())), int(int16(d.uint16())), int(int16(d.uint16()))
+		if width > 0 && length > 0 && height > 0 {
+			blocks = d.read(width * length * height)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	w.SpawnX, w.SpawnY, w.SpawnZ = width/2, height, length/2
+	return w.setBlocks(width, height, length, blocks, nil, true)
+}
+
+func (w *LevelFileWorld) readClassicV2(r io.Reader) error {
+	var d, err = newJavaDecoder(r)
+	if err != nil {
+		return err
+	}
+
+	var x, readErr = d.ReadObject()
+	if readErr != nil {
+		return readErr
+	}
+	var level, ok = x.(*javaObject)
+	if !ok {
+		return UnknownLevelFileError
+	}
+
+	var blocks, _ = level.fields["blocks"].([]byte)
+	var width, _ = level.fields["width"].(int)
+	var length, _ = level.fields["height"].(int)
+	var height, _ = level.fields["depth"].(int)
+	w.SpawnX, _ = level.fields["xSpawn"].(int)
+	w.SpawnY, _ = level.fields["ySpawn"].(int)
+	w.SpawnZ, _ = level.fields["zSpawn"].(int)
+
+	return w.setBlocks(width, height, length, blocks, nil, true)
+}
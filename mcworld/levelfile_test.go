@@ -0,0 +1,214 @@
+package mcworld
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/quag/mcobj/nbt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Each test level is 4 wide, 3 high and 20 long, with stone at 0,0,0 and a
+// block at 3,2,19 in the second row of chunks.
+
+func TestIndevLevel(t *testing.T) {
+	blocks := make([]byte, 4*3*20)
+	data := make([]byte, len(blocks))
+	blocks[0] = 1
+	blocks[levelIndex(3, 2, 19)], data[levelIndex(3, 2, 19)] = 35, 14<<4|0xf
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	w := nbt.NewWriter(gw)
+	w.WriteTag(nbt.TagStruct, "MinecraftLevel")
+	w.WriteTag(nbt.TagStruct, "Map")
+	w.WriteTag(nbt.TagInt16, "Width")
+	w.WriteInt16(4)
+	w.WriteTag(nbt.TagInt16, "Height")
+	w.WriteInt16(3)
+	w.WriteTag(nbt.TagInt16, "Length")
+	w.WriteInt16(20)
+	w.WriteTag(nbt.TagList, "Spawn")
+	w.WriteListHeader(nbt.TagInt16, 3)
+	w.WriteInt16(2)
+	w.WriteInt16(3)
+	w.WriteInt16(10)
+	w.WriteTag(nbt.TagByteArray, "Blocks")
+	w.WriteBytes(blocks)
+	w.WriteTag(nbt.TagByteArray, "Data")
+	w.WriteBytes(data)
+	w.WriteTag(nbt.TagStructEnd, "")
+	w.WriteTag(nbt.TagList, "Entities")
+	w.WriteListHeader(nbt.TagStruct, 1)
+	w.WriteTag(nbt.TagList, "Pos")
+	w.WriteListHeader(nbt.TagFloat32, 3)
+	w.WriteFloat32(1)
+	w.WriteFloat32(2)
+	w.WriteFloat32(3)
+	w.WriteTag(nbt.TagStructEnd, "")
+	w.WriteTag(nbt.TagStructEnd, "")
+	gw.Close()
+
+	checkLevelFile(t, "world.mclevel", buf.Bytes(), 35+14<<8, [3]int{2, 3, 10})
+}
+
+func TestClassicLevelV1(t *testing.T) {
+	blocks := make([]byte, 4*3*20)
+	blocks[0] = 1
+	blocks[levelIndex(3, 2, 19)] = 21
+
+	var level bytes.Buffer
+	binary.Write(&level, binary.BigEndian, uint32(classicMagic))
+	level.WriteByte(1)
+	writeJavaUTF(&level, "A level")
+	writeJavaUTF(&level, "someone")
+	binary.Write(&level, binary.BigEndian, int64(1250000000000))
+	binary.Write(&level, binary.BigEndian, []int16{4, 20, 3})
+	level.Write(blocks)
+
+	checkLevelFile(t, "level.dat", gzipBytes(level.Bytes()), 35+14<<8, [3]int{2, 3, 10})
+}
+
+func TestClassicLevelV2(t *testing.T) {
+	blocks := make([]byte, 4*3*20)
+	blocks[0] = 1
+	blocks[levelIndex(3, 2, 19)] = 36
+
+	var level bytes.Buffer
+	binary.Write(&level, binary.BigEndian, uint32(classicMagic))
+	level.WriteByte(2)
+	binary.Write(&level, binary.BigEndian, []uint16{0xaced, 5})
+
+	// A Level object with int fields, a byte array and a string. The
+	// creator field refers back to the string type written for name.
+	level.WriteByte(tcObject)
+	level.WriteByte(tcClassDesc)
+	writeJavaUTF(&level, "com.mojang.minecraft.level.Level")
+	binary.Write(&level, binary.BigEndian, int64(1))
+	level.WriteByte(scSerializable)
+	ints := []string{"depth", "height", "width", "xSpawn", "ySpawn", "zSpawn"}
+	binary.Write(&level, binary.BigEndian, int16(len(ints)+3))
+	for _, name := range ints {
+		level.WriteByte('I')
+		writeJavaUTF(&level, name)
+	}
+	level.WriteByte('[')
+	writeJavaUTF(&level, "blocks")
+	level.WriteByte(tcString)
+	writeJavaUTF(&level, "[B")
+	level.WriteByte('L')
+	writeJavaUTF(&level, "creator")
+	level.WriteByte(tcString)
+	writeJavaUTF(&level, "Ljava/lang/String;")
+	level.WriteByte('L')
+	writeJavaUTF(&level, "name")
+	level.WriteByte(tcReference)
+	binary.Write(&level, binary.BigEndian, uint32(javaBaseHandle+2))
+	level.WriteByte(tcEndBlockData)
+	level.WriteByte(tcNull)
+
+	binary.Write(&level, binary.BigEndian, []int32{3, 20, 4, 2, 3, 10})
+	level.WriteByte(tcArray)
+	level.WriteByte(tcClassDesc)
+	writeJavaUTF(&level, "[B")
+	binary.Write(&level, binary.BigEndian, int64(2))
+	level.WriteByte(scSerializable)
+	binary.Write(&level, binary.BigEndian, int16(0))
+	level.WriteByte(tcEndBlockData)
+	level.WriteByte(tcNull)
+	binary.Write(&level, binary.BigEndian, int32(len(blocks)))
+	level.Write(blocks)
+	level.WriteByte(tcString)
+	writeJavaUTF(&level, "someone")
+	level.WriteByte(tcNull)
+
+	checkLevelFile(t, "level.mine", gzipBytes(level.Bytes()), 35, [3]int{2, 3, 10})
+}
+
+func TestClassicLevelV0(t *testing.T) {
+	blocks := make([]byte, 256*64*256)
+	blocks[0] = 1
+	blocks[(63*256+255)*256+255] = 49
+
+	path := filepath.Join(t.TempDir(), "level.dat")
+	ioutil.WriteFile(path, gzipBytes(blocks), 0644)
+
+	world, err := OpenWorld(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := world.(*LevelFileWorld)
+	if w.Width != 256 || w.Height != 64 || w.Length != 256 {
+		t.Errorf("Size %vx%vx%v not 256x64x256", w.Width, w.Height, w.Length)
+	}
+	if w.Block(0, 0, 0) != 1 || w.Block(255, 63, 255) != 49 {
+		t.Errorf("Corner blocks are %v and %v", w.Block(0, 0, 0), w.Block(255, 63, 255))
+	}
+}
+
+func levelIndex(x, y, z int) int {
+	return x + 4*(z+20*y)
+}
+
+func writeJavaUTF(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(b)
+	gw.Close()
+	return buf.Bytes()
+}
+
+func checkLevelFile(t *testing.T, filename string, data []byte, corner nbt.Block, spawn [3]int) {
+	path := filepath.Join(t.TempDir(), filename)
+	ioutil.WriteFile(path, data, 0644)
+
+	world, err := OpenWorld(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	w := world.(*LevelFileWorld)
+	if w.Width != 4 || w.Height != 3 || w.Length != 20 {
+		t.Errorf("Size %vx%vx%v not 4x3x20", w.Width, w.Height, w.Length)
+	}
+
+	level, err := w.ReadLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if [3]int{level.SpawnX, level.SpawnY, level.SpawnZ} != spawn {
+		t.Errorf("Spawn %v,%v,%v not %v", level.SpawnX, level.SpawnY, level.SpawnZ, spawn)
+	}
+
+	pool, err := world.ChunkPool(&AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Remaining() != 2 {
+		t.Errorf("%v chunks not 2", pool.Remaining())
+	}
+
+	r, err := world.OpenChunk(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	chunk, err := nbt.ReadChunkNbt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := chunk.Block(3, 2, 3); b != corner {
+		t.Errorf("Block at 3,2,19 is %#x not %#x", b, corner)
+	}
+	if b := w.Block(0, 0, 0); b != 1 {
+		t.Errorf("Block at 0,0,0 is %#x not stone", b)
+	}
+}
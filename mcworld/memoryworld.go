@@ -0,0 +1,151 @@
+package mcworld
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+const MemoryWorldHeight = 256
+
+// MemoryWorld is a World held entirely in memory. It is built up a block or
+// a chunk at a time and serves its chunks as uncompressed Anvil NBT, the same
+// as a region file would after decompression.
+type MemoryWorld struct {
+	lock   sync.RWMutex
+	chunks map[ChunkCoord]*nbt.Chunk
+}
+
+func NewMemoryWorld() *MemoryWorld {
+	return &MemoryWorld{chunks: make(map[ChunkCoord]*nbt.Chunk)}
+}
+
+// AddChunk adds the chunk at its XPos, ZPos replacing any chunk already
+// there.
+func (w *MemoryWorld) AddChunk(chunk *nbt.Chunk) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.chunks[ChunkCoord{chunk.XPos, chunk.ZPos}] = chunk
+}
+
+// EmptyChunk adds a chunk filled with air.
+func (w *MemoryWorld) EmptyChunk(x, z int) *nbt.Chunk {
+	var chunk = nbt.NewChunk(x, z, MemoryWorldHeight)
+	w.AddChunk(chunk)
+	return chunk
+}
+
+func (w *MemoryWorld) RemoveChunk(x, z int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.chunks, ChunkCoord{x, z})
+}
+
+func (w *MemoryWorld) Chunk(x, z int) *nbt.Chunk {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.chunks[ChunkCoord{x, z}]
+}
+
+// SetBlock places a block using world block coordinates. The chunk holding
+// the block is created if it doesn't exist yet.
+func (w *MemoryWorld) SetBlock(x, y, z int, block nbt.Block) {
+	if y < 0 || y >= MemoryWorldHeight {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var coord = ChunkCoord{x >> 4, z >> 4}
+	var chunk = w.chunks[coord]
+	if chunk == nil {
+		chunk = nbt.NewChunk(coord.X, coord.Z, MemoryWorldHeight)
+		w.chunks[coord] = chunk
+	}
+	chunk.SetBlock(x&15, y, z&15, block)
+}
+
+func (w *MemoryWorld) Block(x, y, z int) nbt.Block {
+	if y < 0 || y >= MemoryWorldHeight {
+		return 0
+	}
+
+	var chunk = w.Chunk(x>>4, z>>4)
+	if chunk == nil {
+		return 0
+	}
+
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return chunk.Block(x&15, y, z&15)
+}
+
+// Fill sets every block in the box between the two corners (inclusive).
+func (w *MemoryWorld) Fill(x0, y0, z0, x1, y1, z1 int, block nbt.Block) {
+	x0, x1 = min(x0, x1), max(x0, x1)
+	y0, y1 = min(y0, y1), max(y0, y1)
+	z0, z1 = min(z0, z1), max(z0, z1)
+
+	for x := x0; x <= x1; x++ {
+		for z := z0; z <= z1; z++ {
+			for y := y0; y <= y1; y++ {
+				w.SetBlock(x, y, z, block)
+			}
+		}
+	}
+}
+
+// ChunkNbt returns the chunk serialized as uncompressed NBT.
+func (w *MemoryWorld) ChunkNbt(x, z int) ([]byte, error) {
+	var chunk = w.Chunk(x, z)
+	if chunk == nil {
+		return nil, ChunkNotFoundError
+	}
+
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	var buf bytes.Buffer
+	var err = nbt.WriteChunkNbt(&buf, chunk)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %v,%v: %v", x, z, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *MemoryWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
+	var b, err = w.ChunkNbt(x, z)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (w *MemoryWorld) ChunkPool(mask ChunkMask) (ChunkPool, error) {
+	// Masks may open chunks, so the lock isn't held while asking them
+	w.lock.RLock()
+	var coords = make([]ChunkCoord, 0, len(w.chunks))
+	for c := range w.chunks {
+		coords = append(coords, c)
+	}
+	w.lock.RUnlock()
+
+	var pool = &MemoryChunkPool{newChunkSet()}
+	for _, c := range coords {
+		if !mask.IsMasked(c.X, c.Z) {
+			pool.add(c.X, c.Z)
+		}
+	}
+	return pool, nil
+}
+
+type MemoryChunkPool struct {
+	chunkSet
+}
+
+func (p *MemoryChunkPool) Iterator(order ChunkOrder) *ChunkIterator {
+	return NewChunkIterator(p, p.coords(), order)
+}
@@ -0,0 +1,95 @@
+package mcworld
+
+import (
+	"github.com/quag/mcobj/nbt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryWorldBlocks(t *testing.T) {
+	w := NewMemoryWorld()
+	w.SetBlock(-1, 10, -17, 1)
+	w.Fill(0, 0, 0, 17, 0, 1, 3)
+
+	if b := w.Block(-1, 10, -17); b != 1 {
+		t.Errorf("Block %d not 1", b)
+	}
+	if b := w.Block(17, 0, 1); b != 3 {
+		t.Errorf("Block %d not 3", b)
+	}
+	if b := w.Block(18, 0, 1); b != 0 {
+		t.Errorf("Block %d not 0", b)
+	}
+	if w.Chunk(-1, -2) == nil || w.Chunk(1, 0) == nil {
+		t.Error("Chunks not created by SetBlock/Fill")
+	}
+}
+
+func TestMemoryWorldConcurrentSetBlock(t *testing.T) {
+	w := NewMemoryWorld()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+			w.SetBlock(x, 0, 0, 1)
+		}(i)
+	}
+	wg.Wait()
+
+	for x := 0; x < 16; x++ {
+		if b := w.Block(x, 0, 0); b != 1 {
+			t.Errorf("Block at %d is %d not 1", x, b)
+		}
+	}
+}
+
+func TestMemoryWorldOpenChunk(t *testing.T) {
+	w := NewMemoryWorld()
+	w.SetBlock(-20, 64, 5, 35+4<<8)
+
+	r, err := w.OpenChunk(-2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	chunk, err := nbt.ReadChunkNbt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.XPos != -2 || chunk.ZPos != 0 {
+		t.Errorf("Position (%d,%d) not (-2,0)", chunk.XPos, chunk.ZPos)
+	}
+	if b := chunk.Block(12, 64, 5); b != 35+4<<8 {
+		t.Errorf("Block %#x not %#x", b, 35+4<<8)
+	}
+
+	if _, err := w.OpenChunk(5, 5); err != ChunkNotFoundError {
+		t.Errorf("Error was %q not %q", err, ChunkNotFoundError)
+	}
+}
+
+func TestMemoryWorldPoolMasks(t *testing.T) {
+	w := NewMemoryWorld()
+	for x := -2; x < 2; x++ {
+		for z := -2; z < 2; z++ {
+			w.EmptyChunk(x, z)
+		}
+	}
+
+	pool, _ := w.ChunkPool(&AllChunksMask{})
+	if pool.Remaining() != 16 {
+		t.Errorf("%d chunks not 16", pool.Remaining())
+	}
+	checkBox(t, pool.BoundingBox(), -2, -2, 1, 1)
+
+	pool, _ = w.ChunkPool(&RectangleChunkMask{-1, -1, 1, 1})
+	if pool.Remaining() != 4 {
+		t.Errorf("%d chunks not 4", pool.Remaining())
+	}
+	checkBox(t, pool.BoundingBox(), -1, -1, 0, 0)
+	if pool.Pop(1, 0) || !pool.Pop(0, 0) || pool.Pop(0, 0) {
+		t.Error("Pop doesn't match the mask")
+	}
+}
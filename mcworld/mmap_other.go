@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package mcworld
+
+import (
+	"errors"
+	"os"
+)
+
+var errMmapUnsupported = errors.New("Memory mapping region files isn't supported on this platform")
+
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmapFile(data []byte) error {
+	return errMmapUnsupported
+}
@@ -0,0 +1,50 @@
+package mcworld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/quag/mcobj/nbt"
+)
+
+// PruneRegion rewrites a region file keeping only the chunks keep returns
+// true for, and returns how many chunks were kept and removed. keep is given
+// nil for chunks that can't be decoded, which includes those stored outside
+// the region file. Unreadable location entries are removed.
+func PruneRegion(data []byte, rx, rz int, keep func(x, z int, chunk *nbt.Chunk) bool) (*PackedRegion, int, int) {
+	var (
+		chunks        [1024]*regionChunk
+		kept, removed int
+	)
+
+	for i := 0; i < 1024 && 4*i+4 <= len(data); i++ {
+		var loc = ChunkLocation(binary.BigEndian.Uint32(data[4*i:]))
+		if loc == 0 {
+			continue
+		}
+
+		var payload = regionPayload(data, loc)
+		if payload == nil {
+			removed++
+			continue
+		}
+
+		var chunk *nbt.Chunk
+		if chunkData, err := decompressChunk(payload[0], payload[1:]); err == nil {
+			chunk, _ = nbt.ReadChunkNbt(bytes.NewReader(chunkData))
+		}
+
+		if !keep(rx*32+i%32, rz*32+i/32, chunk) {
+			removed++
+			continue
+		}
+
+		var timestamp uint32
+		if 4096+4*i+4 <= len(data) {
+			timestamp = binary.BigEndian.Uint32(data[4096+4*i:])
+		}
+		chunks[i] = &regionChunk{payload, timestamp}
+		kept++
+	}
+
+	return packRegion(&chunks, rx, rz), kept, removed
+}
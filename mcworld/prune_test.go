@@ -0,0 +1,75 @@
+package mcworld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/quag/mcobj/nbt"
+	"math"
+	"testing"
+)
+
+func TestPruneRegion(t *testing.T) {
+	mw := NewMemoryWorld()
+	for x := 0; x < 4; x++ {
+		mw.SetBlock(x*16, 1, 0, 1)
+		mw.Chunk(x, 0).InhabitedTime = x * 1000
+	}
+	region := testRegion(t, mw, 0, 0)
+
+	mask := &RectangleChunkMask{X0: 1, Z0: 0, X1: 32, Z1: 32}
+	pruned, kept, removed := PruneRegion(region, 0, 0, func(x, z int, chunk *nbt.Chunk) bool {
+		return !mask.IsMasked(x, z) && chunk.InhabitedTime >= 2000
+	})
+	if kept != 2 || removed != 2 {
+		t.Errorf("Kept %v and removed %v, not 2 and 2", kept, removed)
+	}
+	if len(pruned.Data) != 4*4096 {
+		t.Errorf("Pruned region is %v bytes, not %v", len(pruned.Data), 4*4096)
+	}
+
+	for x := 0; x < 4; x++ {
+		loc := ChunkLocation(binary.BigEndian.Uint32(pruned.Data[4*x:]))
+		if (loc != 0) != (x >= 2) {
+			t.Errorf("Chunk %v,0 location is %#x", x, loc)
+			continue
+		}
+		if loc == 0 {
+			continue
+		}
+		data, err := decompressChunk(CompressionZlib, regionPayload(pruned.Data, loc)[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := nbt.ReadChunkNbt(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.XPos != x || chunk.InhabitedTime != x*1000 {
+			t.Errorf("Chunk in slot %v,0 is %v,%v inhabited for %v", x, chunk.XPos, chunk.ZPos, chunk.InhabitedTime)
+		}
+	}
+}
+
+func TestCenteredChunkMask(t *testing.T) {
+	mask, limit := CenteredChunkMask(10, -5, 4, math.MaxInt32, math.MaxInt32)
+	if r, ok := mask.(*RectangleChunkMask); !ok || *r != (RectangleChunkMask{8, -7, 12, -3}) || limit != 16 {
+		t.Errorf("Square mask is %v holding %v chunks", mask, limit)
+	}
+	mask, limit = CenteredChunkMask(0, 0, math.MaxInt32, 3, math.MaxInt32)
+	if mask.IsMasked(-1, 1000000) || !mask.IsMasked(2, 0) || limit != math.MaxInt32 {
+		t.Errorf("Rectangle mask is %v holding %v chunks", mask, limit)
+	}
+}
+
+func TestIsChunkDataFile(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"entities/r.0.-1.mca": true,
+		"DIM1/poi/r.2.0.mca":  true,
+		"region/r.0.0.mca":    false,
+		"entities/notes.txt":  false,
+	} {
+		if IsChunkDataFile(name) != expected {
+			t.Errorf("IsChunkDataFile(%q) is %v", name, !expected)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package mcworld
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const DefaultRegionCacheSize = 32
+
+// regionFile is an open region file along with its chunk location table.
+// Chunks are read with ReadAt so any number of goroutines can share it.
+type regionFile struct {
+	key       ChunkCoord
+	name      string
+	r         io.ReaderAt
+	size      int64
+	locations [1024]ChunkLocation
+
+	closer  func() error
+	refs    int
+	evicted bool
+	element *list.Element
+}
+
+func (f *regionFile) location(x, z int) ChunkLocation {
+	return f.locations[(x&31)+(z&31)*32]
+}
+
+func (f *regionFile) close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer()
+}
+
+// regionCache keeps the most recently used region files open. Region files
+// that don't exist are cached too so that looking up chunks beside the edge
+// of the world doesn't hit the file system each time.
+type regionCache struct {
+	lock     sync.Mutex
+	store    worldStore
+	capacity int
+	mmap     bool
+	files    map[ChunkCoord]*regionFile
+	lru      *list.List
+}
+
+func newRegionCache(store worldStore, capacity int, mmap bool) *regionCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &regionCache{store: store, capacity: capacity, mmap: mmap, files: make(map[ChunkCoord]*regionFile), lru: list.New()}
+}
+
+// acquire returns the region file holding chunk x, z. A nil file without an
+// error means the region doesn't exist. Files must be handed back with
+// release.
+func (c *regionCache) acquire(x, z int) (*regionFile, error) {
+	var key = ChunkCoord{x >> 5, z >> 5}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var f, cached = c.files[key]
+	if cached {
+		c.lru.MoveToFront(f.element)
+	} else {
+		var err error
+		f, err = c.open(key.X, key.Z)
+		if err != nil {
+			return nil, err
+		}
+		f.element = c.lru.PushFront(f)
+		c.files[key] = f
+	}
+
+	if f.r != nil {
+		f.refs++
+	}
+	if !cached {
+		// After taking the reference so the new file isn't evicted itself
+		c.evict()
+	}
+
+	if f.r == nil {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func (c *regionCache) release(f *regionFile) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	f.refs--
+	if f.refs == 0 && f.evicted {
+		return f.close()
+	}
+	return nil
+}
+
+// evict closes the least recently used files that aren't in use until the
+// cache is back within its capacity.
+func (c *regionCache) evict() {
+	for e := c.lru.Back(); e != nil && c.lru.Len() > c.capacity; {
+		var f = e.Value.(*regionFile)
+		var prev = e.Prev()
+		if f.refs == 0 {
+			c.lru.Remove(e)
+			delete(c.files, f.key)
+			f.close()
+		}
+		e = prev
+	}
+}
+
+func (c *regionCache) open(rx, rz int) (*regionFile, error) {
+	var name = fmt.Sprintf("region/r.%v.%v.mca", rx, rz)
+	if _, err := c.store.Stat(name); err != nil {
+		name = fmt.Sprintf("region/r.%v.%v.mcr", rx, rz)
+		if _, err := c.store.Stat(name); err != nil {
+			return &regionFile{key: ChunkCoord{rx, rz}, name: name}, nil
+		}
+	}
+
+	var file, err = c.store.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var size, seekErr = file.Seek(0, 2)
+	if seekErr != nil {
+		file.Close()
+		return nil, seekErr
+	}
+
+	var f = &regionFile{key: ChunkCoord{rx, rz}, name: name, r: file, size: size, closer: file.Close}
+
+	if c.mmap {
+		if osFile, ok := file.(*os.File); ok && size > 0 {
+			var data, mmapErr = mmapFile(osFile, size)
+			if mmapErr == nil {
+				file.Close()
+				f.r = bytes.NewReader(data)
+				f.closer = func() error { return munmapFile(data) }
+			}
+		}
+	}
+
+	var header [4096]byte
+	var n, readErr = f.r.ReadAt(header[:], 0)
+	if readErr != nil && readErr != io.EOF {
+		f.close()
+		return nil, readErr
+	}
+	// An empty or truncated header leaves the rest of the chunks missing
+	for i := 0; i < n/4; i++ {
+		f.locations[i] = ChunkLocation(binary.BigEndian.Uint32(header[4*i:]))
+	}
+
+	return f, nil
+}
+
+func (c *regionCache) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var firstErr error
+	for key, f := range c.files {
+		delete(c.files, key)
+		f.evicted = true
+		if f.refs == 0 {
+			var err = f.close()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	c.lru.Init()
+	return firstErr
+}
+
+// regionReleaser hands a region file back to the cache once the chunk read
+// from it is closed.
+type regionReleaser struct {
+	cache *regionCache
+	file  *regionFile
+}
+
+func (r *regionReleaser) Close() error {
+	return r.cache.release(r.file)
+}
@@ -0,0 +1,87 @@
+package mcworld
+
+import (
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentChunkReads(t *testing.T) {
+	for _, mmap := range []bool{false, true} {
+		world, mw := openTestRegionWorld(t)
+		world.ConfigureRegionCache(2, mmap)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					x, z := (g+i)%4*32, -(i%3)*32
+					checkChunkBlock(t, world, x, z, mw.Block(x*16, 1, z*16))
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if err := world.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMissingRegionAndChunk(t *testing.T) {
+	world, _ := openTestRegionWorld(t)
+	defer world.Close()
+
+	if _, err := world.OpenChunk(500, 500); err != ChunkNotFoundError {
+		t.Errorf("Error was %q not %q", err, ChunkNotFoundError)
+	}
+	if _, err := world.OpenChunk(1, 0); err == nil {
+		t.Error("Opened a chunk missing from its region")
+	}
+}
+
+// openTestRegionWorld writes a world of twelve regions, each holding the
+// chunk at its corner with a block identifying the region.
+func openTestRegionWorld(t *testing.T) (*BetaWorld, *MemoryWorld) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "region"), 0755)
+
+	mw := NewMemoryWorld()
+	for rx := 0; rx < 4; rx++ {
+		for rz := -2; rz <= 0; rz++ {
+			mw.SetBlock(rx*32*16, 1, rz*32*16, nbt.Block(1+rx+4*(rz+2)))
+			name := filepath.Join(dir, "region", fmt.Sprintf("r.%d.%d.mca", rx, rz))
+			ioutil.WriteFile(name, testRegion(t, mw, rx, rz), 0644)
+		}
+	}
+
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return world.(*BetaWorld), mw
+}
+
+func checkChunkBlock(t *testing.T, world World, x, z int, expected nbt.Block) {
+	r, err := world.OpenChunk(x, z)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer r.Close()
+
+	chunk, err := nbt.ReadChunkNbt(r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if b := chunk.Block(0, 1, 0); b != expected {
+		t.Errorf("Chunk %d,%d block %d not %d", x, z, b, expected)
+	}
+}
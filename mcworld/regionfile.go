@@ -0,0 +1,192 @@
+package mcworld
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// regionChunk is a chunk as stored in a region file: the compression byte
+// followed by the compressed data.
+type regionChunk struct {
+	payload   []byte
+	timestamp uint32
+}
+
+// decompressChunk returns the NBT of a chunk from its compressed data.
+func decompressChunk(compression byte, data []byte) ([]byte, error) {
+	var decompressor io.Reader
+	var err error
+	switch compression {
+	case CompressionGzip:
+		decompressor, err = gzip.NewReader(bytes.NewReader(data))
+	case CompressionZlib:
+		decompressor, err = zlib.NewReader(bytes.NewReader(data))
+	case CompressionUncompressed:
+		return data, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown compression type %v", compression))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(decompressor)
+}
+
+// maxChunkSectors is the most sectors a location entry can describe.
+// Bigger chunks are stored outside the region file.
+const maxChunkSectors = 255
+
+// PackedRegion is a rewritten region file and the chunks too big to be
+// stored in it, which go in c.x.z.mcc files beside it.
+type PackedRegion struct {
+	Data     []byte
+	External map[ChunkCoord][]byte
+}
+
+// WriteFile writes the region file and its external chunks. The region is
+// written beside filename then renamed over it, so an interrupted write
+// doesn't leave a half written file.
+func (r *PackedRegion) WriteFile(filename string) error {
+	var dir = filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for coord, data := range r.External {
+		var external = filepath.Join(dir, fmt.Sprintf("c.%v.%v.mcc", coord.X, coord.Z))
+		if err := ioutil.WriteFile(external, data, 0644); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(filename+".tmp", r.Data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// packRegion lays the chunks out one after another from sector 2, giving a
+// region file with no unused sectors.
+func packRegion(chunks *[1024]*regionChunk, rx, rz int) *PackedRegion {
+	var header [8192]byte
+	var body bytes.Buffer
+	var external = make(map[ChunkCoord][]byte)
+
+	for i, chunk := range chunks {
+		if chunk == nil {
+			continue
+		}
+
+		var payload = chunk.payload
+		if (len(payload)+4+4095)/4096 > maxChunkSectors {
+			external[ChunkCoord{rx*32 + i%32, rz*32 + i/32}] = payload[1:]
+			payload = []byte{payload[0] | 0x80}
+		}
+
+		var sector = 2 + body.Len()/4096
+		binary.Write(&body, binary.BigEndian, uint32(len(payload)))
+		body.Write(payload)
+		for body.Len()%4096 != 0 {
+			body.WriteByte(0)
+		}
+
+		var count = 2 + body.Len()/4096 - sector
+		binary.BigEndian.PutUint32(header[4*i:], uint32(sector<<8|count))
+		binary.BigEndian.PutUint32(header[4096+4*i:], chunk.timestamp)
+	}
+
+	return &PackedRegion{append(header[:], body.Bytes()...), external}
+}
+
+// EachRegion calls fn with the contents of every region file in the world,
+// including those of the other dimensions. Names are relative to the world
+// directory, e.g. "DIM-1/region/r.0.0.mca".
+func (w *BetaWorld) EachRegion(fn func(name string, rx, rz int, data []byte) error) error {
+	return w.eachRegionFile(IsRegionFile, fn)
+}
+
+// EachChunkDataRegion is EachRegion for the region files holding chunks'
+// entities and points of interest, e.g. "entities/r.0.0.mca".
+func (w *BetaWorld) EachChunkDataRegion(fn func(name string, rx, rz int, data []byte) error) error {
+	return w.eachRegionFile(IsChunkDataFile, fn)
+}
+
+func (w *BetaWorld) eachRegionFile(match func(name string) bool, fn func(name string, rx, rz int, data []byte) error) error {
+	return w.eachFile(match, func(name string, info os.FileInfo, r io.Reader) error {
+		var rx, rz, _ = parseRegionName(path.Base(name))
+		var data, err = ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return fn(name, rx, rz, data)
+	})
+}
+
+// eachFile calls fn with each of the world's files that match. Stores that
+// don't hold every file are read through in one pass.
+func (w *BetaWorld) eachFile(match func(name string) bool, fn func(name string, info os.FileInfo, r io.Reader) error) error {
+	if s, ok := w.store.(streamStore); ok {
+		return s.Stream(func(name string, info os.FileInfo, r io.Reader) error {
+			if !match(name) {
+				return nil
+			}
+			return fn(name, info, r)
+		})
+	}
+
+	return w.store.Walk(func(name string, info os.FileInfo) error {
+		if !match(name) {
+			return nil
+		}
+		var file, err = w.store.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return fn(name, info, file)
+	})
+}
+
+// IsRegionFile reports whether the slash separated name, relative to the
+// world directory, is a region file.
+func IsRegionFile(name string) bool {
+	var _, _, ok = parseRegionName(path.Base(name))
+	return ok && path.Base(path.Dir(name)) == "region"
+}
+
+// IsChunkDataFile reports whether the name is one of the region files that
+// since 1.17 hold chunks' entities and points of interest apart from their
+// blocks. They use the same slots as the region files of blocks.
+func IsChunkDataFile(name string) bool {
+	var _, _, ok = parseRegionName(path.Base(name))
+	var dir = path.Base(path.Dir(name))
+	return ok && (dir == "entities" || dir == "poi")
+}
+
+// CopyFiles copies the world's files into dir, leaving out those for which
+// skip returns true.
+func (w *BetaWorld) CopyFiles(dir string, skip func(name string) bool) error {
+	var copied = func(name string) bool { return !skip(name) }
+	return w.eachFile(copied, func(name string, info os.FileInfo, src io.Reader) error {
+		var dest = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		var dst, createErr = os.Create(dest)
+		if createErr != nil {
+			return createErr
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		return dst.Close()
+	})
+}
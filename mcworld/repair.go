@@ -0,0 +1,161 @@
+package mcworld
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"io/ioutil"
+)
+
+// RegionRepair counts what RepairRegion did to a region file.
+type RegionRepair struct {
+	Kept     int `json:"kept"`
+	Dropped  int `json:"dropped"`
+	Salvaged int `json:"salvaged"`
+	OldSize  int `json:"oldSize"`
+	NewSize  int `json:"newSize"`
+}
+
+// RepairRegion rewrites a region file with its chunks packed together,
+// dropping unused sectors and the location entries of chunks whose NBT can't
+// be read or that claim to be somewhere else. Chunks in formats whose blocks
+// can't be decoded are kept. With salvage, sectors no good chunk
+// uses are scanned for compressed chunks, which are put back in their slots
+// if those are empty. Chunks stored outside the region file are kept as
+// they are, and salvaged chunks too big for it are moved out of it.
+func RepairRegion(data []byte, rx, rz int, salvage bool) (*PackedRegion, *RegionRepair) {
+	var (
+		repair = &RegionRepair{OldSize: len(data)}
+		chunks [1024]*regionChunk
+		used   = make([]bool, (len(data)+4095)/4096)
+	)
+
+	for i := 0; i < 1024 && 4*i+4 <= len(data); i++ {
+		var loc = ChunkLocation(binary.BigEndian.Uint32(data[4*i:]))
+		if loc == 0 {
+			continue
+		}
+		var timestamp uint32
+		if 4096+4*i+4 <= len(data) {
+			timestamp = binary.BigEndian.Uint32(data[4096+4*i:])
+		}
+
+		var payload = regionPayload(data, loc)
+		if payload != nil && (payload[0]&0x80 != 0 || decodesAt(payload[0], payload[1:], rx*32+i%32, rz*32+i/32)) {
+			chunks[i] = &regionChunk{payload, timestamp}
+			for s := loc.Offset() / 4096; s < loc.Offset()/4096+loc.Sectors() && s < len(used); s++ {
+				used[s] = true
+			}
+			repair.Kept++
+		} else {
+			repair.Dropped++
+		}
+	}
+
+	if salvage {
+		for s := 2; s < len(used); s++ {
+			if used[s] {
+				continue
+			}
+			var compression, payload, x, z, ok = salvageChunk(data[s*4096:])
+			var i = (x & 31) + (z&31)*32
+			if ok && x>>5 == rx && z>>5 == rz && chunks[i] == nil {
+				chunks[i] = &regionChunk{append([]byte{compression}, payload...), 0}
+				repair.Salvaged++
+			}
+		}
+	}
+
+	var repaired = packRegion(&chunks, rx, rz)
+	repair.NewSize = len(repaired.Data)
+	return repaired, repair
+}
+
+// regionPayload returns the compression byte and compressed data of the
+// chunk at loc, or nil if the location or length is out of range.
+func regionPayload(data []byte, loc ChunkLocation) []byte {
+	var offset = loc.Offset()
+	if offset < 8192 || loc.Sectors() == 0 || offset+5 > len(data) {
+		return nil
+	}
+	var length = int(binary.BigEndian.Uint32(data[offset:]))
+	if length < 1 || offset+4+length > len(data) || (length+4+4095)/4096 > loc.Sectors() {
+		return nil
+	}
+	return data[offset+4 : offset+4+length]
+}
+
+func decodesAt(compression byte, data []byte, x, z int) bool {
+	var chunkData, err = decompressChunk(compression, data)
+	if err != nil {
+		return false
+	}
+	var chunkX, chunkZ, ok = chunkPosition(chunkData)
+	return ok && chunkX == x && chunkZ == z
+}
+
+// chunkPosition reads the position recorded in a chunk's NBT without
+// decoding its blocks, so it works for every chunk format.
+func chunkPosition(chunkData []byte) (x, z int, ok bool) {
+	var root, err = nbt.Parse(bytes.NewReader(chunkData))
+	if err != nil {
+		return 0, 0, false
+	}
+	var level, wrapped = root["Level"].(map[string]interface{})
+	if !wrapped {
+		level = root
+	}
+	var xOk, zOk bool
+	x, xOk = level["xPos"].(int)
+	z, zOk = level["zPos"].(int)
+	return x, z, xOk && zOk
+}
+
+// salvageChunk looks for a gzip or zlib stream just after where a chunk's
+// five byte header would be at the start of the sector. It returns the
+// stream, trimmed to its end, and the position the chunk records.
+func salvageChunk(sector []byte) (compression byte, payload []byte, x, z int, ok bool) {
+	if len(sector) < 7 {
+		return 0, nil, 0, 0, false
+	}
+	var (
+		data = sector[5:]
+		r    = bytes.NewReader(data)
+	)
+
+	var decompressor io.Reader
+	var err error
+	switch {
+	case data[0] == 0x1f && data[1] == 0x8b:
+		compression = CompressionGzip
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(r)
+		if err == nil {
+			gz.Multistream(false)
+			decompressor = gz
+		}
+	case data[0]&0xf == 8 && (uint(data[0])<<8|uint(data[1]))%31 == 0:
+		compression = CompressionZlib
+		decompressor, err = zlib.NewReader(r)
+	default:
+		return 0, nil, 0, 0, false
+	}
+	if err != nil {
+		return 0, nil, 0, 0, false
+	}
+
+	// bytes.Reader is an io.ByteReader, so the decompressor reads no further
+	// than the end of the stream
+	var chunkData, readErr = ioutil.ReadAll(decompressor)
+	if readErr != nil {
+		return 0, nil, 0, 0, false
+	}
+	x, z, ok = chunkPosition(chunkData)
+	if !ok {
+		return 0, nil, 0, 0, false
+	}
+	return compression, data[:len(data)-r.Len()], x, z, true
+}
@@ -0,0 +1,185 @@
+package mcworld
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"github.com/quag/mcobj/nbt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepairRegion(t *testing.T) {
+	mw := NewMemoryWorld()
+	for x := 0; x < 4; x++ {
+		mw.SetBlock(x*16, 1, 0, 1)
+	}
+	region := testRegion(t, mw, 0, 0)
+
+	location := func(x int) uint32 { return binary.BigEndian.Uint32(region[4*x:]) }
+	sector := func(x int) int { return int(location(x)>>8) * 4096 }
+
+	// Chunk 1 has a bad compression byte, chunk 2's location entry is lost
+	// and chunk 3 is followed by sectors nothing uses.
+	region[sector(1)+4] = 9
+	binary.BigEndian.PutUint32(region[4*2:], 0)
+	region = append(region, make([]byte, 3*4096)...)
+
+	repaired, repair := RepairRegion(region, 0, 0, false)
+	if repair.Kept != 2 || repair.Dropped != 1 || repair.Salvaged != 0 {
+		t.Errorf("Repair %+v didn't keep 2 and drop 1", repair)
+	}
+	if len(repaired.Data) != 4*4096 || repair.NewSize != len(repaired.Data) {
+		t.Errorf("Repaired region is %v bytes, not %v", len(repaired.Data), 4*4096)
+	}
+	checkRepairedRegion(t, repaired.Data, []int{0, 3})
+
+	salvaged, repair := RepairRegion(region, 0, 0, true)
+	// Chunk 1's zlib stream is intact behind its broken header
+	if repair.Kept != 2 || repair.Dropped != 1 || repair.Salvaged != 2 {
+		t.Errorf("Repair %+v didn't keep 2, drop 1 and salvage 2", repair)
+	}
+	checkRepairedRegion(t, salvaged.Data, []int{0, 1, 2, 3})
+
+	if again, repair := RepairRegion(salvaged.Data, 0, 0, true); !bytes.Equal(again.Data, salvaged.Data) || repair.Dropped != 0 || repair.Salvaged != 0 {
+		t.Errorf("Repairing a repaired region changed it: %+v", repair)
+	}
+}
+
+func TestRepairRegionKeepsUnsupportedChunks(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.SetBlock(0, 1, 0, 1)
+	region := testRegion(t, mw, 0, 0)
+
+	// Chunk 1,0 parses but has no blocks in any known format
+	chunkNbt := unsupportedChunkNbt(1, 0)
+	if _, err := nbt.ReadChunkNbt(bytes.NewReader(chunkNbt)); err == nil {
+		t.Fatal("Test chunk decodes")
+	}
+	region = appendRegionChunk(region, 1, chunkNbt)
+
+	repaired, repair := RepairRegion(region, 0, 0, false)
+	if repair.Kept != 2 || repair.Dropped != 0 {
+		t.Errorf("Repair %+v didn't keep both chunks", repair)
+	}
+	if binary.BigEndian.Uint32(repaired.Data[4*1:]) == 0 {
+		t.Error("Unsupported chunk dropped")
+	}
+}
+
+func TestRepairRegionMovesBigChunksOut(t *testing.T) {
+	mw := NewMemoryWorld()
+	mw.SetBlock(0, 1, 0, 1)
+	region := testRegion(t, mw, 0, 0)
+
+	// Chunk 1,0 is padded with noise to more than 255 sectors
+	noise := make([]byte, 256*4096)
+	rand.New(rand.NewSource(1)).Read(noise)
+	var chunkNbt bytes.Buffer
+	w := nbt.NewWriter(&chunkNbt)
+	w.WriteTag(nbt.TagStruct, "")
+	w.WriteTag(nbt.TagStruct, "Level")
+	w.WriteTag(nbt.TagInt32, "xPos")
+	w.WriteInt32(1)
+	w.WriteTag(nbt.TagInt32, "zPos")
+	w.WriteInt32(0)
+	w.WriteTag(nbt.TagList, "Sections")
+	w.WriteListHeader(nbt.TagStruct, 0)
+	w.WriteTag(nbt.TagByteArray, "Noise")
+	w.WriteBytes(noise)
+	w.WriteTag(nbt.TagStructEnd, "")
+	w.WriteTag(nbt.TagStructEnd, "")
+
+	// The chunk's entry is lost so it can only be salvaged, which is the
+	// one way a chunk too big for its entry comes to be packed
+	region = appendRegionChunk(region, 1, chunkNbt.Bytes())
+	binary.BigEndian.PutUint32(region[4*1:], 0)
+
+	repaired, repair := RepairRegion(region, 0, 0, true)
+	if repair.Kept != 1 || repair.Salvaged != 1 || len(repaired.External) != 1 || repaired.External[ChunkCoord{1, 0}] == nil {
+		t.Fatalf("Repair %+v with external chunks %v", repair, len(repaired.External))
+	}
+	if loc := ChunkLocation(binary.BigEndian.Uint32(repaired.Data[4*1:])); loc.Sectors() != 1 {
+		t.Errorf("Big chunk takes %v sectors in the region", loc.Sectors())
+	}
+
+	dir := t.TempDir()
+	if err := repaired.WriteFile(filepath.Join(dir, "region", "r.0.0.mca")); err != nil {
+		t.Fatal(err)
+	}
+	world, err := OpenWorld(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+	report, err := CheckWorld(world)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Chunks != 2 || len(report.Problems) != 0 {
+		t.Errorf("%v chunks and problems %v", report.Chunks, report.Problems)
+	}
+	r, err := world.OpenChunk(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(data, chunkNbt.Bytes()) {
+		t.Errorf("Big chunk read back as %v bytes, not %v: %v", len(data), chunkNbt.Len(), err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "region", "r.0.0.mca.tmp")); err == nil {
+		t.Error("Temporary region file left behind")
+	}
+}
+
+// unsupportedChunkNbt is a chunk that parses but has no blocks in any known
+// format.
+func unsupportedChunkNbt(x, z int) []byte {
+	var chunkNbt bytes.Buffer
+	w := nbt.NewWriter(&chunkNbt)
+	w.WriteTag(nbt.TagStruct, "")
+	w.WriteTag(nbt.TagStruct, "Level")
+	w.WriteTag(nbt.TagInt32, "xPos")
+	w.WriteInt32(x)
+	w.WriteTag(nbt.TagInt32, "zPos")
+	w.WriteInt32(z)
+	w.WriteTag(nbt.TagStructEnd, "")
+	w.WriteTag(nbt.TagStructEnd, "")
+	return chunkNbt.Bytes()
+}
+
+// appendRegionChunk adds the chunk NBT to the end of the region file in
+// slot i.
+func appendRegionChunk(region []byte, i int, chunkNbt []byte) []byte {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(chunkNbt)
+	zw.Close()
+
+	sector := len(region) / 4096
+	region = binary.BigEndian.AppendUint32(region, uint32(compressed.Len()+1))
+	region = append(region, CompressionZlib)
+	region = append(region, compressed.Bytes()...)
+	for len(region)%4096 != 0 {
+		region = append(region, 0)
+	}
+	binary.BigEndian.PutUint32(region[4*i:], uint32(sector<<8|(len(region)/4096-sector)))
+	return region
+}
+
+func checkRepairedRegion(t *testing.T, region []byte, xs []int) {
+	report := new(CheckReport)
+	new(BetaWorld).checkRegion(report, "r.0.0.mca", 0, 0, region)
+	if len(report.Problems) != 0 || report.Chunks != len(xs) {
+		t.Errorf("Repaired region has %v chunks, not %v, and problems %v", report.Chunks, len(xs), report.Problems)
+	}
+	for _, x := range xs {
+		if binary.BigEndian.Uint32(region[4*x:]) == 0 {
+			t.Errorf("Chunk %v,0 is missing", x)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package mcworld
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	UnknownSchematicError = errors.New("Unknown schematic format. Expected an MCEdit .schematic, a structure block .nbt or a Sponge .schem")
+)
+
+// IsSchematic reports whether the path names a schematic or structure file
+// that OpenWorld can read.
+func IsSchematic(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".schematic", ".schem", ".nbt":
+		return true
+	}
+	return false
+}
+
+// SchematicWorld presents the blocks of a schematic as a world of chunks.
+// The schematic's minimum corner is placed at block 0,0,0 and anything
+// above MemoryWorldHeight is cut off.
+//
+// Blocks named with namespaced ids (structure and Sponge files) are
+// converted with nbt.BlockFromName. Blocks that have no numeric id are
+// drawn as stone so the shape of the build is kept.
+type SchematicWorld struct {
+	*MemoryWorld
+	Width, Height, Length int
+	UnknownBlocks         map[string]int
+}
+
+func OpenSchematic(path string) (*SchematicWorld, error) {
+	var file, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadSchematic(file)
+}
+
+// ReadSchematic reads an MCEdit, structure block or Sponge schematic. The
+// file may be gzipped or plain NBT.
+func ReadSchematic(reader io.Reader) (*SchematicWorld, error) {
+	var br = bufio.NewReader(reader)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		var gz, err = gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var root, err = nbt.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var s = &SchematicWorld{MemoryWorld: NewMemoryWorld(), UnknownBlocks: make(map[string]int)}
+
+	if sponge, ok := root["Schematic"].(map[string]interface{}); ok {
+		err = s.readSponge(sponge)
+	} else if _, ok := root["BlockData"]; ok {
+		err = s.readSponge(root)
+	} else if _, ok := root["Blocks"].([]byte); ok {
+		err = s.readMCEdit(root)
+	} else if _, ok := root["blocks"]; ok {
+		err = s.readStructure(root)
+	} else {
+		err = UnknownSchematicError
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SchematicWorld) setSize(width, height, length int) error {
+	if width < 0 || height < 0 || length < 0 {
+		return errors.New(fmt.Sprintf("Schematic has a negative size %vx%vx%v", width, height, length))
+	}
+	s.Width, s.Height, s.Length = width, height, length
+	return nil
+}
+
+func (s *SchematicWorld) namedBlock(state string) nbt.Block {
+	var block, ok = nbt.BlockFromName(state)
+	if !ok {
+		s.UnknownBlocks[state]++
+		return 1
+	}
+	return block
+}
+
+// MCEdit schematics hold pre-1.13 ids in YZX order. The AddBlocks array for
+// ids above 255 is ignored as nbt.Block can't hold them.
+func (s *SchematicWorld) readMCEdit(root map[string]interface{}) error {
+	var err = s.setSize(intField(root, "Width")&0xffff, intField(root, "Height")&0xffff, intField(root, "Length")&0xffff)
+	if err != nil {
+		return err
+	}
+
+	var blocks, _ = root["Blocks"].([]byte)
+	var data, _ = root["Data"].([]byte)
+	if len(blocks) < s.Width*s.Height*s.Length {
+		return errors.New(fmt.Sprintf("Schematic has %v blocks, expected %v", len(blocks), s.Width*s.Height*s.Length))
+	}
+
+	for i := 0; i < s.Width*s.Height*s.Length; i++ {
+		var block = nbt.Block(blocks[i])
+		if i < len(data) {
+			block += nbt.Block(data[i]&0xf) << 8
+		}
+		if block != 0 {
+			var x, z, y = i % s.Width, (i / s.Width) % s.Length, i / (s.Width * s.Length)
+			s.SetBlock(x, y, z, block)
+		}
+	}
+
+	return nil
+}
+
+// Sponge schematics (versions 1 to 3) store block states in a palette and
+// the blocks as varint palette indexes in YZX order.
+func (s *SchematicWorld) readSponge(root map[string]interface{}) error {
+	var err = s.setSize(intField(root, "Width")&0xffff, intField(root, "Height")&0xffff, intField(root, "Length")&0xffff)
+	if err != nil {
+		return err
+	}
+
+	var paletteTag, data = root["Palette"], root["BlockData"]
+	if container, ok := root["Blocks"].(map[string]interface{}); ok {
+		paletteTag, data = container["Palette"], container["Data"]
+	}
+
+	var names, ok = paletteTag.(map[string]interface{})
+	if !ok {
+		return errors.New("Sponge schematic has no palette")
+	}
+	var palette = make(map[int]nbt.Block)
+	for name, index := range names {
+		if i, ok := index.(int); ok {
+			palette[i] = s.namedBlock(name)
+		}
+	}
+
+	var indexes, _ = data.([]byte)
+	var i, pos = 0, 0
+	for pos < len(indexes) && i < s.Width*s.Height*s.Length {
+		var value, shift = 0, uint(0)
+		for pos < len(indexes) {
+			var b = indexes[pos]
+			pos++
+			value |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				break
+			}
+		}
+
+		if block := palette[value]; block != 0 {
+			var x, z, y = i % s.Width, (i / s.Width) % s.Length, i / (s.Width * s.Length)
+			s.SetBlock(x, y, z, block)
+		}
+		i++
+	}
+
+	if i != s.Width*s.Height*s.Length {
+		return errors.New(fmt.Sprintf("Sponge schematic has %v blocks, expected %v", i, s.Width*s.Height*s.Length))
+	}
+	return nil
+}
+
+// Structure block files list each block with its position and an index into
+// the palette. Files with several palettes use the first.
+func (s *SchematicWorld) readStructure(root map[string]interface{}) error {
+	var size, _ = root["size"].([]int)
+	if len(size) != 3 {
+		return errors.New("Structure has no size")
+	}
+	var err = s.setSize(size[0], size[1], size[2])
+	if err != nil {
+		return err
+	}
+
+	var paletteList, _ = root["palette"].([]interface{})
+	if palettes, ok := root["palettes"].([]interface{}); ok && len(palettes) > 0 {
+		paletteList, _ = palettes[0].([]interface{})
+	}
+
+	var palette = make([]nbt.Block, len(paletteList))
+	for i, entry := range paletteList {
+		var state, _ = entry.(map[string]interface{})
+		var name, _ = state["Name"].(string)
+		palette[i] = s.namedBlock(name + blockStateProperties(state["Properties"]))
+	}
+
+	var blocks, _ = root["blocks"].([]interface{})
+	for _, entry := range blocks {
+		var b, _ = entry.(map[string]interface{})
+		var pos, _ = b["pos"].([]int)
+		var state, ok = b["state"].(int)
+		if !ok || len(pos) != 3 || state < 0 || state >= len(palette) {
+			return errors.New(fmt.Sprintf("Structure has a bad block entry: %v", b))
+		}
+		if palette[state] != 0 {
+			s.SetBlock(pos[0], pos[1], pos[2], palette[state])
+		}
+	}
+
+	return nil
+}
+
+func blockStateProperties(tag interface{}) string {
+	var properties, ok = tag.(map[string]interface{})
+	if !ok || len(properties) == 0 {
+		return ""
+	}
+
+	var pairs = make([]string, 0, len(properties))
+	for key, value := range properties {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", key, value))
+	}
+	return "[" + strings.Join(pairs, ",") + "]"
+}
+
+func intField(tag map[string]interface{}, name string) int {
+	var i, _ = tag[name].(int)
+	return i
+}
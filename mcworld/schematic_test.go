@@ -0,0 +1,261 @@
+package mcworld
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/quag/mcobj/nbt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Each test schematic is 2 wide, 3 high and 17 long, so it spans two chunks,
+// with stone at 0,0,0, a double stone brick slab at 1,2,16 and wool at
+// 1,0,3.
+
+func TestMCEditSchematic(t *testing.T) {
+	blocks := make([]byte, 2*3*17)
+	data := make([]byte, len(blocks))
+	blocks[0] = 1
+	blocks[yzx(1, 2, 16)], data[yzx(1, 2, 16)] = 43, 5
+	blocks[yzx(1, 0, 3)], data[yzx(1, 0, 3)] = 35, 14
+
+	checkSchematic(t, "build.schematic", true, func(w *nbt.Writer) {
+		writeSize(w, "Width", "Height", "Length")
+		w.WriteTag(nbt.TagString, "Materials")
+		w.WriteString("Alpha")
+		w.WriteTag(nbt.TagByteArray, "Blocks")
+		w.WriteBytes(blocks)
+		w.WriteTag(nbt.TagByteArray, "Data")
+		w.WriteBytes(data)
+	})
+}
+
+func TestSpongeSchematic(t *testing.T) {
+	checkSchematic(t, "build.schem", true, func(w *nbt.Writer) {
+		writeSize(w, "Width", "Height", "Length")
+		w.WriteTag(nbt.TagStruct, "Palette")
+		w.WriteTag(nbt.TagInt32, "minecraft:air")
+		w.WriteInt32(0)
+		w.WriteTag(nbt.TagInt32, "minecraft:stone")
+		w.WriteInt32(1)
+		w.WriteTag(nbt.TagInt32, "minecraft:stone_brick_slab[type=double,waterlogged=false]")
+		w.WriteInt32(200)
+		w.WriteTag(nbt.TagInt32, "minecraft:red_wool")
+		w.WriteInt32(3)
+		w.WriteTag(nbt.TagStructEnd, "")
+
+		indexes := make([]byte, 0)
+		for i := 0; i < 2*3*17; i++ {
+			switch i {
+			case 0:
+				indexes = append(indexes, 1)
+			case yzx(1, 2, 16):
+				// 200 takes two bytes as a varint
+				indexes = append(indexes, 200&0x7f|0x80, 200>>7)
+			case yzx(1, 0, 3):
+				indexes = append(indexes, 3)
+			default:
+				indexes = append(indexes, 0)
+			}
+		}
+		w.WriteTag(nbt.TagByteArray, "BlockData")
+		w.WriteBytes(indexes)
+	})
+}
+
+func TestStructureFile(t *testing.T) {
+	checkSchematic(t, "build.nbt", true, func(w *nbt.Writer) {
+		w.WriteTag(nbt.TagList, "size")
+		w.WriteListHeader(nbt.TagInt32, 3)
+		w.WriteInt32(2)
+		w.WriteInt32(3)
+		w.WriteInt32(17)
+
+		w.WriteTag(nbt.TagList, "palette")
+		w.WriteListHeader(nbt.TagStruct, 3)
+		w.WriteTag(nbt.TagString, "Name")
+		w.WriteString("minecraft:stone")
+		w.WriteTag(nbt.TagStructEnd, "")
+		w.WriteTag(nbt.TagString, "Name")
+		w.WriteString("minecraft:stone_brick_slab")
+		w.WriteTag(nbt.TagStruct, "Properties")
+		w.WriteTag(nbt.TagString, "type")
+		w.WriteString("double")
+		w.WriteTag(nbt.TagStructEnd, "")
+		w.WriteTag(nbt.TagStructEnd, "")
+		w.WriteTag(nbt.TagString, "Name")
+		w.WriteString("red_wool")
+		w.WriteTag(nbt.TagStructEnd, "")
+
+		w.WriteTag(nbt.TagList, "blocks")
+		w.WriteListHeader(nbt.TagStruct, 3)
+		for state, pos := range [][]int{{0, 0, 0}, {1, 2, 16}, {1, 0, 3}} {
+			w.WriteTag(nbt.TagInt32, "state")
+			w.WriteInt32(state)
+			w.WriteTag(nbt.TagList, "pos")
+			w.WriteListHeader(nbt.TagInt32, 3)
+			for _, p := range pos {
+				w.WriteInt32(p)
+			}
+			w.WriteTag(nbt.TagStructEnd, "")
+		}
+
+		w.WriteTag(nbt.TagList, "entities")
+		w.WriteListHeader(nbt.TagStructEnd, 0)
+	})
+}
+
+func TestUncompressedSpongeV3Schematic(t *testing.T) {
+	checkSchematic(t, "build.schem", false, func(w *nbt.Writer) {
+		w.WriteTag(nbt.TagStruct, "Schematic")
+		w.WriteTag(nbt.TagInt32, "Version")
+		w.WriteInt32(3)
+		writeSize(w, "Width", "Height", "Length")
+		w.WriteTag(nbt.TagIntArray, "Offset")
+		w.WriteInts([]int{10, 64, -3})
+		w.WriteTag(nbt.TagStruct, "Blocks")
+		w.WriteTag(nbt.TagStruct, "Palette")
+		w.WriteTag(nbt.TagInt32, "air")
+		w.WriteInt32(0)
+		w.WriteTag(nbt.TagInt32, "stone")
+		w.WriteInt32(1)
+		w.WriteTag(nbt.TagInt32, "stone_brick_slab[type=double]")
+		w.WriteInt32(2)
+		w.WriteTag(nbt.TagInt32, "red_wool")
+		w.WriteInt32(3)
+		w.WriteTag(nbt.TagStructEnd, "")
+		indexes := make([]byte, 2*3*17)
+		indexes[0], indexes[yzx(1, 2, 16)], indexes[yzx(1, 0, 3)] = 1, 2, 3
+		w.WriteTag(nbt.TagByteArray, "Data")
+		w.WriteBytes(indexes)
+		w.WriteTag(nbt.TagStructEnd, "")
+		w.WriteTag(nbt.TagStructEnd, "")
+	})
+}
+
+func TestUnknownSchematic(t *testing.T) {
+	var buf bytes.Buffer
+	w := nbt.NewWriter(&buf)
+	w.WriteTag(nbt.TagStruct, "")
+	w.WriteTag(nbt.TagStructEnd, "")
+
+	if _, err := ReadSchematic(&buf); err != UnknownSchematicError {
+		t.Errorf("Error was %v not %v", err, UnknownSchematicError)
+	}
+}
+
+func TestUnknownSchematicBlock(t *testing.T) {
+	var buf bytes.Buffer
+	w := nbt.NewWriter(&buf)
+	w.WriteTag(nbt.TagStruct, "")
+	w.WriteTag(nbt.TagList, "size")
+	w.WriteListHeader(nbt.TagInt32, 3)
+	w.WriteInt32(1)
+	w.WriteInt32(1)
+	w.WriteInt32(1)
+	w.WriteTag(nbt.TagList, "palette")
+	w.WriteListHeader(nbt.TagStruct, 1)
+	w.WriteTag(nbt.TagString, "Name")
+	w.WriteString("mymod:widget")
+	w.WriteTag(nbt.TagStructEnd, "")
+	w.WriteTag(nbt.TagList, "blocks")
+	w.WriteListHeader(nbt.TagStruct, 1)
+	w.WriteTag(nbt.TagInt32, "state")
+	w.WriteInt32(0)
+	w.WriteTag(nbt.TagList, "pos")
+	w.WriteListHeader(nbt.TagInt32, 3)
+	w.WriteInt32(0)
+	w.WriteInt32(0)
+	w.WriteInt32(0)
+	w.WriteTag(nbt.TagStructEnd, "")
+	w.WriteTag(nbt.TagStructEnd, "")
+
+	s, err := ReadSchematic(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Block(0, 0, 0) != 1 || s.UnknownBlocks["mymod:widget"] != 1 {
+		t.Errorf("Unknown block was %v and counted %v", s.Block(0, 0, 0), s.UnknownBlocks)
+	}
+}
+
+func yzx(x, y, z int) int {
+	return x + 2*(z+17*y)
+}
+
+func writeSize(w *nbt.Writer, width, height, length string) {
+	w.WriteTag(nbt.TagInt16, width)
+	w.WriteInt16(2)
+	w.WriteTag(nbt.TagInt16, height)
+	w.WriteInt16(3)
+	w.WriteTag(nbt.TagInt16, length)
+	w.WriteInt16(17)
+}
+
+func checkSchematic(t *testing.T, filename string, gzipped bool, body func(w *nbt.Writer)) {
+	var buf bytes.Buffer
+	var w *nbt.Writer
+	var gw *gzip.Writer
+	if gzipped {
+		gw = gzip.NewWriter(&buf)
+		w = nbt.NewWriter(gw)
+	} else {
+		w = nbt.NewWriter(&buf)
+	}
+	w.WriteTag(nbt.TagStruct, "")
+	body(w)
+	w.WriteTag(nbt.TagStructEnd, "")
+	if gw != nil {
+		gw.Close()
+	}
+
+	path := filepath.Join(t.TempDir(), filename)
+	ioutil.WriteFile(path, buf.Bytes(), 0644)
+
+	world, err := OpenWorld(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseWorld(world)
+
+	s := world.(*SchematicWorld)
+	if s.Width != 2 || s.Height != 3 || s.Length != 17 {
+		t.Errorf("Size %vx%vx%v not 2x3x17", s.Width, s.Height, s.Length)
+	}
+
+	pool, err := world.ChunkPool(&AllChunksMask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Remaining() != 2 {
+		t.Errorf("%v chunks not 2", pool.Remaining())
+	}
+
+	r, err := world.OpenChunk(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	chunk, err := nbt.ReadChunkNbt(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		block   nbt.Block
+		x, y, z int
+	}{
+		{1, 0, 0, 0},
+		{43 + 5<<8, 1, 2, 16},
+		{35 + 14<<8, 1, 0, 3},
+		{0, 1, 1, 1},
+	} {
+		if b := s.Block(c.x, c.y, c.z); b != c.block {
+			t.Errorf("Block at %v,%v,%v is %#x not %#x", c.x, c.y, c.z, b, c.block)
+		}
+	}
+	if b := chunk.Block(1, 2, 0); b != 43+5<<8 {
+		t.Errorf("Chunk 0,1 block is %#x not the double slab", b)
+	}
+}
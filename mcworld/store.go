@@ -0,0 +1,89 @@
+package mcworld
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// worldFile is a file within a world opened for random access.
+type worldFile interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// worldStore holds the files of a world. Names are slash separated and
+// relative to the world directory, e.g. "region/r.0.0.mca".
+type worldStore interface {
+	Open(name string) (worldFile, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDirNames(dir string) ([]string, error)
+	Walk(fn func(name string, info os.FileInfo) error) error
+	Close() error
+}
+
+// streamStore is a worldStore that doesn't hold every file of the world,
+// such as a tar archive. Stream reads all of them in turn.
+type streamStore interface {
+	Stream(fn func(name string, info os.FileInfo, r io.Reader) error) error
+}
+
+func openStore(path string) (worldStore, error) {
+	var fi, err = os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return &dirStore{path}, nil
+	}
+
+	return openArchiveStore(path)
+}
+
+type dirStore struct {
+	dir string
+}
+
+func (s *dirStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+func (s *dirStore) Open(name string) (worldFile, error) {
+	return os.Open(s.path(name))
+}
+
+func (s *dirStore) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(s.path(name))
+}
+
+func (s *dirStore) ReadDirNames(dir string) ([]string, error) {
+	var d, err = os.Open(s.path(dir))
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.Readdirnames(-1)
+}
+
+func (s *dirStore) Walk(fn func(name string, info os.FileInfo) error) error {
+	return filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		var rel, relErr = filepath.Rel(s.dir, path)
+		if relErr != nil {
+			return relErr
+		}
+		return fn(filepath.ToSlash(rel), info)
+	})
+}
+
+func (s *dirStore) Close() error {
+	return nil
+}
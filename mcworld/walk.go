@@ -0,0 +1,213 @@
+package mcworld
+
+import (
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"runtime"
+	"sync"
+)
+
+var (
+	// StopWalk can be returned by a WalkFunc to end the walk early without
+	// Walk returning an error.
+	StopWalk = errors.New("Stop walk")
+
+	WalkCancelledError = errors.New("Walk cancelled")
+)
+
+type WalkFunc func(chunk *nbt.Chunk) error
+
+type WalkOptions struct {
+	// Workers is how many goroutines decode chunks. It defaults to
+	// GOMAXPROCS.
+	Workers int
+
+	// Order is the order chunks are taken from the world in. It defaults to
+	// row major order.
+	Order ChunkOrder
+
+	// Unordered hands chunks over as soon as they are decoded rather than
+	// in Order.
+	Unordered bool
+
+	// Limit is the most chunks to walk. Zero means no limit.
+	Limit int
+
+	// Closing Cancel stops the walk.
+	Cancel <-chan struct{}
+
+	// Coords are the chunks to walk, in the order to walk them, for callers
+	// that already have a pool. The mask and Order aren't used when it is
+	// set.
+	Coords []ChunkCoord
+}
+
+// ChunkError is a chunk that Walk couldn't read.
+type ChunkError struct {
+	X, Z int
+	Err  error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("Chunk %v,%v: %v", e.X, e.Z, e.Err)
+}
+
+// ChunkErrors is returned by Walk when chunks couldn't be read. The other
+// chunks are still walked.
+type ChunkErrors []*ChunkError
+
+func (e ChunkErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v chunks couldn't be read. The first was %v", len(e), e[0])
+}
+
+type walkResult struct {
+	index int
+	chunk *nbt.Chunk
+	err   error
+}
+
+// Walk decodes the world's chunks that aren't masked on several goroutines
+// and calls fn with each of them. fn is only ever called by one goroutine
+// at a time. Walk stops at the first error fn returns, and returns it unless
+// it is StopWalk. Chunks that can't be read are skipped and returned
+// together as ChunkErrors once the walk is done.
+func Walk(world World, mask ChunkMask, opts *WalkOptions, fn WalkFunc) error {
+	if opts == nil {
+		opts = &WalkOptions{}
+	}
+	var workers = opts.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var order = opts.Order
+	if order == nil {
+		order = &RowMajorChunkOrder{}
+	}
+
+	var coords = opts.Coords
+	if coords == nil {
+		var pool, poolErr = world.ChunkPool(mask)
+		if poolErr != nil {
+			return poolErr
+		}
+		coords = make([]ChunkCoord, 0, pool.Remaining())
+		var it = pool.Iterator(order)
+		for x, z, ok := it.Next(); ok && (opts.Limit <= 0 || len(coords) < opts.Limit); x, z, ok = it.Next() {
+			coords = append(coords, ChunkCoord{x, z})
+		}
+	} else if opts.Limit > 0 && len(coords) > opts.Limit {
+		coords = coords[:opts.Limit]
+	}
+
+	var (
+		jobs    = make(chan int)
+		results = make(chan walkResult, workers)
+		stop    = make(chan bool)
+		// window bounds how far decoding gets ahead of fn
+		window = make(chan bool, 4*workers)
+		wg     sync.WaitGroup
+	)
+
+	go func() {
+		defer close(jobs)
+		for i := range coords {
+			select {
+			case window <- true:
+			case <-stop:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var chunk, err = readChunk(world, coords[i].X, coords[i].Z)
+				results <- walkResult{i, chunk, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var finish = func() {
+		close(stop)
+		for range results {
+		}
+	}
+
+	var (
+		chunkErrs = make(ChunkErrors, 0)
+		pending   = make(map[int]walkResult)
+		next      = 0
+	)
+	var collected = func() error {
+		if len(chunkErrs) != 0 {
+			return chunkErrs
+		}
+		return nil
+	}
+	var deliver = func(r walkResult) error {
+		<-window
+		if r.err != nil {
+			chunkErrs = append(chunkErrs, &ChunkError{coords[r.index].X, coords[r.index].Z, r.err})
+			return nil
+		}
+		return fn(r.chunk)
+	}
+
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				return collected()
+			}
+
+			var err error
+			if opts.Unordered {
+				err = deliver(r)
+			} else {
+				pending[r.index] = r
+				for p, ok := pending[next]; ok && err == nil; p, ok = pending[next] {
+					delete(pending, next)
+					next++
+					err = deliver(p)
+				}
+			}
+
+			if err != nil {
+				finish()
+				if err == StopWalk {
+					return collected()
+				}
+				return err
+			}
+		case <-opts.Cancel:
+			finish()
+			return WalkCancelledError
+		}
+	}
+}
+
+func readChunk(world ChunkOpener, x, z int) (*nbt.Chunk, error) {
+	var r, err = world.OpenChunk(x, z)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return nbt.ReadChunkNbt(r)
+}
@@ -0,0 +1,111 @@
+package mcworld
+
+import (
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"io"
+	"testing"
+)
+
+// brokenWorld fails to open the chunks in broken.
+type brokenWorld struct {
+	*MemoryWorld
+	broken map[ChunkCoord]bool
+}
+
+func (w *brokenWorld) OpenChunk(x, z int) (io.ReadCloser, error) {
+	if w.broken[ChunkCoord{x, z}] {
+		return nil, errors.New("broken")
+	}
+	return w.MemoryWorld.OpenChunk(x, z)
+}
+
+func newWalkTestWorld() *brokenWorld {
+	w := &brokenWorld{NewMemoryWorld(), map[ChunkCoord]bool{{2, 0}: true, {5, 5}: true}}
+	for x := 0; x < 8; x++ {
+		for z := 0; z < 8; z++ {
+			w.EmptyChunk(x, z)
+		}
+	}
+	return w
+}
+
+func TestWalkOrdered(t *testing.T) {
+	world := newWalkTestWorld()
+
+	var walked []ChunkCoord
+	err := Walk(world, &AllChunksMask{}, &WalkOptions{Workers: 4}, func(chunk *nbt.Chunk) error {
+		walked = append(walked, ChunkCoord{chunk.XPos, chunk.ZPos})
+		return nil
+	})
+
+	chunkErrs, ok := err.(ChunkErrors)
+	if !ok || len(chunkErrs) != 2 || *chunkErrs[0] != (ChunkError{2, 0, chunkErrs[0].Err}) {
+		t.Errorf("Walk returned %v", err)
+	}
+	if len(walked) != 62 {
+		t.Fatalf("Walked %v chunks not 62", len(walked))
+	}
+	order := &RowMajorChunkOrder{}
+	for i := 1; i < len(walked); i++ {
+		if !order.Less(walked[i-1], walked[i]) {
+			t.Errorf("Chunk %v came after %v", walked[i], walked[i-1])
+		}
+	}
+}
+
+func TestWalkCoords(t *testing.T) {
+	world := newWalkTestWorld()
+
+	coords := []ChunkCoord{{3, 1}, {0, 0}, {7, 2}, {1, 1}}
+	var walked []ChunkCoord
+	err := Walk(world, nil, &WalkOptions{Workers: 4, Coords: coords, Limit: 3}, func(chunk *nbt.Chunk) error {
+		walked = append(walked, ChunkCoord{chunk.XPos, chunk.ZPos})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(walked) != fmt.Sprint(coords[:3]) {
+		t.Errorf("Walked %v not %v", walked, coords[:3])
+	}
+}
+
+func TestWalkStopAndCancel(t *testing.T) {
+	world := newWalkTestWorld()
+	delete(world.broken, ChunkCoord{5, 5})
+
+	count := 0
+	err := Walk(world, &RectangleChunkMask{0, 0, 4, 4}, &WalkOptions{Unordered: true, Limit: 10}, func(chunk *nbt.Chunk) error {
+		count++
+		if count == 5 {
+			return StopWalk
+		}
+		return nil
+	})
+	if count != 5 {
+		t.Errorf("Walked %v chunks after stopping at 5", count)
+	}
+	if _, ok := err.(ChunkErrors); err != nil && !ok {
+		t.Errorf("Stopped walk returned %v", err)
+	}
+
+	cancel := make(chan struct{})
+	count = 0
+	err = Walk(world, &AllChunksMask{}, &WalkOptions{Cancel: cancel}, func(chunk *nbt.Chunk) error {
+		count++
+		if count == 3 {
+			close(cancel)
+		}
+		return nil
+	})
+	if err != WalkCancelledError || count >= 63 {
+		t.Errorf("Cancelled walk returned %v after %v chunks", err, count)
+	}
+
+	fail := errors.New("fail")
+	if err := Walk(world, &AllChunksMask{}, nil, func(chunk *nbt.Chunk) error { return fail }); err != fail {
+		t.Errorf("Walk returned %v not the callback's error", err)
+	}
+}
@@ -1,10 +1,9 @@
 package mcworld
 
 import (
+	"github.com/quag/mcobj/nbt"
 	"io"
 	"math"
-	"os"
-	"path/filepath"
 )
 
 type ChunkOpener interface {
@@ -20,22 +19,71 @@ type World interface {
 	ChunkPooler
 }
 
+// LevelReader is implemented by worlds that have a level.dat.
+type LevelReader interface {
+	ReadLevel() (*nbt.Level, error)
+}
+
 type ChunkPool interface {
 	Pop(x, z int) bool
 	Remaining() int
 	BoundingBox() *BoundingBox
+	Iterator(order ChunkOrder) *ChunkIterator
 }
 
+// BoundingBox bounds are inclusive, so a box holding a single chunk has
+// X0 == X1 and Z0 == Z1.
 type BoundingBox struct {
 	X0, Z0, X1, Z1 int
 }
 
-func OpenWorld(worldDir string) World {
-	var _, err = os.Stat(filepath.Join(worldDir, "region"))
+// OpenWorld opens the world in a save directory or in a .zip, .tar or
+// .tar.gz backup of one. Bedrock Edition worlds are read from their db
+// folder. Indev and Classic level files and schematics are opened as small
+// worlds of their own. The world should be closed with CloseWorld.
+func OpenWorld(path string) (World, error) {
+	if IsSchematic(path) {
+		return OpenSchematic(path)
+	}
+	if IsLevelFile(path) {
+		return OpenLevelFile(path)
+	}
+	if IsBedrockWorld(path) {
+		return OpenBedrockWorld(path)
+	}
+
+	var store, err = openStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := store.Stat("db/CURRENT"); err == nil {
+		store.Close()
+		return nil, BedrockArchiveError
+	}
+
+	if _, err := store.Stat("region"); err != nil {
+		return &AlphaWorld{store: store}, nil
+	}
+	return newBetaWorld(store), nil
+}
+
+// CloseWorld releases any files held open by the world.
+func CloseWorld(world World) error {
+	if closer, ok := world.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func readLevel(store worldStore) (*nbt.Level, error) {
+	var file, err = store.Open("level.dat")
 	if err != nil {
-		return &AlphaWorld{worldDir}
+		return nil, err
 	}
-	return &BetaWorld{worldDir}
+	defer file.Close()
+
+	return nbt.ReadLevelDat(file)
 }
 
 type ReadCloserPair struct {
@@ -66,13 +114,76 @@ func EmptyBoundingBox() *BoundingBox {
 func (b *BoundingBox) Union(x, z int) {
 	if x < b.X0 {
 		b.X0 = x
-	} else if x > b.X1 {
+	}
+	if x > b.X1 {
 		b.X1 = x
 	}
 
 	if z < b.Z0 {
 		b.Z0 = z
-	} else if z > b.Z1 {
+	}
+	if z > b.Z1 {
 		b.Z1 = z
 	}
 }
+
+func (b *BoundingBox) IsEmpty() bool {
+	return b.X0 > b.X1 || b.Z0 > b.Z1
+}
+
+func (b *BoundingBox) Width() int {
+	if b.IsEmpty() {
+		return 0
+	}
+	return b.X1 - b.X0 + 1
+}
+
+func (b *BoundingBox) Length() int {
+	if b.IsEmpty() {
+		return 0
+	}
+	return b.Z1 - b.Z0 + 1
+}
+
+func (b *BoundingBox) Contains(x, z int) bool {
+	return x >= b.X0 && x <= b.X1 && z >= b.Z0 && z <= b.Z1
+}
+
+func (b *BoundingBox) Intersect(o *BoundingBox) *BoundingBox {
+	var r = &BoundingBox{max(b.X0, o.X0), max(b.Z0, o.Z0), min(b.X1, o.X1), min(b.Z1, o.Z1)}
+	if r.IsEmpty() {
+		return EmptyBoundingBox()
+	}
+	return r
+}
+
+// Expand returns a copy of the box grown by n on every side. Negative n
+// shrinks the box.
+func (b *BoundingBox) Expand(n int) *BoundingBox {
+	if b.IsEmpty() {
+		return EmptyBoundingBox()
+	}
+	var r = &BoundingBox{b.X0 - n, b.Z0 - n, b.X1 + n, b.Z1 + n}
+	if r.IsEmpty() {
+		return EmptyBoundingBox()
+	}
+	return r
+}
+
+// BlockBox converts a box of chunk coordinates to the box of block
+// coordinates covered by those chunks.
+func (b *BoundingBox) BlockBox() *BoundingBox {
+	if b.IsEmpty() {
+		return EmptyBoundingBox()
+	}
+	return &BoundingBox{b.X0 * 16, b.Z0 * 16, b.X1*16 + 15, b.Z1*16 + 15}
+}
+
+// ChunkBox converts a box of block coordinates to the box of chunks that
+// contain those blocks.
+func (b *BoundingBox) ChunkBox() *BoundingBox {
+	if b.IsEmpty() {
+		return EmptyBoundingBox()
+	}
+	return &BoundingBox{b.X0 >> 4, b.Z0 >> 4, b.X1 >> 4, b.Z1 >> 4}
+}
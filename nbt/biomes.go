@@ -0,0 +1,88 @@
+package nbt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// biomeNames are the names of the numeric biome ids used before 1.18.
+var biomeNames = map[int]string{
+	0: "ocean", 1: "plains", 2: "desert", 3: "mountains", 4: "forest", 5: "taiga", 6: "swamp", 7: "river",
+	8: "nether_wastes", 9: "the_end", 10: "frozen_ocean", 11: "frozen_river", 12: "snowy_tundra", 13: "snowy_mountains",
+	14: "mushroom_fields", 15: "mushroom_field_shore", 16: "beach", 17: "desert_hills", 18: "wooded_hills",
+	19: "taiga_hills", 20: "mountain_edge", 21: "jungle", 22: "jungle_hills", 23: "jungle_edge", 24: "deep_ocean",
+	25: "stone_shore", 26: "snowy_beach", 27: "birch_forest", 28: "birch_forest_hills", 29: "dark_forest",
+	30: "snowy_taiga", 31: "snowy_taiga_hills", 32: "giant_tree_taiga", 33: "giant_tree_taiga_hills",
+	34: "wooded_mountains", 35: "savanna", 36: "savanna_plateau", 37: "badlands", 38: "wooded_badlands_plateau",
+	39: "badlands_plateau", 40: "small_end_islands", 41: "end_midlands", 42: "end_highlands", 43: "end_barrens",
+	44: "warm_ocean", 45: "lukewarm_ocean", 46: "cold_ocean", 47: "deep_warm_ocean", 48: "deep_lukewarm_ocean",
+	49: "deep_cold_ocean", 50: "deep_frozen_ocean", 127: "the_void", 129: "sunflower_plains", 130: "desert_lakes",
+	131: "gravelly_mountains", 132: "flower_forest", 133: "taiga_mountains", 134: "swamp_hills", 140: "ice_spikes",
+	149: "modified_jungle", 151: "modified_jungle_edge", 155: "tall_birch_forest", 156: "tall_birch_hills",
+	157: "dark_forest_hills", 158: "snowy_taiga_mountains", 160: "giant_spruce_taiga", 161: "giant_spruce_taiga_hills",
+	162: "modified_gravelly_mountains", 163: "shattered_savanna", 164: "shattered_savanna_plateau",
+	165: "eroded_badlands", 166: "modified_wooded_badlands_plateau", 167: "modified_badlands_plateau",
+	168: "bamboo_jungle", 169: "bamboo_jungle_hills", 170: "soul_sand_valley", 171: "crimson_forest",
+	172: "warped_forest", 173: "basalt_deltas", 174: "dripstone_caves", 175: "lush_caves",
+
+	// Biomes added since 1.18, which have no numeric ids of their own
+	176: "meadow", 177: "grove", 178: "snowy_slopes", 179: "frozen_peaks", 180: "jagged_peaks", 181: "stony_peaks",
+	182: "deep_dark", 183: "mangrove_swamp", 184: "cherry_grove", 185: "pale_garden",
+}
+
+// renamedBiomes are the 1.18 names of biomes that were renamed, with their
+// old ids.
+var renamedBiomes = map[string]int{
+	"snowy_plains": 12, "windswept_hills": 3, "sparse_jungle": 23, "stony_shore": 25,
+	"old_growth_pine_taiga": 32, "windswept_forest": 34, "wooded_badlands": 38,
+	"windswept_gravelly_hills": 131, "old_growth_birch_forest": 155, "old_growth_spruce_taiga": 160,
+	"windswept_savanna": 163,
+}
+
+var (
+	biomeIds      = make(map[string]int)
+	unknownBiomes = 0
+	biomesLock    sync.Mutex
+)
+
+func init() {
+	for id, name := range biomeNames {
+		biomeIds[name] = id
+	}
+	for name, id := range renamedBiomes {
+		biomeIds[name] = id
+	}
+}
+
+// firstUnknownBiome is the id given to the first biome name that isn't
+// known, such as a mod's. Later ones follow it.
+const firstUnknownBiome = 1000
+
+// BiomeId returns the numeric id of a namespaced biome name, as 1.18 and
+// later chunks hold.
+func BiomeId(name string) int {
+	biomesLock.Lock()
+	defer biomesLock.Unlock()
+
+	var short = strings.TrimPrefix(name, "minecraft:")
+	if id, ok := biomeIds[short]; ok {
+		return id
+	}
+	var id = firstUnknownBiome + unknownBiomes
+	unknownBiomes++
+	biomeIds[short] = id
+	biomeNames[id] = short
+	return id
+}
+
+// BiomeName returns the name of a numeric biome id.
+func BiomeName(id int) string {
+	biomesLock.Lock()
+	defer biomesLock.Unlock()
+
+	if name, ok := biomeNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("biome_%d", id)
+}
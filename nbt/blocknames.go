@@ -0,0 +1,241 @@
+package nbt
+
+import (
+	"strings"
+)
+
+// BlockFromName converts a namespaced block state such as
+// "minecraft:oak_log[axis=y]" to the numeric id and data used before
+// Minecraft 1.13. Names without a namespace are taken to be "minecraft:".
+// The second result is false for blocks without a numeric equivalent.
+func BlockFromName(state string) (Block, bool) {
+	var name, properties = SplitBlockState(state)
+
+	var block, ok = blockNames[name]
+	if !ok {
+		return 0, false
+	}
+
+	// Double slabs are a separate block id rather than a slab property
+	if properties["type"] == "double" && block&0xff == 44 {
+		block = block&0xff00 | 43
+	}
+
+	return block, true
+}
+
+// NameFromBlock is the reverse of BlockFromName, giving the namespaced name
+// of a numeric block without its properties. Where several names share a
+// block the shortest is used, which is the plainest: stone rather than
+// granite, oak_log rather than oak_wood.
+func NameFromBlock(block Block) (string, bool) {
+	var name, ok = blockIds[block]
+	return name, ok
+}
+
+// SplitBlockState separates a block state into its namespaced name and its
+// properties.
+func SplitBlockState(state string) (string, map[string]string) {
+	var name, properties = state, map[string]string{}
+
+	if i := strings.Index(state, "["); i != -1 {
+		name = state[:i]
+		for _, property := range strings.Split(strings.TrimSuffix(state[i+1:], "]"), ",") {
+			var kv = strings.SplitN(property, "=", 2)
+			if len(kv) == 2 {
+				properties[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+	}
+
+	if !strings.Contains(name, ":") {
+		name = "minecraft:" + name
+	}
+
+	return name, properties
+}
+
+func legacyBlock(id, data int) Block {
+	return Block(id) + Block(data)<<8
+}
+
+var woolColors = []string{"white", "orange", "magenta", "light_blue", "yellow", "lime", "pink", "gray", "light_gray", "cyan", "purple", "blue", "brown", "green", "red", "black"}
+
+var blockNames = map[string]Block{
+	"minecraft:air":                   legacyBlock(0, 0),
+	"minecraft:cave_air":              legacyBlock(0, 0),
+	"minecraft:void_air":              legacyBlock(0, 0),
+	"minecraft:structure_void":        legacyBlock(0, 0),
+	"minecraft:stone":                 legacyBlock(1, 0),
+	"minecraft:granite":               legacyBlock(1, 0),
+	"minecraft:diorite":               legacyBlock(1, 0),
+	"minecraft:andesite":              legacyBlock(1, 0),
+	"minecraft:grass_block":           legacyBlock(2, 0),
+	"minecraft:dirt":                  legacyBlock(3, 0),
+	"minecraft:coarse_dirt":           legacyBlock(3, 0),
+	"minecraft:podzol":                legacyBlock(3, 0),
+	"minecraft:cobblestone":           legacyBlock(4, 0),
+	"minecraft:oak_planks":            legacyBlock(5, 0),
+	"minecraft:spruce_planks":         legacyBlock(5, 1),
+	"minecraft:birch_planks":          legacyBlock(5, 2),
+	"minecraft:jungle_planks":         legacyBlock(5, 3),
+	"minecraft:oak_sapling":           legacyBlock(6, 0),
+	"minecraft:spruce_sapling":        legacyBlock(6, 1),
+	"minecraft:birch_sapling":         legacyBlock(6, 2),
+	"minecraft:jungle_sapling":        legacyBlock(6, 3),
+	"minecraft:bedrock":               legacyBlock(7, 0),
+	"minecraft:water":                 legacyBlock(9, 0),
+	"minecraft:flowing_water":         legacyBlock(8, 0),
+	"minecraft:lava":                  legacyBlock(11, 0),
+	"minecraft:flowing_lava":          legacyBlock(10, 0),
+	"minecraft:sand":                  legacyBlock(12, 0),
+	"minecraft:gravel":                legacyBlock(13, 0),
+	"minecraft:gold_ore":              legacyBlock(14, 0),
+	"minecraft:iron_ore":              legacyBlock(15, 0),
+	"minecraft:coal_ore":              legacyBlock(16, 0),
+	"minecraft:oak_log":               legacyBlock(17, 0),
+	"minecraft:spruce_log":            legacyBlock(17, 1),
+	"minecraft:birch_log":             legacyBlock(17, 2),
+	"minecraft:jungle_log":            legacyBlock(17, 3),
+	"minecraft:oak_wood":              legacyBlock(17, 0),
+	"minecraft:spruce_wood":           legacyBlock(17, 1),
+	"minecraft:birch_wood":            legacyBlock(17, 2),
+	"minecraft:jungle_wood":           legacyBlock(17, 3),
+	"minecraft:oak_leaves":            legacyBlock(18, 0),
+	"minecraft:spruce_leaves":         legacyBlock(18, 1),
+	"minecraft:birch_leaves":          legacyBlock(18, 2),
+	"minecraft:jungle_leaves":         legacyBlock(18, 3),
+	"minecraft:sponge":                legacyBlock(19, 0),
+	"minecraft:glass":                 legacyBlock(20, 0),
+	"minecraft:lapis_ore":             legacyBlock(21, 0),
+	"minecraft:lapis_block":           legacyBlock(22, 0),
+	"minecraft:dispenser":             legacyBlock(23, 0),
+	"minecraft:sandstone":             legacyBlock(24, 0),
+	"minecraft:chiseled_sandstone":    legacyBlock(24, 1),
+	"minecraft:cut_sandstone":         legacyBlock(24, 2),
+	"minecraft:smooth_sandstone":      legacyBlock(24, 2),
+	"minecraft:note_block":            legacyBlock(25, 0),
+	"minecraft:red_bed":               legacyBlock(26, 0),
+	"minecraft:powered_rail":          legacyBlock(27, 0),
+	"minecraft:detector_rail":         legacyBlock(28, 0),
+	"minecraft:sticky_piston":         legacyBlock(29, 0),
+	"minecraft:cobweb":                legacyBlock(30, 0),
+	"minecraft:dead_bush":             legacyBlock(32, 0),
+	"minecraft:tall_grass":            legacyBlock(31, 1),
+	"minecraft:grass":                 legacyBlock(31, 1),
+	"minecraft:short_grass":           legacyBlock(31, 1),
+	"minecraft:fern":                  legacyBlock(31, 2),
+	"minecraft:piston":                legacyBlock(33, 0),
+	"minecraft:piston_head":           legacyBlock(34, 0),
+	"minecraft:dandelion":             legacyBlock(37, 0),
+	"minecraft:poppy":                 legacyBlock(38, 0),
+	"minecraft:brown_mushroom":        legacyBlock(39, 0),
+	"minecraft:red_mushroom":          legacyBlock(40, 0),
+	"minecraft:gold_block":            legacyBlock(41, 0),
+	"minecraft:iron_block":            legacyBlock(42, 0),
+	"minecraft:smooth_stone":          legacyBlock(43, 0),
+	"minecraft:stone_slab":            legacyBlock(44, 0),
+	"minecraft:smooth_stone_slab":     legacyBlock(44, 0),
+	"minecraft:sandstone_slab":        legacyBlock(44, 1),
+	"minecraft:oak_slab":              legacyBlock(44, 2),
+	"minecraft:cobblestone_slab":      legacyBlock(44, 3),
+	"minecraft:brick_slab":            legacyBlock(44, 4),
+	"minecraft:stone_brick_slab":      legacyBlock(44, 5),
+	"minecraft:bricks":                legacyBlock(45, 0),
+	"minecraft:tnt":                   legacyBlock(46, 0),
+	"minecraft:bookshelf":             legacyBlock(47, 0),
+	"minecraft:mossy_cobblestone":     legacyBlock(48, 0),
+	"minecraft:obsidian":              legacyBlock(49, 0),
+	"minecraft:torch":                 legacyBlock(50, 0),
+	"minecraft:wall_torch":            legacyBlock(50, 0),
+	"minecraft:fire":                  legacyBlock(51, 0),
+	"minecraft:spawner":               legacyBlock(52, 0),
+	"minecraft:oak_stairs":            legacyBlock(53, 0),
+	"minecraft:chest":                 legacyBlock(54, 0),
+	"minecraft:redstone_wire":         legacyBlock(55, 0),
+	"minecraft:diamond_ore":           legacyBlock(56, 0),
+	"minecraft:diamond_block":         legacyBlock(57, 0),
+	"minecraft:crafting_table":        legacyBlock(58, 0),
+	"minecraft:wheat":                 legacyBlock(59, 0),
+	"minecraft:farmland":              legacyBlock(60, 0),
+	"minecraft:furnace":               legacyBlock(61, 0),
+	"minecraft:oak_sign":              legacyBlock(63, 0),
+	"minecraft:sign":                  legacyBlock(63, 0),
+	"minecraft:oak_door":              legacyBlock(64, 0),
+	"minecraft:ladder":                legacyBlock(65, 0),
+	"minecraft:rail":                  legacyBlock(66, 0),
+	"minecraft:cobblestone_stairs":    legacyBlock(67, 0),
+	"minecraft:oak_wall_sign":         legacyBlock(68, 0),
+	"minecraft:wall_sign":             legacyBlock(68, 0),
+	"minecraft:lever":                 legacyBlock(69, 0),
+	"minecraft:stone_pressure_plate":  legacyBlock(70, 0),
+	"minecraft:iron_door":             legacyBlock(71, 0),
+	"minecraft:oak_pressure_plate":    legacyBlock(72, 0),
+	"minecraft:redstone_ore":          legacyBlock(73, 0),
+	"minecraft:redstone_torch":        legacyBlock(76, 0),
+	"minecraft:redstone_wall_torch":   legacyBlock(76, 0),
+	"minecraft:stone_button":          legacyBlock(77, 0),
+	"minecraft:snow":                  legacyBlock(78, 0),
+	"minecraft:ice":                   legacyBlock(79, 0),
+	"minecraft:snow_block":            legacyBlock(80, 0),
+	"minecraft:cactus":                legacyBlock(81, 0),
+	"minecraft:clay":                  legacyBlock(82, 0),
+	"minecraft:sugar_cane":            legacyBlock(83, 0),
+	"minecraft:jukebox":               legacyBlock(84, 0),
+	"minecraft:oak_fence":             legacyBlock(85, 0),
+	"minecraft:pumpkin":               legacyBlock(86, 0),
+	"minecraft:carved_pumpkin":        legacyBlock(86, 0),
+	"minecraft:netherrack":            legacyBlock(87, 0),
+	"minecraft:soul_sand":             legacyBlock(88, 0),
+	"minecraft:glowstone":             legacyBlock(89, 0),
+	"minecraft:nether_portal":         legacyBlock(90, 0),
+	"minecraft:jack_o_lantern":        legacyBlock(91, 0),
+	"minecraft:cake":                  legacyBlock(92, 0),
+	"minecraft:repeater":              legacyBlock(93, 0),
+	"minecraft:oak_trapdoor":          legacyBlock(96, 0),
+	"minecraft:infested_stone":        legacyBlock(97, 0),
+	"minecraft:stone_bricks":          legacyBlock(98, 0),
+	"minecraft:mossy_stone_bricks":    legacyBlock(98, 1),
+	"minecraft:cracked_stone_bricks":  legacyBlock(98, 2),
+	"minecraft:chiseled_stone_bricks": legacyBlock(98, 3),
+	"minecraft:brown_mushroom_block":  legacyBlock(99, 0),
+	"minecraft:red_mushroom_block":    legacyBlock(100, 0),
+	"minecraft:mushroom_stem":         legacyBlock(99, 10),
+	"minecraft:iron_bars":             legacyBlock(101, 0),
+	"minecraft:glass_pane":            legacyBlock(102, 0),
+	"minecraft:melon":                 legacyBlock(103, 0),
+	"minecraft:pumpkin_stem":          legacyBlock(104, 0),
+	"minecraft:melon_stem":            legacyBlock(105, 0),
+	"minecraft:vine":                  legacyBlock(106, 0),
+	"minecraft:oak_fence_gate":        legacyBlock(107, 0),
+	"minecraft:brick_stairs":          legacyBlock(108, 0),
+	"minecraft:stone_brick_stairs":    legacyBlock(109, 0),
+	"minecraft:mycelium":              legacyBlock(110, 0),
+	"minecraft:lily_pad":              legacyBlock(111, 0),
+	"minecraft:nether_bricks":         legacyBlock(112, 0),
+	"minecraft:nether_brick_fence":    legacyBlock(113, 0),
+	"minecraft:nether_brick_stairs":   legacyBlock(114, 0),
+	"minecraft:nether_wart":           legacyBlock(115, 0),
+	"minecraft:enchanting_table":      legacyBlock(116, 0),
+	"minecraft:brewing_stand":         legacyBlock(117, 0),
+	"minecraft:cauldron":              legacyBlock(118, 0),
+	"minecraft:end_portal":            legacyBlock(119, 0),
+	"minecraft:end_portal_frame":      legacyBlock(120, 0),
+	"minecraft:end_stone":             legacyBlock(121, 0),
+	"minecraft:dragon_egg":            legacyBlock(122, 0),
+	"minecraft:redstone_lamp":         legacyBlock(123, 0),
+}
+
+var blockIds = make(map[Block]string)
+
+func init() {
+	for i, color := range woolColors {
+		blockNames["minecraft:"+color+"_wool"] = legacyBlock(35, i)
+	}
+
+	for name, block := range blockNames {
+		if other, ok := blockIds[block]; !ok || len(name) < len(other) || len(name) == len(other) && name < other {
+			blockIds[block] = name
+		}
+	}
+}
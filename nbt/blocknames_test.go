@@ -0,0 +1,25 @@
+package nbt
+
+import (
+	"testing"
+)
+
+func TestNameFromBlock(t *testing.T) {
+	var tests = map[Block]string{
+		1:          "minecraft:stone",
+		17 + 2<<8:  "minecraft:birch_log",
+		35 + 14<<8: "minecraft:red_wool",
+	}
+	for block, expected := range tests {
+		if name, ok := NameFromBlock(block); !ok || name != expected {
+			t.Errorf("Block %#x named %q not %q", block, name, expected)
+		}
+		if back, _ := BlockFromName(expected); back != block {
+			t.Errorf("%v is block %#x not %#x", expected, back, block)
+		}
+	}
+
+	if name, ok := NameFromBlock(255 + 15<<8); ok {
+		t.Errorf("Unknown block named %q", name)
+	}
+}
@@ -1,20 +1,52 @@
 package nbt
 
 import (
+	"bufio"
 	"compress/gzip"
-	"errors"
-	"fmt"
 	"io"
 )
 
+// Chunk blocks are stored column by column (XZY), so the block at x, y, z is
+// Blocks[y + height*(z + 16*x)].
 type Chunk struct {
 	XPos, ZPos int
 	Blocks     []Block
+
+	// MinY is the y of the bottom of Blocks, which is below 0 from 1.18
+	MinY int
+
+	// DataVersion is the version of Minecraft that saved the chunk, or 0
+	// before 1.9
+	DataVersion int
+
+	// InhabitedTime is how many ticks players have spent near the chunk
+	InhabitedTime int
+
+	// Populated is false for chunks still being generated, whose trees and
+	// ores may not have been placed yet
+	Populated bool
+
+	// Biomes holds a biome id for each column, indexed by x + 16*z, or from
+	// 1.15 for each 4x4x4 cell, indexed by x/4 + 4*(z/4 + 4*((y-MinY)/4)).
+	// Cells whose biome isn't known are -1
+	Biomes []int
 }
 
-var (
-	ErrListUnknown = errors.New("Lists of unknown type aren't supported")
-)
+func NewChunk(xPos, zPos, height int) *Chunk {
+	return &Chunk{XPos: xPos, ZPos: zPos, Blocks: make([]Block, 16*16*height), Populated: true}
+}
+
+func (c *Chunk) Height() int {
+	return len(c.Blocks) / (16 * 16)
+}
+
+func (c *Chunk) Block(x, y, z int) Block {
+	return c.Blocks[y+c.Height()*(z+16*x)]
+}
+
+func (c *Chunk) SetBlock(x, y, z int, block Block) {
+	c.Blocks[y+c.Height()*(z+16*x)] = block
+}
 
 func ReadChunkDat(reader io.Reader) (*Chunk, error) {
 	r, err := gzip.NewReader(reader)
@@ -26,46 +58,101 @@ func ReadChunkDat(reader io.Reader) (*Chunk, error) {
 	return ReadChunkNbt(r)
 }
 
+// ReadChunkNbt reads a chunk in any of the ChunkFormats. Chunks in a layout
+// it doesn't recognise give an *UnsupportedChunkError.
 func ReadChunkNbt(reader io.Reader) (*Chunk, error) {
-	chunkData := new(chunkData)
-	chunkData.sections = make([]*sectionData, 0)
-	if err := chunkData.parse(NewReader(reader), false); err != nil {
+	var root, err = Parse(reader)
+	if err != nil {
 		return nil, err
 	}
+	return decodeChunk(root)
+}
 
-	chunk := &Chunk{chunkData.xPos, chunkData.zPos, nil}
-
-	if len(chunkData.sections) != 0 {
-		chunk.Blocks = make([]Block, 256*16*16) // Hard coded height for now. TODO: Make variable height chunks.
-		for _, section := range chunkData.sections {
-			for i, blockId := range section.blocks {
-				var metadata byte
-				if i&1 == 1 {
-					metadata = section.data[i/2] >> 4
-				} else {
-					metadata = section.data[i/2] & 0xf
-				}
-				// Note that the old format is XZY and the new format is YZX
-				x, z, y := indexToCoords(i, 16, 16)
-				chunk.Blocks[coordsToIndex(x, z, y+16*section.y, 16, 256)] = Block(blockId) + (Block(metadata) << 8)
+// WriteChunkNbt writes the chunk as uncompressed Anvil NBT. Sections that
+// are entirely air are omitted.
+func WriteChunkNbt(writer io.Writer, chunk *Chunk) error {
+	var bw = bufio.NewWriter(writer)
+	var sw = &stickyWriter{w: bw}
+	var w = NewWriter(sw)
+
+	var height = chunk.Height()
+	var sections = make([]*sectionData, 0, height/16)
+	for sy := 0; sy < height/16; sy++ {
+		var section = &sectionData{sy + chunk.MinY/16, make([]byte, 16*16*16), make([]byte, 16*16*16/2)}
+		var empty = true
+		for i := range section.blocks {
+			// Sections are stored YZX
+			x, z, y := indexToCoords(i, 16, 16)
+			var block = chunk.Blocks[coordsToIndex(x, z, y+16*sy, 16, height)]
+			if block != 0 {
+				empty = false
+			}
+			section.blocks[i] = byte(block & 0xff)
+			var metadata = byte(block>>8) & 0xf
+			if i&1 == 1 {
+				section.data[i/2] |= metadata << 4
+			} else {
+				section.data[i/2] |= metadata
 			}
 		}
-	} else {
-		if chunkData.blocks != nil && chunkData.data != nil {
-			chunk.Blocks = make([]Block, len(chunkData.blocks))
-			for i, blockId := range chunkData.blocks {
-				var metadata byte
-				if i&1 == 1 {
-					metadata = chunkData.data[i/2] >> 4
-				} else {
-					metadata = chunkData.data[i/2] & 0xf
-				}
-				chunk.Blocks[i] = Block(blockId) + (Block(metadata) << 8)
-			}
+		if !empty {
+			sections = append(sections, section)
 		}
 	}
 
-	return chunk, nil
+	w.WriteTag(TagStruct, "")
+	w.WriteTag(TagStruct, "Level")
+	w.WriteTag(TagInt32, "xPos")
+	w.WriteInt32(chunk.XPos)
+	w.WriteTag(TagInt32, "zPos")
+	w.WriteInt32(chunk.ZPos)
+	w.WriteTag(TagInt8, "TerrainPopulated")
+	if chunk.Populated {
+		w.WriteInt8(1)
+	} else {
+		w.WriteInt8(0)
+	}
+	if chunk.InhabitedTime != 0 {
+		w.WriteTag(TagInt64, "InhabitedTime")
+		w.WriteInt64(chunk.InhabitedTime)
+	}
+	if chunk.Biomes != nil {
+		w.WriteTag(TagIntArray, "Biomes")
+		w.WriteInts(chunk.Biomes)
+	}
+	w.WriteTag(TagList, "Sections")
+	w.WriteListHeader(TagStruct, len(sections))
+	for _, section := range sections {
+		w.WriteTag(TagInt8, "Y")
+		w.WriteInt8(section.y)
+		w.WriteTag(TagByteArray, "Blocks")
+		w.WriteBytes(section.blocks)
+		w.WriteTag(TagByteArray, "Data")
+		w.WriteBytes(section.data)
+		w.WriteTag(TagStructEnd, "")
+	}
+	w.WriteTag(TagStructEnd, "")
+	w.WriteTag(TagStructEnd, "")
+
+	if sw.err != nil {
+		return sw.err
+	}
+	return bw.Flush()
+}
+
+// stickyWriter remembers the first write error and ignores all later writes.
+type stickyWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (s *stickyWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	var n int
+	n, s.err = s.w.Write(p)
+	return n, s.err
 }
 
 func indexToCoords(i, aMax, bMax int) (a, b, c int) {
@@ -89,157 +176,8 @@ func yzxToXzy(yzx, xMax, zMax, yMax int) int {
 	return xzy
 }
 
-type chunkData struct {
-	xPos, zPos int
-	blocks     []byte
-	data       []byte
-	section    *sectionData
-	sections   []*sectionData
-}
-
 type sectionData struct {
 	y      int
 	blocks []byte
 	data   []byte
 }
-
-func (chunk *chunkData) parse(r *Reader, listStruct bool) error {
-	structDepth := 0
-	if listStruct {
-		structDepth++
-	}
-
-	for {
-		typeId, name, err := r.ReadTag()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		switch typeId {
-		case TagStruct:
-			structDepth++
-		case TagStructEnd:
-			structDepth--
-			if structDepth == 0 {
-				return nil
-			}
-		case TagByteArray:
-			bytes, err := r.ReadBytes()
-			if err != nil {
-				return err
-			}
-			if name == "Blocks" {
-				if chunk.section != nil {
-					chunk.section.blocks = bytes
-				} else {
-					chunk.blocks = bytes
-				}
-			} else if name == "Data" {
-				if chunk.section != nil {
-					chunk.section.data = bytes
-				} else {
-					chunk.data = bytes
-				}
-			}
-		case TagIntArray:
-			_, err := r.ReadInts()
-			if err != nil {
-				return err
-			}
-		case TagInt8:
-			number, err := r.ReadInt8()
-			if err != nil {
-				return err
-			}
-			if name == "Y" {
-				chunk.section.y = int(number)
-			}
-		case TagInt16:
-			_, err := r.ReadInt16()
-			if err != nil {
-				return err
-			}
-		case TagInt32:
-			number, err := r.ReadInt32()
-			if err != nil {
-				return err
-			}
-
-			if name == "xPos" {
-				chunk.xPos = number
-			}
-			if name == "zPos" {
-				chunk.zPos = number
-			}
-		case TagInt64:
-			_, err := r.ReadInt64()
-			if err != nil {
-				return err
-			}
-		case TagFloat32:
-			_, err := r.ReadFloat32()
-			if err != nil {
-				return err
-			}
-		case TagFloat64:
-			_, err := r.ReadFloat64()
-			if err != nil {
-				return err
-			}
-		case TagString:
-			_, err := r.ReadString()
-			if err != nil {
-				return err
-			}
-		case TagList:
-			itemTypeId, length, err := r.ReadListHeader()
-			if err != nil {
-				return err
-			}
-			switch itemTypeId {
-			case TagInt8:
-				for i := 0; i < length; i++ {
-					_, err := r.ReadInt8()
-					if err != nil {
-						return err
-					}
-				}
-			case TagFloat32:
-				for i := 0; i < length; i++ {
-					_, err := r.ReadFloat32()
-					if err != nil {
-						return err
-					}
-				}
-			case TagFloat64:
-				for i := 0; i < length; i++ {
-					_, err := r.ReadFloat64()
-					if err != nil {
-						return err
-					}
-				}
-			case TagStruct:
-				for i := 0; i < length; i++ {
-					if name == "Sections" {
-						chunk.section = new(sectionData)
-						chunk.sections = append(chunk.sections, chunk.section)
-					}
-					err := chunk.parse(r, true)
-					if err != nil {
-						return err
-					}
-				}
-			default:
-				fmt.Printf("# %s list todo(%v) %v\n", name, itemTypeId, length)
-				return ErrListUnknown
-			}
-		default:
-			fmt.Printf("# %s todo(%d)\n", name, typeId)
-		}
-	}
-
-	return nil
-}
@@ -0,0 +1,77 @@
+package nbt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	chunk := NewChunk(-3, 70000, 256)
+	chunk.SetBlock(0, 0, 0, 7)
+	chunk.SetBlock(15, 255, 15, 20)
+	chunk.SetBlock(3, 64, 9, 35+14<<8) // Red wool
+	chunk.SetBlock(4, 64, 9, 35+1<<8)  // Orange wool
+	chunk.InhabitedTime = 1 << 40
+	chunk.Populated = false
+	chunk.Biomes = make([]int, 256)
+	chunk.Biomes[17] = 2
+
+	var buf bytes.Buffer
+	if err := WriteChunkNbt(&buf, chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadChunkNbt(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.XPos != -3 || read.ZPos != 70000 {
+		t.Errorf("Position (%d,%d) not (-3,70000)", read.XPos, read.ZPos)
+	}
+	if len(read.Biomes) != 256 || read.Biomes[17] != 2 {
+		t.Errorf("Biomes %v not desert at 1,1", read.Biomes)
+	}
+	if read.Populated {
+		t.Errorf("Unpopulated chunk read as populated")
+	}
+	if read.InhabitedTime != 1<<40 {
+		t.Errorf("InhabitedTime %d not %d", read.InhabitedTime, 1<<40)
+	}
+	if len(read.Blocks) != len(chunk.Blocks) {
+		t.Fatalf("Read %d blocks not %d", len(read.Blocks), len(chunk.Blocks))
+	}
+	for i, block := range chunk.Blocks {
+		if read.Blocks[i] != block {
+			t.Errorf("Block %d is %#x not %#x", i, read.Blocks[i], block)
+		}
+	}
+}
+
+func TestEmptyChunkRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteChunkNbt(&buf, NewChunk(1, 2, 256)); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadChunkNbt(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Height() != 256 {
+		t.Errorf("Height %d not 256", read.Height())
+	}
+}
+
+func TestReadNegativeInts(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{0xff, 0xff, 0xfe, 0xff, 0xff, 0xff, 0xfd}))
+	if i, _ := r.ReadInt8(); i != -1 {
+		t.Errorf("Int8 %d not -1", i)
+	}
+	if i, _ := r.ReadInt16(); i != -2 {
+		t.Errorf("Int16 %d not -2", i)
+	}
+	if i, _ := r.ReadInt32(); i != -3 {
+		t.Errorf("Int32 %d not -3", i)
+	}
+}
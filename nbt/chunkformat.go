@@ -0,0 +1,418 @@
+package nbt
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// ChunkFormat is the layout of a chunk's NBT, which changed every few
+// versions of Minecraft.
+type ChunkFormat int
+
+const (
+	UnknownChunkFormat ChunkFormat = iota
+
+	// AlphaChunkFormat is a 128 block high array of ids beside an array of
+	// data values, used by Alpha and McRegion worlds
+	AlphaChunkFormat
+
+	// AnvilChunkFormat holds 16x16x16 sections of ids and data values, from
+	// 1.2
+	AnvilChunkFormat
+
+	// PaletteChunkFormat holds sections of indexes into palettes of
+	// namespaced block states, from 1.13
+	PaletteChunkFormat
+
+	// UnwrappedChunkFormat is the palette format without the Level compound
+	// around it, and reaching down to y -64, from 1.18
+	UnwrappedChunkFormat
+)
+
+var chunkFormatNames = []string{"unknown", "Alpha/McRegion", "Anvil", "1.13 palette", "1.18"}
+
+func (f ChunkFormat) String() string {
+	if f < 0 || int(f) >= len(chunkFormatNames) {
+		return chunkFormatNames[0]
+	}
+	return chunkFormatNames[f]
+}
+
+// DataVersions where the chunk format changed
+const (
+	DataVersionFlattening  = 1451 // 17w47a, the first with block palettes
+	DataVersionPackedLongs = 2529 // 20w17a, palette indexes stopped spanning longs
+	DataVersionNoLevel     = 2844 // 21w43a, the Level compound was removed
+)
+
+// UnsupportedChunkError is returned for chunks whose layout isn't one of
+// the known ChunkFormats, or is broken in a way that leaves the blocks
+// unreadable.
+type UnsupportedChunkError struct {
+	DataVersion int // 0 before 1.9, when chunks didn't record it
+	Format      ChunkFormat
+	Reason      string
+}
+
+func (e *UnsupportedChunkError) Error() string {
+	var version = "no DataVersion"
+	if e.DataVersion != 0 {
+		version = fmt.Sprintf("DataVersion %d", e.DataVersion)
+	}
+	if e.Format != UnknownChunkFormat {
+		return fmt.Sprintf("Unsupported %v chunk (%v): %v", e.Format, version, e.Reason)
+	}
+	return fmt.Sprintf("Unsupported chunk format (%v): %v", version, e.Reason)
+}
+
+// DetectChunkFormat works out the layout of a chunk read with Parse.
+func DetectChunkFormat(root map[string]interface{}) (ChunkFormat, error) {
+	var dataVersion, _ = root["DataVersion"].(int)
+
+	var level, wrapped = root["Level"].(map[string]interface{})
+	if !wrapped {
+		if _, ok := root["sections"]; ok || dataVersion >= DataVersionNoLevel {
+			return UnwrappedChunkFormat, nil
+		}
+		return UnknownChunkFormat, &UnsupportedChunkError{dataVersion, UnknownChunkFormat, "no Level compound or sections"}
+	}
+
+	if sections, ok := level["Sections"].([]interface{}); ok {
+		for _, s := range sections {
+			var section, _ = s.(map[string]interface{})
+			if _, ok := section["Palette"]; ok {
+				return PaletteChunkFormat, nil
+			}
+			if _, ok := section["Blocks"]; ok {
+				return AnvilChunkFormat, nil
+			}
+		}
+		// Sections that only hold light say nothing about the format
+		if dataVersion >= DataVersionFlattening {
+			return PaletteChunkFormat, nil
+		}
+		return AnvilChunkFormat, nil
+	}
+	if _, ok := level["Blocks"]; ok {
+		return AlphaChunkFormat, nil
+	}
+	if dataVersion >= DataVersionFlattening {
+		// Chunks still being generated don't have sections yet
+		return PaletteChunkFormat, nil
+	}
+	return UnknownChunkFormat, &UnsupportedChunkError{dataVersion, UnknownChunkFormat, "no Blocks or Sections"}
+}
+
+// decodeChunk turns a chunk read with Parse into a Chunk using the decoder
+// for its format.
+func decodeChunk(root map[string]interface{}) (*Chunk, error) {
+	var format, err = DetectChunkFormat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var dataVersion, _ = root["DataVersion"].(int)
+	var level = root
+	if format != UnwrappedChunkFormat {
+		level = root["Level"].(map[string]interface{})
+	}
+
+	var chunk = &Chunk{DataVersion: dataVersion}
+	chunk.XPos, _ = level["xPos"].(int)
+	chunk.ZPos, _ = level["zPos"].(int)
+	chunk.InhabitedTime, _ = level["InhabitedTime"].(int)
+	chunk.Populated = populated(level)
+	switch biomes := level["Biomes"].(type) {
+	case []int:
+		chunk.Biomes = biomes
+	case []byte:
+		chunk.Biomes = make([]int, len(biomes))
+		for i, b := range biomes {
+			chunk.Biomes[i] = int(b)
+		}
+	}
+
+	var reason string
+	switch format {
+	case AlphaChunkFormat:
+		reason = decodeAlphaBlocks(chunk, level)
+	case AnvilChunkFormat:
+		reason = decodeSections(chunk, level, "Sections", 0, 15, anvilSection, nil)
+	case PaletteChunkFormat:
+		reason = decodeSections(chunk, level, "Sections", 0, 15, paletteSection(dataVersion >= DataVersionPackedLongs, "Palette", "BlockStates", false), nil)
+	case UnwrappedChunkFormat:
+		var minSection = -4
+		if yPos, ok := level["yPos"].(int); ok {
+			minSection = yPos
+		}
+		reason = decodeSections(chunk, level, "sections", minSection, minSection+23, paletteSection(true, "palette", "data", true), sectionBiomes)
+	}
+	if reason != "" {
+		return nil, &UnsupportedChunkError{dataVersion, format, reason}
+	}
+	return chunk, nil
+}
+
+// populated reads the generation status of the chunk. Before 1.13 it is a
+// flag. Since then it is a status that is "full" once generation has
+// finished, which 1.13 itself spread over its last three steps. Chunks with
+// neither are taken to be finished.
+func populated(level map[string]interface{}) bool {
+	if status, ok := level["Status"].(string); ok {
+		switch strings.TrimPrefix(status, "minecraft:") {
+		case "full", "finalized", "fullchunk", "postprocessed":
+			return true
+		}
+		return false
+	}
+	if flag, ok := level["TerrainPopulated"].(int); ok {
+		return flag != 0
+	}
+	return true
+}
+
+func decodeAlphaBlocks(chunk *Chunk, level map[string]interface{}) string {
+	var blocks, _ = level["Blocks"].([]byte)
+	var data, _ = level["Data"].([]byte)
+	if len(blocks) == 0 || len(blocks)%256 != 0 || len(data)*2 < len(blocks) {
+		return fmt.Sprintf("%d Blocks and %d Data bytes", len(blocks), len(data))
+	}
+
+	chunk.Blocks = make([]Block, len(blocks))
+	for i, blockId := range blocks {
+		chunk.Blocks[i] = Block(blockId) + Block(nibble(data, i))<<8
+	}
+	return ""
+}
+
+func nibble(data []byte, i int) byte {
+	if i&1 == 1 {
+		return data[i/2] >> 4
+	}
+	return data[i/2] & 0xf
+}
+
+// sectionDecoder returns the blocks of a section in YZX order.
+type sectionDecoder func(section map[string]interface{}) ([]Block, string)
+
+// biomeDecoder returns the biomes of a section's 4x4x4 cells in YZX order,
+// or nil if it has none.
+type biomeDecoder func(section map[string]interface{}) ([]int, string)
+
+// decodeSections fills the chunk from a list of sections. The chunk covers
+// the sections from minSection to maxSection, further if any blocks are
+// outside that range. Sections just beyond the world that only hold light
+// are ignored. Formats that keep biomes in the sections pass decodeBiomes,
+// and cells of sections without biomes are given -1.
+func decodeSections(chunk *Chunk, level map[string]interface{}, name string, minSection, maxSection int, decode sectionDecoder, decodeBiomes biomeDecoder) string {
+	var sections, _ = level[name].([]interface{})
+	var decoded = make(map[int][]Block, len(sections))
+	var biomes = make(map[int][]int)
+	for _, s := range sections {
+		var section, _ = s.(map[string]interface{})
+		var sy, _ = section["Y"].(int)
+		var blocks, reason = decode(section)
+		if reason != "" {
+			return fmt.Sprintf("section %d: %v", sy, reason)
+		}
+		for _, block := range blocks {
+			if block != 0 {
+				decoded[sy] = blocks
+				minSection, maxSection = min(minSection, sy), max(maxSection, sy)
+				break
+			}
+		}
+
+		if decodeBiomes != nil {
+			var cells, reason = decodeBiomes(section)
+			if reason != "" {
+				return fmt.Sprintf("section %d biomes: %v", sy, reason)
+			}
+			if cells != nil {
+				biomes[sy] = cells
+			}
+		}
+	}
+
+	var height = 16 * (maxSection - minSection + 1)
+	chunk.MinY = 16 * minSection
+	chunk.Blocks = make([]Block, 16*16*height)
+	for sy, blocks := range decoded {
+		for i, block := range blocks {
+			// Sections are stored YZX
+			x, z, y := indexToCoords(i, 16, 16)
+			chunk.Blocks[coordsToIndex(x, z, y+16*(sy-minSection), 16, height)] = block
+		}
+	}
+
+	if len(biomes) != 0 {
+		chunk.Biomes = make([]int, 64*(maxSection-minSection+1))
+		for sy := minSection; sy <= maxSection; sy++ {
+			var cells = chunk.Biomes[64*(sy-minSection) : 64*(sy-minSection+1)]
+			if biomes[sy] == nil {
+				for i := range cells {
+					cells[i] = -1
+				}
+				continue
+			}
+			copy(cells, biomes[sy])
+		}
+	}
+	return ""
+}
+
+// sectionBiomes decodes the biomes of a 1.18 section: a palette of biome
+// names and indexes packed into longs, left out when the palette has a
+// single entry.
+func sectionBiomes(section map[string]interface{}) ([]int, string) {
+	var biomes, _ = section["biomes"].(map[string]interface{})
+	var palette, _ = biomes["palette"].([]string)
+	if len(palette) == 0 {
+		return nil, ""
+	}
+
+	var ids = make([]int, len(palette))
+	for i, name := range palette {
+		ids[i] = BiomeId(name)
+	}
+
+	var cells = make([]int, 64)
+	if len(palette) == 1 {
+		for i := range cells {
+			cells[i] = ids[0]
+		}
+		return cells, ""
+	}
+
+	var longs, _ = biomes["data"].([]int64)
+	var indexes, err = unpackIndexes(longs, bits.Len(uint(len(palette)-1)), true, len(cells))
+	if err != nil {
+		return nil, err.Error()
+	}
+	for i, index := range indexes {
+		if index >= len(ids) {
+			return nil, fmt.Sprintf("palette index %d of %d", index, len(ids))
+		}
+		cells[i] = ids[index]
+	}
+	return cells, ""
+}
+
+func anvilSection(section map[string]interface{}) ([]Block, string) {
+	var ids, hasIds = section["Blocks"].([]byte)
+	if !hasIds {
+		// Sections holding only light
+		return nil, ""
+	}
+	var data, _ = section["Data"].([]byte)
+	if len(ids) != 4096 || len(data) != 2048 {
+		return nil, fmt.Sprintf("%d Blocks and %d Data bytes", len(ids), len(data))
+	}
+
+	var blocks = make([]Block, len(ids))
+	for i, id := range ids {
+		blocks[i] = Block(id) + Block(nibble(data, i))<<8
+	}
+	return blocks, ""
+}
+
+// paletteSection decodes sections of palette indexes packed into longs.
+// Before 1.16 indexes could span two longs. From 1.18 the palette and
+// indexes are in a block_states compound and the indexes are left out
+// when the palette has a single entry.
+func paletteSection(packed bool, paletteName, indexesName string, blockStates bool) sectionDecoder {
+	return func(section map[string]interface{}) ([]Block, string) {
+		var states = section
+		if blockStates {
+			states, _ = section["block_states"].(map[string]interface{})
+		}
+		var palette, _ = states[paletteName].([]interface{})
+		if len(palette) == 0 {
+			return nil, ""
+		}
+
+		var blocks = make([]Block, len(palette))
+		for i, entry := range palette {
+			var state, _ = entry.(map[string]interface{})
+			blocks[i] = blockFromPaletteState(state)
+		}
+
+		var longs, _ = states[indexesName].([]int64)
+		if len(palette) == 1 && len(longs) == 0 {
+			var filled = make([]Block, 4096)
+			for i := range filled {
+				filled[i] = blocks[0]
+			}
+			return filled, ""
+		}
+
+		var indexes, err = unpackIndexes(longs, max(4, bits.Len(uint(len(palette)-1))), packed, 4096)
+		if err != nil {
+			return nil, err.Error()
+		}
+		var decoded = make([]Block, 4096)
+		for i, index := range indexes {
+			if index >= len(blocks) {
+				return nil, fmt.Sprintf("palette index %d of %d", index, len(blocks))
+			}
+			decoded[i] = blocks[index]
+		}
+		return decoded, ""
+	}
+}
+
+// unpackIndexes reads n indexes of the given size from longs. Packed
+// indexes don't span two longs, leaving the top bits of each long unused.
+func unpackIndexes(longs []int64, size int, packed bool, n int) ([]int, error) {
+	var expected = (n*size + 63) / 64
+	if packed {
+		var perLong = 64 / size
+		expected = (n + perLong - 1) / perLong
+	}
+	if len(longs) < expected {
+		return nil, errors.New(fmt.Sprintf("%d longs of indexes, expected %d", len(longs), expected))
+	}
+
+	var (
+		indexes = make([]int, n)
+		mask    = uint64(1)<<uint(size) - 1
+	)
+	for i := range indexes {
+		if packed {
+			var perLong = 64 / size
+			indexes[i] = int(uint64(longs[i/perLong]) >> uint(size*(i%perLong)) & mask)
+			continue
+		}
+		var bit = i * size
+		var value = uint64(longs[bit/64]) >> uint(bit%64)
+		if bit%64+size > 64 {
+			value |= uint64(longs[bit/64+1]) << uint(64-bit%64)
+		}
+		indexes[i] = int(value & mask)
+	}
+	return indexes, nil
+}
+
+// blockFromPaletteState converts a palette entry to a numeric block. Blocks
+// without a numeric equivalent become stone so the shape of the world is
+// kept.
+func blockFromPaletteState(state map[string]interface{}) Block {
+	var name, _ = state["Name"].(string)
+	if properties, ok := state["Properties"].(map[string]interface{}); ok && len(properties) != 0 {
+		var pairs = make([]string, 0, len(properties))
+		for k, v := range properties {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", k, v))
+		}
+		sort.Strings(pairs)
+		name += "[" + strings.Join(pairs, ",") + "]"
+	}
+
+	var block, ok = BlockFromName(name)
+	if !ok {
+		return 1
+	}
+	return block
+}
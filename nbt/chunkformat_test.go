@@ -0,0 +1,217 @@
+package nbt
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func compound(name string, children ...*Tag) *Tag {
+	return &Tag{TagStruct, name, children}
+}
+
+func compoundList(name string, items ...*Tag) *Tag {
+	return &Tag{TagList, name, &List{TagStruct, items}}
+}
+
+func paletteList(name string, states ...string) *Tag {
+	var items []*Tag
+	for _, state := range states {
+		items = append(items, compound("", &Tag{TagString, "Name", state}))
+	}
+	return compoundList(name, items...)
+}
+
+// packIndexes is the inverse of unpackIndexes.
+func packIndexes(indexes []int, size int, packed bool) []int64 {
+	var longs []int64
+	if packed {
+		var perLong = 64 / size
+		longs = make([]int64, (len(indexes)+perLong-1)/perLong)
+		for i, index := range indexes {
+			longs[i/perLong] |= int64(index) << uint(size*(i%perLong))
+		}
+		return longs
+	}
+	longs = make([]int64, (len(indexes)*size+63)/64)
+	for i, index := range indexes {
+		var bit = i * size
+		longs[bit/64] |= int64(index) << uint(bit%64)
+		if bit%64+size > 64 {
+			longs[bit/64+1] |= int64(index) >> uint(64-bit%64)
+		}
+	}
+	return longs
+}
+
+func readTree(t *testing.T, root *Tag) (*Chunk, error) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).WriteTree(root); err != nil {
+		t.Fatal(err)
+	}
+	return ReadChunkNbt(&buf)
+}
+
+func TestReadPaletteChunk(t *testing.T) {
+	// Seventeen states need five bit indexes, which span longs before 20w17a
+	var states = []string{"minecraft:air"}
+	for _, color := range woolColors {
+		states = append(states, "minecraft:"+color+"_wool")
+	}
+	var indexes = make([]int, 4096)
+	for i := range indexes {
+		indexes[i] = i % len(states)
+	}
+
+	for _, dataVersion := range []int{1976, 2586} {
+		var root = compound("",
+			&Tag{TagInt32, "DataVersion", dataVersion},
+			compound("Level",
+				&Tag{TagInt32, "xPos", 1},
+				&Tag{TagInt32, "zPos", 2},
+				&Tag{TagString, "Status", "carvers"},
+				compoundList("Sections",
+					compound("", &Tag{TagInt8, "Y", -1}, &Tag{TagByteArray, "SkyLight", make([]byte, 2048)}),
+					compound("",
+						&Tag{TagInt8, "Y", 4},
+						paletteList("Palette", states...),
+						&Tag{TagLongArray, "BlockStates", packIndexes(indexes, 5, dataVersion >= DataVersionPackedLongs)})),
+			))
+
+		var chunk, err = readTree(t, root)
+		if err != nil {
+			t.Fatalf("DataVersion %d: %v", dataVersion, err)
+		}
+		if chunk.XPos != 1 || chunk.ZPos != 2 || chunk.DataVersion != dataVersion || chunk.Populated {
+			t.Errorf("DataVersion %d: chunk %d,%d version %d populated %v", dataVersion, chunk.XPos, chunk.ZPos, chunk.DataVersion, chunk.Populated)
+		}
+		if chunk.Height() != 256 || chunk.MinY != 0 {
+			t.Fatalf("DataVersion %d: height %d from %d not 256 from 0", dataVersion, chunk.Height(), chunk.MinY)
+		}
+		for i, index := range indexes {
+			x, z, y := indexToCoords(i, 16, 16)
+			var expected Block
+			if index != 0 {
+				expected = 35 + Block(index-1)<<8
+			}
+			if block := chunk.Block(x, 64+y, z); block != expected {
+				t.Fatalf("DataVersion %d: block %d,%d,%d is %#x not %#x", dataVersion, x, 64+y, z, block, expected)
+			}
+		}
+	}
+}
+
+func biomeList(names ...string) *Tag {
+	var items []*Tag
+	for _, name := range names {
+		items = append(items, &Tag{TagString, "", name})
+	}
+	return &Tag{TagList, "palette", &List{TagString, items}}
+}
+
+func TestRead118Chunk(t *testing.T) {
+	var indexes = make([]int, 4096)
+	indexes[1+16*(2+16*3)] = 1
+	indexes[0] = 2
+	var biomes = make([]int, 64)
+	biomes[5], biomes[63] = 1, 2
+
+	var root = compound("",
+		&Tag{TagInt32, "DataVersion", 2975},
+		&Tag{TagInt32, "xPos", -5},
+		&Tag{TagInt32, "zPos", 7},
+		&Tag{TagInt32, "yPos", -4},
+		&Tag{TagInt64, "InhabitedTime", 99},
+		&Tag{TagString, "Status", "minecraft:full"},
+		compoundList("sections",
+			compound("",
+				&Tag{TagInt8, "Y", -4},
+				compound("block_states", paletteList("palette", "minecraft:bedrock")),
+				compound("biomes", biomeList("minecraft:deep_dark"))),
+			compound("",
+				&Tag{TagInt8, "Y", 0},
+				compound("block_states",
+					paletteList("palette", "minecraft:air", "minecraft:oak_planks", "minecraft:deepslate"),
+					&Tag{TagLongArray, "data", packIndexes(indexes, 4, true)}),
+				compound("biomes",
+					biomeList("minecraft:plains", "minecraft:windswept_hills", "mod:moon"),
+					&Tag{TagLongArray, "data", packIndexes(biomes, 2, true)})),
+		))
+
+	var chunk, err = readTree(t, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.XPos != -5 || chunk.ZPos != 7 || chunk.InhabitedTime != 99 || !chunk.Populated {
+		t.Errorf("Chunk %d,%d inhabited %d populated %v", chunk.XPos, chunk.ZPos, chunk.InhabitedTime, chunk.Populated)
+	}
+	if chunk.MinY != -64 || chunk.Height() != 384 {
+		t.Fatalf("Height %d from %d not 384 from -64", chunk.Height(), chunk.MinY)
+	}
+
+	var tests = []struct {
+		x, y, z  int
+		expected Block
+	}{
+		{0, -64, 0, 7},
+		{15, -49, 15, 7},
+		{0, -48, 0, 0},
+		{1, 3, 2, 5},
+		{0, 0, 0, 1}, // Deepslate has no numeric id
+		{1, 4, 2, 0},
+		{0, 319, 0, 0},
+	}
+	for _, test := range tests {
+		if block := chunk.Block(test.x, test.y-chunk.MinY, test.z); block != test.expected {
+			t.Errorf("Block %d,%d,%d is %#x not %#x", test.x, test.y, test.z, block, test.expected)
+		}
+	}
+
+	if len(chunk.Biomes) != 24*64 {
+		t.Fatalf("%d biome cells not %d", len(chunk.Biomes), 24*64)
+	}
+	var moon = chunk.Biomes[4*64+63]
+	if moon < firstUnknownBiome || BiomeName(moon) != "mod:moon" {
+		t.Errorf("Mod biome is %d, named %v", moon, BiomeName(moon))
+	}
+	for i, expected := range map[int]int{0: 182, 63: 182, 64: -1, 4 * 64: 1, 4*64 + 5: 3, 4*64 + 6: 1} {
+		if chunk.Biomes[i] != expected {
+			t.Errorf("Biome cell %d is %d not %d", i, chunk.Biomes[i], expected)
+		}
+	}
+}
+
+func TestUnsupportedChunk(t *testing.T) {
+	var tests = []struct {
+		root        *Tag
+		dataVersion int
+		format      ChunkFormat
+	}{
+		{compound("", compound("Stuff")), 0, UnknownChunkFormat},
+		{compound("", &Tag{TagInt32, "DataVersion", 1343}, compound("Level", &Tag{TagInt32, "xPos", 1})), 1343, UnknownChunkFormat},
+		{compound("",
+			&Tag{TagInt32, "DataVersion", 1631},
+			compound("Level", compoundList("Sections", compound("",
+				&Tag{TagInt8, "Y", 0},
+				paletteList("Palette", "minecraft:air", "minecraft:stone"),
+				&Tag{TagLongArray, "BlockStates", make([]int64, 3)})))),
+			1631, PaletteChunkFormat},
+	}
+
+	for _, test := range tests {
+		var _, err = readTree(t, test.root)
+		var unsupported *UnsupportedChunkError
+		if !errors.As(err, &unsupported) {
+			t.Errorf("Error %v not an UnsupportedChunkError", err)
+			continue
+		}
+		if unsupported.DataVersion != test.dataVersion || unsupported.Format != test.format {
+			t.Errorf("Error for %v %v chunk is for %v %v", test.dataVersion, test.format, unsupported.DataVersion, unsupported.Format)
+		}
+		if test.dataVersion != 0 && !strings.Contains(err.Error(), strconv.Itoa(test.dataVersion)) {
+			t.Errorf("Error %q doesn't name the version", err)
+		}
+	}
+}
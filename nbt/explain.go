@@ -129,8 +129,6 @@ func (e *explainer) parseStruct(nr *Reader, listStruct bool) error {
 			e.stack.pop()
 		}
 	}
-
-	return nil
 }
 
 func (e *explainer) RecordTag(typeId TypeId, name string) {
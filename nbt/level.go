@@ -13,6 +13,16 @@ var (
 
 type Level struct {
 	SpawnX, SpawnY, SpawnZ int
+
+	// These are left at their zero values when missing
+	Name                string
+	GameType            int
+	Time, DayTime       int
+	Raining, Thundering bool
+	Seed                int
+	Version             string // The name of the version that last saved the world, from 1.9
+	DataVersion         int    // From 1.9
+	StorageVersion      int    // 19132 for McRegion, 19133 for Anvil
 }
 
 func ReadLevelDat(reader io.Reader) (*Level, error) {
@@ -41,6 +51,27 @@ func ReadLevelNbt(reader io.Reader) (*Level, error) {
 		return nil, DataStructNotFound
 	}
 
+	return levelFromData(data)
+}
+
+// ReadBedrockLevelDat reads the level.dat of a Bedrock Edition world. It is
+// uncompressed little endian NBT after an 8 byte header holding the format
+// version and length, and has the spawn at the top level.
+func ReadBedrockLevelDat(reader io.Reader) (*Level, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, err
+	}
+
+	root, err := ParseLittleEndian(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return levelFromData(root)
+}
+
+func levelFromData(data map[string]interface{}) (*Level, error) {
 	xval, xok := data["SpawnX"]
 	yval, yok := data["SpawnY"]
 	zval, zok := data["SpawnZ"]
@@ -58,5 +89,44 @@ func ReadLevelNbt(reader io.Reader) (*Level, error) {
 		return nil, SpawnIntNotFound
 	}
 
+	level.Name, _ = data["LevelName"].(string)
+	level.GameType, _ = data["GameType"].(int)
+	level.Time, _ = data["Time"].(int)
+	level.DayTime, _ = data["DayTime"].(int)
+	var raining, _ = data["raining"].(int)
+	var thundering, _ = data["thundering"].(int)
+	level.Raining, level.Thundering = raining != 0, thundering != 0
+	level.Seed, _ = data["RandomSeed"].(int)
+	if settings, ok := data["WorldGenSettings"].(map[string]interface{}); ok {
+		// The seed moved here in 1.16
+		level.Seed, _ = settings["seed"].(int)
+	}
+	if version, ok := data["Version"].(map[string]interface{}); ok {
+		level.Version, _ = version["Name"].(string)
+	}
+	level.DataVersion, _ = data["DataVersion"].(int)
+	level.StorageVersion, _ = data["version"].(int)
+
 	return level, nil
 }
+
+// ReadLevelTree reads the whole of a gzipped level.dat so that it can be
+// edited and written back with WriteLevelTree.
+func ReadLevelTree(reader io.Reader) (*Tag, error) {
+	r, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return NewReader(r).ReadTree()
+}
+
+func WriteLevelTree(writer io.Writer, root *Tag) error {
+	w := gzip.NewWriter(writer)
+	if err := NewWriter(w).WriteTree(root); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
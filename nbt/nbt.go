@@ -23,19 +23,37 @@ const (
 	TagList      TypeId = 9  // { TAG_Byte tagId; TAG_Int length; A sequential list of Tags (not Named Tags), of type <typeId>. The length of this array is <length> Tags. } Notes: All tags share the same type.
 	TagStruct    TypeId = 10 // { A sequential list of Named Tags. This array keeps going until a TAG_End is found.; TAG_End end } Notes: If there's a nested TAG_Compound within this tag, that one will also have a TAG_End, so simply reading until the next TAG_End will not work. The names of the named tags have to be unique within each TAG_Compound The order of the tags is not guaranteed.
 	TagIntArray  TypeId = 11 // { TAG_Int length; An array of ints. The length of this array is <length> ints }
+	TagLongArray TypeId = 12 // { TAG_Int length; An array of longs. The length of this array is <length> longs }
+)
+
+var (
+	ErrNegativeLength = errors.New("Negative array length")
 )
 
 type Reader struct {
-	r *bufio.Reader
+	r            *bufio.Reader
+	littleEndian bool
 }
 
 func Parse(r io.Reader) (map[string]interface{}, error) {
-	nr := NewReader(r)
+	return NewReader(r).ReadRoot()
+}
+
+func ParseLittleEndian(r io.Reader) (map[string]interface{}, error) {
+	return NewLittleEndianReader(r).ReadRoot()
+}
+
+// ReadRoot reads a named compound tag, the top level of an NBT file.
+func (nr *Reader) ReadRoot() (map[string]interface{}, error) {
 	typeId, _, err := nr.ReadTag()
 	if err != nil {
 		return nil, err
 	}
 
+	if typeId != TagStruct {
+		return nil, errors.New(fmt.Sprintf("expected a compound tag, found typeId %d", typeId))
+	}
+
 	value, err := nr.ReadValue(typeId)
 	if err != nil {
 		return nil, err
@@ -44,7 +62,12 @@ func Parse(r io.Reader) (map[string]interface{}, error) {
 }
 
 func NewReader(r io.Reader) *Reader {
-	return &Reader{bufio.NewReader(r)}
+	return &Reader{bufio.NewReader(r), false}
+}
+
+// NewLittleEndianReader reads the little endian NBT used by Bedrock Edition.
+func NewLittleEndianReader(r io.Reader) *Reader {
+	return &Reader{bufio.NewReader(r), true}
 }
 
 func (r *Reader) ReadTag() (typeId TypeId, name string, err error) {
@@ -68,12 +91,15 @@ func (r *Reader) ReadListHeader() (itemTypeId TypeId, length int, err error) {
 	if err == nil {
 		length, err = r.ReadInt32()
 	}
+	if err == nil && length < 0 {
+		length, err = 0, ErrNegativeLength
+	}
 
 	return
 }
 
 func (r *Reader) ReadString() (string, error) {
-	var length, err1 = r.ReadInt16()
+	var length, err1 = r.readUintN(2)
 	if err1 != nil {
 		return "", err1
 	}
@@ -88,6 +114,9 @@ func (r *Reader) ReadBytes() ([]byte, error) {
 	if err1 != nil {
 		return nil, err1
 	}
+	if length < 0 {
+		return nil, ErrNegativeLength
+	}
 
 	var bytes = make([]byte, length)
 	var _, err = io.ReadFull(r.r, bytes)
@@ -99,6 +128,9 @@ func (r *Reader) ReadInts() ([]int, error) {
 	if err != nil {
 		return nil, err
 	}
+	if length < 0 {
+		return nil, ErrNegativeLength
+	}
 
 	ints := make([]int, length)
 	for i := 0; i < length; i++ {
@@ -110,6 +142,26 @@ func (r *Reader) ReadInts() ([]int, error) {
 	return ints, nil
 }
 
+func (r *Reader) ReadLongs() ([]int64, error) {
+	length, err := r.ReadInt32()
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, ErrNegativeLength
+	}
+
+	longs := make([]int64, length)
+	for i := 0; i < length; i++ {
+		x, err := r.readUintN(8)
+		if err != nil {
+			return nil, err
+		}
+		longs[i] = int64(x)
+	}
+	return longs, nil
+}
+
 func (r *Reader) ReadInt8() (int, error) {
 	return r.readIntN(1)
 }
@@ -149,7 +201,16 @@ func (r *Reader) readIntN(n int) (int, error) {
 		if err != nil {
 			return a, err
 		}
-		a = a<<8 + int(b)
+		if r.littleEndian {
+			a |= int(b) << uint(8*i)
+		} else {
+			a = a<<8 + int(b)
+		}
+	}
+
+	// Sign extend
+	if n < 8 && a >= 1<<uint(8*n-1) {
+		a -= 1 << uint(8*n)
 	}
 
 	return a, nil
@@ -163,7 +224,11 @@ func (r *Reader) readUintN(n int) (uint64, error) {
 		if err != nil {
 			return a, err
 		}
-		a = a<<8 + uint64(b)
+		if r.littleEndian {
+			a |= uint64(b) << uint(8*i)
+		} else {
+			a = a<<8 + uint64(b)
+		}
 	}
 
 	return a, nil
@@ -196,6 +261,10 @@ func (r *Reader) ReadValue(typeId TypeId) (interface{}, error) {
 		return nil, nil
 	case TagByteArray:
 		return r.ReadBytes()
+	case TagIntArray:
+		return r.ReadInts()
+	case TagLongArray:
+		return r.ReadLongs()
 	case TagInt8:
 		return r.ReadInt8()
 	case TagInt16:
@@ -216,10 +285,20 @@ func (r *Reader) ReadValue(typeId TypeId) (interface{}, error) {
 			return nil, err
 		}
 		switch TypeId(itemTypeId) {
-		case TagInt8:
+		case TagInt8, TagInt16, TagInt32, TagInt64:
 			list := make([]int, length)
 			for i := 0; i < length; i++ {
-				x, err := r.ReadInt8()
+				x, err := r.ReadValue(itemTypeId)
+				if err != nil {
+					return list, err
+				}
+				list[i] = x.(int)
+			}
+			return list, nil
+		case TagString:
+			list := make([]string, length)
+			for i := 0; i < length; i++ {
+				x, err := r.ReadString()
 				list[i] = x
 				if err != nil {
 					return list, err
@@ -257,6 +336,17 @@ func (r *Reader) ReadValue(typeId TypeId) (interface{}, error) {
 				}
 			}
 			return list, nil
+		case TagStructEnd, TagList, TagByteArray, TagIntArray, TagLongArray:
+			// Empty lists are typed TagStructEnd
+			list := make([]interface{}, length)
+			for i := 0; i < length; i++ {
+				x, err := r.ReadValue(itemTypeId)
+				list[i] = x
+				if err != nil {
+					return list, err
+				}
+			}
+			return list, nil
 		default:
 			return nil, errors.New(fmt.Sprintf("reading lists of typeId %d not supported. length:%d", itemTypeId, length))
 		}
@@ -0,0 +1,158 @@
+package nbt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tag is a named NBT value that keeps its type, so a file can be read,
+// changed and written back without altering anything else in it.
+//
+// Values are int for the integer types, float32, float64, string, []byte,
+// []int for int arrays, []int64 for long arrays, []*Tag for compounds and
+// *List for lists.
+type Tag struct {
+	Type  TypeId
+	Name  string
+	Value interface{}
+}
+
+// List is the value of a list tag. Its items are unnamed tags of ItemType.
+type List struct {
+	ItemType TypeId
+	Items    []*Tag
+}
+
+// ReadTree reads a named compound tag, the top level of an NBT file, with
+// everything in it.
+func (r *Reader) ReadTree() (*Tag, error) {
+	typeId, name, err := r.ReadTag()
+	if err != nil {
+		return nil, err
+	}
+	if typeId != TagStruct {
+		return nil, errors.New(fmt.Sprintf("expected a compound tag, found typeId %d", typeId))
+	}
+
+	value, err := r.readTreeValue(typeId)
+	if err != nil {
+		return nil, err
+	}
+	return &Tag{typeId, name, value}, nil
+}
+
+func (r *Reader) readTreeValue(typeId TypeId) (interface{}, error) {
+	switch typeId {
+	case TagStruct:
+		tags := make([]*Tag, 0)
+		for {
+			itemTypeId, name, err := r.ReadTag()
+			if err != nil {
+				return nil, err
+			}
+			if itemTypeId == TagStructEnd {
+				return tags, nil
+			}
+			value, err := r.readTreeValue(itemTypeId)
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, &Tag{itemTypeId, name, value})
+		}
+	case TagList:
+		itemTypeId, length, err := r.ReadListHeader()
+		if err != nil {
+			return nil, err
+		}
+		list := &List{itemTypeId, make([]*Tag, 0, min(length, 1024))}
+		for i := 0; i < length; i++ {
+			value, err := r.readTreeValue(itemTypeId)
+			if err != nil {
+				return nil, err
+			}
+			list.Items = append(list.Items, &Tag{itemTypeId, "", value})
+		}
+		return list, nil
+	case TagStructEnd:
+		return nil, nil
+	}
+	return r.ReadValue(typeId)
+}
+
+// WriteTree writes a tag read with ReadTree.
+func (w *Writer) WriteTree(t *Tag) error {
+	if err := w.WriteTag(t.Type, t.Name); err != nil {
+		return err
+	}
+	return w.writeTreeValue(t)
+}
+
+func (w *Writer) writeTreeValue(t *Tag) error {
+	var err error
+	switch t.Type {
+	case TagStruct:
+		for _, child := range t.Value.([]*Tag) {
+			if err = w.WriteTree(child); err != nil {
+				return err
+			}
+		}
+		err = w.WriteTag(TagStructEnd, "")
+	case TagList:
+		var list = t.Value.(*List)
+		if err = w.WriteListHeader(list.ItemType, len(list.Items)); err != nil {
+			return err
+		}
+		for _, item := range list.Items {
+			if err = w.writeTreeValue(item); err != nil {
+				return err
+			}
+		}
+	case TagInt8:
+		err = w.WriteInt8(t.Value.(int))
+	case TagInt16:
+		err = w.WriteInt16(t.Value.(int))
+	case TagInt32:
+		err = w.WriteInt32(t.Value.(int))
+	case TagInt64:
+		err = w.WriteInt64(t.Value.(int))
+	case TagFloat32:
+		err = w.WriteFloat32(t.Value.(float32))
+	case TagFloat64:
+		err = w.WriteFloat64(t.Value.(float64))
+	case TagString:
+		err = w.WriteString(t.Value.(string))
+	case TagByteArray:
+		err = w.WriteBytes(t.Value.([]byte))
+	case TagIntArray:
+		err = w.WriteInts(t.Value.([]int))
+	case TagLongArray:
+		err = w.WriteLongs(t.Value.([]int64))
+	case TagStructEnd:
+	default:
+		err = errors.New(fmt.Sprintf("writing typeId %d not supported", t.Type))
+	}
+	return err
+}
+
+// Get returns the child of a compound tag with the given name, or nil.
+func (t *Tag) Get(name string) *Tag {
+	if t == nil || t.Type != TagStruct {
+		return nil
+	}
+	for _, child := range t.Value.([]*Tag) {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Set changes the value of a compound tag's child, adding the child if the
+// tag doesn't have one of that name. The child takes the given type.
+func (t *Tag) Set(typeId TypeId, name string, value interface{}) {
+	if child := t.Get(name); child != nil {
+		child.Type, child.Value = typeId, value
+		return
+	}
+	t.Value = append(t.Value.([]*Tag), &Tag{typeId, name, value})
+}
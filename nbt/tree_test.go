@@ -0,0 +1,85 @@
+package nbt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTreeRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteTag(TagStruct, "")
+	w.WriteTag(TagStruct, "Data")
+	w.WriteTag(TagInt64, "RandomSeed")
+	w.WriteInt64(-1234567890123)
+	w.WriteTag(TagInt8, "raining")
+	w.WriteInt8(1)
+	w.WriteTag(TagString, "LevelName")
+	w.WriteString("Old")
+	w.WriteTag(TagList, "Pos")
+	w.WriteListHeader(TagFloat64, 2)
+	w.WriteFloat64(1.5)
+	w.WriteFloat64(-2)
+	w.WriteTag(TagList, "Empty")
+	w.WriteListHeader(TagStructEnd, 0)
+	w.WriteTag(TagLongArray, "Longs")
+	w.WriteLongs([]int64{-1, 1 << 40})
+	w.WriteTag(TagIntArray, "Ints")
+	w.WriteInts([]int{-1, 7})
+	w.WriteTag(TagFloat32, "Float")
+	w.WriteFloat32(0.25)
+	w.WriteTag(TagStructEnd, "")
+	w.WriteTag(TagStructEnd, "")
+	original := append([]byte(nil), buf.Bytes()...)
+
+	root, err := NewReader(&buf).ReadTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := NewWriter(&out).WriteTree(root); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), original) {
+		t.Errorf("Rewritten tree differs\n%v\n%v", out.Bytes(), original)
+	}
+
+	data := root.Get("Data")
+	data.Set(TagString, "LevelName", "New")
+	data.Set(TagInt32, "GameType", 1)
+	out.Reset()
+	NewWriter(&out).WriteTree(root)
+
+	edited := out.Bytes()
+
+	level, err := ReadLevelNbt(bytes.NewReader(edited))
+	if err != SpawnIntNotFound {
+		t.Errorf("Level %v read with error %v", level, err)
+	}
+
+	parsed, err := Parse(bytes.NewReader(edited))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := parsed["Data"].(map[string]interface{})
+	if fields["LevelName"] != "New" || fields["GameType"] != 1 || fields["RandomSeed"] != -1234567890123 {
+		t.Errorf("Edited fields are %v", fields)
+	}
+
+	for _, field := range []string{"SpawnX", "SpawnY", "SpawnZ"} {
+		data.Set(TagInt32, field, 64)
+	}
+	data.Set(TagInt32, "DataVersion", 3465)
+	data.Set(TagStruct, "Version", []*Tag{{TagString, "Name", "1.20.1"}})
+	out.Reset()
+	NewWriter(&out).WriteTree(root)
+
+	level, err = ReadLevelNbt(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level.Seed != -1234567890123 || level.DataVersion != 3465 || level.Version != "1.20.1" || !level.Raining {
+		t.Errorf("Level is %+v", level)
+	}
+}
@@ -0,0 +1,132 @@
+package nbt
+
+import (
+	"io"
+	"math"
+)
+
+type Writer struct {
+	w            io.Writer
+	littleEndian bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w, false}
+}
+
+// NewLittleEndianWriter writes the little endian NBT used by Bedrock Edition.
+func NewLittleEndianWriter(w io.Writer) *Writer {
+	return &Writer{w, true}
+}
+
+func (w *Writer) WriteTag(typeId TypeId, name string) error {
+	var err = w.writeTypeId(typeId)
+	if err != nil || typeId == TagStructEnd {
+		return err
+	}
+
+	return w.WriteString(name)
+}
+
+func (w *Writer) WriteListHeader(itemTypeId TypeId, length int) error {
+	var err = w.writeTypeId(itemTypeId)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteInt32(length)
+}
+
+func (w *Writer) WriteString(s string) error {
+	var err = w.writeUintN(2, uint64(len(s)))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w.w, s)
+	return err
+}
+
+func (w *Writer) WriteBytes(bytes []byte) error {
+	var err = w.WriteInt32(len(bytes))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.w.Write(bytes)
+	return err
+}
+
+func (w *Writer) WriteInts(ints []int) error {
+	var err = w.WriteInt32(len(ints))
+	if err != nil {
+		return err
+	}
+
+	for _, i := range ints {
+		err = w.WriteInt32(i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) WriteLongs(longs []int64) error {
+	var err = w.WriteInt32(len(longs))
+	if err != nil {
+		return err
+	}
+
+	for _, l := range longs {
+		err = w.writeUintN(8, uint64(l))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) WriteInt8(i int) error {
+	return w.writeUintN(1, uint64(i))
+}
+
+func (w *Writer) WriteInt16(i int) error {
+	return w.writeUintN(2, uint64(i))
+}
+
+func (w *Writer) WriteInt32(i int) error {
+	return w.writeUintN(4, uint64(i))
+}
+
+func (w *Writer) WriteInt64(i int) error {
+	return w.writeUintN(8, uint64(i))
+}
+
+func (w *Writer) WriteFloat32(f float32) error {
+	return w.writeUintN(4, uint64(math.Float32bits(f)))
+}
+
+func (w *Writer) WriteFloat64(f float64) error {
+	return w.writeUintN(8, math.Float64bits(f))
+}
+
+func (w *Writer) writeTypeId(typeId TypeId) error {
+	_, err := w.w.Write([]byte{byte(typeId)})
+	return err
+}
+
+func (w *Writer) writeUintN(n int, x uint64) error {
+	var buf [8]byte
+	for i := n - 1; i >= 0; i-- {
+		if w.littleEndian {
+			buf[n-1-i] = byte(x)
+		} else {
+			buf[i] = byte(x)
+		}
+		x >>= 8
+	}
+
+	_, err := w.w.Write(buf[:n])
+	return err
+}
@@ -0,0 +1,88 @@
+// Package ply writes the header of Stanford PLY polygon files.
+package ply
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Formats of the data after the header
+const (
+	Ascii              = "ascii"
+	BinaryLittleEndian = "binary_little_endian"
+)
+
+// countWidth is how many characters each element's count takes in the
+// header, so counts can be filled in once known without moving the data.
+const countWidth = 10
+
+type Element struct {
+	Name       string
+	Count      int64
+	Properties []string // such as "float x" or "list uchar uint vertex_indices"
+}
+
+type Header struct {
+	Format   string
+	Comments []string
+	Elements []Element
+}
+
+// http://paulbourke.net/dataformats/ply/
+func (h *Header) text() (text []byte, countOffsets []int64) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "ply\nformat %s 1.0\n", h.Format)
+	for _, comment := range h.Comments {
+		fmt.Fprintf(&b, "comment %s\n", comment)
+	}
+	for _, e := range h.Elements {
+		fmt.Fprintf(&b, "element %s ", e.Name)
+		countOffsets = append(countOffsets, int64(b.Len()))
+		fmt.Fprintf(&b, "%*d\n", countWidth, e.Count)
+		for _, p := range e.Properties {
+			fmt.Fprintf(&b, "property %s\n", p)
+		}
+	}
+	b.WriteString("end_header\n")
+	return b.Bytes(), countOffsets
+}
+
+func (h *Header) Write(w io.Writer) error {
+	var text, _ = h.text()
+	var _, err = w.Write(text)
+	return err
+}
+
+// UpdateCounts writes the elements' counts over those in the header at the
+// start of the file, leaving the file offset where it was.
+func (h *Header) UpdateCounts(file *os.File) error {
+	for _, e := range h.Elements {
+		if len(fmt.Sprint(e.Count)) > countWidth {
+			return errors.New(fmt.Sprintf("Too many %ss for a ply header: %v", e.Name, e.Count))
+		}
+	}
+
+	var storedOffset, err = file.Seek(0, 1)
+	if err != nil {
+		return err
+	}
+
+	var _, countOffsets = h.text()
+	for i, e := range h.Elements {
+		var count = fmt.Sprintf("%*d", countWidth, e.Count)
+		_, err = file.Seek(countOffsets[i], 0)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(file, count)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = file.Seek(storedOffset, 0)
+	return err
+}
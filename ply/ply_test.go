@@ -0,0 +1,62 @@
+package ply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateCounts(t *testing.T) {
+	var filename = filepath.Join(t.TempDir(), "a.ply")
+	var file, err = os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var h = Header{
+		Format:   Ascii,
+		Comments: []string{"test"},
+		Elements: []Element{
+			{Name: "vertex", Properties: []string{"float x", "float y", "float z"}},
+			{Name: "face", Properties: []string{"list uchar uint vertex_indices"}},
+		},
+	}
+	if err := h.Write(file); err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("0 0 0\n1 0 0\n0 1 0\n3 0 1 2\n")
+
+	h.Elements[0].Count, h.Elements[1].Count = 3, 1
+	if err := h.UpdateCounts(file); err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("\n")
+
+	h.Elements[0].Count = 1e10
+	if err := h.UpdateCounts(file); err == nil {
+		t.Error("Wrote a count wider than the header has room for")
+	}
+	file.Close()
+
+	var expected = `ply
+format ascii 1.0
+comment test
+element vertex          3
+property float x
+property float y
+property float z
+element face          1
+property list uchar uint vertex_indices
+end_header
+0 0 0
+1 0 0
+0 1 0
+3 0 1 2
+
+`
+	if data, _ := ioutil.ReadFile(filename); string(data) != expected {
+		t.Errorf("Wrote\n%s", data)
+	}
+}
@@ -0,0 +1,76 @@
+// Package prt writes the header of Krakatoa PRT particle files.
+package prt
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// Data types of channels
+const (
+	Int32   = 1
+	Float32 = 4
+)
+
+type ChannelDefinition struct {
+	Name                    string // max of 31 characters and must meet the regex [a-zA-Z_][0-9a-zA-Z_]*
+	DataType, Arity, Offset int32
+}
+
+// http://software.primefocusworld.com/software/support/krakatoa/prt_file_format.php
+// http://www.thinkboxsoftware.com/krak-prt-file-format/
+func WriteHeader(w io.Writer, particleCount int64, channels []ChannelDefinition) {
+	// Header (56 bytes)
+	var magic = []byte{192, 'P', 'R', 'T', '\r', '\n', 26, '\n'}
+	w.Write(magic)
+
+	var headerLength = uint32(56)
+	binary.Write(w, binary.LittleEndian, headerLength)
+
+	var signature = make([]byte, 32)
+	copy(signature, []byte("Extensible Particle Format"))
+	w.Write(signature)
+
+	var version = uint32(1)
+	binary.Write(w, binary.LittleEndian, version)
+
+	binary.Write(w, binary.LittleEndian, particleCount)
+
+	// Reserved bytes (4 bytes)
+	var reserved = int32(4)
+	binary.Write(w, binary.LittleEndian, reserved)
+
+	// Channel definition header (8 bytes)
+	binary.Write(w, binary.LittleEndian, int32(len(channels)))
+
+	var channelDefinitionSize = int32(44)
+	binary.Write(w, binary.LittleEndian, channelDefinitionSize)
+
+	for _, channel := range channels {
+		var nameBytes = make([]byte, 32)
+		copy(nameBytes, []byte(channel.Name))
+		w.Write(nameBytes)
+
+		binary.Write(w, binary.LittleEndian, channel.DataType)
+		binary.Write(w, binary.LittleEndian, channel.Arity)
+		binary.Write(w, binary.LittleEndian, channel.Offset)
+	}
+}
+
+func UpdateParticleCount(file *os.File, particleCount int64) error {
+	var storedOffset, err = file.Seek(0, 1)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(0x30, 0)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(file, binary.LittleEndian, particleCount)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(storedOffset, 0)
+	return err
+}
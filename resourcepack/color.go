@@ -0,0 +1,95 @@
+package resourcepack
+
+import (
+	"github.com/quag/mcobj/nbt"
+	"image"
+	"image/color"
+)
+
+// BlockColor is the average colour of the top of a numeric block, or of
+// another side for blocks without a top texture. It is the colour the block
+// has on a map.
+func (p *Pack) BlockColor(block nbt.Block) (color.NRGBA, bool) {
+	var textures, ok = p.BlockTextures(block)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+
+	var texture = textures[Up]
+	for _, t := range textures {
+		if texture.Path != "" {
+			break
+		}
+		texture = t
+	}
+	var img, err = p.ReadTexture(texture)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	return AverageColor(img), true
+}
+
+// FirstFrame is the top square of a texture. Animated textures are a strip
+// of square frames.
+func FirstFrame(img image.Image) image.Rectangle {
+	var b = img.Bounds()
+	var size = min(b.Dx(), b.Dy())
+	return image.Rect(b.Min.X, b.Min.Y, b.Min.X+size, b.Min.Y+size)
+}
+
+// AverageColor is the average colour of the first frame of a texture. Each
+// pixel's colour counts in proportion to its alpha, so the see-through
+// parts of leaves and flowers don't darken them.
+func AverageColor(img image.Image) color.NRGBA {
+	var (
+		frame      = FirstFrame(img)
+		r, g, b, a uint64
+	)
+	for y := frame.Min.Y; y < frame.Max.Y; y++ {
+		for x := frame.Min.X; x < frame.Max.X; x++ {
+			var p = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			r += uint64(p.R) * uint64(p.A)
+			g += uint64(p.G) * uint64(p.A)
+			b += uint64(p.B) * uint64(p.A)
+			a += uint64(p.A)
+		}
+	}
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	var pixels = uint64(frame.Dx() * frame.Dy())
+	return color.NRGBA{
+		uint8((r + a/2) / a),
+		uint8((g + a/2) / a),
+		uint8((b + a/2) / a),
+		uint8((a + pixels/2) / pixels),
+	}
+}
+
+// Opaque reports whether an image has no see-through pixels.
+func Opaque(img image.Image) bool {
+	if img == nil {
+		return true
+	}
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+func tint(img image.Image, c color.NRGBA) image.Image {
+	var b = img.Bounds()
+	var tinted = image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var p = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			tinted.SetNRGBA(x, y, color.NRGBA{
+				uint8(int(p.R) * int(c.R) / 255),
+				uint8(int(p.G) * int(c.G) / 255),
+				uint8(int(p.B) * int(c.B) / 255),
+				p.A,
+			})
+		}
+	}
+	return tinted
+}
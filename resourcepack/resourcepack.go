@@ -0,0 +1,303 @@
+// Package resourcepack reads block states, models and textures from a
+// resource pack or client jar using the layout of 1.13 and later.
+package resourcepack
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quag/mcobj/nbt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"sort"
+	"strings"
+)
+
+// The sides of a block, in the order FaceTextures gives their textures
+const (
+	West = iota
+	East
+	Down
+	Up
+	North
+	South
+)
+
+// Faces are the names models give the sides of a block.
+var Faces = [6]string{"west", "east", "down", "up", "north", "south"}
+
+// Biome tints for plains, used for the grey textures Minecraft colours by
+// biome
+var (
+	GrassTint   = color.NRGBA{0x91, 0xbd, 0x59, 0xff}
+	FoliageTint = color.NRGBA{0x77, 0xab, 0x2f, 0xff}
+)
+
+// Texture is the texture on one side of a block and the tint Minecraft
+// multiplies it by, if any. Path is empty for sides without a texture.
+type Texture struct {
+	Path string
+	Tint *color.NRGBA
+}
+
+// Key identifies the texture with its tint applied.
+func (t Texture) Key() string {
+	if t.Tint == nil {
+		return t.Path
+	}
+	return t.Path + fmt.Sprint(*t.Tint)
+}
+
+type Pack struct {
+	zip    *zip.ReadCloser
+	files  map[string]*zip.File
+	models map[string]*blockModel
+}
+
+type blockModel struct {
+	Parent   string            `json:"parent"`
+	Textures map[string]string `json:"textures"`
+	Elements []modelElement    `json:"elements"`
+}
+
+type modelElement struct {
+	Faces map[string]struct {
+		Texture   string `json:"texture"`
+		TintIndex *int   `json:"tintindex"`
+	} `json:"faces"`
+}
+
+func Open(filename string) (*Pack, error) {
+	var r, err = zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var pack = &Pack{r, make(map[string]*zip.File), make(map[string]*blockModel)}
+	var textures = false
+	for _, f := range r.File {
+		pack.files[f.Name] = f
+		textures = textures || strings.HasPrefix(f.Name, "assets/minecraft/textures/block/")
+	}
+	if !textures {
+		r.Close()
+		return nil, errors.New(fmt.Sprintf("%v has no block textures. Resource packs and jars from 1.13 or later are needed", filename))
+	}
+	return pack, nil
+}
+
+func (p *Pack) Close() error {
+	return p.zip.Close()
+}
+
+func (p *Pack) readJson(name string, v interface{}) error {
+	var f, ok = p.files[name]
+	if !ok {
+		return errors.New(fmt.Sprintf("%v not found", name))
+	}
+	var r, err = f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
+// ReadTexture reads a texture's image with its tint applied.
+func (p *Pack) ReadTexture(t Texture) (image.Image, error) {
+	var f, ok = p.files[t.Path]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%v not found", t.Path))
+	}
+	var r, err = f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var img, _, decodeErr = image.Decode(r)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if t.Tint != nil {
+		img = tint(img, *t.Tint)
+	}
+	return img, nil
+}
+
+// BlockTextures finds the textures of a numeric block, looking it up by the
+// name of its id and data value, or failing that its id alone.
+func (p *Pack) BlockTextures(block nbt.Block) ([6]Texture, bool) {
+	var name, ok = nbt.NameFromBlock(block)
+	if !ok {
+		name, ok = nbt.NameFromBlock(block & 0xff)
+	}
+	if !ok {
+		return [6]Texture{}, false
+	}
+	return p.FaceTextures(strings.TrimPrefix(name, "minecraft:"))
+}
+
+// FaceTextures finds the texture on each side of a block, and the tint of
+// those Minecraft colours by biome. The model is the one for the block's
+// first variant, or failing that the model named after the block.
+func (p *Pack) FaceTextures(name string) (textures [6]Texture, ok bool) {
+	var modelName = "minecraft:block/" + name
+	var states struct {
+		Variants  map[string]json.RawMessage `json:"variants"`
+		Multipart []struct {
+			Apply json.RawMessage `json:"apply"`
+		} `json:"multipart"`
+	}
+	if err := p.readJson("assets/minecraft/blockstates/"+name+".json", &states); err == nil {
+		var variant json.RawMessage
+		if len(states.Variants) != 0 {
+			var keys = make([]string, 0, len(states.Variants))
+			for key := range states.Variants {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			variant = states.Variants[keys[0]]
+		} else if len(states.Multipart) != 0 {
+			variant = states.Multipart[0].Apply
+		}
+		if model := variantModel(variant); model != "" {
+			modelName = model
+		}
+	}
+
+	var textureVars, elements = p.resolveModel(modelName)
+	for i, face := range Faces {
+		var ref string
+		var tinted bool
+		for _, element := range elements {
+			if f, ok := element.Faces[face]; ok {
+				ref, tinted = f.Texture, f.TintIndex != nil
+				break
+			}
+		}
+		if ref == "" {
+			ref = firstTextureVar(textureVars, i)
+		}
+
+		var texture = resolveTextureVar(textureVars, ref)
+		if texture == "" {
+			continue
+		}
+		textures[i].Path = texturePath(texture)
+		if tinted {
+			textures[i].Tint = &GrassTint
+			if strings.Contains(name, "leaves") || name == "vine" {
+				textures[i].Tint = &FoliageTint
+			}
+		}
+		ok = true
+	}
+	return textures, ok
+}
+
+// variantModel reads the model of a block state variant, which is either a
+// model or a list of models to pick between at random.
+func variantModel(variant json.RawMessage) string {
+	var one struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(variant, &one) == nil {
+		return one.Model
+	}
+	var many []struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(variant, &many) == nil && len(many) != 0 {
+		return many[0].Model
+	}
+	return ""
+}
+
+// resolveModel follows a model's parents, gathering the texture variables
+// with those of the model itself overriding its parents', and the elements
+// of the nearest model that has any.
+func (p *Pack) resolveModel(name string) (map[string]string, []modelElement) {
+	var (
+		textures = make(map[string]string)
+		elements []modelElement
+	)
+	for depth := 0; name != "" && depth < 16; depth++ {
+		var m = p.model(name)
+		if m == nil {
+			break
+		}
+		for k, v := range m.Textures {
+			if _, ok := textures[k]; !ok {
+				textures[k] = v
+			}
+		}
+		if elements == nil && len(m.Elements) != 0 {
+			elements = m.Elements
+		}
+		name = m.Parent
+	}
+	return textures, elements
+}
+
+func (p *Pack) model(name string) *blockModel {
+	var namespace, path = "minecraft", name
+	if i := strings.Index(name, ":"); i != -1 {
+		namespace, path = name[:i], name[i+1:]
+	}
+	if !strings.Contains(path, "/") {
+		path = "block/" + path
+	}
+
+	var file = "assets/" + namespace + "/models/" + path + ".json"
+	if m, ok := p.models[file]; ok {
+		return m
+	}
+	var m = &blockModel{}
+	if err := p.readJson(file, m); err != nil {
+		m = nil
+	}
+	p.models[file] = m
+	return m
+}
+
+// firstTextureVar picks a texture for models without elements, preferring
+// the variables the standard cube models use for the side.
+func firstTextureVar(textures map[string]string, side int) string {
+	var face = Faces[side]
+	var names = []string{face, "side", "all", "texture", "particle"}
+	switch side {
+	case Up:
+		names = []string{face, "top", "end", "all", "texture", "particle"}
+	case Down:
+		names = []string{face, "bottom", "end", "all", "texture", "particle"}
+	}
+	for _, name := range names {
+		if _, ok := textures[name]; ok {
+			return "#" + name
+		}
+	}
+	return ""
+}
+
+// resolveTextureVar follows references to other variables, written #name,
+// to a texture name.
+func resolveTextureVar(textures map[string]string, ref string) string {
+	for depth := 0; strings.HasPrefix(ref, "#") && depth < 16; depth++ {
+		ref = textures[ref[1:]]
+	}
+	if strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	return ref
+}
+
+func texturePath(texture string) string {
+	var namespace, path = "minecraft", texture
+	if i := strings.Index(texture, ":"); i != -1 {
+		namespace, path = texture[:i], texture[i+1:]
+	}
+	return "assets/" + namespace + "/textures/" + path + ".png"
+}
@@ -0,0 +1,128 @@
+package resourcepack
+
+import (
+	"archive/zip"
+	"github.com/quag/mcobj/nbt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestPack writes a resource pack with stone, oak leaves and a torch:
+// an animated texture, a tinted see-through one and a model without
+// elements.
+func writeTestPack(t *testing.T, filename string) {
+	var file, err = os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var zw = zip.NewWriter(file)
+
+	var files = map[string]string{
+		"assets/minecraft/blockstates/stone.json":       `{"variants": {"": {"model": "minecraft:block/stone"}}}`,
+		"assets/minecraft/blockstates/oak_leaves.json":  `{"variants": {"": {"model": "minecraft:block/oak_leaves"}}}`,
+		"assets/minecraft/models/block/cube_all.json":   `{"textures": {"particle": "#all"}, "elements": [{"faces": {"down": {"texture": "#all"}, "up": {"texture": "#all"}, "north": {"texture": "#all"}, "south": {"texture": "#all"}, "west": {"texture": "#all"}, "east": {"texture": "#all"}}}]}`,
+		"assets/minecraft/models/block/leaves.json":     `{"textures": {"particle": "#all"}, "elements": [{"faces": {"down": {"texture": "#all", "tintindex": 0}, "up": {"texture": "#all", "tintindex": 0}, "north": {"texture": "#all", "tintindex": 0}, "south": {"texture": "#all", "tintindex": 0}, "west": {"texture": "#all", "tintindex": 0}, "east": {"texture": "#all", "tintindex": 0}}}]}`,
+		"assets/minecraft/models/block/stone.json":      `{"parent": "minecraft:block/cube_all", "textures": {"all": "minecraft:block/stone"}}`,
+		"assets/minecraft/models/block/oak_leaves.json": `{"parent": "minecraft:block/leaves", "textures": {"all": "block/oak_leaves"}}`,
+		"assets/minecraft/models/block/torch.json":      `{"textures": {"particle": "#torch", "torch": "block/torch"}}`,
+	}
+	for name, content := range files {
+		var w, err = zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+
+	var textures = map[string]func(x, y int) color.NRGBA{
+		// The second frame is a different colour, and mustn't count
+		"stone": func(x, y int) color.NRGBA {
+			if y >= 16 {
+				return color.NRGBA{0, 0, 0, 0xff}
+			}
+			return color.NRGBA{0x80, 0x80, 0x80, 0xff}
+		},
+		// White leaves with holes the colour of which mustn't count
+		"oak_leaves": func(x, y int) color.NRGBA {
+			if x%2 == 0 {
+				return color.NRGBA{0, 0, 0, 0}
+			}
+			return color.NRGBA{0xff, 0xff, 0xff, 0xff}
+		},
+		"torch": func(x, y int) color.NRGBA {
+			return color.NRGBA{0xff, 0xd8, 0x00, 0xff}
+		},
+	}
+	for name, at := range textures {
+		var h = 16
+		if name == "stone" {
+			h = 32
+		}
+		var img = image.NewNRGBA(image.Rect(0, 0, 16, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < 16; x++ {
+				img.SetNRGBA(x, y, at(x, y))
+			}
+		}
+		var pw, err = zw.Create("assets/minecraft/textures/block/" + name + ".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(pw, img)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockColor(t *testing.T) {
+	var filename = filepath.Join(t.TempDir(), "pack.zip")
+	writeTestPack(t, filename)
+	var pack, err = Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pack.Close()
+
+	for _, c := range []struct {
+		block nbt.Block
+		color color.NRGBA
+	}{
+		{1, color.NRGBA{0x80, 0x80, 0x80, 0xff}},
+		{18, color.NRGBA{FoliageTint.R, FoliageTint.G, FoliageTint.B, 0x80}},
+		{50 + 5<<8, color.NRGBA{0xff, 0xd8, 0x00, 0xff}},
+	} {
+		if got, ok := pack.BlockColor(c.block); !ok || got != c.color {
+			t.Errorf("Block %#x is %v %v not %v", c.block, got, ok, c.color)
+		}
+	}
+
+	if _, ok := pack.BlockColor(4); ok {
+		t.Error("Cobblestone has a colour without a model")
+	}
+
+	var textures, _ = pack.FaceTextures("oak_leaves")
+	if textures[Up].Path != "assets/minecraft/textures/block/oak_leaves.png" || textures[Up].Tint != &FoliageTint {
+		t.Errorf("Leaves top %+v", textures[Up])
+	}
+}
+
+func TestOpenWithoutTextures(t *testing.T) {
+	var filename = filepath.Join(t.TempDir(), "empty.zip")
+	var file, err = os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zip.NewWriter(file).Close()
+	file.Close()
+
+	if _, err := Open(filename); err == nil {
+		t.Error("Opened a pack without block textures")
+	}
+}